@@ -27,11 +27,26 @@ type AppConfig struct {
 	AlphaPoint struct {
 		Token string `json:"token"`
 	} `json:"alphapoint"`
+	Rates struct {
+		Providers []string `json:"providers"` // alphapoint (default), ecb or file, tried in order
+		File      string   `json:"file"`      // JSON or CSV rates file for the file provider
+		MaxAge    int      `json:"max_age"`   // Seconds a rate is fresh for, one week by default
+	} `json:"rates"`
 	Telegram struct {
-		Token string `json:"token"`
+		Token       string   `json:"token"`
+		Mode        string   `json:"mode"`         // webhook (default) or polling
+		WebhookPath string   `json:"webhook_path"` // Path Telegram sends updates to, /webhook by default
+		SecretToken string   `json:"secret_token"` // Secret verifying updates are from Telegram, derived from secret_key by default
+		AllowedIPs  []string `json:"allowed_ips"`  // Optional CIDR ranges webhook requests may come from
 	} `json:"telegram"`
+	Dispatcher struct {
+		Workers         int `json:"workers"`          // Workers handling messages, 16 by default
+		QueueSize       int `json:"queue_size"`       // Messages each worker may queue, 64 by default
+		ShutdownTimeout int `json:"shutdown_timeout"` // Seconds to finish received messages on shutdown, 30 by default
+	} `json:"dispatcher"`
 	Wit struct {
-		Token string `json:"token"`
+		Token   string `json:"token"`
+		Backend string `json:"backend"` // wit (default), local or local_first
 	} `json:"wit"`
 }
 
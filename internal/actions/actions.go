@@ -3,91 +3,532 @@
 package actions
 
 import (
+	"context"
 	"crypto/rsa"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jinzhu/gorm"
 
 	"github.com/fmitra/dennis-bot/config"
-	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+	"github.com/fmitra/dennis-bot/pkg/categories"
+	"github.com/fmitra/dennis-bot/pkg/exchange"
 	"github.com/fmitra/dennis-bot/pkg/expenses"
+	"github.com/fmitra/dennis-bot/pkg/nlu"
+	"github.com/fmitra/dennis-bot/pkg/rates"
 	"github.com/fmitra/dennis-bot/pkg/sessions"
+	"github.com/fmitra/dennis-bot/pkg/telegram"
 	"github.com/fmitra/dennis-bot/pkg/users"
-	"github.com/fmitra/dennis-bot/pkg/wit"
+	"github.com/fmitra/dennis-bot/pkg/utils"
 )
 
+const (
+	// EditAmount is the amount field of an Expense that a user may edit
+	EditAmount = "amount"
+
+	// EditCurrency is the currency field of an Expense that a user may edit
+	EditCurrency = "currency"
+
+	// EditDescription is the description field of an Expense that a user may edit
+	EditDescription = "description"
+
+	// EditDate is the date field of an Expense that a user may edit
+	EditDate = "date"
+
+	// SettingCurrency is the setting for a user's preferred currency
+	SettingCurrency = "currency"
+
+	// SettingTimezone is the setting for a user's timezone
+	SettingTimezone = "timezone"
+
+	// SettingWeekStart is the setting for the day a user's week starts on
+	SettingWeekStart = "week start"
+)
+
+// settingNames maps the ways a user may refer to a setting to the setting.
+var settingNames = map[string]string{
+	"currency":              SettingCurrency,
+	"timezone":              SettingTimezone,
+	"time zone":             SettingTimezone,
+	"week start":            SettingWeekStart,
+	"week":                  SettingWeekStart,
+	"start of the week":     SettingWeekStart,
+	"first day of the week": SettingWeekStart,
+}
+
 // Actions are taken by the bot in response to a user request during
 // conversation. Typically a user contacts the bot to request some action
 // to be performed, such as expense tracking.
 type Actions struct {
-	Db         *gorm.DB
-	Cache      sessions.Session
-	Config     config.AppConfig
-	Alphapoint alphapoint.Alphapoint
+	Db     *gorm.DB
+	Cache  sessions.Session
+	Config config.AppConfig
+	Rates  rates.RateProvider
+	Jobs   Scheduler
 }
 
-// CreateNewExpense creates and saves a new Expense entry to the DB.
-func (a *Actions) CreateNewExpense(wr wit.Response, userID uint, pk rsa.PublicKey) error {
-	date := wr.GetDate()
-	amount, fromCurrency, _ := wr.GetAmount()
+// Job is work done on behalf of a user in the background, after the bot
+// has responded to them. A non-empty message returned by the Job is sent
+// to the user once it is done.
+type Job func(ctx context.Context) string
+
+// Scheduler runs Jobs in the background for the user who sent a message.
+type Scheduler interface {
+	Schedule(incM telegram.IncomingMessage, job Job) error
+}
+
+// Schedule runs a Job in the background for the user who sent a message.
+func (a *Actions) Schedule(incM telegram.IncomingMessage, job Job) error {
+	if a.Jobs == nil {
+		return errors.New("jobs cannot be scheduled")
+	}
+
+	return a.Jobs.Schedule(incM, job)
+}
+
+// CreateNewExpense creates and saves a new Expense entry to the DB. Messages
+// describing several expenses are saved together in a single transaction.
+// Each Expense keeps a reference to the chat message it was described in,
+// so a message delivered more than once is only tracked once.
+func (a *Actions) CreateNewExpense(ctx context.Context, m nlu.Message, userID uint, pk rsa.PublicKey) error {
+	manager := a.localExpenseManager(userID)
+	messages := []nlu.Message{m}
+	if m.IsBatch() {
+		messages = append([]nlu.Message{}, m.Expenses...)
+		for i := range messages {
+			if m.Source != "" {
+				messages[i].Source = fmt.Sprintf("%s:%d", m.Source, i)
+			}
+		}
+	}
+
+	batch := make([]*expenses.Expense, len(messages))
+	for i, message := range messages {
+		expense, err := a.newExpense(ctx, message, userID, manager.Now(), pk)
+		if err != nil {
+			return err
+		}
+		batch[i] = expense
+	}
+	return a.saveExpenses(userID, messages, batch)
+}
+
+// saveExpenses saves Expenses and learns the categories the user tagged
+// them with in a single transaction, so keywords are only learned from
+// Expenses that were tracked.
+func (a *Actions) saveExpenses(userID uint, messages []nlu.Message, batch []*expenses.Expense) error {
+	tx := a.Db.Begin()
+	manager := expenses.NewExpenseManager(tx)
+	keywords := categories.NewKeywordManager(tx, a.Config.SecretKey)
+	for i, expense := range batch {
+		if err := manager.Save(expense); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		message := messages[i]
+		if message.Category == "" {
+			continue
+		}
+
+		if err := keywords.Learn(userID, message.Description, message.Category); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// newExpense returns an encrypted Expense described by a Message. Dates
+// are relative to now and amounts are converted to USD with the exchange
+// rate on the date of the Expense for historical totals.
+func (a *Actions) newExpense(ctx context.Context, m nlu.Message, userID uint, now time.Time, pk rsa.PublicKey) (*expenses.Expense, error) {
+	date := m.GetDate(now)
+	amount, fromCurrency := m.Amount, m.Currency
 	targetCurrency := "USD"
-	description, _ := wr.GetDescription()
+	description := m.Description
+	category := a.GetCategory(m, userID, description)
+
+	historicalAmount, err := a.ConvertCurrency(ctx, fromCurrency, targetCurrency, amount, date)
+	if err != nil {
+		return nil, err
+	}
 
-	historicalAmount := a.ConvertCurrency(fromCurrency, targetCurrency, amount)
 	expense := &expenses.Expense{
 		Date:        date,
 		Description: description,
 		Total:       strconv.FormatFloat(amount, 'f', -1, 64),
 		Historical:  strconv.FormatFloat(historicalAmount, 'f', -1, 64),
 		Currency:    fromCurrency,
+		Category:    category,
+		Source:      m.Source,
 		UserID:      userID,
 	}
-	expense.Encrypt(pk)
-	manager := expenses.NewExpenseManager(a.Db)
-	return manager.Save(expense)
+	if err = expense.Encrypt(pk); err != nil {
+		return nil, err
+	}
+
+	return expense, nil
 }
 
-// ConvertCurrency attempts to convert currency based on a cached rate.
-// If the cache is empty, it queries alphapoint for an updated rate
-func (a *Actions) ConvertCurrency(from, to string, amount float64) float64 {
-	var conversion alphapoint.Conversion
-	cacheKey := fmt.Sprintf("%s_%s", from, to)
-	err := a.Cache.Get(cacheKey, &conversion)
+// localExpenseManager returns an ExpenseManager in the User's timezone
+// with weeks starting on the User's preferred day.
+func (a *Actions) localExpenseManager(userID uint) *expenses.ExpenseManager {
+	settingsM := users.NewSettingManager(a.Db)
+	location := settingsM.GetLocation(userID)
+	weekStart := settingsM.GetWeekStart(userID)
+	return expenses.NewLocalExpenseManager(a.Db, location, weekStart)
+}
+
+// GetCategory returns the category of an expense. Categories explicitly tagged
+// by the user are learned for future expenses once the expense is saved.
+// Otherwise we attempt to match the description against previously learned
+// keywords.
+func (a *Actions) GetCategory(m nlu.Message, userID uint, description string) string {
+	if m.Category != "" {
+		return m.Category
+	}
+
+	manager := categories.NewKeywordManager(a.Db, a.Config.SecretKey)
+	return manager.Match(userID, description)
+}
 
-	// We ping alphapoint for an updated conversation rate if is not
-	// already stored in our cache.
+// ConvertCurrency converts an amount from one currency to another with
+// the exchange rate on a date.
+func (a *Actions) ConvertCurrency(ctx context.Context, from, to string, amount float64, date time.Time) (float64, error) {
+	rate, err := a.GetRate(ctx, from, to, date)
 	if err != nil {
+		return 0, err
+	}
+
+	return rate * amount, nil
+}
+
+// GetRate returns the exchange rate from one currency to another on a date.
+// Rates are read from the cache, then from the rates we have stored, and
+// only requested from our rate providers if no fresh rate is known. Rates
+// are kept by day, so every expense on the same day shares a rate. If our
+// providers fail, the latest stale rate on or before the date is used.
+// Rates of past days never change, so once known they are never requested
+// again.
+func (a *Actions) GetRate(ctx context.Context, from, to string, date time.Time) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+
+	var conversion rates.Conversion
+	day := date.Format(exchange.DayFormat)
+	cacheKey := fmt.Sprintf("%s_%s_%s", from, to, day)
+	if err := a.Cache.Get(ctx, cacheKey, &conversion); err == nil {
+		return conversion.Rate, nil
+	}
+
+	maxAge := a.rateMaxAge()
+	manager := exchange.NewRateManager(a.Db)
+	stored, storeErr := manager.Latest(from, to, date)
+	if storeErr == nil && stored.IsFresh(date, maxAge) {
+		a.cacheRate(ctx, cacheKey, from, to, date, stored.Value)
+		return stored.Value, nil
+	}
+
+	rate, err := a.Rates.Rate(ctx, from, to, date)
+	if err != nil && storeErr == nil {
+		log.Printf("actions: using stale rate %s to %s from %s - %s", from, to, stored.Day, err)
+		return stored.Value, nil
+	} else if err != nil {
+		log.Printf("actions: failed to get rate %s to %s on %s - %s", from, to, day, err)
+		return 0, err
+	}
+
+	if err = manager.Save(from, to, date, rate); err != nil {
+		log.Printf("actions: failed to store rate %s to %s on %s - %s", from, to, day, err)
+	}
+	a.cacheRate(ctx, cacheKey, from, to, date, rate)
+	return rate, nil
+}
+
+// cacheRate caches the exchange rate from one currency to another on a
+// date for as long as the rate is fresh. Rates of past days are kept in
+// the DB, so they expire from the cache like any other rate.
+func (a *Actions) cacheRate(ctx context.Context, cacheKey, from, to string, date time.Time, rate float64) {
+	conversion := rates.Conversion{FromCurrency: from, ToCurrency: to, Rate: rate, Date: date}
+	a.Cache.Set(ctx, cacheKey, &conversion, int(a.rateMaxAge().Seconds()))
+}
+
+// rateMaxAge returns how long an exchange rate is fresh for. Rates are
+// fresh for one week unless configured otherwise.
+func (a *Actions) rateMaxAge() time.Duration {
+	maxAge := a.Config.Rates.MaxAge
+	if maxAge <= 0 {
 		oneWeek := 604800
-		convertedAmount, newConversion := a.Alphapoint.Convert(from, to, amount)
-		a.Cache.Set(cacheKey, newConversion, oneWeek)
-		return convertedAmount
+		maxAge = oneWeek
 	}
 
-	convertedAmount := conversion.Rate * amount
-	return convertedAmount
+	return time.Duration(maxAge) * time.Second
+}
+
+// converterTo returns a Converter from the historical USD value of an
+// Expense to a currency, using the exchange rate on the date of the Expense.
+func (a *Actions) converterTo(ctx context.Context, currency string) expenses.Converter {
+	return func(historical float64, date time.Time) (float64, error) {
+		return a.ConvertCurrency(ctx, "USD", currency, historical, date)
+	}
 }
 
 // GetExpenseTotal returns the sum of historical expense history over a period of time.
-func (a *Actions) GetExpenseTotal(period string, userID uint, pk rsa.PrivateKey) (string, error) {
-	expenseM := expenses.NewExpenseManager(a.Db)
-	total, err := expenseM.TotalByPeriod(period, userID, pk)
+func (a *Actions) GetExpenseTotal(ctx context.Context, period string, userID uint, pk rsa.PrivateKey) (string, error) {
+	settingsM := users.NewSettingManager(a.Db)
+	toCurrency := settingsM.GetCurrency(userID)
+
+	expenseM := a.localExpenseManager(userID)
+	total, err := expenseM.TotalByPeriod(period, userID, pk, a.converterTo(ctx, toCurrency))
+	if err != nil {
+		log.Printf("actions: failed to query expenses %s", err)
+	}
+
+	strAmount := strconv.FormatFloat(total, 'f', 2, 64)
+	messageVar := fmt.Sprintf("%s %s", strAmount, toCurrency)
+	return messageVar, err
+}
+
+// GetCategoryTotal returns the sum of historical expense history over a period of time
+// for a single category. If all categories are requested, a breakdown of each
+// category is returned instead.
+func (a *Actions) GetCategoryTotal(ctx context.Context, period, category string, userID uint, pk rsa.PrivateKey) (string, error) {
+	settingsM := users.NewSettingManager(a.Db)
+	toCurrency := settingsM.GetCurrency(userID)
+
+	expenseM := a.localExpenseManager(userID)
+	totals, err := expenseM.TotalByCategory(period, userID, pk, a.converterTo(ctx, toCurrency))
+	if err != nil {
+		log.Printf("actions: failed to query expenses %s", err)
+		return "", err
+	}
+
+	formatTotal := func(total float64) string {
+		strAmount := strconv.FormatFloat(total, 'f', 2, 64)
+		return fmt.Sprintf("%s %s", strAmount, toCurrency)
+	}
+
+	if category != nlu.AllCategories {
+		return fmt.Sprintf("%s on %s", formatTotal(totals[category]), category), nil
+	}
+
+	names := []string{}
+	for name := range totals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := []string{}
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s: %s", name, formatTotal(totals[name])))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// GetExpenseList returns an itemized list of expense history over a period of time.
+// Each item describes the date, description and original amount of an expense as
+// well as the amount converted into the user's preferred currency.
+func (a *Actions) GetExpenseList(ctx context.Context, period string, userID uint, pk rsa.PrivateKey) ([]string, error) {
+	expenseM := a.localExpenseManager(userID)
+	expenseList, err := expenseM.QueryByPeriod(period, userID)
 	if err != nil {
 		log.Printf("actions: failed to query expenses %s", err)
+		return []string{}, err
 	}
 
 	fromCurrency := "USD"
 	settingsM := users.NewSettingManager(a.Db)
 	toCurrency := settingsM.GetCurrency(userID)
 
-	convertedAmount := total
-	if toCurrency != fromCurrency {
-		convertedAmount = a.ConvertCurrency(fromCurrency, toCurrency, total)
+	lines := []string{}
+	for _, expense := range expenseList {
+		if err = expense.Decrypt(pk); err != nil {
+			return []string{}, err
+		}
+
+		amount, err := strconv.ParseFloat(expense.Historical, 64)
+		if err != nil {
+			return []string{}, err
+		}
+
+		convertedAmount, err := a.ConvertCurrency(ctx, fromCurrency, toCurrency, amount, expense.Date)
+		if err != nil {
+			return []string{}, err
+		}
+
+		strAmount := strconv.FormatFloat(convertedAmount, 'f', 2, 64)
+
+		line := fmt.Sprintf(
+			"%s - %s: %s %s (%s %s)",
+			expense.Date.In(expenseM.Now().Location()).Format("Jan 2"),
+			expense.Description,
+			expense.Total,
+			expense.Currency,
+			strAmount,
+			toCurrency,
+		)
+		lines = append(lines, line)
 	}
-	strAmount := strconv.FormatFloat(convertedAmount, 'f', 2, 64)
-	messageVar := fmt.Sprintf("%s %s", strAmount, toCurrency)
-	return messageVar, err
+
+	return lines, nil
+}
+
+// GetRecentExpenses returns a User's most recently tracked Expenses, decrypted
+// with their private key and dated in their timezone.
+func (a *Actions) GetRecentExpenses(userID uint, limit int, pk rsa.PrivateKey) ([]expenses.Expense, error) {
+	manager := a.localExpenseManager(userID)
+	recentExpenses, err := manager.RecentForUser(userID, limit)
+	if err != nil {
+		return recentExpenses, err
+	}
+
+	location := manager.Now().Location()
+	for i := range recentExpenses {
+		if err = recentExpenses[i].Decrypt(pk); err != nil {
+			return []expenses.Expense{}, err
+		}
+		recentExpenses[i].Date = recentExpenses[i].Date.In(location)
+	}
+
+	return recentExpenses, nil
+}
+
+// UpgradeEncryption upgrades a User's data encrypted with legacy formats. Key
+// pairs smaller than the key pairs we create today are replaced and every Expense
+// is protected with the new key pair, along with the User's recovery codes. Kept
+// private keys are protected again with the User's password and legacy Expenses
+// are re-encrypted with envelope encryption. It requires the User's password,
+// so it is run once a User supplies their password. Users are only upgraded
+// once. It returns the User's new recovery codes if their key pair was replaced.
+func (a *Actions) UpgradeEncryption(userID uint, password string) ([]string, error) {
+	userManager := users.NewUserManager(a.Db)
+	if userManager.GetByID(userID).EncryptionUpgraded {
+		return []string{}, nil
+	}
+
+	rewrap := func(tx *gorm.DB, oldKey rsa.PrivateKey, newKey rsa.PublicKey) error {
+		manager := expenses.NewExpenseManager(tx)
+		_, err := manager.RewrapDataKeys(userID, oldKey, newKey)
+		return err
+	}
+
+	codes, err := userManager.UpgradeKeyPair(userID, password, rewrap)
+	if err != nil {
+		log.Printf("actions: failed to upgrade key pair %s", err)
+		return []string{}, err
+	}
+
+	user := userManager.GetByID(userID)
+	privateKey, err := user.GetPrivateKey(password)
+	if err != nil {
+		return codes, err
+	}
+
+	manager := expenses.NewExpenseManager(a.Db)
+	if _, err = manager.UpgradeEncryption(userID, privateKey); err != nil {
+		log.Printf("actions: failed to upgrade expenses %s", err)
+		return codes, err
+	}
+
+	return codes, userManager.MarkEncryptionUpgraded(userID)
+}
+
+// DeleteExpense removes a User's Expense.
+func (a *Actions) DeleteExpense(expenseID uint, userID uint) error {
+	manager := expenses.NewExpenseManager(a.Db)
+	expense, err := manager.GetByID(expenseID, userID)
+	if err != nil {
+		return err
+	}
+
+	return manager.Delete(&expense)
+}
+
+// EditExpense updates a single field (amount, currency, description or date) of a
+// User's Expense. Changes to the amount, currency or date update the historical
+// value of the expense.
+func (a *Actions) EditExpense(ctx context.Context, expenseID, userID uint, field, value string, pk rsa.PrivateKey) error {
+	manager := a.localExpenseManager(userID)
+	expense, err := manager.GetByID(expenseID, userID)
+	if err != nil {
+		return err
+	}
+
+	if err = expense.Decrypt(pk); err != nil {
+		return err
+	}
+
+	switch field {
+	case EditAmount:
+		amount, currency := utils.ParseAmount(value)
+		if amount <= 0 {
+			return errors.New("invalid amount")
+		}
+
+		expense.Total = strconv.FormatFloat(amount, 'f', -1, 64)
+		if currency != "" {
+			expense.Currency = currency
+		}
+	case EditCurrency:
+		currency, err := utils.ParseCurrency(value)
+		if err != nil {
+			return err
+		}
+
+		expense.Currency = currency
+	case EditDescription:
+		description := utils.ParseDescription(strings.TrimSpace(value))
+		if description == "" {
+			return errors.New("invalid description")
+		}
+
+		expense.Description = description
+	case EditDate:
+		// ParseDate defaults to now, so we only parse dates we recognize
+		date, _, _ := utils.FindDate(value)
+		if date == "" {
+			return errors.New("invalid date")
+		}
+
+		expense.Date = utils.ParseDate(date, manager.Now())
+	default:
+		return errors.New("invalid field")
+	}
+
+	amount, err := strconv.ParseFloat(expense.Total, 64)
+	if err != nil {
+		return err
+	}
+
+	targetCurrency := "USD"
+	historicalAmount, err := a.ConvertCurrency(ctx, expense.Currency, targetCurrency, amount, expense.Date)
+	if err != nil {
+		return err
+	}
+	expense.Historical = strconv.FormatFloat(historicalAmount, 'f', -1, 64)
+
+	userManager := users.NewUserManager(a.Db)
+	user := userManager.GetByID(userID)
+	publicKey, err := user.GetPublicKey()
+	if err != nil {
+		return err
+	}
+
+	return manager.Update(&expense, publicKey)
+}
+
+// FormatExpense returns a short summary of a decrypted Expense,
+// for example "2000 JPY for sushi on Mar 12".
+func FormatExpense(e expenses.Expense) string {
+	return fmt.Sprintf("%s %s for %s on %s", e.Total, e.Currency, e.Description, e.Date.Format("Jan 2"))
 }
 
 // CreateNewUser saves a user to the DB.
@@ -100,6 +541,88 @@ func (a *Actions) CreateNewUser(userID uint, password string) error {
 	return manager.Save(user)
 }
 
+// SetUserTimezone creates or updates a settings entry with the user's timezone.
+func (a *Actions) SetUserTimezone(userID uint, timezone string) error {
+	manager := users.NewSettingManager(a.Db)
+	return manager.UpdateTimezone(userID, timezone)
+}
+
+// SetUserWeekStart creates or updates a settings entry with the day the
+// user's week starts on.
+func (a *Actions) SetUserWeekStart(userID uint, day string) error {
+	manager := users.NewSettingManager(a.Db)
+	return manager.UpdateWeekStart(userID, day)
+}
+
+// ParseSetting checks if a string refers to a setting a user may change.
+func ParseSetting(s string) (string, error) {
+	cleanString := strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	cleanString = strings.TrimPrefix(cleanString, "my ")
+	setting, ok := settingNames[cleanString]
+	if !ok {
+		return "", errors.New("invalid setting")
+	}
+
+	return setting, nil
+}
+
+// UpdateSetting changes one of a user's settings.
+func (a *Actions) UpdateSetting(userID uint, setting, value string) error {
+	switch setting {
+	case SettingCurrency:
+		return a.SetUserCurrency(userID, value)
+	case SettingTimezone:
+		return a.SetUserTimezone(userID, value)
+	case SettingWeekStart:
+		return a.SetUserWeekStart(userID, value)
+	default:
+		return errors.New("invalid setting")
+	}
+}
+
+// GetSettings returns a summary of a user's settings.
+func (a *Actions) GetSettings(userID uint) string {
+	manager := users.NewSettingManager(a.Db)
+	lines := []string{
+		fmt.Sprintf("%s: %s", SettingCurrency, manager.GetCurrency(userID)),
+		fmt.Sprintf("%s: %s", SettingTimezone, manager.GetLocation(userID)),
+		fmt.Sprintf("%s: %s", SettingWeekStart, manager.GetWeekStart(userID)),
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ChangePassword replaces a user's password. The user's private key is
+// protected again with the new password.
+func (a *Actions) ChangePassword(userID uint, oldPassword, newPassword string) error {
+	manager := users.NewUserManager(a.Db)
+	return manager.UpdatePassword(userID, oldPassword, newPassword)
+}
+
+// CreateRecoveryCodes creates a new set of one-time recovery codes for a user.
+// Each code may be used to reset the user's password if they forget it.
+func (a *Actions) CreateRecoveryCodes(userID uint, password string) ([]string, error) {
+	manager := users.NewUserManager(a.Db)
+	return manager.CreateRecoveryCodes(userID, password)
+}
+
+// ValidateRecoveryCode checks if a code is one of the user's unused
+// recovery codes.
+func (a *Actions) ValidateRecoveryCode(userID uint, code string) error {
+	manager := users.NewUserManager(a.Db)
+	return manager.ValidateRecoveryCode(userID, code)
+}
+
+// ResetPassword replaces a user's password with one of their recovery codes
+// and returns the number of recovery codes they have left.
+func (a *Actions) ResetPassword(userID uint, code, newPassword string) (int, error) {
+	manager := users.NewUserManager(a.Db)
+	if err := manager.ResetPassword(userID, code, newPassword); err != nil {
+		return 0, err
+	}
+
+	return manager.CountRecoveryCodes(userID), nil
+}
+
 // SetUserCurrency creates a settings entry with the user's requested currency.
 func (a *Actions) SetUserCurrency(userID uint, currency string) error {
 	manager := users.NewSettingManager(a.Db)
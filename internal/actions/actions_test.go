@@ -1,16 +1,23 @@
 package actions
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/rsa"
-	"encoding/json"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+	"github.com/fmitra/dennis-bot/pkg/crypto"
+	"github.com/fmitra/dennis-bot/pkg/exchange"
+	"github.com/fmitra/dennis-bot/pkg/expenses"
+	"github.com/fmitra/dennis-bot/pkg/nlu"
+	"github.com/fmitra/dennis-bot/pkg/rates"
 	"github.com/fmitra/dennis-bot/pkg/users"
-	"github.com/fmitra/dennis-bot/pkg/wit"
 	mocks "github.com/fmitra/dennis-bot/test"
 )
 
@@ -24,10 +31,10 @@ func (suite *ActionSuite) SetupSuite() {
 	configFile := "../../config/config.json"
 	suite.Env = mocks.GetTestEnv(configFile)
 	suite.Action = &Actions{
-		suite.Env.Db,
-		suite.Env.Cache,
-		suite.Env.Config,
-		&alphapoint.Client{},
+		Db:     suite.Env.Db,
+		Cache:  suite.Env.Cache,
+		Config: suite.Env.Config,
+		Rates:  &alphapoint.Client{},
 	}
 }
 
@@ -40,19 +47,12 @@ func (suite *ActionSuite) BeforeTest(suiteName, testName string) {
 }
 
 func (suite *ActionSuite) TestCreatesNewExpense() {
-	rawWitResponse := []byte(`{
-		"entities": {
-			"amount": [
-				{ "value": "20 SGD", "confidence": 100.00 }
-			],
-			"datetime": [
-				{ "value": "", "confidence": 100.00 }
-			],
-			"description": [
-				{ "value": "Food", "confidence": 100.00 }
-			]
-		}
-	}`)
+	nluMessage := nlu.Message{
+		Intent:      nlu.TrackExpense,
+		Amount:      20,
+		Currency:    "SGD",
+		Description: "Food",
+	}
 	alphapointResponse := `{
 		"Realtime Currency Exchange Rate": {
 			"5. Exchange Rate": ".7"
@@ -61,34 +61,92 @@ func (suite *ActionSuite) TestCreatesNewExpense() {
 	alphapointServer := mocks.MakeTestServer(alphapointResponse)
 	defer alphapointServer.Close()
 
-	var witResponse wit.Response
-	json.Unmarshal(rawWitResponse, &witResponse)
-
 	ap := &alphapoint.Client{
 		BaseURL: alphapointServer.URL,
 		Token:   "",
 	}
 	action := suite.Action
-	action.Alphapoint = ap
-	publicKey := rsa.PublicKey{}
-	err := action.CreateNewExpense(witResponse, mocks.TestUserID, publicKey)
+	action.Rates = ap
+	mocks.CreateTestUser(suite.Env.Db, 0)
+	user := users.NewUserManager(suite.Env.Db).GetByTelegramID(mocks.TestUserID)
+	publicKey, _ := user.GetPublicKey()
+	err := action.CreateNewExpense(context.Background(), nluMessage, user.ID, publicKey)
 	assert.NoError(suite.T(), err)
+
+	// Expenses are never saved unencrypted
+	err = action.CreateNewExpense(context.Background(), nluMessage, user.ID, rsa.PublicKey{})
+	assert.Error(suite.T(), err)
+
+	var count int
+	suite.Env.Db.Model(&expenses.Expense{}).Where("user_id = ?", user.ID).Count(&count)
+	assert.Equal(suite.T(), 1, count)
 }
 
-func (suite *ActionSuite) TestCreatesNewExpenseFromCache() {
-	rawWitResponse := []byte(`{
-		"entities": {
-			"amount": [
-				{ "value": "20 SGD", "confidence": 100.00 }
-			],
-			"datetime": [
-				{ "value": "", "confidence": 100.00 }
-			],
-			"description": [
-				{ "value": "Food", "confidence": 100.00 }
-			]
+func (suite *ActionSuite) TestCreatesBatchOfExpenses() {
+	nluMessage := nlu.Message{
+		Intent: nlu.TrackExpense,
+		Expenses: []nlu.Message{
+			{Intent: nlu.TrackExpense, Amount: 200, Currency: "RUB", Description: "lunch"},
+			{Intent: nlu.TrackExpense, Amount: 50, Currency: "RUB", Description: "coffee"},
+			{Intent: nlu.TrackExpense, Amount: 1200, Currency: "RUB", Description: "taxi"},
+		},
+	}
+	alphapointResponse := `{
+		"Realtime Currency Exchange Rate": {
+			"5. Exchange Rate": ".015"
 		}
-	}`)
+	}`
+	alphapointServer := mocks.MakeTestServer(alphapointResponse)
+	defer alphapointServer.Close()
+
+	action := suite.Action
+	action.Rates = &alphapoint.Client{
+		BaseURL: alphapointServer.URL,
+		Token:   "",
+	}
+	mocks.CreateTestUser(suite.Env.Db, 0)
+	user := users.NewUserManager(suite.Env.Db).GetByTelegramID(mocks.TestUserID)
+	publicKey, _ := user.GetPublicKey()
+	err := action.CreateNewExpense(context.Background(), nluMessage, user.ID, publicKey)
+	assert.NoError(suite.T(), err)
+
+	var count int
+	suite.Env.Db.Model(&expenses.Expense{}).Where("user_id = ?", user.ID).Count(&count)
+	assert.Equal(suite.T(), 3, count)
+}
+
+func (suite *ActionSuite) TestTracksMessageOnce() {
+	nluMessage := nlu.Message{
+		Intent: nlu.TrackExpense,
+		Expenses: []nlu.Message{
+			{Intent: nlu.TrackExpense, Amount: 5, Currency: "USD", Description: "lunch"},
+			{Intent: nlu.TrackExpense, Amount: 2, Currency: "USD", Description: "coffee"},
+		},
+		Source: "456:123",
+	}
+
+	mocks.CreateTestUser(suite.Env.Db, 0)
+	user := users.NewUserManager(suite.Env.Db).GetByTelegramID(mocks.TestUserID)
+	publicKey, _ := user.GetPublicKey()
+	err := suite.Action.CreateNewExpense(context.Background(), nluMessage, user.ID, publicKey)
+	assert.NoError(suite.T(), err)
+
+	// A message delivered twice is only tracked once
+	err = suite.Action.CreateNewExpense(context.Background(), nluMessage, user.ID, publicKey)
+	assert.Error(suite.T(), err)
+
+	var count int
+	suite.Env.Db.Model(&expenses.Expense{}).Where("user_id = ?", user.ID).Count(&count)
+	assert.Equal(suite.T(), 2, count)
+}
+
+func (suite *ActionSuite) TestCreatesNewExpenseFromCache() {
+	nluMessage := nlu.Message{
+		Intent:      nlu.TrackExpense,
+		Amount:      20,
+		Currency:    "SGD",
+		Description: "Food",
+	}
 	alphapointResponse := `{
 		"Realtime Currency Exchange Rate": {
 			"5. Exchange Rate": ".7"
@@ -96,22 +154,21 @@ func (suite *ActionSuite) TestCreatesNewExpenseFromCache() {
 	}`
 	alphapointServer := mocks.MakeTestServer(alphapointResponse)
 
-	var witResponse wit.Response
-	json.Unmarshal(rawWitResponse, &witResponse)
-
 	ap := &alphapoint.Client{
 		BaseURL: alphapointServer.URL,
 		Token:   "",
 	}
-	publicKey := rsa.PublicKey{}
+	mocks.CreateTestUser(suite.Env.Db, 0)
+	user := users.NewUserManager(suite.Env.Db).GetByTelegramID(mocks.TestUserID)
+	publicKey, _ := user.GetPublicKey()
 	action := suite.Action
-	action.Alphapoint = ap
+	action.Rates = ap
 	// Initial call without cache
-	action.CreateNewExpense(witResponse, mocks.TestUserID, publicKey)
+	action.CreateNewExpense(context.Background(), nluMessage, user.ID, publicKey)
 
 	// Second call should not hit server
 	alphapointServer.Close()
-	err := action.CreateNewExpense(witResponse, mocks.TestUserID, publicKey)
+	err := action.CreateNewExpense(context.Background(), nluMessage, user.ID, publicKey)
 	assert.NoError(suite.T(), err)
 }
 
@@ -119,9 +176,128 @@ func (suite *ActionSuite) TestGetsExpenseTotal() {
 	action := suite.Action
 	privateKey := rsa.PrivateKey{}
 	period := "month"
-	total, err := action.GetExpenseTotal(period, uint(200), privateKey)
+	total, err := action.GetExpenseTotal(context.Background(), period, uint(200), privateKey)
 	assert.Equal(suite.T(), "0.00 USD", total)
 	assert.NoError(suite.T(), err)
+
+	for _, period := range []string{"yesterday", "last 30 days", "from march 1 to march 15"} {
+		total, err = action.GetExpenseTotal(context.Background(), period, uint(200), privateKey)
+		assert.Equal(suite.T(), "0.00 USD", total)
+		assert.NoError(suite.T(), err)
+	}
+}
+
+func (suite *ActionSuite) TestFailsToConvertWithoutRate() {
+	action := suite.Action
+	action.Rates = rates.NewChain()
+
+	amount, err := action.ConvertCurrency(context.Background(), "SGD", "SGD", 20, time.Now())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 20.0, amount)
+
+	_, err = action.ConvertCurrency(context.Background(), "SGD", "USD", 20, time.Now())
+	assert.EqualError(suite.T(), err, "no rate providers")
+
+	nluMessage := nlu.Message{
+		Intent:      nlu.TrackExpense,
+		Amount:      20,
+		Currency:    "SGD",
+		Description: "Food",
+	}
+	err = action.CreateNewExpense(context.Background(), nluMessage, mocks.TestUserID, rsa.PublicKey{})
+	assert.EqualError(suite.T(), err, "no rate providers")
+}
+
+func (suite *ActionSuite) TestConvertsWithRateOnExpenseDate() {
+	action := suite.Action
+	action.Rates = rates.NewChain()
+
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1)
+	for date, rate := range map[time.Time]float64{now: 0.7, yesterday: 0.5} {
+		cacheKey := fmt.Sprintf("SGD_USD_%s", date.Format("2006-01-02"))
+		conversion := &rates.Conversion{FromCurrency: "SGD", ToCurrency: "USD", Rate: rate, Date: date}
+		suite.Env.Cache.Set(context.Background(), cacheKey, conversion, 180)
+	}
+
+	amount, err := action.ConvertCurrency(context.Background(), "SGD", "USD", 20, now)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 14.0, amount)
+
+	amount, err = action.ConvertCurrency(context.Background(), "SGD", "USD", 20, yesterday)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 10.0, amount)
+
+	mocks.CreateTestUser(suite.Env.Db, 0)
+	user := users.NewUserManager(suite.Env.Db).GetByTelegramID(mocks.TestUserID)
+	publicKey, _ := user.GetPublicKey()
+	nluMessage := nlu.Message{
+		Intent:      nlu.TrackExpense,
+		Amount:      20,
+		Currency:    "SGD",
+		Description: "Food",
+		Date:        "yesterday",
+	}
+	err = action.CreateNewExpense(context.Background(), nluMessage, user.ID, publicKey)
+	assert.NoError(suite.T(), err)
+
+	expense, _ := expenses.NewExpenseManager(suite.Env.Db).LastForUser(user.ID)
+	privateKey, _ := user.GetPrivateKey("my-password")
+	expense.Decrypt(privateKey)
+	assert.Equal(suite.T(), "10", expense.Historical)
+}
+
+func (suite *ActionSuite) TestReadsRatesFromStore() {
+	action := suite.Action
+	action.Rates = rates.NewChain()
+	manager := exchange.NewRateManager(suite.Env.Db)
+
+	_, err := action.GetRate(context.Background(), "SGD", "USD", time.Now())
+	assert.EqualError(suite.T(), err, "no rate providers")
+
+	// Stale rates are used when our providers fail
+	lastWeek := time.Now().AddDate(0, 0, -7)
+	manager.Save("SGD", "USD", lastWeek, 0.7)
+	rate, err := action.GetRate(context.Background(), "SGD", "USD", time.Now())
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0.7, rate)
+
+	// Fresh rates are used without asking our providers
+	yesterday := time.Now().AddDate(0, 0, -1)
+	manager.Save("SGD", "USD", yesterday, 0.75)
+	rate, err = action.GetRate(context.Background(), "SGD", "USD", yesterday)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0.75, rate)
+}
+
+func (suite *ActionSuite) TestStoresRatesFromProvider() {
+	alphapointResponse := `{
+		"Realtime Currency Exchange Rate": {
+			"5. Exchange Rate": ".7"
+		}
+	}`
+	alphapointServer := mocks.MakeTestServer(alphapointResponse)
+
+	action := suite.Action
+	action.Rates = &alphapoint.Client{
+		BaseURL: alphapointServer.URL,
+		Token:   "",
+	}
+	now := time.Now()
+	rate, err := action.GetRate(context.Background(), "SGD", "USD", now)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0.7, rate)
+	alphapointServer.Close()
+
+	stored, err := exchange.NewRateManager(suite.Env.Db).Latest("SGD", "USD", now)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0.7, stored.Value)
+
+	// Rates are still available once the cache is flushed
+	suite.Env.Cache.Delete(context.Background(), fmt.Sprintf("SGD_USD_%s", now.Format("2006-01-02")))
+	rate, err = action.GetRate(context.Background(), "SGD", "USD", now)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0.7, rate)
 }
 
 func (suite *ActionSuite) TestGetsConvertedExpenseTotal() {
@@ -147,28 +323,313 @@ func (suite *ActionSuite) TestGetsConvertedExpenseTotal() {
 		Token:   "",
 	}
 	action := suite.Action
-	action.Alphapoint = ap
+	action.Rates = ap
 	privateKey := rsa.PrivateKey{}
 	period := "month"
-	total, err := action.GetExpenseTotal(period, user.ID, privateKey)
+	total, err := action.GetExpenseTotal(context.Background(), period, user.ID, privateKey)
 	assert.Equal(suite.T(), "0.00 PHP", total)
 	assert.NoError(suite.T(), err)
 }
 
+func (suite *ActionSuite) TestCreatesNewExpenseWithCategory() {
+	nluMessage := nlu.Message{
+		Text:        "20 SGD for Lunch #food",
+		Intent:      nlu.TrackExpense,
+		Amount:      20,
+		Currency:    "SGD",
+		Description: "Lunch",
+		Category:    "food",
+	}
+	alphapointResponse := `{
+		"Realtime Currency Exchange Rate": {
+			"5. Exchange Rate": ".7"
+		}
+	}`
+	alphapointServer := mocks.MakeTestServer(alphapointResponse)
+	defer alphapointServer.Close()
+
+	mocks.CreateTestUser(suite.Env.Db, 0)
+	user := users.NewUserManager(suite.Env.Db).GetByTelegramID(mocks.TestUserID)
+	publicKey, _ := user.GetPublicKey()
+
+	action := suite.Action
+	action.Rates = &alphapoint.Client{
+		BaseURL: alphapointServer.URL,
+		Token:   "",
+	}
+	err := action.CreateNewExpense(context.Background(), nluMessage, user.ID, publicKey)
+	assert.NoError(suite.T(), err)
+
+	// Category is learned for future expenses with a similar description
+	nluMessage = nlu.Message{Text: "20 SGD for lunch", Intent: nlu.TrackExpense}
+	assert.Equal(suite.T(), "food", action.GetCategory(nluMessage, user.ID, "lunch"))
+}
+
+func (suite *ActionSuite) TestDoesNotLearnCategoryOfUnsavedExpense() {
+	nluMessage := nlu.Message{
+		Text:        "20 SGD for Lunch #food",
+		Intent:      nlu.TrackExpense,
+		Amount:      20,
+		Currency:    "SGD",
+		Description: "Lunch",
+		Category:    "food",
+		Source:      "456:123",
+	}
+	alphapointResponse := `{
+		"Realtime Currency Exchange Rate": {
+			"5. Exchange Rate": ".7"
+		}
+	}`
+	alphapointServer := mocks.MakeTestServer(alphapointResponse)
+	defer alphapointServer.Close()
+
+	mocks.CreateTestUser(suite.Env.Db, 0)
+	user := users.NewUserManager(suite.Env.Db).GetByTelegramID(mocks.TestUserID)
+	publicKey, _ := user.GetPublicKey()
+
+	action := suite.Action
+	action.Rates = &alphapoint.Client{
+		BaseURL: alphapointServer.URL,
+		Token:   "",
+	}
+	err := action.CreateNewExpense(context.Background(), nluMessage, user.ID, publicKey)
+	assert.NoError(suite.T(), err)
+
+	// The same chat message is only tracked once, so its category is not learned
+	nluMessage.Category = "work"
+	err = action.CreateNewExpense(context.Background(), nluMessage, user.ID, publicKey)
+	assert.Error(suite.T(), err)
+
+	nluMessage = nlu.Message{Text: "20 SGD for lunch", Intent: nlu.TrackExpense}
+	assert.Equal(suite.T(), "food", action.GetCategory(nluMessage, user.ID, "lunch"))
+}
+
+func (suite *ActionSuite) TestGetsCategoryTotal() {
+	action := suite.Action
+	privateKey := rsa.PrivateKey{}
+	period := "month"
+
+	total, err := action.GetCategoryTotal(context.Background(), period, "food", uint(200), privateKey)
+	assert.Equal(suite.T(), "0.00 USD on food", total)
+	assert.NoError(suite.T(), err)
+
+	total, err = action.GetCategoryTotal(context.Background(), period, nlu.AllCategories, uint(200), privateKey)
+	assert.Equal(suite.T(), "", total)
+	assert.NoError(suite.T(), err)
+}
+
 func (suite *ActionSuite) TestReturnsErrorForInvalidPeriod() {
 	action := &Actions{
-		suite.Env.Db,
-		suite.Env.Cache,
-		suite.Env.Config,
-		&alphapoint.Client{},
+		Db:     suite.Env.Db,
+		Cache:  suite.Env.Cache,
+		Config: suite.Env.Config,
+		Rates:  &alphapoint.Client{},
 	}
 
 	privateKey := rsa.PrivateKey{}
 	period := "foo"
-	_, err := action.GetExpenseTotal(period, mocks.TestUserID, privateKey)
+	_, err := action.GetExpenseTotal(context.Background(), period, mocks.TestUserID, privateKey)
 	assert.EqualError(suite.T(), err, "foo is an invalid period")
 }
 
+func (suite *ActionSuite) TestGetsExpenseList() {
+	action := suite.Action
+	privateKey := rsa.PrivateKey{}
+
+	lines, err := action.GetExpenseList(context.Background(), "week", uint(200), privateKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{}, lines)
+
+	_, err = action.GetExpenseList(context.Background(), "foo", uint(200), privateKey)
+	assert.EqualError(suite.T(), err, "foo is an invalid period")
+}
+
+func (suite *ActionSuite) TestUpgradesLegacyEncryption() {
+	action := suite.Action
+	action.CreateNewUser(mocks.TestUserID, "my-password")
+	user := users.NewUserManager(action.Db).GetByTelegramID(mocks.TestUserID)
+	action.Db.Model(&user).Update("encryption_upgraded", false)
+	publicKey, _ := user.GetPublicKey()
+
+	createLegacyExpense := func() {
+		total, _ := crypto.AsymEncrypt("10", publicKey)
+		description, _ := crypto.AsymEncrypt("coffee", publicKey)
+		currency, _ := crypto.AsymEncrypt("USD", publicKey)
+		action.Db.Create(&expenses.Expense{
+			Date:        time.Now(),
+			Description: description,
+			Total:       total,
+			Historical:  total,
+			Currency:    currency,
+			UserID:      user.ID,
+		})
+	}
+	createLegacyExpense()
+
+	_, err := action.UpgradeEncryption(user.ID, "not-my-password")
+	assert.EqualError(suite.T(), err, "invalid password")
+
+	codes, err := action.UpgradeEncryption(user.ID, "my-password")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, len(codes))
+
+	expense, _ := expenses.NewExpenseManager(action.Db).LastForUser(user.ID)
+	assert.False(suite.T(), expense.IsLegacy())
+	assert.True(suite.T(), users.NewUserManager(action.Db).GetByID(user.ID).EncryptionUpgraded)
+
+	// Users are only upgraded once
+	createLegacyExpense()
+	_, err = action.UpgradeEncryption(user.ID, "my-password")
+	assert.NoError(suite.T(), err)
+	expense, _ = expenses.NewExpenseManager(action.Db).LastForUser(user.ID)
+	assert.True(suite.T(), expense.IsLegacy())
+}
+
+func (suite *ActionSuite) TestReplacesLegacyKeyPair() {
+	action := suite.Action
+	action.CreateNewUser(mocks.TestUserID, "my-password")
+	user := users.NewUserManager(action.Db).GetByTelegramID(mocks.TestUserID)
+
+	// Replace the key pair with one the size we created before
+	legacyKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	publicKey, privateKey, _ := crypto.ProtectKeyPair(legacyKey.PublicKey, *legacyKey, "my-password")
+	action.Db.Model(&user).Updates(map[string]interface{}{
+		"public_key":          publicKey,
+		"private_key":         privateKey,
+		"encryption_upgraded": false,
+	})
+
+	total, _ := crypto.AsymEncrypt("10", legacyKey.PublicKey)
+	description, _ := crypto.AsymEncrypt("coffee", legacyKey.PublicKey)
+	currency, _ := crypto.AsymEncrypt("USD", legacyKey.PublicKey)
+	action.Db.Create(&expenses.Expense{
+		Date:        time.Now(),
+		Description: description,
+		Total:       total,
+		Historical:  total,
+		Currency:    currency,
+		UserID:      user.ID,
+	})
+
+	codes, err := action.UpgradeEncryption(user.ID, "my-password")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), users.RecoveryCodeCount, len(codes))
+
+	expenseList, err := action.GetRecentExpenses(user.ID, 1, *legacyKey)
+	assert.Error(suite.T(), err)
+
+	upgradedUser := users.NewUserManager(action.Db).GetByID(user.ID)
+	upgradedKey, _ := upgradedUser.GetPrivateKey("my-password")
+	assert.Equal(suite.T(), crypto.KeyBitSize, upgradedKey.N.BitLen())
+	expenseList, err = action.GetRecentExpenses(user.ID, 1, upgradedKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "coffee", expenseList[0].Description)
+}
+
+func (suite *ActionSuite) TestDeleteExpenseNotFound() {
+	action := suite.Action
+	err := action.DeleteExpense(uint(1), uint(200))
+	assert.EqualError(suite.T(), err, "expense does not exist")
+}
+
+func (suite *ActionSuite) TestEditExpenseNotFound() {
+	action := suite.Action
+	privateKey := rsa.PrivateKey{}
+	err := action.EditExpense(context.Background(), uint(1), uint(200), EditAmount, "20 SGD", privateKey)
+	assert.EqualError(suite.T(), err, "expense does not exist")
+}
+
+func (suite *ActionSuite) TestEditsExpense() {
+	alphapointResponse := `{
+		"Realtime Currency Exchange Rate": {
+			"5. Exchange Rate": ".5"
+		}
+	}`
+	alphapointServer := mocks.MakeTestServer(alphapointResponse)
+	defer alphapointServer.Close()
+
+	action := suite.Action
+	action.Rates = &alphapoint.Client{
+		BaseURL: alphapointServer.URL,
+		Token:   "",
+	}
+	mocks.CreateTestUser(suite.Env.Db, 0)
+	user := users.NewUserManager(suite.Env.Db).GetByTelegramID(mocks.TestUserID)
+	publicKey, _ := user.GetPublicKey()
+	privateKey, _ := user.GetPrivateKey("my-password")
+	nluMessage := nlu.Message{
+		Intent:      nlu.TrackExpense,
+		Amount:      20,
+		Currency:    "USD",
+		Description: "lunch",
+	}
+	action.CreateNewExpense(context.Background(), nluMessage, user.ID, publicKey)
+	expense, _ := expenses.NewExpenseManager(suite.Env.Db).LastForUser(user.ID)
+	ctx := context.Background()
+
+	err := action.EditExpense(ctx, expense.ID, user.ID, EditCurrency, "euros", privateKey)
+	assert.NoError(suite.T(), err)
+
+	err = action.EditExpense(ctx, expense.ID, user.ID, EditDate, "blah", privateKey)
+	assert.EqualError(suite.T(), err, "invalid date")
+
+	err = action.EditExpense(ctx, expense.ID, user.ID, EditDate, "yesterday", privateKey)
+	assert.NoError(suite.T(), err)
+
+	expense, _ = expenses.NewExpenseManager(suite.Env.Db).LastForUser(user.ID)
+	expense.Decrypt(privateKey)
+	assert.Equal(suite.T(), "EUR", expense.Currency)
+	assert.Equal(suite.T(), "10", expense.Historical)
+	yesterday := time.Now().AddDate(0, 0, -1).UTC().Format("2006-01-02")
+	assert.Equal(suite.T(), yesterday, expense.Date.UTC().Format("2006-01-02"))
+}
+
+func (suite *ActionSuite) TestFormatsExpense() {
+	expense := expenses.Expense{
+		Date:        time.Date(2018, 3, 12, 0, 0, 0, 0, time.UTC),
+		Description: "sushi",
+		Total:       "2000",
+		Currency:    "JPY",
+	}
+	assert.Equal(suite.T(), "2000 JPY for sushi on Mar 12", FormatExpense(expense))
+}
+
+func (suite *ActionSuite) TestParsesSetting() {
+	var testCases = []struct {
+		input    string
+		expected string
+	}{
+		{"Currency", SettingCurrency},
+		{"my time zone", SettingTimezone},
+		{"first day of the week", SettingWeekStart},
+	}
+
+	for _, test := range testCases {
+		setting, err := ParseSetting(test.input)
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), test.expected, setting)
+	}
+
+	_, err := ParseSetting("colour")
+	assert.EqualError(suite.T(), err, "invalid setting")
+}
+
+func (suite *ActionSuite) TestUpdatesSetting() {
+	action := suite.Action
+	mocks.CreateTestUser(suite.Env.Db, 0)
+	user := users.NewUserManager(suite.Env.Db).GetByTelegramID(mocks.TestUserID)
+
+	assert.NoError(suite.T(), action.UpdateSetting(user.ID, SettingCurrency, "SGD"))
+	assert.NoError(suite.T(), action.UpdateSetting(user.ID, SettingTimezone, "Asia/Singapore"))
+	assert.NoError(suite.T(), action.UpdateSetting(user.ID, SettingWeekStart, "monday"))
+	assert.EqualError(suite.T(), action.UpdateSetting(user.ID, "colour", "red"), "invalid setting")
+	assert.Equal(
+		suite.T(),
+		"currency: SGD\ntimezone: Asia/Singapore\nweek start: Monday",
+		action.GetSettings(user.ID),
+	)
+}
+
 func (suite *ActionSuite) TestCreatesNewUser() {
 	action := suite.Action
 	password := "my-password"
@@ -177,6 +638,22 @@ func (suite *ActionSuite) TestCreatesNewUser() {
 	assert.NoError(suite.T(), err)
 }
 
+func (suite *ActionSuite) TestResetsPasswordWithRecoveryCode() {
+	action := suite.Action
+	action.CreateNewUser(mocks.TestUserID, "my-password")
+	user := users.NewUserManager(action.Db).GetByTelegramID(mocks.TestUserID)
+
+	codes, err := action.CreateRecoveryCodes(user.ID, "my-password")
+	assert.NoError(suite.T(), err)
+
+	remaining, err := action.ResetPassword(user.ID, codes[0], "new-password")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), users.RecoveryCodeCount-1, remaining)
+
+	_, err = action.ResetPassword(user.ID, codes[0], "new-password")
+	assert.EqualError(suite.T(), err, "invalid recovery code")
+}
+
 func TestActionSuite(t *testing.T) {
 	suite.Run(t, new(ActionSuite))
 }
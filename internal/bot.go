@@ -1,23 +1,34 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/fmitra/dennis-bot/internal/actions"
 	convo "github.com/fmitra/dennis-bot/internal/conversation"
 	"github.com/fmitra/dennis-bot/pkg/telegram"
 )
 
+// releaseTimeout is how long we wait to release the claim on an update.
+const releaseTimeout = 5 * time.Second
+
 // Bot is responsible for parsing messages and responding
-// to a user. It is configured based on the environment
+// to a user. It is configured based on the environment. Background
+// jobs are run by the Dispatcher handing the Bot its messages.
 type Bot struct {
-	env *Env
+	env        *Env
+	dispatcher *Dispatcher
 }
 
 // Converse is the entry point to communicate with the bot. We parse an incoming
-// message and map it to  to a key word trigger to determine a response.
-func (bot *Bot) Converse(b []byte) int {
+// message and map it to  to a key word trigger to determine a response. The
+// context is passed on to every request made while responding, so a cancelled
+// context stops the bot from waiting on Telegram, the NLU backend or rates.
+func (bot *Bot) Converse(ctx context.Context, b []byte) int {
 	incMessage, err := bot.ReceiveMessage(b)
 	if err != nil {
 		log.Printf("bot: cannot respond to unsupported payload - %s", err)
@@ -25,10 +36,31 @@ func (bot *Bot) Converse(b []byte) int {
 		return errorCode
 	}
 
-	bot.SendTypingIndicator(incMessage)
-	response := bot.BuildResponse(incMessage)
+	// Every update from Telegram has an ID, so payloads without one are
+	// not updates and cannot be told apart from each other
+	if incMessage.UpdateID == 0 {
+		log.Printf("bot: cannot respond to payload without an update ID")
+		errorCode := 400
+		return errorCode
+	}
+
+	if !bot.ClaimUpdate(ctx, incMessage) {
+		log.Printf("bot: skipping duplicate update %d", incMessage.UpdateID)
+		statusCode := 200
+		return statusCode
+	}
 
-	return bot.SendMessage(response, incMessage)
+	bot.SendTypingIndicator(ctx, incMessage)
+	response := bot.BuildResponse(ctx, incMessage)
+	statusCode := bot.SendMessage(ctx, response, incMessage)
+
+	// Updates we could not respond to are released, so Telegram's retry
+	// is handled instead of being skipped as a duplicate
+	if ctx.Err() != nil || statusCode != 200 {
+		bot.ReleaseUpdate(incMessage)
+	}
+
+	return statusCode
 }
 
 // ReceiveMessage unmarshals a byte response into a telegram IncomingMessage.
@@ -42,31 +74,76 @@ func (bot *Bot) ReceiveMessage(b []byte) (telegram.IncomingMessage, error) {
 	return incM, nil
 }
 
+// ClaimUpdate records an update as processed so it is only handled once.
+// Telegram retries updates it believes were not delivered, so an update we
+// already claimed returns false. Updates are processed if the claim cannot
+// be recorded, as missing a message is worse than handling it twice.
+func (bot *Bot) ClaimUpdate(ctx context.Context, incM telegram.IncomingMessage) bool {
+	cacheKey := fmt.Sprintf("%d_update", incM.UpdateID)
+	oneDay := 86400
+	isClaimed, err := bot.env.cache.SetNX(ctx, cacheKey, true, oneDay)
+	if err != nil {
+		log.Printf("bot: failed to claim update %d - %s", incM.UpdateID, err)
+		return true
+	}
+
+	return isClaimed
+}
+
+// ReleaseUpdate removes the claim on an update so it may be handled again.
+// Updates are released after their context is cancelled, so the claim is
+// removed with a context of its own.
+func (bot *Bot) ReleaseUpdate(incM telegram.IncomingMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	cacheKey := fmt.Sprintf("%d_update", incM.UpdateID)
+	if err := bot.env.cache.Delete(ctx, cacheKey); err != nil {
+		log.Printf("bot: failed to release update %d - %s", incM.UpdateID, err)
+	}
+}
+
 // SendMessage sends a a message back through Telegram.
-func (bot *Bot) SendMessage(r convo.BotResponse, incM telegram.IncomingMessage) int {
+func (bot *Bot) SendMessage(ctx context.Context, r convo.BotResponse, incM telegram.IncomingMessage) int {
 	chatID := incM.GetChatID()
 
-	return bot.env.telegram.Send(chatID, string(r))
+	return bot.env.telegram.Send(ctx, chatID, string(r))
 }
 
 // SendTypingIndicator sends a typign indicator to the user to alert them
 // that we have received and processing their mssage.
-func (bot *Bot) SendTypingIndicator(incM telegram.IncomingMessage) int {
+func (bot *Bot) SendTypingIndicator(ctx context.Context, incM telegram.IncomingMessage) int {
 	chatID := incM.GetChatID()
 	action := "typing"
-	return bot.env.telegram.SendAction(chatID, action)
+	return bot.env.telegram.SendAction(ctx, chatID, action)
+}
+
+// Schedule runs a job on the worker of the user who sent a message, once the
+// messages they already sent are handled. A message returned by the job is
+// sent to the user.
+func (bot *Bot) Schedule(incM telegram.IncomingMessage, job actions.Job) error {
+	if bot.dispatcher == nil {
+		return errors.New("bot has no dispatcher")
+	}
+
+	return bot.dispatcher.Schedule(incM.GetUser().ID, func(ctx context.Context) {
+		if message := job(ctx); message != "" {
+			bot.SendMessage(ctx, convo.BotResponse(message), incM)
+		}
+	})
 }
 
 // BuildResponse coordinates with the action layer to to determine context behind
 // a user's message and return an appropriate response.
-func (bot *Bot) BuildResponse(incM telegram.IncomingMessage) convo.BotResponse {
-	witResponse := bot.env.wit.ParseMessage(incM.GetMessage())
+func (bot *Bot) BuildResponse(ctx context.Context, incM telegram.IncomingMessage) convo.BotResponse {
+	message := bot.env.nlu.Parse(ctx, incM.GetMessage())
 	actions := &actions.Actions{
-		Db:         bot.env.db,
-		Cache:      bot.env.cache,
-		Config:     bot.env.config,
-		Alphapoint: bot.env.alphapoint,
+		Db:     bot.env.db,
+		Cache:  bot.env.cache,
+		Config: bot.env.config,
+		Rates:  bot.env.rates,
+		Jobs:   bot,
 	}
-	botResponse := convo.GetResponse(witResponse, incM, actions)
+	botResponse := convo.GetResponse(ctx, message, incM, actions)
 	return botResponse
 }
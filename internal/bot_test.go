@@ -1,10 +1,12 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -73,7 +75,7 @@ func (suite *BotSuite) TestHandlesTrackingIntent() {
 	alphapointMock.BaseURL = alphapointServer.URL
 
 	bot := &Bot{
-		&Env{
+		env: &Env{
 			suite.Env.Db,
 			suite.Env.Cache,
 			suite.Env.Config,
@@ -83,8 +85,9 @@ func (suite *BotSuite) TestHandlesTrackingIntent() {
 		},
 	}
 
-	response := bot.BuildResponse(incMessage)
-	assert.Equal(suite.T(), convo.BotResponse("Roger that!"), response)
+	response := bot.BuildResponse(context.Background(), incMessage)
+	today := time.Now().UTC().Format("Mon, Jan 2")
+	assert.Equal(suite.T(), convo.BotResponse("Roger that, "+today+"!"), response)
 }
 
 func (suite *BotSuite) TestHandlesExpenseTotalIntent() {
@@ -111,7 +114,7 @@ func (suite *BotSuite) TestHandlesExpenseTotalIntent() {
 	witMock.BaseURL = witServer.URL
 
 	bot := &Bot{
-		&Env{
+		env: &Env{
 			suite.Env.Db,
 			suite.Env.Cache,
 			suite.Env.Config,
@@ -121,7 +124,7 @@ func (suite *BotSuite) TestHandlesExpenseTotalIntent() {
 		},
 	}
 
-	response := bot.BuildResponse(incMessage)
+	response := bot.BuildResponse(context.Background(), incMessage)
 	assert.Equal(suite.T(), convo.BotResponse("I need your password"), response)
 }
 
@@ -147,7 +150,7 @@ func (suite *BotSuite) TestReturnsDefaultMessage() {
 	witMock.BaseURL = witServer.URL
 
 	bot := &Bot{
-		&Env{
+		env: &Env{
 			suite.Env.Db,
 			suite.Env.Cache,
 			suite.Env.Config,
@@ -157,7 +160,7 @@ func (suite *BotSuite) TestReturnsDefaultMessage() {
 		},
 	}
 
-	response := bot.BuildResponse(incMessage)
+	response := bot.BuildResponse(context.Background(), incMessage)
 	assert.Equal(suite.T(), convo.BotResponse("This is a default message"), response)
 }
 
@@ -185,7 +188,7 @@ func (suite *BotSuite) TestReturnsErrorMessage() {
 	witMock.BaseURL = witServer.URL
 
 	bot := &Bot{
-		&Env{
+		env: &Env{
 			suite.Env.Db,
 			suite.Env.Cache,
 			suite.Env.Config,
@@ -197,9 +200,9 @@ func (suite *BotSuite) TestReturnsErrorMessage() {
 
 	cacheKey := fmt.Sprintf("%s_password", strconv.Itoa(int(mocks.TestUserID)))
 	password, _ := crypto.Encrypt("my-password", suite.Env.Config.SecretKey)
-	suite.Env.Cache.Set(cacheKey, password, 180)
+	suite.Env.Cache.Set(context.Background(), cacheKey, password, 180)
 
-	response := bot.BuildResponse(incMessage)
+	response := bot.BuildResponse(context.Background(), incMessage)
 	assert.Equal(suite.T(), convo.BotResponse("Whoops!"), response)
 }
 
@@ -222,7 +225,7 @@ func (suite *BotSuite) TestReceivesRespondsWithTelegram() {
 	defer witServer.Close()
 
 	bot := &Bot{
-		&Env{
+		env: &Env{
 			suite.Env.Db,
 			sessionMock,
 			suite.Env.Config,
@@ -232,13 +235,102 @@ func (suite *BotSuite) TestReceivesRespondsWithTelegram() {
 		},
 	}
 
-	bot.Converse(message)
+	bot.Converse(context.Background(), message)
 	assert.Equal(suite.T(), 1, telegramMock.Calls.Send)
 }
 
+func (suite *BotSuite) TestSkipsDuplicateUpdates() {
+	telegramMock := &mocks.TelegramMock{}
+	witClient := wit.NewClient("")
+	alphapointClient := alphapoint.NewClient("")
+
+	message := mocks.GetMockMessage("")
+	witResponse := `{
+		"entities": {
+			"amount": [],
+			"datetime": [],
+			"description": []
+		}
+	}`
+	witServer := mocks.MakeTestServer(witResponse)
+	witClient.BaseURL = witServer.URL
+	defer witServer.Close()
+
+	bot := &Bot{
+		env: &Env{
+			suite.Env.Db,
+			suite.Env.Cache,
+			suite.Env.Config,
+			telegramMock,
+			witClient,
+			alphapointClient,
+		},
+	}
+
+	// Telegram retries an update it believes was not delivered
+	bot.Converse(context.Background(), message)
+	bot.Converse(context.Background(), message)
+	assert.Equal(suite.T(), 1, telegramMock.Calls.Send)
+}
+
+func (suite *BotSuite) TestRetriesUpdatesItFailedToAnswer() {
+	telegramMock := &mocks.TelegramMock{SendStatus: 500}
+	witClient := wit.NewClient("")
+	alphapointClient := alphapoint.NewClient("")
+
+	message := mocks.GetMockMessage("")
+	witResponse := `{
+		"entities": {
+			"amount": [],
+			"datetime": [],
+			"description": []
+		}
+	}`
+	witServer := mocks.MakeTestServer(witResponse)
+	witClient.BaseURL = witServer.URL
+	defer witServer.Close()
+
+	bot := &Bot{
+		env: &Env{
+			suite.Env.Db,
+			suite.Env.Cache,
+			suite.Env.Config,
+			telegramMock,
+			witClient,
+			alphapointClient,
+		},
+	}
+
+	statusCode := bot.Converse(context.Background(), message)
+	assert.Equal(suite.T(), 500, statusCode)
+
+	telegramMock.SendStatus = 200
+	statusCode = bot.Converse(context.Background(), message)
+	assert.Equal(suite.T(), 200, statusCode)
+	assert.Equal(suite.T(), 2, telegramMock.Calls.Send)
+}
+
+func (suite *BotSuite) TestRejectsUpdatesWithoutID() {
+	telegramMock := &mocks.TelegramMock{}
+	bot := &Bot{
+		env: &Env{
+			suite.Env.Db,
+			suite.Env.Cache,
+			suite.Env.Config,
+			telegramMock,
+			&wit.Client{},
+			&alphapoint.Client{},
+		},
+	}
+
+	statusCode := bot.Converse(context.Background(), []byte(`{"message": {"text": "hello"}}`))
+	assert.Equal(suite.T(), 400, statusCode)
+	assert.Equal(suite.T(), 0, telegramMock.Calls.Send)
+}
+
 func (suite *BotSuite) TestReceivesIncomingMessage() {
 	bot := &Bot{
-		&Env{
+		env: &Env{
 			suite.Env.Db,
 			suite.Env.Cache,
 			suite.Env.Config,
@@ -265,7 +357,7 @@ func (suite *BotSuite) TestSendsOutgoingMessage() {
 	defer telegramServer.Close()
 
 	bot := &Bot{
-		&Env{
+		env: &Env{
 			suite.Env.Db,
 			suite.Env.Cache,
 			suite.Env.Config,
@@ -280,7 +372,7 @@ func (suite *BotSuite) TestSendsOutgoingMessage() {
 	var incMessage telegram.IncomingMessage
 	json.Unmarshal(message, &incMessage)
 
-	statusCode := bot.SendMessage(response, incMessage)
+	statusCode := bot.SendMessage(context.Background(), response, incMessage)
 	assert.Equal(suite.T(), 200, statusCode)
 }
 
@@ -291,7 +383,7 @@ func (suite *BotSuite) TestSendsTypingIndicator() {
 	defer telegramServer.Close()
 
 	bot := &Bot{
-		&Env{
+		env: &Env{
 			suite.Env.Db,
 			suite.Env.Cache,
 			suite.Env.Config,
@@ -304,7 +396,7 @@ func (suite *BotSuite) TestSendsTypingIndicator() {
 	var incMessage telegram.IncomingMessage
 	json.Unmarshal(message, &incMessage)
 
-	statusCode := bot.SendTypingIndicator(incMessage)
+	statusCode := bot.SendTypingIndicator(context.Background(), incMessage)
 	assert.Equal(suite.T(), 200, statusCode)
 }
 
@@ -0,0 +1,130 @@
+package conversation
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	a "github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/crypto"
+	"github.com/fmitra/dennis-bot/pkg/users"
+)
+
+// ChangePassword is an Intent designed to replace a user's password.
+type ChangePassword struct {
+	*Conversation
+	actions *a.Actions
+}
+
+// passwordChange is the auxiliary data we hold on to while the user confirms
+// their new password. Passwords are encrypted with the app secret key.
+type passwordChange struct {
+	OldPassword string
+	NewPassword string
+}
+
+// GetResponses returns a list of functions each containing a BotResponse.
+func (i *ChangePassword) GetResponses() []func() (BotResponse, error) {
+	return []func() (BotResponse, error){
+		i.AskForOldPassword,
+		i.ValidateOldPassword,
+		i.AskForNewPassword,
+		i.ConfirmNewPassword,
+		i.SavePassword,
+	}
+}
+
+// AskForOldPassword requests the user for their current password.
+func (i *ChangePassword) AskForOldPassword() (BotResponse, error) {
+	return GetMessage(ChangePasswordAskForOld, ""), nil
+}
+
+// ValidateOldPassword checks if the supplied password is the user's current
+// password. It will return an empty response and nil error on success, triggering
+// the bot to skip over to the next response function in line.
+func (i *ChangePassword) ValidateOldPassword() (BotResponse, error) {
+	password := i.IncMessage.GetMessage()
+	if strings.ToLower(strings.TrimSpace(password)) == "cancel" {
+		i.EndConversation()
+		return GetMessage(ConversationCancelled, ""), errors.New("user requested cancel")
+	}
+
+	manager := users.NewUserManager(i.actions.Db)
+	user := manager.GetByTelegramID(i.IncMessage.GetUser().ID)
+	if err := user.ValidatePassword(password); err != nil {
+		return GetMessage(ChangePasswordInvalidOld, ""), errors.New("password invalid")
+	}
+
+	encryptedPass, err := crypto.Encrypt(password, i.actions.Config.SecretKey)
+	if err != nil {
+		i.EndConversation()
+		return GetMessage(ChangePasswordFailed, ""), err
+	}
+
+	auxData, _ := json.Marshal(passwordChange{OldPassword: encryptedPass})
+	i.AuxData = string(auxData)
+	return i.SkipResponse()
+}
+
+// AskForNewPassword requests the user for their new password.
+func (i *ChangePassword) AskForNewPassword() (BotResponse, error) {
+	return GetMessage(ChangePasswordAskForNew, ""), nil
+}
+
+// ConfirmNewPassword requests the user to confirm if the new password they
+// submitted is final.
+func (i *ChangePassword) ConfirmNewPassword() (BotResponse, error) {
+	password := i.IncMessage.GetMessage()
+	encryptedPass, err := crypto.Encrypt(password, i.actions.Config.SecretKey)
+	if err != nil {
+		i.EndConversation()
+		return GetMessage(ChangePasswordFailed, ""), err
+	}
+
+	var change passwordChange
+	json.Unmarshal([]byte(i.AuxData), &change)
+	change.NewPassword = encryptedPass
+	auxData, _ := json.Marshal(change)
+	i.AuxData = string(auxData)
+
+	return GetMessage(ChangePasswordConfirmNew, password), nil
+}
+
+// SavePassword replaces the user's password if they confirmed their new password.
+// Cached passwords are removed so the old password can no longer be used.
+func (i *ChangePassword) SavePassword() (BotResponse, error) {
+	userInput := strings.ToLower(i.IncMessage.GetMessage())
+
+	isConfirmed := userInput == "yes"
+	isRejected := userInput == "no"
+	if !isConfirmed && !isRejected {
+		return GetMessage(ConfirmationInvalid, ""), errors.New("response invalid")
+	}
+
+	i.EndConversation()
+	if isRejected {
+		return GetMessage(ConversationCancelled, ""), errors.New("password rejected")
+	}
+
+	var change passwordChange
+	json.Unmarshal([]byte(i.AuxData), &change)
+
+	secretKey := i.actions.Config.SecretKey
+	oldPassword, err := crypto.Decrypt(change.OldPassword, secretKey)
+	if err != nil {
+		return GetMessage(ChangePasswordFailed, ""), err
+	}
+
+	newPassword, err := crypto.Decrypt(change.NewPassword, secretKey)
+	if err != nil {
+		return GetMessage(ChangePasswordFailed, ""), err
+	}
+
+	err = i.actions.ChangePassword(i.BotUserID, oldPassword, newPassword)
+	if err != nil {
+		return GetMessage(ChangePasswordFailed, ""), err
+	}
+
+	i.actions.Cache.Delete(i.Context(), passwordCacheKey(i.IncMessage.GetUser().ID))
+	return GetMessage(ChangePasswordSuccess, ""), nil
+}
@@ -0,0 +1,151 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+	"github.com/fmitra/dennis-bot/pkg/crypto"
+	"github.com/fmitra/dennis-bot/pkg/telegram"
+	"github.com/fmitra/dennis-bot/pkg/users"
+	mocks "github.com/fmitra/dennis-bot/test"
+)
+
+type ChangePasswordSuite struct {
+	suite.Suite
+	Env    *mocks.TestEnv
+	Action *actions.Actions
+}
+
+func (suite *ChangePasswordSuite) SetupSuite() {
+	configFile := "../../config/config.json"
+	suite.Env = mocks.GetTestEnv(configFile)
+	suite.Action = &actions.Actions{
+		Db:     suite.Env.Db,
+		Cache:  suite.Env.Cache,
+		Config: suite.Env.Config,
+		Rates:  &alphapoint.Client{},
+	}
+}
+
+func (suite *ChangePasswordSuite) TearDownSuite() {
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *ChangePasswordSuite) BeforeTest(suiteName, testName string) {
+	MessageMap = mocks.MessageMapMock
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *ChangePasswordSuite) TestGetResponseList() {
+	changePassword := &ChangePassword{}
+	assert.Equal(suite.T(), 5, len(changePassword.GetResponses()))
+}
+
+func (suite *ChangePasswordSuite) TestChangesPassword() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("")
+	json.Unmarshal(message, &incMessage)
+
+	suite.Action.CreateNewUser(mocks.TestUserID, "my-password")
+	manager := users.NewUserManager(suite.Env.Db)
+	user := manager.GetByTelegramID(mocks.TestUserID)
+	originalKey, _ := user.GetPrivateKey("my-password")
+
+	cacheKey := fmt.Sprintf("%s_password", strconv.Itoa(int(mocks.TestUserID)))
+	encryptedPass, _ := crypto.Encrypt("my-password", suite.Env.Config.SecretKey)
+	suite.Env.Cache.Set(context.Background(), cacheKey, encryptedPass, 180)
+
+	changePassword := &ChangePassword{
+		&Conversation{
+			IncMessage: incMessage,
+			BotUserID:  user.ID,
+		},
+		suite.Action,
+	}
+	responses := changePassword.GetResponses()
+
+	reply := func(text string) BotResponse {
+		message := mocks.GetMockMessage(text)
+		json.Unmarshal(message, &incMessage)
+		changePassword.IncMessage = incMessage
+		return changePassword.ProcessResponses(responses)
+	}
+
+	response := changePassword.ProcessResponses(responses)
+	assert.Equal(suite.T(), BotResponse("Current password?"), response)
+
+	response = reply("not-my-password")
+	assert.Equal(suite.T(), BotResponse("Wrong current password"), response)
+
+	response = reply("my-password")
+	assert.Equal(suite.T(), BotResponse("New password?"), response)
+
+	response = reply("new-password")
+	assert.Equal(suite.T(), BotResponse("New password is new-password?"), response)
+
+	response = reply("maybe")
+	assert.Equal(suite.T(), BotResponse("Please say yes or no"), response)
+
+	response = reply("yes")
+	assert.Equal(suite.T(), BotResponse("Password changed"), response)
+	assert.Equal(suite.T(), -1, changePassword.Step)
+
+	user = manager.GetByID(user.ID)
+	privateKey, err := user.GetPrivateKey("new-password")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), originalKey.D, privateKey.D)
+
+	var cachedPassword string
+	err = suite.Env.Cache.Get(context.Background(), cacheKey, &cachedPassword)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ChangePasswordSuite) TestRejectsNewPassword() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("no")
+	json.Unmarshal(message, &incMessage)
+
+	changePassword := &ChangePassword{
+		&Conversation{
+			Step:       4,
+			IncMessage: incMessage,
+		},
+		suite.Action,
+	}
+
+	response, err := changePassword.SavePassword()
+	assert.EqualError(suite.T(), err, "password rejected")
+	assert.Equal(suite.T(), BotResponse("Ok, never mind"), response)
+	assert.Equal(suite.T(), -1, changePassword.Step)
+}
+
+func (suite *ChangePasswordSuite) TestCancelsPasswordChange() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage(" Cancel ")
+	json.Unmarshal(message, &incMessage)
+
+	changePassword := &ChangePassword{
+		&Conversation{
+			Step:       1,
+			IncMessage: incMessage,
+		},
+		suite.Action,
+	}
+
+	response, err := changePassword.ValidateOldPassword()
+	assert.EqualError(suite.T(), err, "user requested cancel")
+	assert.Equal(suite.T(), BotResponse("Ok, never mind"), response)
+	assert.Equal(suite.T(), -1, changePassword.Step)
+}
+
+func TestChangePasswordSuite(t *testing.T) {
+	suite.Run(t, new(ChangePasswordSuite))
+}
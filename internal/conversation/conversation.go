@@ -3,15 +3,16 @@
 package conversation
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
 
 	"github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/nlu"
 	"github.com/fmitra/dennis-bot/pkg/sessions"
 	t "github.com/fmitra/dennis-bot/pkg/telegram"
 	"github.com/fmitra/dennis-bot/pkg/users"
-	"github.com/fmitra/dennis-bot/pkg/wit"
 )
 
 const (
@@ -25,6 +26,31 @@ const (
 	// GetExpenseTotalIntent is an intent to returns total expense
 	// history for the user
 	GetExpenseTotalIntent = "get_expense_total_intent"
+
+	// GetCategoryTotalIntent is an intent to return total expense history
+	// for one or all categories
+	GetCategoryTotalIntent = "get_category_total_intent"
+
+	// GetExpenseListIntent is an intent to retrieve an itemized list of expense history
+	GetExpenseListIntent = "get_expense_list_intent"
+
+	// ManageSettingsIntent is an intent to show or change a user's settings
+	ManageSettingsIntent = "manage_settings_intent"
+
+	// ChangePasswordIntent is an intent to replace a user's password
+	ChangePasswordIntent = "change_password_intent"
+
+	// ResetPasswordIntent is an intent to reset a forgotten password with a recovery code
+	ResetPasswordIntent = "reset_password_intent"
+
+	// UndoExpenseIntent is an intent to remove the last tracked expense
+	UndoExpenseIntent = "undo_expense_intent"
+
+	// DeleteExpenseIntent is an intent to remove a recently tracked expense
+	DeleteExpenseIntent = "delete_expense_intent"
+
+	// EditExpenseIntent is an intent to change the last tracked expense
+	EditExpenseIntent = "edit_expense_intent"
 )
 
 // Intent describe the objective of a user. They are responsible for the
@@ -40,19 +66,34 @@ type Intent interface {
 // may have just recently been initialized or may be ongoing. Conversations instantiate
 // structs adhering to the Intent interface to build responses for the user.
 type Conversation struct {
-	IntentType  string            // String representing the the Intent of the user
-	UserID      uint              // The user ID from the incoming chat service (ex. Telegram User ID)
-	BotUserID   uint              // The ID of the user account (if it exists) in our system
-	Step        int               // A user's place in a conversation
-	AuxData     string            // Optional auxiliary info that we can set while processing a response
-	WitResponse wit.Response      // Wit.ai API response to a user's message
-	IncMessage  t.IncomingMessage // Raw user message as received by Telegram
+	IntentType string            // String representing the the Intent of the user
+	UserID     uint              // The user ID from the incoming chat service (ex. Telegram User ID)
+	BotUserID  uint              // The ID of the user account (if it exists) in our system
+	Step       int               // A user's place in a conversation
+	AuxData    string            // Optional auxiliary info that we can set while processing a response
+	Message    nlu.Message       // NLU backend's parsing of a user's message
+	IncMessage t.IncomingMessage // Raw user message as received by Telegram
+
+	// Context of the request being responded to. Conversations are cached
+	// between requests, so the context is set for each request and never
+	// cached with the Conversation.
+	ctx context.Context
+}
+
+// Context returns the context of the request the Conversation is responding
+// to. Intents pass it on to their actions so a response stops waiting on the
+// network once the request is cancelled.
+func (c *Conversation) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
 }
 
-// SetLastUserMessage sets the most recently received telegram message and Wit.ai
+// SetLastUserMessage sets the most recently received telegram message and NLU
 // parsing of the message to the Conversation struct.
-func (c *Conversation) SetLastUserMessage(w wit.Response, inc t.IncomingMessage) {
-	c.WitResponse = w
+func (c *Conversation) SetLastUserMessage(m nlu.Message, inc t.IncomingMessage) {
+	c.Message = m
 	c.IncMessage = inc
 }
 
@@ -114,6 +155,22 @@ func (c *Conversation) GetIntent(a *actions.Actions) Intent {
 		return &TrackExpense{c, a}
 	case GetExpenseTotalIntent:
 		return &GetExpenseTotal{c, a}
+	case GetCategoryTotalIntent:
+		return &GetCategoryTotal{c, a}
+	case GetExpenseListIntent:
+		return &GetExpenseList{c, a}
+	case ManageSettingsIntent:
+		return &ManageSettings{c, a}
+	case ChangePasswordIntent:
+		return &ChangePassword{c, a}
+	case ResetPasswordIntent:
+		return &ResetPassword{c, a}
+	case UndoExpenseIntent:
+		return &UndoExpense{c, a}
+	case DeleteExpenseIntent:
+		return &DeleteExpense{c, a}
+	case EditExpenseIntent:
+		return &EditExpense{c, a}
 	default:
 		return &GenericResponse{c, a}
 	}
@@ -132,7 +189,7 @@ func (c *Conversation) Respond(a *actions.Actions) BotResponse {
 }
 
 // InferIntent determines which Intent to instantiate for the Conversation.
-func InferIntent(w wit.Response, botUserID uint) string {
+func InferIntent(m nlu.Message, botUserID uint) string {
 	// We can only process a user's request if they have an account
 	// in our system, otherwise we force them into an onboarding flow.
 	noID := 0
@@ -140,14 +197,29 @@ func InferIntent(w wit.Response, botUserID uint) string {
 		return OnboardUserIntent
 	}
 
-	overview := w.GetMessageOverview()
-	switch overview {
-	case wit.TrackingRequestedSuccess:
-		return TrackExpenseIntent
-	case wit.TrackingRequestedError:
+	switch m.Intent {
+	case nlu.TrackExpense:
 		return TrackExpenseIntent
-	case wit.ExpenseTotalRequestedSuccess:
+	case nlu.ExpenseTotal:
 		return GetExpenseTotalIntent
+	case nlu.CategoryTotal:
+		return GetCategoryTotalIntent
+	case nlu.ExpenseList:
+		return GetExpenseListIntent
+	case nlu.ShowSettings:
+		return ManageSettingsIntent
+	case nlu.ChangeSetting:
+		return ManageSettingsIntent
+	case nlu.ChangePassword:
+		return ChangePasswordIntent
+	case nlu.ResetPassword:
+		return ResetPasswordIntent
+	case nlu.UndoExpense:
+		return UndoExpenseIntent
+	case nlu.DeleteExpense:
+		return DeleteExpenseIntent
+	case nlu.EditExpense:
+		return EditExpenseIntent
 	default:
 		return ""
 	}
@@ -156,11 +228,11 @@ func InferIntent(w wit.Response, botUserID uint) string {
 // NewConversation creates a new conversation between the bot and the user. If the user
 // has an existing account, we associate their account ID with the user
 // ID of their chat service.
-func NewConversation(userID uint, w wit.Response, a *actions.Actions) Conversation {
+func NewConversation(userID uint, m nlu.Message, a *actions.Actions) Conversation {
 	manager := users.NewUserManager(a.Db)
 	botUser := manager.GetByTelegramID(userID)
 
-	intent := InferIntent(w, botUser.ID)
+	intent := InferIntent(m, botUser.ID)
 	conversation := Conversation{
 		IntentType: intent,
 		UserID:     userID,
@@ -171,10 +243,10 @@ func NewConversation(userID uint, w wit.Response, a *actions.Actions) Conversati
 }
 
 // GetConversation checks if an ongoing Conversation exists in the cache.
-func GetConversation(userID uint, cache sessions.Session) (Conversation, error) {
+func GetConversation(ctx context.Context, userID uint, cache sessions.Session) (Conversation, error) {
 	var conversation Conversation
 	cacheKey := fmt.Sprintf("%s_conversation", strconv.Itoa(int(userID)))
-	err := cache.Get(cacheKey, &conversation)
+	err := cache.Get(ctx, cacheKey, &conversation)
 	if err != nil {
 		return conversation, errors.New("no conversation found")
 	}
@@ -187,15 +259,16 @@ func GetConversation(userID uint, cache sessions.Session) (Conversation, error)
 
 // GetResponse creates or retrieves a Conversation in order to return the
 // next available response.
-func GetResponse(w wit.Response, inc t.IncomingMessage, a *actions.Actions) BotResponse {
+func GetResponse(ctx context.Context, m nlu.Message, inc t.IncomingMessage, a *actions.Actions) BotResponse {
 	userID := inc.GetUser().ID
 
-	conversation, err := GetConversation(userID, a.Cache)
+	conversation, err := GetConversation(ctx, userID, a.Cache)
 	if err != nil {
-		conversation = NewConversation(userID, w, a)
+		conversation = NewConversation(userID, m, a)
 	}
 
-	conversation.SetLastUserMessage(w, inc)
+	conversation.ctx = ctx
+	conversation.SetLastUserMessage(m, inc)
 	response := conversation.Respond(a)
 
 	// Check if there are additional responses available. If responses are found,
@@ -203,9 +276,9 @@ func GetResponse(w wit.Response, inc t.IncomingMessage, a *actions.Actions) BotR
 	cacheKey := fmt.Sprintf("%s_conversation", strconv.Itoa(int(userID)))
 	if conversation.HasResponse() {
 		threeMinutes := 180
-		a.Cache.Set(cacheKey, conversation, threeMinutes)
+		a.Cache.Set(ctx, cacheKey, conversation, threeMinutes)
 	} else {
-		a.Cache.Delete(cacheKey)
+		a.Cache.Delete(ctx, cacheKey)
 	}
 
 	return response
@@ -1,6 +1,7 @@
 package conversation
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -11,8 +12,8 @@ import (
 
 	"github.com/fmitra/dennis-bot/internal/actions"
 	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+	"github.com/fmitra/dennis-bot/pkg/nlu"
 	"github.com/fmitra/dennis-bot/pkg/telegram"
-	"github.com/fmitra/dennis-bot/pkg/wit"
 	mocks "github.com/fmitra/dennis-bot/test"
 )
 
@@ -50,103 +51,55 @@ func (suite *ConvoSuite) TestReturnsBooleanForResponseCheck() {
 }
 
 func (suite *ConvoSuite) TestCreatesNewConversation() {
-	rawWitResponse := []byte(`{
-		"entities": {
-			"amount": [
-				{ "value": "20 SGD", "confidence": 100.00 }
-			],
-			"datetime": [
-				{ "value": "", "confidence": 100.00 }
-			],
-			"description": [
-				{ "value": "Food", "confidence": 100.00 }
-			]
-		}
-	}`)
-	var witResponse wit.Response
-	json.Unmarshal(rawWitResponse, &witResponse)
+	message := nlu.Message{
+		Intent:      nlu.TrackExpense,
+		Amount:      20,
+		Currency:    "SGD",
+		Description: "Food",
+	}
 	action := &actions.Actions{
 		Db: suite.Env.Db,
 	}
 
-	conversation := NewConversation(mocks.TestUserID, witResponse, action)
+	conversation := NewConversation(mocks.TestUserID, message, action)
 	assert.Equal(suite.T(), mocks.TestUserID, conversation.UserID)
 	assert.Equal(suite.T(), OnboardUserIntent, conversation.IntentType)
 }
 
-func (suite *ConvoSuite) TestInfersUserIntentFromWitResponse() {
-	var rawWitResponse []byte
-	var witResponse wit.Response
-
-	rawWitResponse = []byte(`{
-		"entities": {
-			"amount": [
-				{ "value": "20 SGD", "confidence": 100.00 }
-			],
-			"datetime": [
-				{ "value": "", "confidence": 100.00 }
-			],
-			"description": [
-				{ "value": "Food", "confidence": 100.00 }
-			]
-		}
-	}`)
-	json.Unmarshal(rawWitResponse, &witResponse)
-	assert.Equal(suite.T(), OnboardUserIntent, InferIntent(witResponse, uint(0)))
-
-	rawWitResponse = []byte(`{
-		"entities": {
-			"amount": [
-				{ "value": "20 SGD", "confidence": 100.00 }
-			],
-			"datetime": [
-				{ "value": "", "confidence": 100.00 }
-			],
-			"description": [
-				{ "value": "Food", "confidence": 100.00 }
-			]
-		}
-	}`)
-	json.Unmarshal(rawWitResponse, &witResponse)
-	assert.Equal(suite.T(), TrackExpenseIntent, InferIntent(witResponse, uint(123)))
-
-	rawWitResponse = []byte(`{
-		"entities": {
-			"amount": [
-				{ "value": "20 SGD", "confidence": 100.00 }
-			],
-			"datetime": [
-				{ "value": "", "confidence": 100.00 }
-			],
-			"description": []
-		}
-	}`)
-	json.Unmarshal(rawWitResponse, &witResponse)
-	assert.Equal(suite.T(), TrackExpenseIntent, InferIntent(witResponse, uint(123)))
-
-	rawWitResponse = []byte(`{
-		"entities": {
-			"amount": [],
-			"datetime": [],
-			"description": [],
-			"total_spent": [
-				{ "value": "month", "confidence": 100.00 }
-			]
-		}
-	}`)
-	json.Unmarshal(rawWitResponse, &witResponse)
-	assert.Equal(suite.T(), GetExpenseTotalIntent, InferIntent(witResponse, uint(123)))
-
-	rawWitResponse = []byte(`{
-		"entities": {
-			"amount": [],
-			"datetime": [],
-			"description": [],
-			"total_spent": []
-		}
-	}`)
-	json.Unmarshal(rawWitResponse, &witResponse)
-	assert.Equal(suite.T(), "", InferIntent(witResponse, uint(123)))
+func (suite *ConvoSuite) TestInfersUserIntentFromMessage() {
+	message := nlu.Message{
+		Intent:      nlu.TrackExpense,
+		Amount:      20,
+		Currency:    "SGD",
+		Description: "Food",
+	}
+	assert.Equal(suite.T(), OnboardUserIntent, InferIntent(message, uint(0)))
+	assert.Equal(suite.T(), TrackExpenseIntent, InferIntent(message, uint(123)))
+
+	message = nlu.Message{Intent: nlu.TrackExpense, Amount: 20, Currency: "SGD"}
+	assert.Equal(suite.T(), TrackExpenseIntent, InferIntent(message, uint(123)))
+
+	var testCases = []struct {
+		intent   string
+		expected string
+	}{
+		{nlu.ExpenseTotal, GetExpenseTotalIntent},
+		{nlu.CategoryTotal, GetCategoryTotalIntent},
+		{nlu.ExpenseList, GetExpenseListIntent},
+		{nlu.ShowSettings, ManageSettingsIntent},
+		{nlu.ChangeSetting, ManageSettingsIntent},
+		{nlu.ChangePassword, ChangePasswordIntent},
+		{nlu.ResetPassword, ResetPasswordIntent},
+		{nlu.UndoExpense, UndoExpenseIntent},
+		{nlu.DeleteExpense, DeleteExpenseIntent},
+		{nlu.EditExpense, EditExpenseIntent},
+		{nlu.Unknown, ""},
+	}
+
+	for _, test := range testCases {
+		message = nlu.Message{Intent: test.intent}
+		assert.Equal(suite.T(), test.expected, InferIntent(message, uint(123)), test.intent)
+	}
 }
 
 func (suite *ConvoSuite) TestGetsConversationFromCache() {
@@ -158,8 +111,8 @@ func (suite *ConvoSuite) TestGetsConversationFromCache() {
 	cacheKey := fmt.Sprintf("%s_conversation", strconv.Itoa(int(mocks.TestUserID)))
 
 	oneMinute := 60
-	cache.Set(cacheKey, conversation, oneMinute)
-	cachedConversation, err := GetConversation(mocks.TestUserID, cache)
+	cache.Set(context.Background(), cacheKey, conversation, oneMinute)
+	cachedConversation, err := GetConversation(context.Background(), mocks.TestUserID, cache)
 
 	assert.NoError(suite.T(), err)
 	assert.Equal(suite.T(), conversation, cachedConversation)
@@ -167,7 +120,7 @@ func (suite *ConvoSuite) TestGetsConversationFromCache() {
 
 func (suite *ConvoSuite) TestReturnsErrorFetchingFromCache() {
 	cache := suite.Env.Cache
-	cachedConversation, err := GetConversation(mocks.TestUserID, cache)
+	cachedConversation, err := GetConversation(context.Background(), mocks.TestUserID, cache)
 	assert.EqualError(suite.T(), err, "no conversation found")
 	assert.Equal(suite.T(), cachedConversation, Conversation{})
 
@@ -178,8 +131,8 @@ func (suite *ConvoSuite) TestReturnsErrorFetchingFromCache() {
 	}
 	cacheKey := fmt.Sprintf("%s_conversation", strconv.Itoa(int(mocks.TestUserID)))
 	oneMinute := 60
-	cache.Set(cacheKey, conversation, oneMinute)
-	_, err = GetConversation(mocks.TestUserID, cache)
+	cache.Set(context.Background(), cacheKey, conversation, oneMinute)
+	_, err = GetConversation(context.Background(), mocks.TestUserID, cache)
 	assert.EqualError(suite.T(), err, "no responses available")
 }
 
@@ -196,12 +149,12 @@ func (suite *ConvoSuite) TestGetResponseInCorrectOrder() {
 		IntentType: OnboardUserIntent,
 	}
 	a := &actions.Actions{
-		Db:         suite.Env.Db,
-		Cache:      suite.Env.Cache,
-		Config:     suite.Env.Config,
-		Alphapoint: &alphapoint.Client{},
+		Db:     suite.Env.Db,
+		Cache:  suite.Env.Cache,
+		Config: suite.Env.Config,
+		Rates:  &alphapoint.Client{},
 	}
-	witResponse := wit.Response{}
+	nluMessage := nlu.Message{}
 	incMessage := telegram.IncomingMessage{}
 	message := mocks.GetMockMessage("")
 	json.Unmarshal(message, &incMessage)
@@ -210,7 +163,7 @@ func (suite *ConvoSuite) TestGetResponseInCorrectOrder() {
 	assert.Equal(suite.T(), 0, conversation.Step)
 
 	// First response requests password
-	conversation.SetLastUserMessage(witResponse, incMessage)
+	conversation.SetLastUserMessage(nluMessage, incMessage)
 	response := conversation.Respond(a)
 	assert.Equal(suite.T(), BotResponse("What's your password?"), response)
 	assert.Equal(suite.T(), 1, conversation.Step)
@@ -218,7 +171,7 @@ func (suite *ConvoSuite) TestGetResponseInCorrectOrder() {
 	// Second response requests confirmation
 	message = mocks.GetMockMessage("foo")
 	json.Unmarshal(message, &incMessage)
-	conversation.SetLastUserMessage(witResponse, incMessage)
+	conversation.SetLastUserMessage(nluMessage, incMessage)
 	response = conversation.Respond(a)
 	assert.Equal(suite.T(), BotResponse("Your password is foo"), response)
 	assert.Equal(suite.T(), 2, conversation.Step)
@@ -226,7 +179,7 @@ func (suite *ConvoSuite) TestGetResponseInCorrectOrder() {
 	// Invalid response prevents user from reaching step 3
 	message = mocks.GetMockMessage("invalid answer")
 	json.Unmarshal(message, &incMessage)
-	conversation.SetLastUserMessage(witResponse, incMessage)
+	conversation.SetLastUserMessage(nluMessage, incMessage)
 	response = conversation.Respond(a)
 	assert.Equal(suite.T(), BotResponse("I didn't understand that"), response)
 	assert.Equal(suite.T(), 2, conversation.Step)
@@ -234,7 +187,7 @@ func (suite *ConvoSuite) TestGetResponseInCorrectOrder() {
 	// Answering no to password confirmation ends the conversation
 	message = mocks.GetMockMessage("No")
 	json.Unmarshal(message, &incMessage)
-	conversation.SetLastUserMessage(witResponse, incMessage)
+	conversation.SetLastUserMessage(nluMessage, incMessage)
 	response = conversation.Respond(a)
 	assert.Equal(suite.T(), BotResponse("Okay try again later"), response)
 	assert.Equal(suite.T(), -1, conversation.Step)
@@ -242,7 +195,7 @@ func (suite *ConvoSuite) TestGetResponseInCorrectOrder() {
 	// After receiving a negative step, all future responses are empty
 	message = mocks.GetMockMessage("Hello?")
 	json.Unmarshal(message, &incMessage)
-	conversation.SetLastUserMessage(witResponse, incMessage)
+	conversation.SetLastUserMessage(nluMessage, incMessage)
 	response = conversation.Respond(a)
 	assert.Equal(suite.T(), BotResponse(""), response)
 	assert.Equal(suite.T(), -1, conversation.Step)
@@ -254,7 +207,7 @@ func (suite *ConvoSuite) TestGetResponseInCorrectOrder() {
 	// reset the step to -1 to end the conversation
 	message = mocks.GetMockMessage("Yes")
 	json.Unmarshal(message, &incMessage)
-	conversation.SetLastUserMessage(witResponse, incMessage)
+	conversation.SetLastUserMessage(nluMessage, incMessage)
 	response = conversation.Respond(a)
 	assert.Equal(suite.T(), BotResponse("Outro message"), response)
 	assert.Equal(suite.T(), -1, conversation.Step)
@@ -266,15 +219,15 @@ func (suite *ConvoSuite) TestCachesConversationsWithRemainingResponses() {
 		Cache: suite.Env.Cache,
 		Db:    suite.Env.Db,
 	}
-	witResponse := wit.Response{}
+	nluMessage := nlu.Message{}
 	incMessage := telegram.IncomingMessage{}
 	message := mocks.GetMockMessage("")
 	json.Unmarshal(message, &incMessage)
 
-	GetResponse(witResponse, incMessage, a)
+	GetResponse(context.Background(), nluMessage, incMessage, a)
 
 	var cachedConvo Conversation
-	suite.Env.Cache.Get(cacheKey, &cachedConvo)
+	suite.Env.Cache.Get(context.Background(), cacheKey, &cachedConvo)
 	assert.Equal(suite.T(), OnboardUserIntent, cachedConvo.IntentType)
 }
 
@@ -0,0 +1,98 @@
+package conversation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	a "github.com/fmitra/dennis-bot/internal/actions"
+)
+
+// recentExpenseLimit is the number of recent expenses a user may choose
+// from when deleting an expense.
+const recentExpenseLimit = 5
+
+// DeleteExpense is an Intent designed to remove an expense the user chooses
+// from a list of their recent expenses.
+type DeleteExpense struct {
+	*Conversation
+	actions *a.Actions
+}
+
+// GetResponses returns a list of functions each containing a BotResponse.
+func (i *DeleteExpense) GetResponses() []func() (BotResponse, error) {
+	return []func() (BotResponse, error){
+		i.AskForPassword,
+		i.ValidatePassword,
+		i.ListExpenses,
+		i.RemoveExpense,
+	}
+}
+
+// AskForPassword requests a user for their password. Recent expenses must be
+// decrypted for the user to choose from.
+func (i *DeleteExpense) AskForPassword() (BotResponse, error) {
+	return askForPassword(i.Conversation, i.actions)
+}
+
+// ValidatePassword checks if the supplied password in a previous message is correct.
+func (i *DeleteExpense) ValidatePassword() (BotResponse, error) {
+	return validatePassword(i.Conversation, i.actions)
+}
+
+// ListExpenses returns a numbered list of recent expenses for the user to choose from.
+// Expense IDs are held in auxiliary data so we can map the user's choice back to an
+// expense in the next step.
+func (i *DeleteExpense) ListExpenses() (BotResponse, error) {
+	privateKey, err := privateKeyInCache(i.Conversation, i.actions)
+	if err != nil {
+		i.EndConversation()
+		return GetMessage(GetExpenseTotalError, ""), err
+	}
+
+	recentExpenses, err := i.actions.GetRecentExpenses(i.BotUserID, recentExpenseLimit, privateKey)
+	if err != nil {
+		i.EndConversation()
+		return GetMessage(UndoExpenseNotFound, ""), err
+	}
+
+	expenseIDs := []uint{}
+	lines := []string{}
+	for n, expense := range recentExpenses {
+		expenseIDs = append(expenseIDs, expense.ID)
+		lines = append(lines, fmt.Sprintf("%d. %s", n+1, a.FormatExpense(expense)))
+	}
+
+	auxData, _ := json.Marshal(expenseIDs)
+	i.AuxData = string(auxData)
+	return GetMessage(DeleteExpenseChoose, strings.Join(lines, "\n")), nil
+}
+
+// RemoveExpense removes the expense the user chose from the list.
+func (i *DeleteExpense) RemoveExpense() (BotResponse, error) {
+	userInput := strings.ToLower(strings.TrimSpace(i.IncMessage.GetMessage()))
+	if userInput == "cancel" {
+		i.EndConversation()
+		return GetMessage(ConversationCancelled, ""), errors.New("user requested cancel")
+	}
+
+	var expenseIDs []uint
+	if err := json.Unmarshal([]byte(i.AuxData), &expenseIDs); err != nil {
+		i.EndConversation()
+		return GetMessage(UndoExpenseError, ""), err
+	}
+
+	choice, err := strconv.Atoi(strings.TrimPrefix(userInput, "#"))
+	if err != nil || choice < 1 || choice > len(expenseIDs) {
+		return GetMessage(DeleteExpenseInvalidChoice, ""), errors.New("invalid choice")
+	}
+
+	i.EndConversation()
+	if err = i.actions.DeleteExpense(expenseIDs[choice-1], i.BotUserID); err != nil {
+		return GetMessage(UndoExpenseError, ""), err
+	}
+
+	return GetMessage(UndoExpenseSuccess, ""), nil
+}
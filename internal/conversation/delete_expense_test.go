@@ -0,0 +1,149 @@
+package conversation
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+	"github.com/fmitra/dennis-bot/pkg/telegram"
+	mocks "github.com/fmitra/dennis-bot/test"
+)
+
+type DeleteExpenseSuite struct {
+	suite.Suite
+	Env    *mocks.TestEnv
+	Action *actions.Actions
+}
+
+func (suite *DeleteExpenseSuite) SetupSuite() {
+	configFile := "../../config/config.json"
+	suite.Env = mocks.GetTestEnv(configFile)
+	suite.Action = &actions.Actions{
+		Db:     suite.Env.Db,
+		Cache:  suite.Env.Cache,
+		Config: suite.Env.Config,
+		Rates:  &alphapoint.Client{},
+	}
+}
+
+func (suite *DeleteExpenseSuite) TearDownSuite() {
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *DeleteExpenseSuite) BeforeTest(suiteName, testName string) {
+	MessageMap = mocks.MessageMapMock
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *DeleteExpenseSuite) TestGetResponseList() {
+	deleteExpense := &DeleteExpense{}
+	assert.Equal(suite.T(), 4, len(deleteExpense.GetResponses()))
+}
+
+func (suite *DeleteExpenseSuite) TestListExpensesRequiresPassword() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("")
+	json.Unmarshal(message, &incMessage)
+
+	deleteExpense := &DeleteExpense{
+		&Conversation{
+			Step:       2,
+			IncMessage: incMessage,
+		},
+		suite.Action,
+	}
+
+	response, err := deleteExpense.ListExpenses()
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), BotResponse("Whoops!"), response)
+	assert.Equal(suite.T(), -1, deleteExpense.Step)
+}
+
+func (suite *DeleteExpenseSuite) TestRemoveExpenseInvalidChoice() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("3")
+	json.Unmarshal(message, &incMessage)
+
+	deleteExpense := &DeleteExpense{
+		&Conversation{
+			Step:       3,
+			IncMessage: incMessage,
+			AuxData:    "[5,4]",
+		},
+		suite.Action,
+	}
+
+	response, err := deleteExpense.RemoveExpense()
+	assert.EqualError(suite.T(), err, "invalid choice")
+	assert.Equal(suite.T(), BotResponse("Invalid choice"), response)
+	assert.Equal(suite.T(), 3, deleteExpense.Step)
+}
+
+func (suite *DeleteExpenseSuite) TestRemoveExpenseCancelled() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("Cancel")
+	json.Unmarshal(message, &incMessage)
+
+	deleteExpense := &DeleteExpense{
+		&Conversation{
+			Step:       3,
+			IncMessage: incMessage,
+			AuxData:    "[5,4]",
+		},
+		suite.Action,
+	}
+
+	response, err := deleteExpense.RemoveExpense()
+	assert.EqualError(suite.T(), err, "user requested cancel")
+	assert.Equal(suite.T(), BotResponse("Ok, never mind"), response)
+	assert.Equal(suite.T(), -1, deleteExpense.Step)
+}
+
+func (suite *DeleteExpenseSuite) TestRemoveChosenExpenseFailure() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("2")
+	json.Unmarshal(message, &incMessage)
+
+	deleteExpense := &DeleteExpense{
+		&Conversation{
+			Step:       3,
+			IncMessage: incMessage,
+			BotUserID:  uint(200),
+			AuxData:    "[5,4]",
+		},
+		suite.Action,
+	}
+
+	response, err := deleteExpense.RemoveExpense()
+	assert.EqualError(suite.T(), err, "expense does not exist")
+	assert.Equal(suite.T(), BotResponse("Expense not removed"), response)
+	assert.Equal(suite.T(), -1, deleteExpense.Step)
+}
+
+func (suite *DeleteExpenseSuite) TestRemoveExpenseInvalidAuxData() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("1")
+	json.Unmarshal(message, &incMessage)
+
+	deleteExpense := &DeleteExpense{
+		&Conversation{
+			Step:       3,
+			IncMessage: incMessage,
+			AuxData:    "invalid",
+		},
+		suite.Action,
+	}
+
+	response, err := deleteExpense.RemoveExpense()
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), BotResponse("Expense not removed"), response)
+	assert.Equal(suite.T(), -1, deleteExpense.Step)
+}
+
+func TestDeleteExpenseSuite(t *testing.T) {
+	suite.Run(t, new(DeleteExpenseSuite))
+}
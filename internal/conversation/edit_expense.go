@@ -0,0 +1,121 @@
+package conversation
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	a "github.com/fmitra/dennis-bot/internal/actions"
+)
+
+// EditExpense is an Intent designed to change the amount, currency, description
+// or date of the last expense a user tracked.
+type EditExpense struct {
+	*Conversation
+	actions *a.Actions
+}
+
+// expenseEdit is the auxiliary data we hold on to while the user describes
+// the change they want to make.
+type expenseEdit struct {
+	ExpenseID uint
+	Field     string
+}
+
+// GetResponses returns a list of functions each containing a BotResponse.
+func (i *EditExpense) GetResponses() []func() (BotResponse, error) {
+	return []func() (BotResponse, error){
+		i.AskForPassword,
+		i.ValidatePassword,
+		i.AskForField,
+		i.ValidateField,
+		i.SaveChange,
+	}
+}
+
+// AskForPassword requests a user for their password. The last expense must be
+// decrypted before we can change it.
+func (i *EditExpense) AskForPassword() (BotResponse, error) {
+	return askForPassword(i.Conversation, i.actions)
+}
+
+// ValidatePassword checks if the supplied password in a previous message is correct.
+func (i *EditExpense) ValidatePassword() (BotResponse, error) {
+	return validatePassword(i.Conversation, i.actions)
+}
+
+// AskForField describes the last tracked expense and asks the user which
+// field they would like to change.
+func (i *EditExpense) AskForField() (BotResponse, error) {
+	privateKey, err := privateKeyInCache(i.Conversation, i.actions)
+	if err != nil {
+		i.EndConversation()
+		return GetMessage(GetExpenseTotalError, ""), err
+	}
+
+	lastExpense, err := i.actions.GetRecentExpenses(i.BotUserID, 1, privateKey)
+	if err != nil {
+		i.EndConversation()
+		return GetMessage(UndoExpenseNotFound, ""), err
+	}
+
+	auxData, _ := json.Marshal(expenseEdit{ExpenseID: lastExpense[0].ID})
+	i.AuxData = string(auxData)
+	return GetMessage(EditExpenseAskForField, a.FormatExpense(lastExpense[0])), nil
+}
+
+// ValidateField checks if the user chose a field that can be changed.
+func (i *EditExpense) ValidateField() (BotResponse, error) {
+	field := strings.ToLower(strings.TrimSpace(i.IncMessage.GetMessage()))
+	if field == "cancel" {
+		i.EndConversation()
+		return GetMessage(ConversationCancelled, ""), errors.New("user requested cancel")
+	}
+
+	switch field {
+	case a.EditAmount, a.EditCurrency, a.EditDescription, a.EditDate:
+	default:
+		return GetMessage(EditExpenseInvalidField, ""), errors.New("invalid field")
+	}
+
+	var edit expenseEdit
+	if err := json.Unmarshal([]byte(i.AuxData), &edit); err != nil {
+		i.EndConversation()
+		return GetMessage(GetExpenseTotalError, ""), err
+	}
+
+	edit.Field = field
+	auxData, _ := json.Marshal(edit)
+	i.AuxData = string(auxData)
+
+	return GetMessage(EditExpenseAskForValue, field), nil
+}
+
+// SaveChange updates the expense with the new value the user supplied.
+func (i *EditExpense) SaveChange() (BotResponse, error) {
+	value := strings.TrimSpace(i.IncMessage.GetMessage())
+	if strings.ToLower(value) == "cancel" {
+		i.EndConversation()
+		return GetMessage(ConversationCancelled, ""), errors.New("user requested cancel")
+	}
+
+	privateKey, err := privateKeyInCache(i.Conversation, i.actions)
+	if err != nil {
+		i.EndConversation()
+		return GetMessage(GetExpenseTotalError, ""), err
+	}
+
+	var edit expenseEdit
+	if err = json.Unmarshal([]byte(i.AuxData), &edit); err != nil {
+		i.EndConversation()
+		return GetMessage(GetExpenseTotalError, ""), err
+	}
+
+	err = i.actions.EditExpense(i.Context(), edit.ExpenseID, i.BotUserID, edit.Field, value, privateKey)
+	if err != nil {
+		return GetMessage(EditExpenseInvalidValue, edit.Field), err
+	}
+
+	i.EndConversation()
+	return GetMessage(EditExpenseSuccess, ""), nil
+}
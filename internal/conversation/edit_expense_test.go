@@ -0,0 +1,129 @@
+package conversation
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+	"github.com/fmitra/dennis-bot/pkg/telegram"
+	mocks "github.com/fmitra/dennis-bot/test"
+)
+
+type EditExpenseSuite struct {
+	suite.Suite
+	Env    *mocks.TestEnv
+	Action *actions.Actions
+}
+
+func (suite *EditExpenseSuite) SetupSuite() {
+	configFile := "../../config/config.json"
+	suite.Env = mocks.GetTestEnv(configFile)
+	suite.Action = &actions.Actions{
+		Db:     suite.Env.Db,
+		Cache:  suite.Env.Cache,
+		Config: suite.Env.Config,
+		Rates:  &alphapoint.Client{},
+	}
+}
+
+func (suite *EditExpenseSuite) TearDownSuite() {
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *EditExpenseSuite) BeforeTest(suiteName, testName string) {
+	MessageMap = mocks.MessageMapMock
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *EditExpenseSuite) TestGetResponseList() {
+	editExpense := &EditExpense{}
+	assert.Equal(suite.T(), 5, len(editExpense.GetResponses()))
+}
+
+func (suite *EditExpenseSuite) TestValidatesField() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("Amount")
+	json.Unmarshal(message, &incMessage)
+
+	editExpense := &EditExpense{
+		&Conversation{
+			Step:       3,
+			IncMessage: incMessage,
+			AuxData:    `{"ExpenseID":5,"Field":""}`,
+		},
+		suite.Action,
+	}
+
+	response, err := editExpense.ValidateField()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), BotResponse("New amount?"), response)
+	assert.Equal(suite.T(), `{"ExpenseID":5,"Field":"amount"}`, editExpense.AuxData)
+}
+
+func (suite *EditExpenseSuite) TestRejectsInvalidField() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("category")
+	json.Unmarshal(message, &incMessage)
+
+	editExpense := &EditExpense{
+		&Conversation{
+			Step:       3,
+			IncMessage: incMessage,
+			AuxData:    `{"ExpenseID":5,"Field":""}`,
+		},
+		suite.Action,
+	}
+
+	response, err := editExpense.ValidateField()
+	assert.EqualError(suite.T(), err, "invalid field")
+	assert.Equal(suite.T(), BotResponse("Invalid field"), response)
+	assert.Equal(suite.T(), 3, editExpense.Step)
+}
+
+func (suite *EditExpenseSuite) TestSaveChangeCancelled() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("cancel")
+	json.Unmarshal(message, &incMessage)
+
+	editExpense := &EditExpense{
+		&Conversation{
+			Step:       4,
+			IncMessage: incMessage,
+			AuxData:    `{"ExpenseID":5,"Field":"amount"}`,
+		},
+		suite.Action,
+	}
+
+	response, err := editExpense.SaveChange()
+	assert.EqualError(suite.T(), err, "user requested cancel")
+	assert.Equal(suite.T(), BotResponse("Ok, never mind"), response)
+	assert.Equal(suite.T(), -1, editExpense.Step)
+}
+
+func (suite *EditExpenseSuite) TestValidateFieldInvalidAuxData() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("amount")
+	json.Unmarshal(message, &incMessage)
+
+	editExpense := &EditExpense{
+		&Conversation{
+			Step:       3,
+			IncMessage: incMessage,
+			AuxData:    "invalid",
+		},
+		suite.Action,
+	}
+
+	response, err := editExpense.ValidateField()
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), BotResponse("Whoops!"), response)
+	assert.Equal(suite.T(), -1, editExpense.Step)
+}
+
+func TestEditExpenseSuite(t *testing.T) {
+	suite.Run(t, new(EditExpenseSuite))
+}
@@ -8,8 +8,8 @@ import (
 	"github.com/stretchr/testify/suite"
 
 	"github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/nlu"
 	"github.com/fmitra/dennis-bot/pkg/telegram"
-	"github.com/fmitra/dennis-bot/pkg/wit"
 	mocks "github.com/fmitra/dennis-bot/test"
 )
 
@@ -28,21 +28,12 @@ func (suite *GenericResponseSuite) TestGetResponseList() {
 }
 
 func (suite *GenericResponseSuite) TestReturnResponse() {
-	rawWitResponse := []byte(`{
-		"entities": {
-			"amount": [
-				{ "value": "20 SGD", "confidence": 100.00 }
-			],
-			"datetime": [
-				{ "value": "", "confidence": 100.00 }
-			],
-			"description": [
-				{ "value": "Food", "confidence": 100.00 }
-			]
-		}
-	}`)
-	var witResponse wit.Response
-	json.Unmarshal(rawWitResponse, &witResponse)
+	nluMessage := nlu.Message{
+		Intent:      nlu.TrackExpense,
+		Amount:      20,
+		Currency:    "SGD",
+		Description: "Food",
+	}
 
 	var incMessage telegram.IncomingMessage
 	message := mocks.GetMockMessage("")
@@ -50,9 +41,9 @@ func (suite *GenericResponseSuite) TestReturnResponse() {
 
 	genericResponse := &GenericResponse{
 		&Conversation{
-			Step:        0,
-			WitResponse: witResponse,
-			IncMessage:  incMessage,
+			Step:       0,
+			Message:    nluMessage,
+			IncMessage: incMessage,
 		},
 		&actions.Actions{},
 	}
@@ -0,0 +1,87 @@
+package conversation
+
+import (
+	"encoding/json"
+	"errors"
+
+	a "github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/nlu"
+)
+
+// GetCategoryTotal is an Intent designed to retrieve expense history totals
+// for a single category or a breakdown of all categories.
+type GetCategoryTotal struct {
+	*Conversation
+	actions *a.Actions
+}
+
+// categoryQuery is the auxiliary data we hold on to while the user
+// confirms their password.
+type categoryQuery struct {
+	Period   string
+	Category string
+}
+
+// GetResponses returns a list of functions each containing a BotResponse.
+func (i *GetCategoryTotal) GetResponses() []func() (BotResponse, error) {
+	return []func() (BotResponse, error){
+		i.AskForPassword,
+		i.ValidatePassword,
+		i.CalculateTotal,
+	}
+}
+
+// AskForPassword requests a user for their password.
+func (i *GetCategoryTotal) AskForPassword() (BotResponse, error) {
+	expensePeriod := i.Message.Period
+	if expensePeriod == "" {
+		return GetMessage(GetExpenseTotalInvalidPeriod, ""), errors.New("invalid period")
+	}
+
+	category := i.Message.Category
+	if category == "" {
+		return GetMessage(GetCategoryTotalInvalidCategory, ""), errors.New("invalid category")
+	}
+
+	query, _ := json.Marshal(categoryQuery{expensePeriod, category})
+	i.AuxData = string(query)
+	return askForPassword(i.Conversation, i.actions)
+}
+
+// ValidatePassword checks if the supplied password in a previous message is correct.
+// This is a validation response, therefore it will return an empty response
+// nil error on success, triggering the bot to skip over to the next response function
+// in line.
+func (i *GetCategoryTotal) ValidatePassword() (BotResponse, error) {
+	return validatePassword(i.Conversation, i.actions)
+}
+
+// CalculateTotal runs an action to check for the total sum of user expenses
+// by category for a specific period in time.
+func (i *GetCategoryTotal) CalculateTotal() (BotResponse, error) {
+	var query categoryQuery
+	if err := json.Unmarshal([]byte(i.AuxData), &query); err != nil {
+		i.EndConversation()
+		return GetMessage(GetExpenseTotalError, ""), nil
+	}
+
+	// No need to handle this error. Bot will return an error
+	// response if the private key is invalid
+	privateKey, _ := privateKeyInCache(i.Conversation, i.actions)
+
+	messageVar, err := i.actions.GetCategoryTotal(i.Context(), query.Period, query.Category, i.BotUserID, privateKey)
+	if err != nil {
+		return GetMessage(GetExpenseTotalError, ""), nil
+	}
+
+	i.EndConversation()
+	if messageVar == "" {
+		return GetMessage(GetCategoryTotalEmpty, ""), nil
+	}
+
+	if query.Category == nlu.AllCategories {
+		return GetMessage(GetCategoryTotalBreakdown, messageVar), nil
+	}
+
+	return GetMessage(GetCategoryTotalSuccess, messageVar), nil
+}
@@ -0,0 +1,132 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+	"github.com/fmitra/dennis-bot/pkg/crypto"
+	"github.com/fmitra/dennis-bot/pkg/nlu"
+	"github.com/fmitra/dennis-bot/pkg/telegram"
+	mocks "github.com/fmitra/dennis-bot/test"
+)
+
+type CategoryTotalSuite struct {
+	suite.Suite
+	Env    *mocks.TestEnv
+	Action *actions.Actions
+}
+
+func (suite *CategoryTotalSuite) SetupSuite() {
+	configFile := "../../config/config.json"
+	suite.Env = mocks.GetTestEnv(configFile)
+	suite.Action = &actions.Actions{
+		Db:     suite.Env.Db,
+		Cache:  suite.Env.Cache,
+		Config: suite.Env.Config,
+		Rates:  &alphapoint.Client{},
+	}
+}
+
+func (suite *CategoryTotalSuite) TearDownSuite() {
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *CategoryTotalSuite) BeforeTest(suiteName, testName string) {
+	MessageMap = mocks.MessageMapMock
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *CategoryTotalSuite) TestGetResponseList() {
+	categoryTotal := &GetCategoryTotal{}
+	assert.Equal(suite.T(), 3, len(categoryTotal.GetResponses()))
+}
+
+func (suite *CategoryTotalSuite) TestAskForPassword() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("")
+	json.Unmarshal(message, &incMessage)
+
+	nluMessage := nlu.Message{
+		Intent:   nlu.CategoryTotal,
+		Period:   "month",
+		Category: "food",
+	}
+
+	categoryTotal := &GetCategoryTotal{
+		&Conversation{
+			IncMessage: incMessage,
+			Message:    nluMessage,
+		},
+		suite.Action,
+	}
+
+	response, err := categoryTotal.AskForPassword()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), BotResponse("I need your password"), response)
+	assert.Equal(suite.T(), `{"Period":"month","Category":"food"}`, categoryTotal.AuxData)
+}
+
+func (suite *CategoryTotalSuite) TestGetCategoryTotalMessage() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("")
+	json.Unmarshal(message, &incMessage)
+
+	mocks.CreateTestUser(suite.Env.Db, 0)
+	cacheKey := fmt.Sprintf("%s_password", strconv.Itoa(int(incMessage.GetUser().ID)))
+	password, _ := crypto.Encrypt("my-password", suite.Env.Config.SecretKey)
+	suite.Action.Cache.Set(context.Background(), cacheKey, password, 180)
+
+	categoryTotal := &GetCategoryTotal{
+		&Conversation{
+			Step:       2,
+			IncMessage: incMessage,
+			AuxData:    `{"Period":"month","Category":"food"}`,
+		},
+		suite.Action,
+	}
+	response, err := categoryTotal.CalculateTotal()
+	assert.Equal(suite.T(), BotResponse("You spent 0.00 USD on food"), response)
+	assert.NoError(suite.T(), err)
+
+	categoryTotal = &GetCategoryTotal{
+		&Conversation{
+			Step:       2,
+			IncMessage: incMessage,
+			AuxData:    `{"Period":"month","Category":"all"}`,
+		},
+		suite.Action,
+	}
+	response, err = categoryTotal.CalculateTotal()
+	assert.Equal(suite.T(), BotResponse("Nothing spent"), response)
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *CategoryTotalSuite) TestGetCategoryTotalError() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("")
+	json.Unmarshal(message, &incMessage)
+
+	categoryTotal := &GetCategoryTotal{
+		&Conversation{
+			Step:       2,
+			IncMessage: incMessage,
+			AuxData:    `{"Period":"foo","Category":"food"}`,
+		},
+		suite.Action,
+	}
+	response, err := categoryTotal.CalculateTotal()
+	assert.Equal(suite.T(), BotResponse("Whoops!"), response)
+	assert.NoError(suite.T(), err)
+}
+
+func TestCategoryTotalSuite(t *testing.T) {
+	suite.Run(t, new(CategoryTotalSuite))
+}
@@ -0,0 +1,121 @@
+package conversation
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	a "github.com/fmitra/dennis-bot/internal/actions"
+)
+
+// expenseListPageSize is the number of expenses we list in a single message.
+const expenseListPageSize = 10
+
+// GetExpenseList is an Intent designed to retrieve an itemized list of
+// expense history. Long lists are split across several messages.
+type GetExpenseList struct {
+	*Conversation
+	actions *a.Actions
+}
+
+// expenseListQuery is the auxiliary data we hold on to while the user
+// confirms their password and pages through their expenses.
+type expenseListQuery struct {
+	Period string
+	Page   int
+}
+
+// GetResponses returns a list of functions each containing a BotResponse.
+func (i *GetExpenseList) GetResponses() []func() (BotResponse, error) {
+	return []func() (BotResponse, error){
+		i.AskForPassword,
+		i.ValidatePassword,
+		i.ListExpenses,
+		i.ListMoreExpenses,
+	}
+}
+
+// AskForPassword requests a user for their password.
+func (i *GetExpenseList) AskForPassword() (BotResponse, error) {
+	expensePeriod := i.Message.Period
+	if expensePeriod == "" {
+		return GetMessage(GetExpenseTotalInvalidPeriod, ""), errors.New("invalid period")
+	}
+
+	query, _ := json.Marshal(expenseListQuery{Period: expensePeriod})
+	i.AuxData = string(query)
+	return askForPassword(i.Conversation, i.actions)
+}
+
+// ValidatePassword checks if the supplied password in a previous message is correct.
+// This is a validation response, therefore it will return an empty response
+// nil error on success, triggering the bot to skip over to the next response function
+// in line.
+func (i *GetExpenseList) ValidatePassword() (BotResponse, error) {
+	return validatePassword(i.Conversation, i.actions)
+}
+
+// ListExpenses returns the first page of expenses for the requested period.
+func (i *GetExpenseList) ListExpenses() (BotResponse, error) {
+	return i.listPage()
+}
+
+// ListMoreExpenses returns the next page of expenses if the user asks for more.
+// We remain on this step until the user has seen every page.
+func (i *GetExpenseList) ListMoreExpenses() (BotResponse, error) {
+	userInput := strings.ToLower(strings.TrimSpace(i.IncMessage.GetMessage()))
+	if userInput != "more" {
+		i.EndConversation()
+		return GetMessage(ConversationCancelled, ""), errors.New("user requested cancel")
+	}
+
+	response, err := i.listPage()
+	if err == nil && i.HasResponse() {
+		err = errors.New("more expenses available")
+	}
+
+	return response, err
+}
+
+// listPage returns the current page of expenses held in auxiliary data and
+// moves the query on to the next page. The conversation ends once the last
+// page is returned.
+func (i *GetExpenseList) listPage() (BotResponse, error) {
+	var query expenseListQuery
+	if err := json.Unmarshal([]byte(i.AuxData), &query); err != nil {
+		i.EndConversation()
+		return GetMessage(GetExpenseTotalError, ""), nil
+	}
+
+	// No need to handle this error. Bot will return an error
+	// response if the private key is invalid
+	privateKey, _ := privateKeyInCache(i.Conversation, i.actions)
+
+	lines, err := i.actions.GetExpenseList(i.Context(), query.Period, i.BotUserID, privateKey)
+	if err != nil {
+		i.EndConversation()
+		return GetMessage(GetExpenseTotalError, ""), nil
+	}
+
+	if len(lines) == 0 {
+		i.EndConversation()
+		return GetMessage(GetExpenseListEmpty, ""), nil
+	}
+
+	start := query.Page * expenseListPageSize
+	if start >= len(lines) {
+		i.EndConversation()
+		return GetMessage(GetExpenseListEmpty, ""), nil
+	}
+
+	end := start + expenseListPageSize
+	if end >= len(lines) {
+		i.EndConversation()
+		return GetMessage(GetExpenseListSuccess, strings.Join(lines[start:], "\n")), nil
+	}
+
+	query.Page++
+	auxData, _ := json.Marshal(query)
+	i.AuxData = string(auxData)
+	return GetMessage(GetExpenseListMore, strings.Join(lines[start:end], "\n")), nil
+}
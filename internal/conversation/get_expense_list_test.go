@@ -0,0 +1,170 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+	"github.com/fmitra/dennis-bot/pkg/crypto"
+	"github.com/fmitra/dennis-bot/pkg/expenses"
+	"github.com/fmitra/dennis-bot/pkg/nlu"
+	"github.com/fmitra/dennis-bot/pkg/telegram"
+	"github.com/fmitra/dennis-bot/pkg/users"
+	mocks "github.com/fmitra/dennis-bot/test"
+)
+
+type ExpenseListSuite struct {
+	suite.Suite
+	Env    *mocks.TestEnv
+	Action *actions.Actions
+}
+
+func (suite *ExpenseListSuite) SetupSuite() {
+	configFile := "../../config/config.json"
+	suite.Env = mocks.GetTestEnv(configFile)
+	suite.Action = &actions.Actions{
+		Db:     suite.Env.Db,
+		Cache:  suite.Env.Cache,
+		Config: suite.Env.Config,
+		Rates:  &alphapoint.Client{},
+	}
+}
+
+func (suite *ExpenseListSuite) TearDownSuite() {
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *ExpenseListSuite) BeforeTest(suiteName, testName string) {
+	MessageMap = mocks.MessageMapMock
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *ExpenseListSuite) TestGetResponseList() {
+	expenseList := &GetExpenseList{}
+	assert.Equal(suite.T(), 4, len(expenseList.GetResponses()))
+}
+
+func (suite *ExpenseListSuite) TestAskForPassword() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("")
+	json.Unmarshal(message, &incMessage)
+
+	nluMessage := nlu.Message{
+		Intent: nlu.ExpenseList,
+		Period: "week",
+	}
+
+	expenseList := &GetExpenseList{
+		&Conversation{
+			IncMessage: incMessage,
+			Message:    nluMessage,
+		},
+		suite.Action,
+	}
+
+	response, err := expenseList.AskForPassword()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), BotResponse("I need your password"), response)
+	assert.Equal(suite.T(), `{"Period":"week","Page":0}`, expenseList.AuxData)
+}
+
+func (suite *ExpenseListSuite) TestListsEmptyExpenses() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("")
+	json.Unmarshal(message, &incMessage)
+
+	expenseList := &GetExpenseList{
+		&Conversation{
+			Step:       2,
+			IncMessage: incMessage,
+			BotUserID:  uint(200),
+			AuxData:    `{"Period":"week","Page":0}`,
+		},
+		suite.Action,
+	}
+
+	response, err := expenseList.ListExpenses()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), BotResponse("No expenses to list"), response)
+	assert.Equal(suite.T(), -1, expenseList.Step)
+}
+
+func (suite *ExpenseListSuite) TestPaginatesExpenses() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("more")
+	json.Unmarshal(message, &incMessage)
+
+	password := "my-password"
+	suite.Action.CreateNewUser(mocks.TestUserID, password)
+	user := users.NewUserManager(suite.Env.Db).GetByTelegramID(mocks.TestUserID)
+	publicKey, _ := user.GetPublicKey()
+
+	manager := expenses.NewExpenseManager(suite.Env.Db)
+	for n := 0; n < expenseListPageSize+2; n++ {
+		expense := &expenses.Expense{
+			Date:        time.Now(),
+			Description: "Food",
+			Total:       "20",
+			Historical:  "20",
+			Currency:    "USD",
+			User:        user,
+		}
+		expense.Encrypt(publicKey)
+		manager.Save(expense)
+	}
+
+	cacheKey := fmt.Sprintf("%s_password", strconv.Itoa(int(mocks.TestUserID)))
+	encryptedPass, _ := crypto.Encrypt(password, suite.Env.Config.SecretKey)
+	suite.Env.Cache.Set(context.Background(), cacheKey, encryptedPass, 180)
+
+	expenseList := &GetExpenseList{
+		&Conversation{
+			Step:       2,
+			IncMessage: incMessage,
+			BotUserID:  user.ID,
+			AuxData:    `{"Period":"month","Page":0}`,
+		},
+		suite.Action,
+	}
+
+	response := expenseList.ProcessResponses(expenseList.GetResponses())
+	assert.Contains(suite.T(), string(response), "More expenses")
+	assert.Equal(suite.T(), 3, expenseList.Step)
+	assert.Equal(suite.T(), `{"Period":"month","Page":1}`, expenseList.AuxData)
+
+	response = expenseList.ProcessResponses(expenseList.GetResponses())
+	assert.Contains(suite.T(), string(response), "Expenses")
+	assert.Equal(suite.T(), -1, expenseList.Step)
+}
+
+func (suite *ExpenseListSuite) TestStopsListingExpenses() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("stop")
+	json.Unmarshal(message, &incMessage)
+
+	expenseList := &GetExpenseList{
+		&Conversation{
+			Step:       3,
+			IncMessage: incMessage,
+			AuxData:    `{"Period":"week","Page":1}`,
+		},
+		suite.Action,
+	}
+
+	response, err := expenseList.ListMoreExpenses()
+	assert.EqualError(suite.T(), err, "user requested cancel")
+	assert.Equal(suite.T(), BotResponse("Ok, never mind"), response)
+	assert.Equal(suite.T(), -1, expenseList.Step)
+}
+
+func TestExpenseListSuite(t *testing.T) {
+	suite.Run(t, new(ExpenseListSuite))
+}
@@ -1,9 +1,13 @@
 package conversation
 
 import (
+	"context"
+	"crypto/rsa"
 	"errors"
 	"fmt"
+	"log"
 	"strconv"
+	"strings"
 
 	a "github.com/fmitra/dennis-bot/internal/actions"
 	"github.com/fmitra/dennis-bot/pkg/crypto"
@@ -28,21 +32,13 @@ func (i *GetExpenseTotal) GetResponses() []func() (BotResponse, error) {
 
 // AskForPassword requests a user for their password.
 func (i *GetExpenseTotal) AskForPassword() (BotResponse, error) {
-	expensePeriod, err := i.WitResponse.GetSpendPeriod()
-	if err != nil {
+	expensePeriod := i.Message.Period
+	if expensePeriod == "" {
 		return GetMessage(GetExpenseTotalInvalidPeriod, ""), errors.New("invalid period")
 	}
 
 	i.AuxData = expensePeriod
-	telegramUserID := i.IncMessage.GetUser().ID
-
-	key := i.actions.Config.SecretKey
-	_, err = passwordInCache(telegramUserID, key, i.actions.Cache)
-	if err == nil {
-		return i.SkipResponse()
-	}
-
-	return GetMessage(GetExpenseTotalAskForPassword, ""), nil
+	return askForPassword(i.Conversation, i.actions)
 }
 
 // ValidatePassword checks if the supplied password in a previous message is correct.
@@ -50,28 +46,66 @@ func (i *GetExpenseTotal) AskForPassword() (BotResponse, error) {
 // nil error on success, triggering the bot to skip over to the next response function
 // in line.
 func (i *GetExpenseTotal) ValidatePassword() (BotResponse, error) {
-	telegramUserID := i.IncMessage.GetUser().ID
-	key := i.actions.Config.SecretKey
+	return validatePassword(i.Conversation, i.actions)
+}
+
+// CalculateTotal runs an action to check for the total sum of user expenses
+// for a specific period in time.
+func (i *GetExpenseTotal) CalculateTotal() (BotResponse, error) {
+	// No need to handle this error. Bot will return an error
+	// response if the private key is invalid
+	privateKey, _ := privateKeyInCache(i.Conversation, i.actions)
+
+	expensePeriod := i.AuxData
+	messageVar, err := i.actions.GetExpenseTotal(i.Context(), expensePeriod, i.BotUserID, privateKey)
+	if err != nil {
+		return GetMessage(GetExpenseTotalError, ""), nil
+	}
+
+	i.EndConversation()
+	return GetMessage(GetExpenseTotalSuccess, messageVar), nil
+}
+
+// askForPassword requests a user for their password. We skip the request if
+// the user recently supplied a valid password.
+func askForPassword(c *Conversation, actions *a.Actions) (BotResponse, error) {
+	telegramUserID := c.IncMessage.GetUser().ID
+	key := actions.Config.SecretKey
 
-	_, err := passwordInCache(telegramUserID, key, i.actions.Cache)
+	_, err := passwordInCache(c.Context(), telegramUserID, key, actions.Cache)
 	if err == nil {
-		return i.SkipResponse()
+		return c.SkipResponse()
 	}
 
-	shouldEnd := i.IncMessage.GetMessage() == "cancel"
+	return GetMessage(GetExpenseTotalAskForPassword, ""), nil
+}
+
+// validatePassword checks if the supplied password in a previous message is correct
+// and caches it for consecutive queries. Intents that require access to a user's
+// private key should run this step before decrypting expenses.
+func validatePassword(c *Conversation, actions *a.Actions) (BotResponse, error) {
+	telegramUserID := c.IncMessage.GetUser().ID
+	key := actions.Config.SecretKey
+
+	_, err := passwordInCache(c.Context(), telegramUserID, key, actions.Cache)
+	if err == nil {
+		return c.SkipResponse()
+	}
+
+	shouldEnd := c.IncMessage.GetMessage() == "cancel"
 	if shouldEnd {
-		i.EndConversation()
+		c.EndConversation()
 		return GetMessage(GetExpenseTotalCancel, ""), errors.New("user requested cancel")
 	}
 
-	password := i.IncMessage.GetMessage()
-	encryptedPass, err := crypto.Encrypt(password, i.actions.Config.SecretKey)
+	password := c.IncMessage.GetMessage()
+	encryptedPass, err := crypto.Encrypt(password, actions.Config.SecretKey)
 	if err != nil {
 		response := GetMessage(GetExpenseTotalPasswordInvalid, "")
 		return response, err
 	}
 
-	manager := users.NewUserManager(i.actions.Db)
+	manager := users.NewUserManager(actions.Db)
 	user := manager.GetByTelegramID(telegramUserID)
 
 	if err = user.ValidatePassword(password); err != nil {
@@ -82,32 +116,51 @@ func (i *GetExpenseTotal) ValidatePassword() (BotResponse, error) {
 
 	threeMinutes := 180
 	cacheKey := passwordCacheKey(telegramUserID)
-	i.actions.Cache.Set(cacheKey, encryptedPass, threeMinutes)
-	return i.SkipResponse()
+	actions.Cache.Set(c.Context(), cacheKey, encryptedPass, threeMinutes)
+
+	// Data encrypted with legacy formats can only be upgraded with the
+	// user's password, so we upgrade it in the background now that we
+	// have it. Users who were already upgraded are skipped
+	if !user.EncryptionUpgraded {
+		err = actions.Schedule(c.IncMessage, upgradeEncryption(actions, user.ID, password))
+		if err != nil {
+			log.Printf("conversation: failed to schedule encryption upgrade of user %d - %s", user.ID, err)
+		}
+	}
+	return c.SkipResponse()
 }
 
-// CalculateTotal runs an action to check for the total sum of user expenses
-// for a specific period in time.
-func (i *GetExpenseTotal) CalculateTotal() (BotResponse, error) {
-	telegramUserID := i.IncMessage.GetUser().ID
-	key := i.actions.Config.SecretKey
-
-	// No need to handle this error or below. Bot will return an error
-	// response if the private key is invalid
-	password, _ := passwordInCache(telegramUserID, key, i.actions.Cache)
+// upgradeEncryption returns a Job upgrading a user's data encrypted with
+// legacy formats. The user is shown their new recovery codes if their key
+// pair was replaced.
+func upgradeEncryption(actions *a.Actions, userID uint, password string) a.Job {
+	return func(ctx context.Context) string {
+		codes, err := actions.UpgradeEncryption(userID, password)
+		if err != nil {
+			log.Printf("conversation: failed to upgrade encryption of user %d - %s", userID, err)
+		}
+		if len(codes) == 0 {
+			return ""
+		}
+
+		return string(GetMessage(GetExpenseTotalNewRecoveryCodes, strings.Join(codes, "\n")))
+	}
+}
 
-	manager := users.NewUserManager(i.actions.Db)
-	user := manager.GetByTelegramID(telegramUserID)
-	privateKey, _ := user.GetPrivateKey(password)
+// privateKeyInCache returns the user's private key using the password cached
+// in a previous validatePassword step.
+func privateKeyInCache(c *Conversation, actions *a.Actions) (rsa.PrivateKey, error) {
+	telegramUserID := c.IncMessage.GetUser().ID
+	key := actions.Config.SecretKey
 
-	expensePeriod := i.AuxData
-	messageVar, err := i.actions.GetExpenseTotal(expensePeriod, i.BotUserID, privateKey)
+	password, err := passwordInCache(c.Context(), telegramUserID, key, actions.Cache)
 	if err != nil {
-		return GetMessage(GetExpenseTotalError, ""), nil
+		return rsa.PrivateKey{}, err
 	}
 
-	i.EndConversation()
-	return GetMessage(GetExpenseTotalSuccess, messageVar), nil
+	manager := users.NewUserManager(actions.Db)
+	user := manager.GetByTelegramID(telegramUserID)
+	return user.GetPrivateKey(password)
 }
 
 // passwordCacheKey returns the cache key for password checks.
@@ -118,10 +171,10 @@ func passwordCacheKey(userID uint) string {
 // passwordInCache checks for a password in cache, indicating the user completed
 // this flow within the past few minutes. We do not require users to re-enter password
 // for consecutive queries within the cache timeout.
-func passwordInCache(userID uint, secretKey string, cache sessions.Session) (string, error) {
+func passwordInCache(ctx context.Context, userID uint, secretKey string, cache sessions.Session) (string, error) {
 	var password string
 	cacheKey := passwordCacheKey(userID)
-	err := cache.Get(cacheKey, &password)
+	err := cache.Get(ctx, cacheKey, &password)
 	if err != nil {
 		return "", err
 	}
@@ -1,6 +1,7 @@
 package conversation
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -12,8 +13,8 @@ import (
 	"github.com/fmitra/dennis-bot/internal/actions"
 	"github.com/fmitra/dennis-bot/pkg/alphapoint"
 	"github.com/fmitra/dennis-bot/pkg/crypto"
+	"github.com/fmitra/dennis-bot/pkg/nlu"
 	"github.com/fmitra/dennis-bot/pkg/telegram"
-	"github.com/fmitra/dennis-bot/pkg/wit"
 	mocks "github.com/fmitra/dennis-bot/test"
 )
 
@@ -23,14 +24,24 @@ type ExpenseTotalSuite struct {
 	Action *actions.Actions
 }
 
+// jobRecorder is a Scheduler holding on to Jobs instead of running them.
+type jobRecorder struct {
+	jobs []actions.Job
+}
+
+func (r *jobRecorder) Schedule(incM telegram.IncomingMessage, job actions.Job) error {
+	r.jobs = append(r.jobs, job)
+	return nil
+}
+
 func (suite *ExpenseTotalSuite) SetupSuite() {
 	configFile := "../../config/config.json"
 	suite.Env = mocks.GetTestEnv(configFile)
 	suite.Action = &actions.Actions{
-		Db:         suite.Env.Db,
-		Cache:      suite.Env.Cache,
-		Config:     suite.Env.Config,
-		Alphapoint: &alphapoint.Client{},
+		Db:     suite.Env.Db,
+		Cache:  suite.Env.Cache,
+		Config: suite.Env.Config,
+		Rates:  &alphapoint.Client{},
 	}
 }
 
@@ -49,18 +60,10 @@ func (suite *ExpenseTotalSuite) TestGetResponseList() {
 }
 
 func (suite *ExpenseTotalSuite) TestGetExpenseTotalMessage() {
-	rawWitResponse := []byte(`{
-		"entities": {
-			"amount": [],
-			"datetime": [],
-			"description": [],
-			"total_spent": [
-				{ "value": "month", "confidence": 100.00 }
-			]
-		}
-	}`)
-	var witResponse wit.Response
-	json.Unmarshal(rawWitResponse, &witResponse)
+	nluMessage := nlu.Message{
+		Intent: nlu.ExpenseTotal,
+		Period: "month",
+	}
 
 	var incMessage telegram.IncomingMessage
 	message := mocks.GetMockMessage("")
@@ -68,10 +71,10 @@ func (suite *ExpenseTotalSuite) TestGetExpenseTotalMessage() {
 
 	expenseTotal := &GetExpenseTotal{
 		&Conversation{
-			Step:        2,
-			WitResponse: witResponse,
-			IncMessage:  incMessage,
-			AuxData:     "month",
+			Step:       2,
+			Message:    nluMessage,
+			IncMessage: incMessage,
+			AuxData:    "month",
 		},
 		suite.Action,
 	}
@@ -81,18 +84,10 @@ func (suite *ExpenseTotalSuite) TestGetExpenseTotalMessage() {
 }
 
 func (suite *ExpenseTotalSuite) TestGetExpenseTotalError() {
-	rawWitResponse := []byte(`{
-		"entities": {
-			"amount": [],
-			"datetime": [],
-			"description": [],
-			"total_spent": [
-				{ "value": "foo", "confidence": 100.00 }
-			]
-		}
-	}`)
-	var witResponse wit.Response
-	json.Unmarshal(rawWitResponse, &witResponse)
+	nluMessage := nlu.Message{
+		Intent: nlu.ExpenseTotal,
+		Period: "foo",
+	}
 
 	var incMessage telegram.IncomingMessage
 	message := mocks.GetMockMessage("")
@@ -100,9 +95,9 @@ func (suite *ExpenseTotalSuite) TestGetExpenseTotalError() {
 
 	expenseTotal := &GetExpenseTotal{
 		&Conversation{
-			Step:        2,
-			WitResponse: witResponse,
-			IncMessage:  incMessage,
+			Step:       2,
+			Message:    nluMessage,
+			IncMessage: incMessage,
 		},
 		suite.Action,
 	}
@@ -116,24 +111,16 @@ func (suite *ExpenseTotalSuite) TestAskForPassword() {
 	message := mocks.GetMockMessage("")
 	json.Unmarshal(message, &incMessage)
 
-	rawWitResponse := []byte(`{
-		"entities": {
-			"amount": [],
-			"datetime": [],
-			"description": [],
-			"total_spent": [
-				{ "value": "month", "confidence": 100.00 }
-			]
-		}
-	}`)
-	var witResponse wit.Response
-	json.Unmarshal(rawWitResponse, &witResponse)
+	nluMessage := nlu.Message{
+		Intent: nlu.ExpenseTotal,
+		Period: "month",
+	}
 
 	expenseTotal := &GetExpenseTotal{
 		&Conversation{
-			Step:        0,
-			IncMessage:  incMessage,
-			WitResponse: witResponse,
+			Step:       0,
+			IncMessage: incMessage,
+			Message:    nluMessage,
 		},
 		suite.Action,
 	}
@@ -148,28 +135,20 @@ func (suite *ExpenseTotalSuite) TestSkipsPasswordRequest() {
 	message := mocks.GetMockMessage("")
 	json.Unmarshal(message, &incMessage)
 
-	rawWitResponse := []byte(`{
-		"entities": {
-			"amount": [],
-			"datetime": [],
-			"description": [],
-			"total_spent": [
-				{ "value": "month", "confidence": 100.00 }
-			]
-		}
-	}`)
-	var witResponse wit.Response
-	json.Unmarshal(rawWitResponse, &witResponse)
+	nluMessage := nlu.Message{
+		Intent: nlu.ExpenseTotal,
+		Period: "month",
+	}
 
 	cacheKey := fmt.Sprintf("%s_password", strconv.Itoa(int(incMessage.GetUser().ID)))
 	password, _ := crypto.Encrypt("my-password", suite.Env.Config.SecretKey)
-	suite.Action.Cache.Set(cacheKey, password, 180)
+	suite.Action.Cache.Set(context.Background(), cacheKey, password, 180)
 
 	expenseTotal := &GetExpenseTotal{
 		&Conversation{
-			Step:        0,
-			IncMessage:  incMessage,
-			WitResponse: witResponse,
+			Step:       0,
+			IncMessage: incMessage,
+			Message:    nluMessage,
 		},
 		suite.Action,
 	}
@@ -180,7 +159,7 @@ func (suite *ExpenseTotalSuite) TestSkipsPasswordRequest() {
 }
 
 func (suite *ExpenseTotalSuite) TestValidatesPassword() {
-	var witResponse wit.Response
+	var nluMessage nlu.Message
 	var incMessage telegram.IncomingMessage
 	message := mocks.GetMockMessage("my-password")
 	json.Unmarshal(message, &incMessage)
@@ -188,9 +167,9 @@ func (suite *ExpenseTotalSuite) TestValidatesPassword() {
 	mocks.CreateTestUser(suite.Env.Db, 0)
 	expenseTotal := &GetExpenseTotal{
 		&Conversation{
-			Step:        0,
-			IncMessage:  incMessage,
-			WitResponse: witResponse,
+			Step:       0,
+			IncMessage: incMessage,
+			Message:    nluMessage,
 		},
 		suite.Action,
 	}
@@ -200,8 +179,39 @@ func (suite *ExpenseTotalSuite) TestValidatesPassword() {
 	assert.Equal(suite.T(), BotResponse(""), response)
 }
 
+func (suite *ExpenseTotalSuite) TestSchedulesEncryptionUpgradeOnce() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("my-password")
+	json.Unmarshal(message, &incMessage)
+
+	mocks.CreateTestUser(suite.Env.Db, 0)
+	suite.Env.Db.Table("users").
+		Where("telegram_id = ?", mocks.TestUserID).
+		Update("encryption_upgraded", false)
+
+	recorder := &jobRecorder{}
+	action := *suite.Action
+	action.Jobs = recorder
+	validate := func() {
+		expenseTotal := &GetExpenseTotal{
+			&Conversation{IncMessage: incMessage},
+			&action,
+		}
+		response, err := expenseTotal.ValidatePassword()
+		assert.NoError(suite.T(), err)
+		assert.Equal(suite.T(), BotResponse(""), response)
+	}
+
+	validate()
+	assert.Equal(suite.T(), 1, len(recorder.jobs))
+	assert.Equal(suite.T(), "", recorder.jobs[0](context.Background()))
+
+	validate()
+	assert.Equal(suite.T(), 1, len(recorder.jobs))
+}
+
 func (suite *ExpenseTotalSuite) TestShouldCancelPasswordValidation() {
-	var witResponse wit.Response
+	var nluMessage nlu.Message
 	var incMessage telegram.IncomingMessage
 	message := mocks.GetMockMessage("cancel")
 	json.Unmarshal(message, &incMessage)
@@ -209,9 +219,9 @@ func (suite *ExpenseTotalSuite) TestShouldCancelPasswordValidation() {
 	mocks.CreateTestUser(suite.Env.Db, 0)
 	expenseTotal := &GetExpenseTotal{
 		&Conversation{
-			Step:        0,
-			IncMessage:  incMessage,
-			WitResponse: witResponse,
+			Step:       0,
+			IncMessage: incMessage,
+			Message:    nluMessage,
 		},
 		suite.Action,
 	}
@@ -228,7 +238,7 @@ func (suite *ExpenseTotalSuite) TestSkipsPasswordValidation() {
 
 	cacheKey := fmt.Sprintf("%s_password", strconv.Itoa(int(incMessage.GetUser().ID)))
 	password, _ := crypto.Encrypt("my-password", suite.Env.Config.SecretKey)
-	suite.Action.Cache.Set(cacheKey, password, 180)
+	suite.Action.Cache.Set(context.Background(), cacheKey, password, 180)
 
 	expenseTotal := &GetExpenseTotal{
 		&Conversation{
@@ -0,0 +1,124 @@
+package conversation
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	a "github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/nlu"
+)
+
+// ManageSettings is an Intent designed to show a user their settings or change
+// their currency, timezone or week start after onboarding.
+type ManageSettings struct {
+	*Conversation
+	actions *a.Actions
+}
+
+// settingChange is the auxiliary data we hold on to while the user describes
+// the setting they want to change.
+type settingChange struct {
+	Setting string
+	Value   string
+}
+
+// GetResponses returns a list of functions each containing a BotResponse.
+func (i *ManageSettings) GetResponses() []func() (BotResponse, error) {
+	return []func() (BotResponse, error){
+		i.ChooseSetting,
+		i.ValidateSetting,
+		i.AskForValue,
+		i.SaveSetting,
+	}
+}
+
+// ChooseSetting shows the user their settings or asks which setting they would
+// like to change. If the user already told us the setting (ex. "change my currency
+// to EUR"), we skip ahead to the next response.
+func (i *ManageSettings) ChooseSetting() (BotResponse, error) {
+	if i.Message.Intent == nlu.ShowSettings {
+		i.EndConversation()
+		return GetMessage(ManageSettingsShow, i.actions.GetSettings(i.BotUserID)), nil
+	}
+
+	var change settingChange
+	change.Setting, _ = a.ParseSetting(i.Message.Setting)
+	if change.Setting != "" {
+		change.Value = i.Message.SettingValue
+	}
+
+	auxData, _ := json.Marshal(change)
+	i.AuxData = string(auxData)
+	if change.Setting != "" {
+		return i.SkipResponse()
+	}
+
+	return GetMessage(ManageSettingsAskForSetting, ""), nil
+}
+
+// ValidateSetting checks if the user chose a setting that can be changed.
+func (i *ManageSettings) ValidateSetting() (BotResponse, error) {
+	var change settingChange
+	json.Unmarshal([]byte(i.AuxData), &change)
+	if change.Setting != "" {
+		return i.SkipResponse()
+	}
+
+	userInput := strings.ToLower(strings.TrimSpace(i.IncMessage.GetMessage()))
+	if userInput == "cancel" {
+		i.EndConversation()
+		return GetMessage(ConversationCancelled, ""), errors.New("user requested cancel")
+	}
+
+	setting, err := a.ParseSetting(userInput)
+	if err != nil {
+		return GetMessage(ManageSettingsInvalidSetting, ""), err
+	}
+
+	change.Setting = setting
+	auxData, _ := json.Marshal(change)
+	i.AuxData = string(auxData)
+	return i.SkipResponse()
+}
+
+// AskForValue asks the user for the new value of their setting. If the user
+// already told us the value, we skip ahead to the next response.
+func (i *ManageSettings) AskForValue() (BotResponse, error) {
+	var change settingChange
+	json.Unmarshal([]byte(i.AuxData), &change)
+	if change.Value != "" {
+		return i.SkipResponse()
+	}
+
+	return GetMessage(ManageSettingsAskForValue, change.Setting), nil
+}
+
+// SaveSetting updates the user's setting with the new value.
+func (i *ManageSettings) SaveSetting() (BotResponse, error) {
+	var change settingChange
+	json.Unmarshal([]byte(i.AuxData), &change)
+
+	value := change.Value
+	if value == "" {
+		value = strings.TrimSpace(i.IncMessage.GetMessage())
+	}
+
+	if strings.ToLower(value) == "cancel" {
+		i.EndConversation()
+		return GetMessage(ConversationCancelled, ""), errors.New("user requested cancel")
+	}
+
+	err := i.actions.UpdateSetting(i.BotUserID, change.Setting, value)
+	if err != nil {
+		// A value inferred from the original message may be invalid, so
+		// we ask the user for the value directly on the next attempt
+		change.Value = ""
+		auxData, _ := json.Marshal(change)
+		i.AuxData = string(auxData)
+		return GetMessage(ManageSettingsInvalidValue, change.Setting), err
+	}
+
+	i.EndConversation()
+	return GetMessage(ManageSettingsSuccess, i.actions.GetSettings(i.BotUserID)), nil
+}
@@ -0,0 +1,166 @@
+package conversation
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+	"github.com/fmitra/dennis-bot/pkg/nlu"
+	"github.com/fmitra/dennis-bot/pkg/telegram"
+	"github.com/fmitra/dennis-bot/pkg/users"
+	mocks "github.com/fmitra/dennis-bot/test"
+)
+
+type SettingsSuite struct {
+	suite.Suite
+	Env    *mocks.TestEnv
+	Action *actions.Actions
+}
+
+func (suite *SettingsSuite) SetupSuite() {
+	configFile := "../../config/config.json"
+	suite.Env = mocks.GetTestEnv(configFile)
+	suite.Action = &actions.Actions{
+		Db:     suite.Env.Db,
+		Cache:  suite.Env.Cache,
+		Config: suite.Env.Config,
+		Rates:  &alphapoint.Client{},
+	}
+}
+
+func (suite *SettingsSuite) TearDownSuite() {
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *SettingsSuite) BeforeTest(suiteName, testName string) {
+	MessageMap = mocks.MessageMapMock
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *SettingsSuite) TestGetResponseList() {
+	manageSettings := &ManageSettings{}
+	assert.Equal(suite.T(), 4, len(manageSettings.GetResponses()))
+}
+
+func (suite *SettingsSuite) TestShowsSettings() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("")
+	json.Unmarshal(message, &incMessage)
+
+	nluMessage := nlu.Message{
+		Intent: nlu.ShowSettings,
+	}
+
+	manageSettings := &ManageSettings{
+		&Conversation{
+			IncMessage: incMessage,
+			Message:    nluMessage,
+			BotUserID:  uint(200),
+		},
+		suite.Action,
+	}
+
+	response, err := manageSettings.ChooseSetting()
+	assert.NoError(suite.T(), err)
+	assert.Equal(
+		suite.T(),
+		BotResponse("Settings currency: USD\ntimezone: UTC\nweek start: Sunday"),
+		response,
+	)
+	assert.Equal(suite.T(), -1, manageSettings.Step)
+}
+
+func (suite *SettingsSuite) TestChangesSettingFromMessage() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("")
+	json.Unmarshal(message, &incMessage)
+
+	mocks.CreateTestUser(suite.Env.Db, 0)
+	user := users.NewUserManager(suite.Env.Db).GetByTelegramID(mocks.TestUserID)
+
+	nluMessage := nlu.Message{
+		Intent:       nlu.ChangeSetting,
+		Setting:      "currency",
+		SettingValue: "EUR",
+	}
+
+	manageSettings := &ManageSettings{
+		&Conversation{
+			IncMessage: incMessage,
+			Message:    nluMessage,
+			BotUserID:  user.ID,
+		},
+		suite.Action,
+	}
+
+	response := manageSettings.ProcessResponses(manageSettings.GetResponses())
+	assert.Equal(
+		suite.T(),
+		BotResponse("Settings changed currency: EUR\ntimezone: UTC\nweek start: Sunday"),
+		response,
+	)
+	assert.Equal(suite.T(), -1, manageSettings.Step)
+}
+
+func (suite *SettingsSuite) TestAsksForSettingAndValue() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("")
+	json.Unmarshal(message, &incMessage)
+
+	mocks.CreateTestUser(suite.Env.Db, 0)
+	user := users.NewUserManager(suite.Env.Db).GetByTelegramID(mocks.TestUserID)
+
+	nluMessage := nlu.Message{
+		Intent: nlu.ChangeSetting,
+	}
+
+	manageSettings := &ManageSettings{
+		&Conversation{
+			IncMessage: incMessage,
+			Message:    nluMessage,
+			BotUserID:  user.ID,
+		},
+		suite.Action,
+	}
+	responses := manageSettings.GetResponses()
+
+	response := manageSettings.ProcessResponses(responses)
+	assert.Equal(suite.T(), BotResponse("Which setting?"), response)
+
+	message = mocks.GetMockMessage("colour")
+	json.Unmarshal(message, &incMessage)
+	manageSettings.IncMessage = incMessage
+	response = manageSettings.ProcessResponses(responses)
+	assert.Equal(suite.T(), BotResponse("Invalid setting"), response)
+
+	message = mocks.GetMockMessage("week start")
+	json.Unmarshal(message, &incMessage)
+	manageSettings.IncMessage = incMessage
+	response = manageSettings.ProcessResponses(responses)
+	assert.Equal(suite.T(), BotResponse("New week start?"), response)
+
+	message = mocks.GetMockMessage("someday")
+	json.Unmarshal(message, &incMessage)
+	manageSettings.IncMessage = incMessage
+	response = manageSettings.ProcessResponses(responses)
+	assert.Equal(suite.T(), BotResponse("Invalid week start"), response)
+
+	message = mocks.GetMockMessage("Monday")
+	json.Unmarshal(message, &incMessage)
+	manageSettings.IncMessage = incMessage
+	response = manageSettings.ProcessResponses(responses)
+	assert.Equal(
+		suite.T(),
+		BotResponse("Settings changed currency: USD\ntimezone: UTC\nweek start: Monday"),
+		response,
+	)
+	assert.Equal(suite.T(), -1, manageSettings.Step)
+}
+
+func TestSettingsSuite(t *testing.T) {
+	suite.Run(t, new(SettingsSuite))
+}
@@ -10,6 +10,14 @@ const (
 	// a Users intent
 	DefaultResponse = "default"
 
+	// ConfirmationInvalid is a response when a user responds to a yes or no
+	// confirmation prompt with invalid text
+	ConfirmationInvalid = "confirmation_invalid"
+
+	// ConversationCancelled is a response when a user cancels a conversation or
+	// rejects a confirmation prompt
+	ConversationCancelled = "conversation_cancelled"
+
 	// OnboardUserAskForPassword requests a password for the user to start
 	// interacting with the bot
 	OnboardUserAskForPassword = "onboard_user_ask_for_password"
@@ -37,6 +45,14 @@ const (
 	// from cache.
 	OnboardUserDecryptionFailed = "onboard_user_decryption_failed"
 
+	// OnboardUserShowRecoveryCodes is a response showing a new user their one-time
+	// recovery codes. Codes are only shown once
+	OnboardUserShowRecoveryCodes = "onboard_user_show_recovery_codes"
+
+	// OnboardUserRecoveryCodesFailed is a response when we are unable to create
+	// recovery codes for a new user
+	OnboardUserRecoveryCodesFailed = "onboard_user_recovery_codes_failed"
+
 	// OnboardUserAskForCurrency is a response to check what currency the user would
 	// like to receive expense history in.
 	OnboardUserAskForCurrency = "onboard_user_ask_for_currency"
@@ -45,15 +61,48 @@ const (
 	// currency ISO.
 	OnboardUserInvalidCurrency = "onboard_user_invalid_currency"
 
+	// OnboardUserAskForTimezone is a response to check which timezone the user
+	// lives in
+	OnboardUserAskForTimezone = "onboard_user_ask_for_timezone"
+
+	// OnboardUserInvalidTimezone is a response when a user does not give us a valid
+	// timezone
+	OnboardUserInvalidTimezone = "onboard_user_invalid_timezone"
+
 	// OnboardUserSayOutro is sent when a user successfully sets a password
 	OnboardUserSayOutro = "onboard_user_say_outro"
 
-	// TrackExpenseSuccess is a response when the bot successfully tracks an expense
+	// TrackExpenseSuccess is a response when the bot successfully tracks an expense.
+	// It includes the date of the expense.
 	TrackExpenseSuccess = "track_expense_success"
 
+	// TrackExpenseBatchSuccess is a response when the bot successfully tracks
+	// several expenses from a single message
+	TrackExpenseBatchSuccess = "track_expense_batch_success"
+
 	// TrackExpenseError is a response when a tracking expense request failed
 	TrackExpenseError = "track_expense_error"
 
+	// TrackExpenseAskForDescription is a response when a user tracks an expense
+	// without describing it
+	TrackExpenseAskForDescription = "track_expense_ask_for_description"
+
+	// TrackExpenseAskForCurrency is a response when a user tracks an expense
+	// without a currency
+	TrackExpenseAskForCurrency = "track_expense_ask_for_currency"
+
+	// TrackExpenseInvalidCurrency is a response when a user does not give us a
+	// valid currency for an expense
+	TrackExpenseInvalidCurrency = "track_expense_invalid_currency"
+
+	// TrackExpenseConfirm is a response when we are not confident we understood
+	// an expense. We must first get confirmation before tracking it.
+	TrackExpenseConfirm = "track_expense_confirm"
+
+	// TrackExpenseRejected is a response when a user tells us we misunderstood
+	// their expense
+	TrackExpenseRejected = "track_expense_rejected"
+
 	// GetExpenseTotalSuccess is a response when a user requests for expense total
 	// by time period
 	GetExpenseTotalSuccess = "get_expense_total_success"
@@ -74,6 +123,134 @@ const (
 	// GetExpenseTotalCancel is a response when the user requests the bot to cancel
 	// the query
 	GetExpenseTotalCancel = "get_expense_total_cancel"
+
+	// GetExpenseTotalNewRecoveryCodes is a message showing a user their new one-time
+	// recovery codes after their key pair was replaced. Codes are only shown once
+	GetExpenseTotalNewRecoveryCodes = "get_expense_total_new_recovery_codes"
+
+	// GetCategoryTotalSuccess is a response when a user requests for expense total
+	// of a single category
+	GetCategoryTotalSuccess = "get_category_total_success"
+
+	// GetCategoryTotalBreakdown is a response when a user requests for expense totals
+	// of every category
+	GetCategoryTotalBreakdown = "get_category_total_breakdown"
+
+	// GetCategoryTotalEmpty is a response when a category breakdown is requested for
+	// a period without any expenses
+	GetCategoryTotalEmpty = "get_category_total_empty"
+
+	// GetCategoryTotalInvalidCategory is a response when a category total is
+	// requested without a category
+	GetCategoryTotalInvalidCategory = "get_category_total_invalid_category"
+
+	// GetExpenseListSuccess is a response containing the final page of a user's
+	// itemized expense history
+	GetExpenseListSuccess = "get_expense_list_success"
+
+	// GetExpenseListMore is a response containing a page of a user's itemized
+	// expense history when more pages are available
+	GetExpenseListMore = "get_expense_list_more"
+
+	// GetExpenseListEmpty is a response when a user has no expense history to list
+	GetExpenseListEmpty = "get_expense_list_empty"
+
+	// ManageSettingsShow is a response containing a summary of a user's settings
+	ManageSettingsShow = "manage_settings_show"
+
+	// ManageSettingsAskForSetting is a response asking the user which setting they
+	// would like to change
+	ManageSettingsAskForSetting = "manage_settings_ask_for_setting"
+
+	// ManageSettingsInvalidSetting is a response when a user chooses a setting we
+	// cannot change
+	ManageSettingsInvalidSetting = "manage_settings_invalid_setting"
+
+	// ManageSettingsAskForValue is a response asking the user for the new value
+	// of a setting
+	ManageSettingsAskForValue = "manage_settings_ask_for_value"
+
+	// ManageSettingsInvalidValue is a response when a user supplies an invalid value
+	// for a setting
+	ManageSettingsInvalidValue = "manage_settings_invalid_value"
+
+	// ManageSettingsSuccess is a response when a setting was changed
+	ManageSettingsSuccess = "manage_settings_success"
+
+	// ChangePasswordAskForOld is a response asking the user for their current password
+	ChangePasswordAskForOld = "change_password_ask_for_old"
+
+	// ChangePasswordInvalidOld is a response when a user supplies the wrong current
+	// password
+	ChangePasswordInvalidOld = "change_password_invalid_old"
+
+	// ChangePasswordAskForNew is a response asking the user for their new password
+	ChangePasswordAskForNew = "change_password_ask_for_new"
+
+	// ChangePasswordConfirmNew is a response when a user submits a new password. We must
+	// confirm the new password is correct
+	ChangePasswordConfirmNew = "change_password_confirm_new"
+
+	// ChangePasswordFailed is a response when we fail to change a user's password
+	ChangePasswordFailed = "change_password_failed"
+
+	// ChangePasswordSuccess is a response when a user's password was changed
+	ChangePasswordSuccess = "change_password_success"
+
+	// ResetPasswordAskForCode is a response asking the user for one of their
+	// recovery codes
+	ResetPasswordAskForCode = "reset_password_ask_for_code"
+
+	// ResetPasswordInvalidCode is a response when a user supplies a recovery code
+	// that does not exist or was already used
+	ResetPasswordInvalidCode = "reset_password_invalid_code"
+
+	// ResetPasswordFailed is a response when we fail to reset a user's password
+	ResetPasswordFailed = "reset_password_failed"
+
+	// ResetPasswordSuccess is a response when a user's password was reset
+	ResetPasswordSuccess = "reset_password_success"
+
+	// UndoExpenseConfirm is a response asking the user to confirm removal of their
+	// last tracked expense
+	UndoExpenseConfirm = "undo_expense_confirm"
+
+	// UndoExpenseConfirmError is a response when a user responds to a removal
+	// confirmation prompt with invalid text
+	UndoExpenseConfirmError = "undo_expense_confirm_error"
+
+	// UndoExpenseNotFound is a response when a user has no expenses to remove or edit
+	UndoExpenseNotFound = "undo_expense_not_found"
+
+	// UndoExpenseSuccess is a response when an expense was removed
+	UndoExpenseSuccess = "undo_expense_success"
+
+	// UndoExpenseError is a response when we fail to remove an expense
+	UndoExpenseError = "undo_expense_error"
+
+	// DeleteExpenseChoose is a response listing recent expenses for the user
+	// to choose from
+	DeleteExpenseChoose = "delete_expense_choose"
+
+	// DeleteExpenseInvalidChoice is a response when a user does not choose an
+	// expense from the list
+	DeleteExpenseInvalidChoice = "delete_expense_invalid_choice"
+
+	// EditExpenseAskForField is a response asking the user which field of their
+	// last expense they would like to change
+	EditExpenseAskForField = "edit_expense_ask_for_field"
+
+	// EditExpenseInvalidField is a response when a user chooses a field we cannot change
+	EditExpenseInvalidField = "edit_expense_invalid_field"
+
+	// EditExpenseAskForValue is a response asking the user for the new value of a field
+	EditExpenseAskForValue = "edit_expense_ask_for_value"
+
+	// EditExpenseInvalidValue is a response when a user supplies an invalid value
+	EditExpenseInvalidValue = "edit_expense_invalid_value"
+
+	// EditExpenseSuccess is a response when an expense was changed
+	EditExpenseSuccess = "edit_expense_success"
 )
 
 // BotResponse is a message delivered to the User from the Bot
@@ -94,6 +271,16 @@ var MessageMap = map[string][]string{
 
 		"What you want!? I'm trying to take a vacation",
 	},
+	ConfirmationInvalid: []string{
+		"huh? Just say 'yes' or 'no'",
+
+		"I don't get it. It's a yes or no question!",
+	},
+	ConversationCancelled: []string{
+		"ok, forget about it. Message me if you change your mind.",
+
+		"alright, never mind then",
+	},
 	GetExpenseTotalError: []string{
 		"ehhh oh no... Idk what happened. Try again later.",
 	},
@@ -105,7 +292,8 @@ var MessageMap = map[string][]string{
 		"hmmm.... {{var}}",
 	},
 	GetExpenseTotalInvalidPeriod: []string{
-		"I'm not that smart. Ask me something like 'how much did I spend today'",
+		"I'm not that smart. Ask me something like 'how much did I spend today', " +
+			"'how much did I spend last month' or 'how much did I spend from march 1 to march 15'",
 
 		"ask me something later. Dennis is on vacation",
 	},
@@ -124,14 +312,146 @@ var MessageMap = map[string][]string{
 	GetExpenseTotalCancel: []string{
 		"ok, just message me if you change your mind later.",
 	},
+	GetExpenseTotalNewRecoveryCodes: []string{
+		"btw I upgraded the encryption on your account, so your old recovery codes " +
+			"don't work anymore. Here are your new ones:\n{{var}}\nWrite them down somewhere " +
+			"safe because I won't show them again.",
+	},
+	GetCategoryTotalSuccess: []string{
+		"You spent {{var}}",
+
+		"lets see now... looks like {{var}}",
+	},
+	GetCategoryTotalBreakdown: []string{
+		"here's where your money went:\n{{var}}",
+
+		"ok I did the math:\n{{var}}",
+	},
+	GetCategoryTotalEmpty: []string{
+		"you didn't spend anything! Dennis is proud of you",
+	},
+	GetCategoryTotalInvalidCategory: []string{
+		"what did you spend it on? Ask me something like 'how much did I spend on food this month'",
+	},
+	GetExpenseListSuccess: []string{
+		"here's what you spent:\n{{var}}",
+
+		"this is everything:\n{{var}}",
+	},
+	GetExpenseListMore: []string{
+		"here's what you spent:\n{{var}}\n\nthere's more. Just say 'more' to see the rest",
+	},
+	GetExpenseListEmpty: []string{
+		"you didn't spend anything. Dennis is proud of you",
+
+		"nothing to show here",
+	},
+	ManageSettingsShow: []string{
+		"here are your settings:\n{{var}}",
+	},
+	ManageSettingsAskForSetting: []string{
+		"what do you want to change? You can say currency, timezone or week start",
+	},
+	ManageSettingsInvalidSetting: []string{
+		"I can only change your currency, timezone or week start. Or say 'cancel'",
+	},
+	ManageSettingsAskForValue: []string{
+		"ok, what should your {{var}} be?",
+	},
+	ManageSettingsInvalidValue: []string{
+		"hmm that doesn't look like a valid {{var}}. Try again or say 'cancel'",
+	},
+	ManageSettingsSuccess: []string{
+		"done! here are your new settings:\n{{var}}",
+	},
+	ChangePasswordAskForOld: []string{
+		"ok, what's your current password?",
+	},
+	ChangePasswordInvalidOld: []string{
+		"nope, that's not your current password. Try again or say 'cancel'",
+	},
+	ChangePasswordAskForNew: []string{
+		"got it. What do you want your new password to be?",
+	},
+	ChangePasswordConfirmNew: []string{
+		"alright, your new password is '{{var}}'. Is that right? Just say yes or no.",
+	},
+	ChangePasswordFailed: []string{
+		"ehhh oh no... I couldn't change your password. Your old password still works.",
+	},
+	ChangePasswordSuccess: []string{
+		"done! Use your new password from now on",
+	},
+	ResetPasswordAskForCode: []string{
+		"forgot your password? No problem. What's one of your recovery codes? " +
+			"Or say 'cancel'",
+	},
+	ResetPasswordInvalidCode: []string{
+		"that's not one of your recovery codes, or it was already used. Try another or " +
+			"say 'cancel'",
+	},
+	ResetPasswordFailed: []string{
+		"ehhh oh no... I couldn't reset your password. Your recovery code still works.",
+	},
+	ResetPasswordSuccess: []string{
+		"done! Use your new password from now on. You have {{var}} recovery codes left",
+	},
+	UndoExpenseConfirm: []string{
+		"you want me to erase what you spent on {{var}}? Just say yes or no",
+
+		"remove your last expense from {{var}}? yes or no?",
+	},
+	UndoExpenseConfirmError: []string{
+		"I don't get it. Just say yes or no!",
+	},
+	UndoExpenseNotFound: []string{
+		"hmm... you haven't tracked anything yet",
+	},
+	UndoExpenseSuccess: []string{
+		"poof! it's gone",
+
+		"ok erased it. Dennis never saw anything",
+	},
+	UndoExpenseError: []string{
+		"ehhh oh no... I couldn't do that. Try again later.",
+	},
+	DeleteExpenseChoose: []string{
+		"which one do you want to remove? Just tell me the number or say 'cancel'\n{{var}}",
+	},
+	DeleteExpenseInvalidChoice: []string{
+		"that's not on the list. Tell me a number or say 'cancel'",
+	},
+	EditExpenseAskForField: []string{
+		"your last expense was {{var}}. What do you want to change? You can say " +
+			"amount, currency, description or date",
+	},
+	EditExpenseInvalidField: []string{
+		"I can only change the amount, currency, description or date. Or say 'cancel'",
+	},
+	EditExpenseAskForValue: []string{
+		"ok, what should the {{var}} be?",
+	},
+	EditExpenseInvalidValue: []string{
+		"hmm that doesn't look like a valid {{var}}. Try again or say 'cancel'",
+	},
+	EditExpenseSuccess: []string{
+		"fixed it!",
+
+		"ok, I changed it. Dennis makes mistakes too",
+	},
 	TrackExpenseSuccess: []string{
-		"ok writing it down...",
+		"ok writing it down for {{var}}...",
+
+		"you spend so much. When you gon take me out? Anyway, it's down for {{var}}",
 
-		"you spend so much. When you gon take me out? today is dennis day!",
+		"okay one min. Let me get my calculator. Got it for {{var}}",
 
-		"okay one min. Let me get my calculator",
+		"writing.... and... done! That was {{var}}",
+	},
+	TrackExpenseBatchSuccess: []string{
+		"ok writing it all down. That's {{var}}",
 
-		"writing.... and... done!",
+		"tracked {{var}}. Busy day huh?",
 	},
 	TrackExpenseError: []string{
 		"I didn't get that. Try saying something like '1000RUB for lunch'",
@@ -139,6 +459,23 @@ var MessageMap = map[string][]string{
 		"hmm this is embarrassing. I have no idea what I'm doing. Try asking me to track " +
 			"12USD for food",
 	},
+	TrackExpenseAskForDescription: []string{
+		"what was it for? You can tag it too, like 'lunch #food'. Or say cancel to forget it.",
+	},
+	TrackExpenseAskForCurrency: []string{
+		"{{var}} in what currency? Say 'default' to use your usual currency.",
+	},
+	TrackExpenseInvalidCurrency: []string{
+		"I don't know that currency. Try a currency ISO like 'USD' or say 'default'.",
+	},
+	TrackExpenseConfirm: []string{
+		"did you mean {{var}}? Just say yes or no.",
+
+		"just to be sure, {{var}}? Yes or no?",
+	},
+	TrackExpenseRejected: []string{
+		"my bad. I didn't write anything down. Try saying it again like '1000RUB for lunch'",
+	},
 	OnboardUserAskForPassword: []string{
 		"I dont know you. I'm Dennis though, and I can track your finances. But first, " +
 			"you gotta make a password. What do you want your password to be?",
@@ -153,6 +490,14 @@ var MessageMap = map[string][]string{
 
 		"ok '{{var}}' right? Just say yes or no",
 	},
+	OnboardUserShowRecoveryCodes: []string{
+		"account created! Here are your recovery codes:\n{{var}}\nIf you ever forget " +
+			"your password, you can use one of these to reset it. Write them down somewhere " +
+			"safe because I won't show them again. Say ok when you're done.",
+	},
+	OnboardUserRecoveryCodesFailed: []string{
+		"uh oh I couldn't make your recovery codes. Say anything and I'll try again",
+	},
 	OnboardUserAskForCurrency: []string{
 		"what currency do you want to receive updates in? You can say something like 'USD' " +
 			"or 'SGD' or any other currency ISO",
@@ -160,6 +505,13 @@ var MessageMap = map[string][]string{
 	OnboardUserInvalidCurrency: []string{
 		"hey I don't understand that! Please say a currency ISO like 'USD' or 'JPY'",
 	},
+	OnboardUserAskForTimezone: []string{
+		"what timezone do you live in? You can say something like 'Asia/Singapore' " +
+			"or 'UTC+8'",
+	},
+	OnboardUserInvalidTimezone: []string{
+		"I don't know that timezone. Try something like 'America/New_York' or 'UTC-5'",
+	},
 	OnboardUserSayOutro: []string{
 		"got it! you're all set! Next time you buy something, just to tell me something " +
 			"like 450SGD for tickets",
@@ -12,8 +12,8 @@ func TestGeneratesMessage(t *testing.T) {
 	var message BotResponse
 	MessageMap = mocks.MessageMapMock
 
-	message = GetMessage("track_expense_success", "")
-	assert.Equal(t, BotResponse("Roger that!"), message)
+	message = GetMessage("track_expense_success", "Wed, Mar 14")
+	assert.Equal(t, BotResponse("Roger that, Wed, Mar 14!"), message)
 
 	message = GetMessage("get_expense_total_success", "20")
 	assert.Equal(t, BotResponse("You spent 20"), message)
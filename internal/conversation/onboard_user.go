@@ -21,8 +21,11 @@ func (i *OnboardUser) GetResponses() []func() (BotResponse, error) {
 		i.AskForPassword,
 		i.ConfirmPassword,
 		i.ValidatePassword,
+		i.ShowRecoveryCodes,
 		i.AskForCurrency,
 		i.ValidateCurrency,
+		i.AskForTimezone,
+		i.ValidateTimezone,
 		i.SayOutro,
 	}
 }
@@ -92,6 +95,27 @@ func (i *OnboardUser) ValidatePassword() (BotResponse, error) {
 	return i.SkipResponse()
 }
 
+// ShowRecoveryCodes creates one-time recovery codes for the new account and
+// shows them to the user. Codes are never shown again, so the user may reset
+// a forgotten password without losing their expenses.
+func (i *OnboardUser) ShowRecoveryCodes() (BotResponse, error) {
+	password, err := crypto.Decrypt(i.AuxData, i.actions.Config.SecretKey)
+	if err != nil {
+		return GetMessage(OnboardUserRecoveryCodesFailed, ""), err
+	}
+
+	manager := users.NewUserManager(i.actions.Db)
+	user := manager.GetByTelegramID(i.IncMessage.GetUser().ID)
+	codes, err := i.actions.CreateRecoveryCodes(user.ID, password)
+	if err != nil {
+		return GetMessage(OnboardUserRecoveryCodesFailed, ""), err
+	}
+
+	// The password is no longer needed for the remaining steps
+	i.AuxData = ""
+	return GetMessage(OnboardUserShowRecoveryCodes, strings.Join(codes, "\n")), nil
+}
+
 // AskForCurrency checks if a user would like to receive expense totals in a
 // a currency other than the default (USD).
 func (i *OnboardUser) AskForCurrency() (BotResponse, error) {
@@ -114,6 +138,28 @@ func (i *OnboardUser) ValidateCurrency() (BotResponse, error) {
 	return i.SkipResponse()
 }
 
+// AskForTimezone checks which timezone a user lives in so expenses are
+// dated by the user's local day.
+func (i *OnboardUser) AskForTimezone() (BotResponse, error) {
+	return GetMessage(OnboardUserAskForTimezone, ""), nil
+}
+
+// ValidateTimezone checks if a user supplied a valid timezone and updates
+// the user's related Settings.
+func (i *OnboardUser) ValidateTimezone() (BotResponse, error) {
+	timezone := i.IncMessage.GetMessage()
+	tID := i.IncMessage.GetUser().ID
+	manager := users.NewUserManager(i.actions.Db)
+	user := manager.GetByTelegramID(tID)
+
+	err := i.actions.SetUserTimezone(user.ID, timezone)
+	if err != nil {
+		return GetMessage(OnboardUserInvalidTimezone, ""), err
+	}
+
+	return i.SkipResponse()
+}
+
 // SayOutro confirms to the user that account creation is complete.
 func (i *OnboardUser) SayOutro() (BotResponse, error) {
 	i.EndConversation()
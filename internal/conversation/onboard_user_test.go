@@ -25,10 +25,10 @@ func (suite *OnboardUserSuite) SetupSuite() {
 	configFile := "../../config/config.json"
 	suite.Env = mocks.GetTestEnv(configFile)
 	suite.Action = &actions.Actions{
-		Db:         suite.Env.Db,
-		Cache:      suite.Env.Cache,
-		Config:     suite.Env.Config,
-		Alphapoint: &alphapoint.Client{},
+		Db:     suite.Env.Db,
+		Cache:  suite.Env.Cache,
+		Config: suite.Env.Config,
+		Rates:  &alphapoint.Client{},
 	}
 }
 
@@ -43,7 +43,7 @@ func (suite *OnboardUserSuite) BeforeTest(suiteName, testName string) {
 
 func (suite *OnboardUserSuite) TestGetResponseList() {
 	onboardUser := &OnboardUser{}
-	assert.Equal(suite.T(), 6, len(onboardUser.GetResponses()))
+	assert.Equal(suite.T(), 9, len(onboardUser.GetResponses()))
 }
 
 func (suite *OnboardUserSuite) TestAsksForPassword() {
@@ -187,6 +187,32 @@ func (suite *OnboardUserSuite) TestReturnsErrorForFailedAccountCreation() {
 	assert.Equal(suite.T(), BotResponse("Couldn't create account"), response)
 }
 
+func (suite *OnboardUserSuite) TestShowsRecoveryCodes() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("Yes")
+	json.Unmarshal(message, &incMessage)
+	suite.Action.CreateNewUser(mocks.TestUserID, "password")
+	password, _ := crypto.Encrypt("password", suite.Env.Config.SecretKey)
+
+	onboardUser := &OnboardUser{
+		&Conversation{
+			Step:       3,
+			IncMessage: incMessage,
+			AuxData:    password,
+		},
+		suite.Action,
+	}
+
+	response, err := onboardUser.ShowRecoveryCodes()
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), string(response), "Recovery codes ")
+	assert.Equal(suite.T(), "", onboardUser.AuxData)
+
+	manager := users.NewUserManager(suite.Env.Db)
+	user := manager.GetByTelegramID(mocks.TestUserID)
+	assert.Equal(suite.T(), users.RecoveryCodeCount, manager.CountRecoveryCodes(user.ID))
+}
+
 func (suite *OnboardUserSuite) TestAsksForCurrency() {
 	onboardUser := &OnboardUser{
 		&Conversation{},
@@ -229,10 +255,52 @@ func (suite *OnboardUserSuite) TestValidatesCurrency() {
 	assert.Equal(suite.T(), BotResponse(""), response)
 }
 
+func (suite *OnboardUserSuite) TestAsksForTimezone() {
+	onboardUser := &OnboardUser{
+		&Conversation{},
+		suite.Action,
+	}
+	response, err := onboardUser.AskForTimezone()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), BotResponse("What timezone do you live in?"), response)
+}
+
+func (suite *OnboardUserSuite) TestValidatesTimezone() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("Mars/Olympus")
+	json.Unmarshal(message, &incMessage)
+	mocks.CreateTestUser(suite.Env.Db, 0)
+
+	onboardUser := &OnboardUser{
+		&Conversation{
+			IncMessage: incMessage,
+		},
+		suite.Action,
+	}
+
+	response, err := onboardUser.ValidateTimezone()
+	assert.EqualError(suite.T(), err, "invalid timezone")
+	assert.Equal(suite.T(), BotResponse("Timezone is invalid"), response)
+
+	message = mocks.GetMockMessage("Asia/Tokyo")
+	json.Unmarshal(message, &incMessage)
+
+	onboardUser = &OnboardUser{
+		&Conversation{
+			IncMessage: incMessage,
+		},
+		suite.Action,
+	}
+
+	response, err = onboardUser.ValidateTimezone()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), BotResponse(""), response)
+}
+
 func (suite *OnboardUserSuite) TestSaysOutro() {
 	onboardUser := &OnboardUser{
 		&Conversation{
-			Step: 5,
+			Step: 8,
 		},
 		suite.Action,
 	}
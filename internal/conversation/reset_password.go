@@ -0,0 +1,130 @@
+package conversation
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	a "github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/crypto"
+)
+
+// ResetPassword is an Intent designed to replace a forgotten password using
+// one of the user's recovery codes.
+type ResetPassword struct {
+	*Conversation
+	actions *a.Actions
+}
+
+// passwordReset is the auxiliary data we hold on to while the user confirms
+// their new password. The recovery code and password are encrypted with the
+// app secret key.
+type passwordReset struct {
+	Code        string
+	NewPassword string
+}
+
+// GetResponses returns a list of functions each containing a BotResponse.
+func (i *ResetPassword) GetResponses() []func() (BotResponse, error) {
+	return []func() (BotResponse, error){
+		i.AskForRecoveryCode,
+		i.ValidateRecoveryCode,
+		i.AskForNewPassword,
+		i.ConfirmNewPassword,
+		i.SavePassword,
+	}
+}
+
+// AskForRecoveryCode requests the user for one of their recovery codes.
+func (i *ResetPassword) AskForRecoveryCode() (BotResponse, error) {
+	return GetMessage(ResetPasswordAskForCode, ""), nil
+}
+
+// ValidateRecoveryCode checks if the supplied code is one of the user's unused
+// recovery codes. It will return an empty response and nil error on success,
+// triggering the bot to skip over to the next response function in line.
+func (i *ResetPassword) ValidateRecoveryCode() (BotResponse, error) {
+	code := strings.TrimSpace(i.IncMessage.GetMessage())
+	if strings.ToLower(code) == "cancel" {
+		i.EndConversation()
+		return GetMessage(ConversationCancelled, ""), errors.New("user requested cancel")
+	}
+
+	if err := i.actions.ValidateRecoveryCode(i.BotUserID, code); err != nil {
+		return GetMessage(ResetPasswordInvalidCode, ""), err
+	}
+
+	encryptedCode, err := crypto.Encrypt(code, i.actions.Config.SecretKey)
+	if err != nil {
+		i.EndConversation()
+		return GetMessage(ResetPasswordFailed, ""), err
+	}
+
+	auxData, _ := json.Marshal(passwordReset{Code: encryptedCode})
+	i.AuxData = string(auxData)
+	return i.SkipResponse()
+}
+
+// AskForNewPassword requests the user for their new password.
+func (i *ResetPassword) AskForNewPassword() (BotResponse, error) {
+	return GetMessage(ChangePasswordAskForNew, ""), nil
+}
+
+// ConfirmNewPassword requests the user to confirm if the new password they
+// submitted is final.
+func (i *ResetPassword) ConfirmNewPassword() (BotResponse, error) {
+	password := i.IncMessage.GetMessage()
+	encryptedPass, err := crypto.Encrypt(password, i.actions.Config.SecretKey)
+	if err != nil {
+		i.EndConversation()
+		return GetMessage(ResetPasswordFailed, ""), err
+	}
+
+	var reset passwordReset
+	json.Unmarshal([]byte(i.AuxData), &reset)
+	reset.NewPassword = encryptedPass
+	auxData, _ := json.Marshal(reset)
+	i.AuxData = string(auxData)
+
+	return GetMessage(ChangePasswordConfirmNew, password), nil
+}
+
+// SavePassword replaces the user's password if they confirmed their new password.
+// The recovery code is used up and cached passwords are removed.
+func (i *ResetPassword) SavePassword() (BotResponse, error) {
+	userInput := strings.ToLower(i.IncMessage.GetMessage())
+
+	isConfirmed := userInput == "yes"
+	isRejected := userInput == "no"
+	if !isConfirmed && !isRejected {
+		return GetMessage(ConfirmationInvalid, ""), errors.New("response invalid")
+	}
+
+	i.EndConversation()
+	if isRejected {
+		return GetMessage(ConversationCancelled, ""), errors.New("password rejected")
+	}
+
+	var reset passwordReset
+	json.Unmarshal([]byte(i.AuxData), &reset)
+
+	secretKey := i.actions.Config.SecretKey
+	code, err := crypto.Decrypt(reset.Code, secretKey)
+	if err != nil {
+		return GetMessage(ResetPasswordFailed, ""), err
+	}
+
+	newPassword, err := crypto.Decrypt(reset.NewPassword, secretKey)
+	if err != nil {
+		return GetMessage(ResetPasswordFailed, ""), err
+	}
+
+	remaining, err := i.actions.ResetPassword(i.BotUserID, code, newPassword)
+	if err != nil {
+		return GetMessage(ResetPasswordFailed, ""), err
+	}
+
+	i.actions.Cache.Delete(i.Context(), passwordCacheKey(i.IncMessage.GetUser().ID))
+	return GetMessage(ResetPasswordSuccess, strconv.Itoa(remaining)), nil
+}
@@ -0,0 +1,132 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+	"github.com/fmitra/dennis-bot/pkg/crypto"
+	"github.com/fmitra/dennis-bot/pkg/telegram"
+	"github.com/fmitra/dennis-bot/pkg/users"
+	mocks "github.com/fmitra/dennis-bot/test"
+)
+
+type ResetPasswordSuite struct {
+	suite.Suite
+	Env    *mocks.TestEnv
+	Action *actions.Actions
+}
+
+func (suite *ResetPasswordSuite) SetupSuite() {
+	configFile := "../../config/config.json"
+	suite.Env = mocks.GetTestEnv(configFile)
+	suite.Action = &actions.Actions{
+		Db:     suite.Env.Db,
+		Cache:  suite.Env.Cache,
+		Config: suite.Env.Config,
+		Rates:  &alphapoint.Client{},
+	}
+}
+
+func (suite *ResetPasswordSuite) TearDownSuite() {
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *ResetPasswordSuite) BeforeTest(suiteName, testName string) {
+	MessageMap = mocks.MessageMapMock
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *ResetPasswordSuite) TestGetResponseList() {
+	resetPassword := &ResetPassword{}
+	assert.Equal(suite.T(), 5, len(resetPassword.GetResponses()))
+}
+
+func (suite *ResetPasswordSuite) TestResetsPassword() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("")
+	json.Unmarshal(message, &incMessage)
+
+	suite.Action.CreateNewUser(mocks.TestUserID, "my-password")
+	manager := users.NewUserManager(suite.Env.Db)
+	user := manager.GetByTelegramID(mocks.TestUserID)
+	originalKey, _ := user.GetPrivateKey("my-password")
+	codes, _ := suite.Action.CreateRecoveryCodes(user.ID, "my-password")
+
+	cacheKey := fmt.Sprintf("%s_password", strconv.Itoa(int(mocks.TestUserID)))
+	encryptedPass, _ := crypto.Encrypt("my-password", suite.Env.Config.SecretKey)
+	suite.Env.Cache.Set(context.Background(), cacheKey, encryptedPass, 180)
+
+	resetPassword := &ResetPassword{
+		&Conversation{
+			IncMessage: incMessage,
+			BotUserID:  user.ID,
+		},
+		suite.Action,
+	}
+	responses := resetPassword.GetResponses()
+
+	reply := func(text string) BotResponse {
+		message := mocks.GetMockMessage(text)
+		json.Unmarshal(message, &incMessage)
+		resetPassword.IncMessage = incMessage
+		return resetPassword.ProcessResponses(responses)
+	}
+
+	response := resetPassword.ProcessResponses(responses)
+	assert.Equal(suite.T(), BotResponse("Recovery code?"), response)
+
+	response = reply("abcde-fghjk")
+	assert.Equal(suite.T(), BotResponse("Invalid recovery code"), response)
+
+	response = reply(codes[2])
+	assert.Equal(suite.T(), BotResponse("New password?"), response)
+
+	response = reply("new-password")
+	assert.Equal(suite.T(), BotResponse("New password is new-password?"), response)
+
+	response = reply("yes")
+	expected := fmt.Sprintf("Password reset %d", users.RecoveryCodeCount-1)
+	assert.Equal(suite.T(), BotResponse(expected), response)
+	assert.Equal(suite.T(), -1, resetPassword.Step)
+
+	user = manager.GetByID(user.ID)
+	privateKey, err := user.GetPrivateKey("new-password")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), originalKey.D, privateKey.D)
+	assert.Error(suite.T(), manager.ValidateRecoveryCode(user.ID, codes[2]))
+
+	var cachedPassword string
+	err = suite.Env.Cache.Get(context.Background(), cacheKey, &cachedPassword)
+	assert.Error(suite.T(), err)
+}
+
+func (suite *ResetPasswordSuite) TestCancelsReset() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("cancel")
+	json.Unmarshal(message, &incMessage)
+
+	resetPassword := &ResetPassword{
+		&Conversation{
+			Step:       1,
+			IncMessage: incMessage,
+		},
+		suite.Action,
+	}
+
+	response, err := resetPassword.ValidateRecoveryCode()
+	assert.EqualError(suite.T(), err, "user requested cancel")
+	assert.Equal(suite.T(), BotResponse("Ok, never mind"), response)
+	assert.Equal(suite.T(), -1, resetPassword.Step)
+}
+
+func TestResetPasswordSuite(t *testing.T) {
+	suite.Run(t, new(ResetPasswordSuite))
+}
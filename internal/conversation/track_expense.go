@@ -1,11 +1,26 @@
 package conversation
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	a "github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/nlu"
 	"github.com/fmitra/dennis-bot/pkg/users"
-	"github.com/fmitra/dennis-bot/pkg/wit"
+	"github.com/fmitra/dennis-bot/pkg/utils"
 )
 
+// minConfidence is the lowest confidence at which we track an expense without
+// first asking the user if we understood them correctly.
+const minConfidence = 0.8
+
+// dateFormat is the format of expense dates we echo back to the user.
+const dateFormat = "Mon, Jan 2"
+
 // TrackExpense is an Intent designed to track a user's expenses.
 type TrackExpense struct {
 	*Conversation
@@ -15,28 +30,250 @@ type TrackExpense struct {
 // GetResponses proccesses a list of response functions.
 func (i *TrackExpense) GetResponses() []func() (BotResponse, error) {
 	return []func() (BotResponse, error){
+		i.AskForDescription,
+		i.SaveDescription,
+		i.AskForCurrency,
+		i.SaveCurrency,
+		i.AskForConfirmation,
+		i.ValidateConfirmation,
 		i.ConfirmExpense,
 	}
 }
 
-// ConfirmExpense starts an action to track the user's expense and returns
-// confirmation if it was successful or if it failed.
+// AskForDescription holds on to the expense as auxiliary data while we ask
+// the user for anything that is missing from it, starting with its description.
+// Expenses with a description, or several complete expenses from a single
+// message, skip over to the next response. Expenses keep a reference to the
+// message they were described in.
+func (i *TrackExpense) AskForDescription() (BotResponse, error) {
+	i.Message.Source = i.IncMessage.GetReference()
+	if i.Message.IsBatch() {
+		i.savePendingExpense(i.Message)
+		return i.SkipResponse()
+	}
+
+	if i.Message.Amount <= 0 {
+		i.EndConversation()
+		return GetMessage(TrackExpenseError, ""), nil
+	}
+
+	i.savePendingExpense(i.Message)
+	if i.Message.Description != "" {
+		return i.SkipResponse()
+	}
+
+	return GetMessage(TrackExpenseAskForDescription, ""), nil
+}
+
+// SaveDescription adds the description supplied by the user to the expense.
+// Category tags in the description are kept, for example "lunch #food".
+func (i *TrackExpense) SaveDescription() (BotResponse, error) {
+	expense := i.getPendingExpense()
+	if expense.IsBatch() || expense.Description != "" {
+		return i.SkipResponse()
+	}
+
+	userInput := strings.TrimSpace(i.IncMessage.GetMessage())
+	if strings.ToLower(userInput) == "cancel" {
+		i.EndConversation()
+		return GetMessage(ConversationCancelled, ""), errors.New("user requested cancel")
+	}
+
+	category, text := utils.ParseCategory(userInput)
+	expense.Description = utils.ParseDescription(text)
+	if expense.Description == "" {
+		return GetMessage(TrackExpenseAskForDescription, ""), errors.New("no description")
+	}
+
+	if expense.Category == "" {
+		expense.Category = category
+	}
+
+	i.savePendingExpense(expense)
+	return i.SkipResponse()
+}
+
+// AskForCurrency asks the user for the currency of the expense. Expenses
+// with a currency skip over to the next response.
+func (i *TrackExpense) AskForCurrency() (BotResponse, error) {
+	expense := i.getPendingExpense()
+	if expense.IsBatch() || expense.Currency != "" {
+		return i.SkipResponse()
+	}
+
+	amount := strconv.FormatFloat(expense.Amount, 'f', -1, 64)
+	return GetMessage(TrackExpenseAskForCurrency, amount), nil
+}
+
+// SaveCurrency adds the currency supplied by the user to the expense as an ISO,
+// symbol or name, for example "EUR", "€" or "euros". Users may reply "default"
+// to use their preferred currency.
+func (i *TrackExpense) SaveCurrency() (BotResponse, error) {
+	expense := i.getPendingExpense()
+	if expense.IsBatch() || expense.Currency != "" {
+		return i.SkipResponse()
+	}
+
+	userInput := strings.TrimSpace(i.IncMessage.GetMessage())
+	switch strings.ToLower(userInput) {
+	case "cancel":
+		i.EndConversation()
+		return GetMessage(ConversationCancelled, ""), errors.New("user requested cancel")
+	case "default":
+		manager := users.NewSettingManager(i.actions.Db)
+		expense.Currency = manager.GetCurrency(i.BotUserID)
+	default:
+		currency, err := utils.ParseCurrency(userInput)
+		if err != nil {
+			return GetMessage(TrackExpenseInvalidCurrency, ""), err
+		}
+		expense.Currency = currency
+	}
+
+	i.savePendingExpense(expense)
+	return i.SkipResponse()
+}
+
+// AskForConfirmation asks the user to confirm an expense if we are not
+// confident we understood it, for example if the NLU backend found several
+// amounts. Expenses we are confident in skip over to the next response.
+func (i *TrackExpense) AskForConfirmation() (BotResponse, error) {
+	expense := i.getPendingExpense()
+	if isCertain(expense) {
+		return i.SkipResponse()
+	}
+
+	if !expense.IsBatch() {
+		date := i.getExpenseDate(expense)
+		return GetMessage(TrackExpenseConfirm, describeExpense(expense, date)), nil
+	}
+
+	descriptions := make([]string, len(expense.Expenses))
+	for index, batchExpense := range expense.Expenses {
+		descriptions[index] = describeExpense(batchExpense, i.getExpenseDate(batchExpense))
+	}
+	return GetMessage(TrackExpenseConfirm, strings.Join(descriptions, ", ")), nil
+}
+
+// ValidateConfirmation checks if the user confirmed the expense we asked
+// about. It will return an empty response and nil error on success, triggering
+// the bot to skip over to the next response function in line.
+func (i *TrackExpense) ValidateConfirmation() (BotResponse, error) {
+	if isCertain(i.getPendingExpense()) {
+		return i.SkipResponse()
+	}
+
+	userInput := strings.ToLower(strings.TrimSpace(i.IncMessage.GetMessage()))
+	isConfirmed := userInput == "yes"
+	isRejected := userInput == "no"
+	if !isConfirmed && !isRejected {
+		return GetMessage(ConfirmationInvalid, ""), errors.New("response invalid")
+	}
+
+	if isRejected {
+		i.EndConversation()
+		return GetMessage(TrackExpenseRejected, ""), errors.New("expense rejected")
+	}
+
+	return i.SkipResponse()
+}
+
+// ConfirmExpense tracks the user's expense and returns confirmation if it was
+// successful or if it failed. Successful confirmations include the date the
+// expense was tracked on, in the user's timezone. The expense is saved before
+// we respond, so a conversation still being handled during shutdown is only
+// finished once its expense is written.
 func (i *TrackExpense) ConfirmExpense() (BotResponse, error) {
-	var messageVar string
 	var response BotResponse
-	overview := i.WitResponse.GetMessageOverview()
 
 	telegramUserID := i.IncMessage.GetUser().ID
 	manager := users.NewUserManager(i.actions.Db)
 	user := manager.GetByTelegramID(telegramUserID)
-	publicKey, _ := user.GetPublicKey()
+	publicKey, err := user.GetPublicKey()
+	if err != nil {
+		i.EndConversation()
+		return GetMessage(TrackExpenseError, ""), err
+	}
 
-	response = GetMessage(TrackExpenseError, messageVar)
-	if overview == wit.TrackingRequestedSuccess {
-		go i.actions.CreateNewExpense(i.WitResponse, i.BotUserID, publicKey)
-		response = GetMessage(TrackExpenseSuccess, messageVar)
+	expense := i.getPendingExpense()
+	if !expense.IsComplete() {
+		i.EndConversation()
+		return GetMessage(TrackExpenseError, ""), nil
+	}
+
+	err = i.actions.CreateNewExpense(i.Context(), expense, i.BotUserID, publicKey)
+	switch {
+	case err != nil:
+		response = GetMessage(TrackExpenseError, "")
+	case expense.IsBatch():
+		response = GetMessage(TrackExpenseBatchSuccess, describeBatch(expense))
+	default:
+		date := i.getExpenseDate(expense)
+		response = GetMessage(TrackExpenseSuccess, date.Format(dateFormat))
 	}
 
 	i.EndConversation()
 	return response, nil
 }
+
+// getPendingExpense returns the expense held on to as auxiliary data. The
+// parsed user message is the expense if there is no auxiliary data yet.
+func (i *TrackExpense) getPendingExpense() nlu.Message {
+	if i.AuxData == "" {
+		return i.Message
+	}
+
+	var expense nlu.Message
+	json.Unmarshal([]byte(i.AuxData), &expense)
+	return expense
+}
+
+// savePendingExpense holds on to an expense as auxiliary data while we ask
+// the user about it.
+func (i *TrackExpense) savePendingExpense(expense nlu.Message) {
+	auxData, _ := json.Marshal(expense)
+	i.AuxData = string(auxData)
+}
+
+// getExpenseDate resolves the date of an expense in the user's timezone, for
+// example "last friday" is the most recent Friday of the user's local week.
+func (i *TrackExpense) getExpenseDate(expense nlu.Message) time.Time {
+	settings := users.NewSettingManager(i.actions.Db)
+	now := time.Now().In(settings.GetLocation(i.BotUserID))
+	return expense.GetDate(now)
+}
+
+// isCertain checks if we are confident enough in an expense to track it
+// without asking the user for confirmation.
+func isCertain(expense nlu.Message) bool {
+	return expense.Confidence >= minConfidence && !expense.Ambiguous
+}
+
+// describeExpense summarizes an expense as we understood it, for example
+// "200 RUB for Lunch on Fri, Mar 14".
+func describeExpense(m nlu.Message, date time.Time) string {
+	amount := strconv.FormatFloat(m.Amount, 'f', -1, 64)
+	return fmt.Sprintf("%s %s for %s on %s", amount, m.Currency, m.Description, date.Format(dateFormat))
+}
+
+// describeBatch summarizes several expenses tracked from a single message, for
+// example "3 expenses totalling 1450 RUB". Totals in different currencies are
+// listed separately, for example "2 expenses totalling 1200 RUB and 5 USD".
+func describeBatch(m nlu.Message) string {
+	var currencies []string
+	totals := make(map[string]float64)
+	for _, expense := range m.Expenses {
+		if _, ok := totals[expense.Currency]; !ok {
+			currencies = append(currencies, expense.Currency)
+		}
+		totals[expense.Currency] += expense.Amount
+	}
+
+	amounts := make([]string, len(currencies))
+	for index, currency := range currencies {
+		total := strconv.FormatFloat(totals[currency], 'f', -1, 64)
+		amounts[index] = fmt.Sprintf("%s %s", total, currency)
+	}
+
+	return fmt.Sprintf("%d expenses totalling %s", len(m.Expenses), strings.Join(amounts, " and "))
+}
@@ -2,65 +2,73 @@ package conversation
 
 import (
 	"encoding/json"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/fmitra/dennis-bot/internal/actions"
 	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+	"github.com/fmitra/dennis-bot/pkg/nlu"
 	"github.com/fmitra/dennis-bot/pkg/telegram"
-	"github.com/fmitra/dennis-bot/pkg/wit"
+	"github.com/fmitra/dennis-bot/pkg/users"
 	mocks "github.com/fmitra/dennis-bot/test"
 )
 
 type TrackExpenseSuite struct {
 	suite.Suite
-	Env    *mocks.TestEnv
-	Action *actions.Actions
+	Env         *mocks.TestEnv
+	Action      *actions.Actions
+	RatesServer *httptest.Server
 }
 
 func (suite *TrackExpenseSuite) SetupSuite() {
 	configFile := "../../config/config.json"
 	suite.Env = mocks.GetTestEnv(configFile)
+
+	// Expenses are saved before we respond, so rates must be available
+	// for both realtime and daily requests
+	suite.RatesServer = mocks.MakeTestServer(`{
+		"Realtime Currency Exchange Rate": {
+			"5. Exchange Rate": ".7"
+		},
+		"Time Series FX (Daily)": {
+			"2018-03-14": { "4. close": ".7" }
+		}
+	}`)
 	suite.Action = &actions.Actions{
-		Db:         suite.Env.Db,
-		Cache:      suite.Env.Cache,
-		Config:     suite.Env.Config,
-		Alphapoint: &alphapoint.Client{},
+		Db:     suite.Env.Db,
+		Cache:  suite.Env.Cache,
+		Config: suite.Env.Config,
+		Rates:  &alphapoint.Client{BaseURL: suite.RatesServer.URL},
 	}
 }
 
 func (suite *TrackExpenseSuite) TearDownSuite() {
+	suite.RatesServer.Close()
 	mocks.CleanUpEnv(suite.Env)
 }
 
 func (suite *TrackExpenseSuite) BeforeTest(suiteName, testName string) {
 	MessageMap = mocks.MessageMapMock
 	mocks.CleanUpEnv(suite.Env)
+	mocks.CreateTestUser(suite.Env.Db, 0)
 }
 
 func (suite *TrackExpenseSuite) TestGetResponseList() {
 	trackExpense := &TrackExpense{}
-	assert.Equal(suite.T(), 1, len(trackExpense.GetResponses()))
+	assert.Equal(suite.T(), 7, len(trackExpense.GetResponses()))
 }
 
 func (suite *TrackExpenseSuite) TestReturnsSuccessMessage() {
-	rawWitResponse := []byte(`{
-		"entities": {
-			"amount": [
-				{ "value": "20 SGD", "confidence": 100.00 }
-			],
-			"datetime": [
-				{ "value": "", "confidence": 100.00 }
-			],
-			"description": [
-				{ "value": "Food", "confidence": 100.00 }
-			]
-		}
-	}`)
-	var witResponse wit.Response
-	json.Unmarshal(rawWitResponse, &witResponse)
+	nluMessage := nlu.Message{
+		Intent:      nlu.TrackExpense,
+		Amount:      20,
+		Currency:    "SGD",
+		Description: "Food",
+	}
 
 	var incMessage telegram.IncomingMessage
 	message := mocks.GetMockMessage("")
@@ -68,29 +76,22 @@ func (suite *TrackExpenseSuite) TestReturnsSuccessMessage() {
 
 	trackExpense := &TrackExpense{
 		&Conversation{
-			Step:        0,
-			WitResponse: witResponse,
-			IncMessage:  incMessage,
+			Step:       0,
+			Message:    nluMessage,
+			IncMessage: incMessage,
 		},
 		suite.Action,
 	}
 	response, err := trackExpense.ConfirmExpense()
-	assert.Equal(suite.T(), BotResponse("Roger that!"), response)
+	today := time.Now().UTC().Format(dateFormat)
+	assert.Equal(suite.T(), BotResponse("Roger that, "+today+"!"), response)
 	assert.NoError(suite.T(), err)
 }
 
 func (suite *TrackExpenseSuite) TestReturnsErrorMessage() {
-	rawWitResponse := []byte(`{
-		"entities": {
-			"amount": [],
-			"datetime": [
-				{ "value": "", "confidence": 100.00 }
-			],
-			"description": []
-		}
-	}`)
-	var witResponse wit.Response
-	json.Unmarshal(rawWitResponse, &witResponse)
+	nluMessage := nlu.Message{
+		Intent: nlu.Unknown,
+	}
 
 	var incMessage telegram.IncomingMessage
 	message := mocks.GetMockMessage("")
@@ -98,9 +99,9 @@ func (suite *TrackExpenseSuite) TestReturnsErrorMessage() {
 
 	trackExpense := &TrackExpense{
 		&Conversation{
-			Step:        0,
-			WitResponse: witResponse,
-			IncMessage:  incMessage,
+			Step:       0,
+			Message:    nluMessage,
+			IncMessage: incMessage,
 		},
 		suite.Action,
 	}
@@ -109,6 +110,354 @@ func (suite *TrackExpenseSuite) TestReturnsErrorMessage() {
 	assert.NoError(suite.T(), err)
 }
 
+func (suite *TrackExpenseSuite) TestFailsWithoutPublicKey() {
+	nluMessage := nlu.Message{
+		Intent:      nlu.TrackExpense,
+		Amount:      20,
+		Currency:    "SGD",
+		Description: "Food",
+	}
+
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("")
+	json.Unmarshal(message, &incMessage)
+
+	// Without a user there is no public key, and expenses are never
+	// saved unencrypted
+	mocks.CleanUpEnv(suite.Env)
+	trackExpense := &TrackExpense{
+		&Conversation{
+			Step:       0,
+			Message:    nluMessage,
+			IncMessage: incMessage,
+		},
+		suite.Action,
+	}
+	response, err := trackExpense.ConfirmExpense()
+	assert.Equal(suite.T(), BotResponse("Whoops!"), response)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), -1, trackExpense.Step)
+}
+
+func (suite *TrackExpenseSuite) TestTracksConfidentExpense() {
+	nluMessage := nlu.Message{
+		Intent:      nlu.TrackExpense,
+		Amount:      20,
+		Currency:    "SGD",
+		Description: "Food",
+		Confidence:  0.95,
+	}
+
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("20 SGD for Food")
+	json.Unmarshal(message, &incMessage)
+
+	trackExpense := &TrackExpense{
+		&Conversation{
+			Message:    nluMessage,
+			IncMessage: incMessage,
+		},
+		suite.Action,
+	}
+	response := trackExpense.ProcessResponses(trackExpense.GetResponses())
+	today := time.Now().UTC().Format(dateFormat)
+	assert.Equal(suite.T(), BotResponse("Roger that, "+today+"!"), response)
+	assert.Equal(suite.T(), -1, trackExpense.Step)
+}
+
+func (suite *TrackExpenseSuite) TestConfirmsUncertainExpense() {
+	var testCases = []nlu.Message{
+		{
+			Intent:      nlu.TrackExpense,
+			Amount:      20,
+			Currency:    "SGD",
+			Description: "Food",
+			Confidence:  0.5,
+		},
+		{
+			Intent:      nlu.TrackExpense,
+			Amount:      20,
+			Currency:    "SGD",
+			Description: "Food",
+			Confidence:  1,
+			Ambiguous:   true,
+		},
+	}
+
+	today := time.Now().UTC().Format(dateFormat)
+	for _, nluMessage := range testCases {
+		var incMessage telegram.IncomingMessage
+		message := mocks.GetMockMessage("20 SGD for Food")
+		json.Unmarshal(message, &incMessage)
+
+		trackExpense := &TrackExpense{
+			&Conversation{
+				Message:    nluMessage,
+				IncMessage: incMessage,
+			},
+			suite.Action,
+		}
+		responses := trackExpense.GetResponses()
+
+		response := trackExpense.ProcessResponses(responses)
+		assert.Equal(suite.T(), BotResponse("Did you mean 20 SGD for Food on "+today+"?"), response)
+		assert.Equal(suite.T(), 5, trackExpense.Step)
+
+		message = mocks.GetMockMessage("maybe")
+		json.Unmarshal(message, &incMessage)
+		trackExpense.SetLastUserMessage(nlu.Message{Intent: nlu.Unknown}, incMessage)
+		response = trackExpense.ProcessResponses(responses)
+		assert.Equal(suite.T(), BotResponse("Please say yes or no"), response)
+		assert.Equal(suite.T(), 5, trackExpense.Step)
+
+		message = mocks.GetMockMessage("Yes")
+		json.Unmarshal(message, &incMessage)
+		trackExpense.SetLastUserMessage(nlu.Message{Intent: nlu.Unknown}, incMessage)
+		response = trackExpense.ProcessResponses(responses)
+		assert.Equal(suite.T(), BotResponse("Roger that, "+today+"!"), response)
+		assert.Equal(suite.T(), -1, trackExpense.Step)
+	}
+}
+
+func (suite *TrackExpenseSuite) TestRejectsUncertainExpense() {
+	nluMessage := nlu.Message{
+		Intent:      nlu.TrackExpense,
+		Amount:      20,
+		Currency:    "SGD",
+		Description: "Food",
+		Date:        "yesterday",
+		Confidence:  0.5,
+	}
+
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("20 SGD for Food yesterday")
+	json.Unmarshal(message, &incMessage)
+
+	trackExpense := &TrackExpense{
+		&Conversation{
+			Message:    nluMessage,
+			IncMessage: incMessage,
+		},
+		suite.Action,
+	}
+	responses := trackExpense.GetResponses()
+
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(dateFormat)
+	response := trackExpense.ProcessResponses(responses)
+	assert.Equal(suite.T(), BotResponse("Did you mean 20 SGD for Food on "+yesterday+"?"), response)
+
+	message = mocks.GetMockMessage("no")
+	json.Unmarshal(message, &incMessage)
+	trackExpense.SetLastUserMessage(nlu.Message{Intent: nlu.Unknown}, incMessage)
+	response = trackExpense.ProcessResponses(responses)
+	assert.Equal(suite.T(), BotResponse("Not tracked"), response)
+	assert.Equal(suite.T(), -1, trackExpense.Step)
+}
+
+func (suite *TrackExpenseSuite) TestEchoesExpenseDateInUserTimezone() {
+	user := users.NewUserManager(suite.Env.Db).GetByTelegramID(mocks.TestUserID)
+	users.NewSettingManager(suite.Env.Db).UpdateTimezone(user.ID, "Pacific/Kiritimati")
+
+	nluMessage := nlu.Message{
+		Intent:      nlu.TrackExpense,
+		Amount:      20,
+		Currency:    "SGD",
+		Description: "Food",
+		Date:        "2 days ago",
+		Confidence:  1,
+	}
+
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("20 SGD for Food 2 days ago")
+	json.Unmarshal(message, &incMessage)
+
+	trackExpense := &TrackExpense{
+		&Conversation{
+			Message:    nluMessage,
+			IncMessage: incMessage,
+			BotUserID:  user.ID,
+		},
+		suite.Action,
+	}
+	location, _ := time.LoadLocation("Pacific/Kiritimati")
+	date := time.Now().In(location).AddDate(0, 0, -2).Format(dateFormat)
+	response := trackExpense.ProcessResponses(trackExpense.GetResponses())
+	assert.Equal(suite.T(), BotResponse("Roger that, "+date+"!"), response)
+}
+
+func (suite *TrackExpenseSuite) TestTracksBatchOfExpenses() {
+	nluMessage := nlu.Message{
+		Intent:     nlu.TrackExpense,
+		Confidence: 1,
+		Expenses: []nlu.Message{
+			{Intent: nlu.TrackExpense, Amount: 200, Currency: "RUB", Description: "lunch", Confidence: 1},
+			{Intent: nlu.TrackExpense, Amount: 50, Currency: "RUB", Description: "coffee", Confidence: 1},
+			{Intent: nlu.TrackExpense, Amount: 5, Currency: "USD", Description: "taxi", Confidence: 1},
+		},
+	}
+
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("200RUB for lunch, 50RUB for coffee, 5USD taxi")
+	json.Unmarshal(message, &incMessage)
+
+	trackExpense := &TrackExpense{
+		&Conversation{
+			Message:    nluMessage,
+			IncMessage: incMessage,
+		},
+		suite.Action,
+	}
+	response := trackExpense.ProcessResponses(trackExpense.GetResponses())
+	expected := BotResponse("Tracked 3 expenses totalling 250 RUB and 5 USD")
+	assert.Equal(suite.T(), expected, response)
+	assert.Equal(suite.T(), -1, trackExpense.Step)
+}
+
+func (suite *TrackExpenseSuite) TestConfirmsUncertainBatchOfExpenses() {
+	nluMessage := nlu.Message{
+		Intent:     nlu.TrackExpense,
+		Confidence: 0.5,
+		Expenses: []nlu.Message{
+			{Intent: nlu.TrackExpense, Amount: 200, Currency: "RUB", Description: "lunch"},
+			{Intent: nlu.TrackExpense, Amount: 50, Currency: "RUB", Description: "coffee"},
+		},
+	}
+
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("200RUB for lunch, 50RUB for coffee")
+	json.Unmarshal(message, &incMessage)
+
+	trackExpense := &TrackExpense{
+		&Conversation{
+			Message:    nluMessage,
+			IncMessage: incMessage,
+		},
+		suite.Action,
+	}
+	responses := trackExpense.GetResponses()
+
+	today := time.Now().UTC().Format(dateFormat)
+	response := trackExpense.ProcessResponses(responses)
+	expected := BotResponse("Did you mean 200 RUB for lunch on " + today +
+		", 50 RUB for coffee on " + today + "?")
+	assert.Equal(suite.T(), expected, response)
+
+	message = mocks.GetMockMessage("yes")
+	json.Unmarshal(message, &incMessage)
+	trackExpense.SetLastUserMessage(nlu.Message{Intent: nlu.Unknown}, incMessage)
+	response = trackExpense.ProcessResponses(responses)
+	assert.Equal(suite.T(), BotResponse("Tracked 2 expenses totalling 250 RUB"), response)
+}
+
+func (suite *TrackExpenseSuite) TestRejectsExpenseWithoutAmount() {
+	nluMessage := nlu.Message{
+		Intent:      nlu.TrackExpense,
+		Description: "Food",
+	}
+
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("Food")
+	json.Unmarshal(message, &incMessage)
+
+	trackExpense := &TrackExpense{
+		&Conversation{
+			Message:    nluMessage,
+			IncMessage: incMessage,
+		},
+		suite.Action,
+	}
+	response := trackExpense.ProcessResponses(trackExpense.GetResponses())
+	assert.Equal(suite.T(), BotResponse("Whoops!"), response)
+	assert.Equal(suite.T(), -1, trackExpense.Step)
+}
+
+func (suite *TrackExpenseSuite) TestAsksForMissingFields() {
+	user := users.NewUserManager(suite.Env.Db).GetByTelegramID(mocks.TestUserID)
+	users.NewSettingManager(suite.Env.Db).UpdateCurrency(user.ID, "EUR")
+
+	nluMessage := nlu.Message{
+		Intent:     nlu.TrackExpense,
+		Amount:     20,
+		Confidence: 1,
+	}
+
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("20")
+	json.Unmarshal(message, &incMessage)
+
+	trackExpense := &TrackExpense{
+		&Conversation{
+			Message:    nluMessage,
+			IncMessage: incMessage,
+			BotUserID:  user.ID,
+		},
+		suite.Action,
+	}
+	responses := trackExpense.GetResponses()
+
+	response := trackExpense.ProcessResponses(responses)
+	assert.Equal(suite.T(), BotResponse("Description?"), response)
+	assert.Equal(suite.T(), 1, trackExpense.Step)
+
+	message = mocks.GetMockMessage("lunch #food")
+	json.Unmarshal(message, &incMessage)
+	trackExpense.SetLastUserMessage(nlu.Message{Intent: nlu.Unknown}, incMessage)
+	response = trackExpense.ProcessResponses(responses)
+	assert.Equal(suite.T(), BotResponse("Currency for 20?"), response)
+	assert.Equal(suite.T(), 3, trackExpense.Step)
+
+	message = mocks.GetMockMessage("doubloons")
+	json.Unmarshal(message, &incMessage)
+	trackExpense.SetLastUserMessage(nlu.Message{Intent: nlu.Unknown}, incMessage)
+	response = trackExpense.ProcessResponses(responses)
+	assert.Equal(suite.T(), BotResponse("Invalid currency"), response)
+	assert.Equal(suite.T(), 3, trackExpense.Step)
+
+	message = mocks.GetMockMessage("Default")
+	json.Unmarshal(message, &incMessage)
+	trackExpense.SetLastUserMessage(nlu.Message{Intent: nlu.Unknown}, incMessage)
+	response = trackExpense.ProcessResponses(responses)
+	today := time.Now().UTC().Format(dateFormat)
+	assert.Equal(suite.T(), BotResponse("Roger that, "+today+"!"), response)
+	assert.Equal(suite.T(), -1, trackExpense.Step)
+
+	expense := trackExpense.getPendingExpense()
+	assert.Equal(suite.T(), "lunch", expense.Description)
+	assert.Equal(suite.T(), "food", expense.Category)
+	assert.Equal(suite.T(), "EUR", expense.Currency)
+}
+
+func (suite *TrackExpenseSuite) TestCancelsMissingFields() {
+	nluMessage := nlu.Message{
+		Intent:   nlu.TrackExpense,
+		Amount:   20,
+		Currency: "SGD",
+	}
+
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("20 SGD")
+	json.Unmarshal(message, &incMessage)
+
+	trackExpense := &TrackExpense{
+		&Conversation{
+			Message:    nluMessage,
+			IncMessage: incMessage,
+		},
+		suite.Action,
+	}
+	responses := trackExpense.GetResponses()
+
+	response := trackExpense.ProcessResponses(responses)
+	assert.Equal(suite.T(), BotResponse("Description?"), response)
+
+	message = mocks.GetMockMessage("cancel")
+	json.Unmarshal(message, &incMessage)
+	trackExpense.SetLastUserMessage(nlu.Message{Intent: nlu.Unknown}, incMessage)
+	response = trackExpense.ProcessResponses(responses)
+	assert.Equal(suite.T(), BotResponse("Ok, never mind"), response)
+	assert.Equal(suite.T(), -1, trackExpense.Step)
+}
+
 func TestTrackExpenseSuite(t *testing.T) {
 	suite.Run(t, new(TrackExpenseSuite))
 }
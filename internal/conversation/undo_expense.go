@@ -0,0 +1,69 @@
+package conversation
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	a "github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/expenses"
+	"github.com/fmitra/dennis-bot/pkg/users"
+)
+
+// UndoExpense is an Intent designed to remove the last expense a user tracked.
+type UndoExpense struct {
+	*Conversation
+	actions *a.Actions
+}
+
+// GetResponses returns a list of functions each containing a BotResponse.
+func (i *UndoExpense) GetResponses() []func() (BotResponse, error) {
+	return []func() (BotResponse, error){
+		i.ConfirmUndo,
+		i.RemoveExpense,
+	}
+}
+
+// ConfirmUndo asks the user to confirm removal of their last tracked expense.
+// Expense details are encrypted, so we can only describe the expense by date.
+func (i *UndoExpense) ConfirmUndo() (BotResponse, error) {
+	manager := expenses.NewExpenseManager(i.actions.Db)
+	expense, err := manager.LastForUser(i.BotUserID)
+	if err != nil {
+		i.EndConversation()
+		return GetMessage(UndoExpenseNotFound, ""), err
+	}
+
+	settings := users.NewSettingManager(i.actions.Db)
+	expenseDate := expense.Date.In(settings.GetLocation(i.BotUserID))
+
+	i.AuxData = strconv.Itoa(int(expense.ID))
+	return GetMessage(UndoExpenseConfirm, expenseDate.Format("Jan 2")), nil
+}
+
+// RemoveExpense removes the last tracked expense if the user confirmed.
+func (i *UndoExpense) RemoveExpense() (BotResponse, error) {
+	userInput := strings.ToLower(strings.TrimSpace(i.IncMessage.GetMessage()))
+
+	isConfirmed := userInput == "yes"
+	isRejected := userInput == "no"
+	if !isConfirmed && !isRejected {
+		return GetMessage(UndoExpenseConfirmError, ""), errors.New("response invalid")
+	}
+
+	i.EndConversation()
+	if isRejected {
+		return GetMessage(ConversationCancelled, ""), errors.New("user requested cancel")
+	}
+
+	expenseID, err := strconv.Atoi(i.AuxData)
+	if err != nil {
+		return GetMessage(UndoExpenseError, ""), err
+	}
+
+	if err = i.actions.DeleteExpense(uint(expenseID), i.BotUserID); err != nil {
+		return GetMessage(UndoExpenseError, ""), err
+	}
+
+	return GetMessage(UndoExpenseSuccess, ""), nil
+}
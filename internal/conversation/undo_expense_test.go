@@ -0,0 +1,149 @@
+package conversation
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/fmitra/dennis-bot/internal/actions"
+	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+	"github.com/fmitra/dennis-bot/pkg/telegram"
+	mocks "github.com/fmitra/dennis-bot/test"
+)
+
+type UndoExpenseSuite struct {
+	suite.Suite
+	Env    *mocks.TestEnv
+	Action *actions.Actions
+}
+
+func (suite *UndoExpenseSuite) SetupSuite() {
+	configFile := "../../config/config.json"
+	suite.Env = mocks.GetTestEnv(configFile)
+	suite.Action = &actions.Actions{
+		Db:     suite.Env.Db,
+		Cache:  suite.Env.Cache,
+		Config: suite.Env.Config,
+		Rates:  &alphapoint.Client{},
+	}
+}
+
+func (suite *UndoExpenseSuite) TearDownSuite() {
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *UndoExpenseSuite) BeforeTest(suiteName, testName string) {
+	MessageMap = mocks.MessageMapMock
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *UndoExpenseSuite) TestGetResponseList() {
+	undoExpense := &UndoExpense{}
+	assert.Equal(suite.T(), 2, len(undoExpense.GetResponses()))
+}
+
+func (suite *UndoExpenseSuite) TestConfirmUndoWithoutExpenses() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("")
+	json.Unmarshal(message, &incMessage)
+
+	undoExpense := &UndoExpense{
+		&Conversation{
+			IncMessage: incMessage,
+			BotUserID:  uint(200),
+		},
+		suite.Action,
+	}
+
+	response, err := undoExpense.ConfirmUndo()
+	assert.EqualError(suite.T(), err, "no expenses found")
+	assert.Equal(suite.T(), BotResponse("No expenses"), response)
+	assert.Equal(suite.T(), -1, undoExpense.Step)
+}
+
+func (suite *UndoExpenseSuite) TestRemoveExpenseRequiresConfirmation() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("maybe")
+	json.Unmarshal(message, &incMessage)
+
+	undoExpense := &UndoExpense{
+		&Conversation{
+			Step:       1,
+			IncMessage: incMessage,
+			AuxData:    "1",
+		},
+		suite.Action,
+	}
+
+	response, err := undoExpense.RemoveExpense()
+	assert.EqualError(suite.T(), err, "response invalid")
+	assert.Equal(suite.T(), BotResponse("Yes or no?"), response)
+	assert.Equal(suite.T(), 1, undoExpense.Step)
+}
+
+func (suite *UndoExpenseSuite) TestRemoveExpenseCancelled() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("no")
+	json.Unmarshal(message, &incMessage)
+
+	undoExpense := &UndoExpense{
+		&Conversation{
+			Step:       1,
+			IncMessage: incMessage,
+			AuxData:    "1",
+		},
+		suite.Action,
+	}
+
+	response, err := undoExpense.RemoveExpense()
+	assert.EqualError(suite.T(), err, "user requested cancel")
+	assert.Equal(suite.T(), BotResponse("Ok, never mind"), response)
+	assert.Equal(suite.T(), -1, undoExpense.Step)
+}
+
+func (suite *UndoExpenseSuite) TestRemoveExpenseFailure() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("yes")
+	json.Unmarshal(message, &incMessage)
+
+	undoExpense := &UndoExpense{
+		&Conversation{
+			Step:       1,
+			IncMessage: incMessage,
+			BotUserID:  uint(200),
+			AuxData:    "1",
+		},
+		suite.Action,
+	}
+
+	response, err := undoExpense.RemoveExpense()
+	assert.EqualError(suite.T(), err, "expense does not exist")
+	assert.Equal(suite.T(), BotResponse("Expense not removed"), response)
+}
+
+func (suite *UndoExpenseSuite) TestRemoveExpenseTrimsConfirmation() {
+	var incMessage telegram.IncomingMessage
+	message := mocks.GetMockMessage("Yes ")
+	json.Unmarshal(message, &incMessage)
+
+	undoExpense := &UndoExpense{
+		&Conversation{
+			Step:       1,
+			IncMessage: incMessage,
+			BotUserID:  uint(200),
+			AuxData:    "1",
+		},
+		suite.Action,
+	}
+
+	// Confirmation is accepted, so we attempt to remove the expense
+	_, err := undoExpense.RemoveExpense()
+	assert.EqualError(suite.T(), err, "expense does not exist")
+	assert.Equal(suite.T(), -1, undoExpense.Step)
+}
+
+func TestUndoExpenseSuite(t *testing.T) {
+	suite.Run(t, new(UndoExpenseSuite))
+}
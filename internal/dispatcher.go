@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/fmitra/dennis-bot/pkg/telegram"
+)
+
+const (
+	// defaultWorkers is the number of workers a Dispatcher runs if none
+	// are configured
+	defaultWorkers = 16
+
+	// defaultQueueSize is the number of payloads each worker may hold on
+	// to if no queue size is configured
+	defaultQueueSize = 64
+)
+
+// Dispatcher hands payloads received from Telegram to a fixed pool of
+// workers. Payloads are sharded by the ID of the User who sent them, so
+// each User's messages are handled one at a time in the order they were
+// received and never race on the User's cached Conversation. Background
+// work scheduled for a User runs on the same worker, after the payloads
+// already queued. Payloads are handled with the Dispatcher's context, which
+// is only cancelled if the Dispatcher is not stopped in time.
+type Dispatcher struct {
+	queues  []chan func(ctx context.Context)
+	handle  func(ctx context.Context, payload []byte)
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mutex   sync.RWMutex
+	stopped bool
+	workers sync.WaitGroup
+}
+
+// NewDispatcher returns a Dispatcher with running workers. Each worker
+// queues up to queueSize payloads, after which dispatching blocks.
+func NewDispatcher(workers, queueSize int, handle func(ctx context.Context, payload []byte)) *Dispatcher {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		queues: make([]chan func(ctx context.Context), workers),
+		handle: handle,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for i := range d.queues {
+		d.queues[i] = make(chan func(ctx context.Context), queueSize)
+		d.workers.Add(1)
+		go d.work(d.queues[i])
+	}
+
+	return d
+}
+
+// Dispatch queues a payload for the worker of the User who sent it. If the
+// worker's queue is full, we wait for space until the context is done.
+// Payloads we cannot parse are still handled, so they may be logged.
+func (d *Dispatcher) Dispatch(ctx context.Context, payload []byte) error {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if d.stopped {
+		return errors.New("dispatcher stopped")
+	}
+
+	var incMessage telegram.IncomingMessage
+	json.Unmarshal(payload, &incMessage)
+	handle := func(ctx context.Context) {
+		d.handle(ctx, payload)
+	}
+
+	select {
+	case d.queue(incMessage.GetUser().ID) <- handle:
+		return nil
+	case <-ctx.Done():
+		return errors.New("dispatcher queue full")
+	}
+}
+
+// Schedule queues work for the worker of a User, to run after the payloads
+// already queued for them. Work is scheduled while handling payloads, so
+// we never wait for space in a full queue as the worker may be our own.
+// Work cannot be scheduled once the Dispatcher is stopped.
+func (d *Dispatcher) Schedule(userID uint, work func(ctx context.Context)) error {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if d.stopped {
+		return errors.New("dispatcher stopped")
+	}
+
+	select {
+	case d.queue(userID) <- work:
+		return nil
+	default:
+		return errors.New("dispatcher queue full")
+	}
+}
+
+// queue returns the queue of the worker handling a User's payloads.
+func (d *Dispatcher) queue(userID uint) chan func(ctx context.Context) {
+	return d.queues[userID%uint(len(d.queues))]
+}
+
+// Stop stops accepting payloads and waits for the workers to handle every
+// payload and work already queued. If the context is done first, payloads
+// being handled are cancelled and payloads still queued are dropped. We still
+// wait for the workers to return, so nothing is left half written, and
+// return the context's error.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.mutex.Lock()
+	if !d.stopped {
+		d.stopped = true
+		for _, queue := range d.queues {
+			close(queue)
+		}
+	}
+	d.mutex.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(drained)
+	}()
+
+	defer d.cancel()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-drained
+		return ctx.Err()
+	}
+}
+
+// work runs the payloads and work of a queue in order until the queue is
+// closed. Both are dropped once the Dispatcher's context is cancelled.
+func (d *Dispatcher) work(queue chan func(ctx context.Context)) {
+	defer d.workers.Done()
+	for run := range queue {
+		if d.ctx.Err() != nil {
+			log.Printf("dispatcher: dropping payload after shutdown deadline")
+			continue
+		}
+		run(d.ctx)
+	}
+}
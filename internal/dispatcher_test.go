@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fmitra/dennis-bot/pkg/telegram"
+)
+
+// getUserPayload returns a stub Telegram payload sent by a User.
+func getUserPayload(userID int, text string) []byte {
+	return []byte(fmt.Sprintf(`{"message": {"text": "%s", "from": {"id": %d}}}`, text, userID))
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Run("Returns dispatcher with default pool", func(t *testing.T) {
+		dispatcher := NewDispatcher(0, 0, func(ctx context.Context, payload []byte) {})
+		defer dispatcher.Stop(context.Background())
+
+		assert.Equal(t, defaultWorkers, len(dispatcher.queues))
+		assert.Equal(t, defaultQueueSize, cap(dispatcher.queues[0]))
+	})
+
+	t.Run("Handles each user's payloads in order", func(t *testing.T) {
+		var mutex sync.Mutex
+		handled := map[uint][]string{}
+		dispatcher := NewDispatcher(4, 10, func(ctx context.Context, payload []byte) {
+			var incMessage telegram.IncomingMessage
+			json.Unmarshal(payload, &incMessage)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			userID := incMessage.GetUser().ID
+			handled[userID] = append(handled[userID], incMessage.GetMessage())
+		})
+
+		for _, text := range []string{"first", "second", "third"} {
+			for userID := 1; userID <= 6; userID++ {
+				err := dispatcher.Dispatch(context.Background(), getUserPayload(userID, text))
+				assert.NoError(t, err)
+			}
+		}
+		dispatcher.Stop(context.Background())
+
+		for userID := uint(1); userID <= 6; userID++ {
+			assert.Equal(t, []string{"first", "second", "third"}, handled[userID])
+		}
+	})
+
+	t.Run("Waits for space in a full queue", func(t *testing.T) {
+		release := make(chan bool)
+		dispatcher := NewDispatcher(1, 1, func(ctx context.Context, payload []byte) {
+			<-release
+		})
+
+		// The first payload is held by the worker and the second fills the queue
+		assert.NoError(t, dispatcher.Dispatch(context.Background(), getUserPayload(1, "first")))
+		assert.NoError(t, dispatcher.Dispatch(context.Background(), getUserPayload(1, "second")))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := dispatcher.Dispatch(ctx, getUserPayload(1, "third"))
+		assert.EqualError(t, err, "dispatcher queue full")
+
+		close(release)
+		dispatcher.Stop(context.Background())
+	})
+
+	t.Run("Runs scheduled work after the user's queued payloads", func(t *testing.T) {
+		var mutex sync.Mutex
+		handled := []string{}
+		scheduled := make(chan bool)
+		var dispatcher *Dispatcher
+		dispatcher = NewDispatcher(4, 10, func(ctx context.Context, payload []byte) {
+			var incMessage telegram.IncomingMessage
+			json.Unmarshal(payload, &incMessage)
+
+			mutex.Lock()
+			handled = append(handled, incMessage.GetMessage())
+			mutex.Unlock()
+
+			if incMessage.GetMessage() == "first" {
+				err := dispatcher.Schedule(incMessage.GetUser().ID, func(ctx context.Context) {
+					mutex.Lock()
+					defer mutex.Unlock()
+					handled = append(handled, "work")
+				})
+				assert.NoError(t, err)
+				close(scheduled)
+			}
+		})
+
+		// The worker is held until both payloads are queued
+		release := make(chan bool)
+		dispatcher.Schedule(1, func(ctx context.Context) { <-release })
+		dispatcher.Dispatch(context.Background(), getUserPayload(1, "first"))
+		dispatcher.Dispatch(context.Background(), getUserPayload(1, "second"))
+		close(release)
+		<-scheduled
+		dispatcher.Stop(context.Background())
+
+		assert.Equal(t, []string{"first", "second", "work"}, handled)
+
+		err := dispatcher.Schedule(1, func(ctx context.Context) {})
+		assert.EqualError(t, err, "dispatcher stopped")
+	})
+
+	t.Run("Does not wait for space to schedule work", func(t *testing.T) {
+		release := make(chan bool)
+		dispatcher := NewDispatcher(1, 1, func(ctx context.Context, payload []byte) {
+			<-release
+		})
+
+		assert.NoError(t, dispatcher.Dispatch(context.Background(), getUserPayload(1, "first")))
+		assert.NoError(t, dispatcher.Dispatch(context.Background(), getUserPayload(1, "second")))
+
+		err := dispatcher.Schedule(1, func(ctx context.Context) {})
+		assert.EqualError(t, err, "dispatcher queue full")
+
+		close(release)
+		dispatcher.Stop(context.Background())
+	})
+
+	t.Run("Drains queued payloads when stopped", func(t *testing.T) {
+		var mutex sync.Mutex
+		handled := 0
+		dispatcher := NewDispatcher(2, 10, func(ctx context.Context, payload []byte) {
+			time.Sleep(time.Millisecond)
+			mutex.Lock()
+			defer mutex.Unlock()
+			handled++
+		})
+
+		for i := 0; i < 10; i++ {
+			dispatcher.Dispatch(context.Background(), getUserPayload(i, "hello"))
+		}
+		dispatcher.Stop(context.Background())
+		assert.Equal(t, 10, handled)
+
+		err := dispatcher.Dispatch(context.Background(), getUserPayload(1, "hello"))
+		assert.EqualError(t, err, "dispatcher stopped")
+	})
+
+	t.Run("Cancels payloads not handled before the deadline", func(t *testing.T) {
+		var mutex sync.Mutex
+		handled := []string{}
+		dispatcher := NewDispatcher(1, 10, func(ctx context.Context, payload []byte) {
+			var incMessage telegram.IncomingMessage
+			json.Unmarshal(payload, &incMessage)
+
+			<-ctx.Done()
+			mutex.Lock()
+			defer mutex.Unlock()
+			handled = append(handled, incMessage.GetMessage())
+		})
+
+		dispatcher.Dispatch(context.Background(), getUserPayload(1, "first"))
+		dispatcher.Dispatch(context.Background(), getUserPayload(1, "second"))
+
+		deadline, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := dispatcher.Stop(deadline)
+		assert.EqualError(t, err, "context deadline exceeded")
+
+		// The payload being handled was cancelled and the queued one dropped
+		assert.Equal(t, []string{"first"}, handled)
+	})
+}
@@ -1,19 +1,30 @@
 package internal
 
 import (
+	"context"
+	"crypto/subtle"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	// Register SQL driver for DB
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 
 	"github.com/fmitra/dennis-bot/config"
-	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+	"github.com/fmitra/dennis-bot/pkg/categories"
 	"github.com/fmitra/dennis-bot/pkg/crypto"
+	"github.com/fmitra/dennis-bot/pkg/exchange"
 	"github.com/fmitra/dennis-bot/pkg/expenses"
+	"github.com/fmitra/dennis-bot/pkg/nlu"
+	"github.com/fmitra/dennis-bot/pkg/rates"
 	"github.com/fmitra/dennis-bot/pkg/sessions"
 	"github.com/fmitra/dennis-bot/pkg/telegram"
 	"github.com/fmitra/dennis-bot/pkg/users"
@@ -24,12 +35,12 @@ import (
 // to communicate with the bot and the DB/Cache layer as well
 // as application configuration.
 type Env struct {
-	db         *gorm.DB
-	cache      sessions.Session
-	config     config.AppConfig
-	telegram   telegram.Telegram
-	wit        wit.Wit
-	alphapoint alphapoint.Alphapoint
+	db       *gorm.DB
+	cache    sessions.Session
+	config   config.AppConfig
+	telegram telegram.Telegram
+	nlu      nlu.NLU
+	rates    rates.RateProvider
 }
 
 // HealthCheck ensures application is running.
@@ -39,35 +50,187 @@ func (env *Env) HealthCheck() http.HandlerFunc {
 	}
 }
 
-// Webhook accepts payload from Telegram API for incoming messages.
-func (env *Env) Webhook() http.HandlerFunc {
+// dispatchTimeout is how long a webhook request waits for space in a full
+// Dispatcher queue before asking Telegram to retry the update later.
+const dispatchTimeout = 5 * time.Second
+
+// Webhook accepts payload from Telegram API for incoming messages and hands
+// them to a Dispatcher. Requests must carry the secret token Telegram was
+// given when setting the webhook and, if an allowlist is configured, come
+// from an allowed IP range.
+func (env *Env) Webhook(dispatcher *Dispatcher) http.HandlerFunc {
+	allowedIPs := []*net.IPNet{}
+	for _, cidr := range env.config.Telegram.AllowedIPs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Panicf("environment: invalid allowed IP range %s - %s", cidr, err)
+		}
+		allowedIPs = append(allowedIPs, ipNet)
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAllowedIP(r.RemoteAddr, allowedIPs) {
+			log.Printf("environment: rejected webhook from %s", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		secretToken := []byte(env.config.Telegram.SecretToken)
+		requestToken := []byte(r.Header.Get(telegram.SecretTokenHeader))
+		if subtle.ConstantTimeCompare(secretToken, requestToken) != 1 {
+			log.Printf("environment: rejected webhook with invalid secret token from %s", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
 		body, _ := ioutil.ReadAll(r.Body)
 		defer r.Body.Close()
 
-		bot := &Bot{env}
-		go bot.Converse(body)
+		ctx, cancel := context.WithTimeout(r.Context(), dispatchTimeout)
+		defer cancel()
+		if err := dispatcher.Dispatch(ctx, body); err != nil {
+			log.Printf("environment: failed to dispatch webhook - %s", err)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
 
 		w.Write([]byte("received"))
 	}
 }
 
-// Start sets the Telegram webhook and starts the HTTP server.
+// isAllowedIP checks if the address of a request is within any of the
+// allowed IP ranges. Every address is allowed if there are no ranges.
+func isAllowedIP(remoteAddr string, allowedIPs []*net.IPNet) bool {
+	if len(allowedIPs) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	for _, ipNet := range allowedIPs {
+		if ip != nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// defaultShutdownTimeout is how long received updates may take to finish
+// on shutdown if no timeout is configured.
+const defaultShutdownTimeout = 30 * time.Second
+
+// Start receives updates from Telegram through the bot webhook or by
+// polling, depending on the configured mode, until the process is
+// interrupted. The HTTP server runs in both modes to serve health checks.
+// Updates are handed to a Dispatcher. On shutdown we stop receiving
+// updates and finish every update already received within the shutdown
+// timeout, after which updates still being handled are cancelled.
 func (env *Env) Start() {
-	go env.telegram.SetWebhook()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		log.Printf("main: shutting down")
+		cancel()
+	}()
 
-	// Telegram does not send authentication headers on each request
-	// and instead recommends we use their token as the webhook path
-	webhookPath := fmt.Sprintf("/%s", env.config.Telegram.Token)
+	bot := &Bot{env: env}
+	dispatcher := NewDispatcher(
+		env.config.Dispatcher.Workers,
+		env.config.Dispatcher.QueueSize,
+		func(ctx context.Context, payload []byte) { bot.Converse(ctx, payload) },
+	)
+	bot.dispatcher = dispatcher
 
 	http.HandleFunc("/healthcheck", env.HealthCheck())
-	http.HandleFunc(webhookPath, env.Webhook())
 
-	// Run server
-	log.Printf("main: starting server on port 8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	polling := &sync.WaitGroup{}
+	switch env.config.Telegram.Mode {
+	case "", telegram.ModeWebhook:
+		// Requests cancelled by an interrupt during startup are not errors,
+		// as we carry on shutting down
+		if _, err := env.telegram.SetWebhook(ctx); err != nil && ctx.Err() == nil {
+			log.Panicf("environment: failed to set webhook - %s", err)
+		}
+		http.HandleFunc(env.config.Telegram.WebhookPath, env.Webhook(dispatcher))
+	case telegram.ModePolling:
+		updater, ok := env.telegram.(telegram.Updater)
+		if !ok {
+			log.Panicf("environment: telegram client cannot poll for updates")
+		}
+
+		polling.Add(1)
+		go func() {
+			defer polling.Done()
+			env.Poll(ctx, telegram.NewPoller(updater), dispatcher)
+		}()
+	default:
+		log.Panicf("environment: invalid telegram mode %s", env.config.Telegram.Mode)
+	}
+
+	server := env.Serve(":8080")
+	<-ctx.Done()
+
+	// Webhook requests in progress are finished before we stop the
+	// Dispatcher, so every update Telegram was told we received is handled
+	deadline, cancelDeadline := context.WithTimeout(context.Background(), env.shutdownTimeout())
+	defer cancelDeadline()
+	if err := server.Shutdown(deadline); err != nil {
+		log.Printf("main: failed to stop server - %s", err)
+	}
+	polling.Wait()
+
+	log.Printf("main: finishing received updates")
+	if err := dispatcher.Stop(deadline); err != nil {
+		log.Printf("main: cancelled updates still being handled - %s", err)
+	}
+}
+
+// Poll hands every update received by a Poller to a Dispatcher until the
+// context is cancelled. Updates that could not be dispatched are not
+// acknowledged, so Telegram delivers them again the next time we poll.
+func (env *Env) Poll(ctx context.Context, poller *telegram.Poller, dispatcher *Dispatcher) {
+	log.Printf("main: polling telegram for updates")
+	poller.Poll(ctx, func(payload []byte) error {
+		return dispatcher.Dispatch(ctx, payload)
+	})
+}
+
+// Serve runs the HTTP server in the background. The server is returned so
+// it may be shut down.
+func (env *Env) Serve(address string) *http.Server {
+	server := &http.Server{Addr: address}
+	go func() {
+		log.Printf("main: starting server on %s", address)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	return server
 }
 
+// shutdownTimeout returns how long received updates may take to finish on
+// shutdown. Updates have 30 seconds unless configured otherwise.
+func (env *Env) shutdownTimeout() time.Duration {
+	timeout := env.config.Dispatcher.ShutdownTimeout
+	if timeout <= 0 {
+		return defaultShutdownTimeout
+	}
+
+	return time.Duration(timeout) * time.Second
+}
+
+// webhookSecretContext is digested with the secret key to derive the
+// webhook secret token if none is configured.
+const webhookSecretContext = "telegram_webhook_secret"
+
 // LoadEnv initializes dependencies and attaches them to the environment.
 func LoadEnv(config config.AppConfig) *Env {
 	db, err := gorm.Open(
@@ -89,9 +252,25 @@ func LoadEnv(config config.AppConfig) *Env {
 	db.AutoMigrate(
 		&users.User{},
 		&users.Setting{},
+		&users.RecoveryCode{},
 		&expenses.Expense{},
+		&categories.Keyword{},
+		&exchange.Rate{},
 	)
 
+	// Categories were previously stored in plaintext and must be widened
+	// to fit encrypted values. Sealed fields are only limited by the
+	// length of their value, so the remaining fields are widened as well
+	for _, column := range []string{"category", "description", "total", "historical", "currency"} {
+		db.Model(&expenses.Expense{}).ModifyColumn(column, "text")
+	}
+
+	// Private keys of 3072-bit key pairs do not fit the original columns
+	db.Model(&users.User{}).ModifyColumn("private_key", "text")
+	db.Model(&users.RecoveryCode{}).ModifyColumn("private_key", "text")
+
+	db.Exec(expenses.SourceIndex)
+
 	cache, err := sessions.NewClient(sessions.Config{
 		Host:     config.Redis.Host,
 		Port:     config.Redis.Port,
@@ -102,22 +281,44 @@ func LoadEnv(config config.AppConfig) *Env {
 		log.Panicf("environment: redis connection failed - %s", err)
 	}
 
+	// Telegram sends the secret token with every update to the webhook.
+	// If none is configured it is derived from the secret key, so every
+	// instance of the bot accepts the secret of whichever set the webhook last
+	if config.Telegram.WebhookPath == "" {
+		config.Telegram.WebhookPath = telegram.DefaultWebhookPath
+	}
+	if config.Telegram.SecretToken == "" {
+		if config.SecretKey == "" {
+			log.Panicf("environment: a secret key or telegram secret token is required")
+		}
+		config.Telegram.SecretToken = crypto.Digest(webhookSecretContext, config.SecretKey)
+	}
+
 	telegram := telegram.NewClient(
 		config.Telegram.Token,
 		config.BotDomain,
 	)
+	telegram.WebhookPath = config.Telegram.WebhookPath
+	telegram.SecretToken = config.Telegram.SecretToken
 
-	wit := wit.NewClient(config.Wit.Token)
-	alphapoint := alphapoint.NewClient(config.AlphaPoint.Token)
+	nlu, err := wit.NewBackend(config.Wit.Backend, config.Wit.Token)
+	if err != nil {
+		log.Panicf("environment: wit backend %s failed - %s", config.Wit.Backend, err)
+	}
+
+	rates, err := rates.NewProvider(config.Rates.Providers, config.AlphaPoint.Token, config.Rates.File)
+	if err != nil {
+		log.Panicf("environment: rate providers %v failed - %s", config.Rates.Providers, err)
+	}
 
 	crypto.InitializeGob()
 
 	return &Env{
-		db:         db,
-		cache:      cache,
-		config:     config,
-		telegram:   telegram,
-		wit:        wit,
-		alphapoint: alphapoint,
+		db:       db,
+		cache:    cache,
+		config:   config,
+		telegram: telegram,
+		nlu:      nlu,
+		rates:    rates,
 	}
 }
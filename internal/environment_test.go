@@ -2,16 +2,17 @@ package internal
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 
 	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+	"github.com/fmitra/dennis-bot/pkg/crypto"
 	"github.com/fmitra/dennis-bot/pkg/telegram"
 	"github.com/fmitra/dennis-bot/pkg/wit"
 	mocks "github.com/fmitra/dennis-bot/test"
@@ -77,19 +78,60 @@ func (suite *EnvSuite) TestRespondsToWebhook() {
 	req, err := http.NewRequest("POST", "/webook", bytes.NewBuffer(message))
 	assert.NoError(suite.T(), err)
 
+	bot := &Bot{env: env}
+	dispatcher := NewDispatcher(1, 1, func(ctx context.Context, payload []byte) { bot.Converse(ctx, payload) })
+
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(env.Webhook())
+	handler := http.HandlerFunc(env.Webhook(dispatcher))
 
 	handler.ServeHTTP(rr, req)
 	assert.Equal(suite.T(), "received", rr.Body.String())
 
-	// Business logic is handled in a go routine, so we need
-	// to add a delay to close the test server
-	time.Sleep(time.Second * 1)
+	// Business logic is handled by the dispatcher's workers, so we
+	// wait for them to finish before closing the test server
+	dispatcher.Stop(context.Background())
 	telegramServer.Close()
 	witServer.Close()
 }
 
+func (suite *EnvSuite) TestRejectsUnauthenticatedWebhook() {
+	appConfig := suite.Env.Config
+	appConfig.Telegram.SecretToken = "secret"
+	appConfig.Telegram.AllowedIPs = []string{"149.154.160.0/20"}
+	env := &Env{
+		suite.Env.Db,
+		suite.Env.Cache,
+		appConfig,
+		&mocks.TelegramMock{},
+		&wit.Client{},
+		&alphapoint.Client{},
+	}
+	dispatcher := NewDispatcher(1, 1, func(ctx context.Context, payload []byte) {})
+	defer dispatcher.Stop(context.Background())
+	handler := http.HandlerFunc(env.Webhook(dispatcher))
+
+	var testCases = []struct {
+		remoteAddr  string
+		secretToken string
+		statusCode  int
+	}{
+		{"149.154.167.50:443", "secret", http.StatusOK},
+		{"149.154.167.50:443", "", http.StatusUnauthorized},
+		{"149.154.167.50:443", "wrong", http.StatusUnauthorized},
+		{"203.0.113.10:443", "secret", http.StatusForbidden},
+	}
+
+	for _, test := range testCases {
+		req, _ := http.NewRequest("POST", "/webhook", bytes.NewBufferString(""))
+		req.RemoteAddr = test.remoteAddr
+		req.Header.Set(telegram.SecretTokenHeader, test.secretToken)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(suite.T(), test.statusCode, rr.Code)
+	}
+}
+
 func (suite *EnvSuite) TestShouldLoadFromConfig() {
 	env := LoadEnv(suite.Env.Config)
 
@@ -97,6 +139,12 @@ func (suite *EnvSuite) TestShouldLoadFromConfig() {
 	assert.NotNil(suite.T(), env.cache)
 	assert.NotNil(suite.T(), env.config)
 	assert.NotNil(suite.T(), env.telegram)
+
+	// Webhooks are authenticated with a secret derived from the secret key
+	// if none is configured, so it is the same on every instance
+	secretToken := crypto.Digest(webhookSecretContext, suite.Env.Config.SecretKey)
+	assert.Equal(suite.T(), telegram.DefaultWebhookPath, env.config.Telegram.WebhookPath)
+	assert.Equal(suite.T(), secretToken, env.config.Telegram.SecretToken)
 }
 
 func TestEnvSuite(t *testing.T) {
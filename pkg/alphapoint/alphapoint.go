@@ -1,29 +1,32 @@
 // Package alphapoint implements a wrapper for the Alphapoint API.
-// AlphaPoint provides an API for currency conversion.
+// AlphaPoint provides an API for currency conversion. Its Client is
+// one of the exchange rate providers in the rates package.
 package alphapoint
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Rican7/retry"
 	"github.com/Rican7/retry/backoff"
 	"github.com/Rican7/retry/strategy"
+
+	"github.com/fmitra/dennis-bot/pkg/utils"
 )
 
 // BaseURL for Alphapoint
 const BaseURL = "https://www.alphavantage.co/query"
 
-// Alphapoint is an itnerface to provide utility methods to interact
-// with the Alphapoint API.
-type Alphapoint interface {
-	Convert(fromISO string, toISO string, total float64) (float64, *Conversion)
-}
+// seriesMaxAge is how long a fetched daily series is used for.
+const seriesMaxAge = time.Hour
 
 // CurrencyDetails describes the exchange rate of a currency.
 type CurrencyDetails struct {
@@ -32,17 +35,31 @@ type CurrencyDetails struct {
 	} `json:"Realtime Currency Exchange Rate"`
 }
 
-// Client is a consumer of the Alphapoint API.
+// DailySeries describes the daily exchange rates of a currency, keyed
+// by day (ex. 2018-03-14).
+type DailySeries struct {
+	Days map[string]struct {
+		Close string `json:"4. close"`
+	} `json:"Time Series FX (Daily)"`
+}
+
+// Client is a consumer of the Alphapoint API. Daily series list the
+// rates of many days, so each fetched series is kept for an hour and
+// used for every date it has a rate for.
 type Client struct {
 	Token   string
 	BaseURL string
+
+	mutex  sync.Mutex
+	series map[string]cachedSeries
 }
 
-// Conversion describes the exchange rate between two currencies.
-type Conversion struct {
-	FromCurrency string
-	ToCurrency   string
-	Rate         float64
+// cachedSeries is a fetched DailySeries of a currency pair. Full series
+// include every trading day, compact ones only the last 100.
+type cachedSeries struct {
+	DailySeries
+	isFull    bool
+	fetchedAt time.Time
 }
 
 // NewClient returns a Client with default BaseUrl.
@@ -53,8 +70,20 @@ func NewClient(token string) *Client {
 	}
 }
 
-// Convert converts from one currency to another using AlphaPoints' API.
-func (c *Client) Convert(fromISO string, toISO string, total float64) (float64, *Conversion) {
+// Rate returns the exchange rate from one currency to another on a date
+// using AlphaPoint's API. Realtime rates are used for dates within the last
+// day, otherwise we use the closing rate of the date or of the last trading
+// day before it. Requests are retried with an exponential backoff.
+func (c *Client) Rate(ctx context.Context, fromISO string, toISO string, date time.Time) (float64, error) {
+	if time.Since(date) < 24*time.Hour {
+		return c.realtimeRate(ctx, fromISO, toISO)
+	}
+
+	return c.dailyRate(ctx, fromISO, toISO, date)
+}
+
+// realtimeRate returns the current exchange rate from one currency to another.
+func (c *Client) realtimeRate(ctx context.Context, fromISO string, toISO string) (float64, error) {
 	var currencyDetails CurrencyDetails
 
 	currencyBase := fmt.Sprintf(
@@ -64,39 +93,124 @@ func (c *Client) Convert(fromISO string, toISO string, total float64) (float64,
 		toISO,
 	)
 	url := fmt.Sprintf("%s&apikey=%s", currencyBase, c.Token)
+	if err := get(ctx, url, &currencyDetails); err != nil {
+		return 0, err
+	}
+
+	// Alphapoint responds with an error message instead of an exchange
+	// rate for unsupported currencies or when we are rate limited
+	exchangeRate, err := strconv.ParseFloat(currencyDetails.Details.ExchangeRate, 64)
+	if err != nil || exchangeRate <= 0 {
+		return 0, errors.New("no exchange rate")
+	}
+
+	return exchangeRate, nil
+}
+
+// dailyRate returns the closing exchange rate from one currency to another
+// on a date. Markets close on weekends and holidays, so the rate of the last
+// trading day before the date is used if there is no rate on the date.
+func (c *Client) dailyRate(ctx context.Context, fromISO string, toISO string, date time.Time) (float64, error) {
+	// Compact responses only include the last 100 trading days
+	isFull := time.Since(date) > 100*24*time.Hour
+	dailySeries, err := c.dailySeries(ctx, fromISO, toISO, isFull)
+	if err != nil {
+		return 0, err
+	}
+
+	day := date.Format("2006-01-02")
+	closestDay := ""
+	for seriesDay := range dailySeries.Days {
+		if seriesDay <= day && seriesDay > closestDay {
+			closestDay = seriesDay
+		}
+	}
+
+	exchangeRate, err := strconv.ParseFloat(dailySeries.Days[closestDay].Close, 64)
+	if err != nil || exchangeRate <= 0 {
+		return 0, errors.New("no exchange rate")
+	}
+
+	return exchangeRate, nil
+}
+
+// dailySeries returns the daily exchange rates from one currency to another,
+// fetching the series again once the series we have is more than an hour old
+// or does not go back far enough. The series are only locked while they are
+// read or written, so a slow request never holds up the rates of other pairs.
+func (c *Client) dailySeries(ctx context.Context, fromISO string, toISO string, isFull bool) (DailySeries, error) {
+	key := fmt.Sprintf("%s_%s", fromISO, toISO)
+	c.mutex.Lock()
+	series, ok := c.series[key]
+	c.mutex.Unlock()
+
+	isFresh := ok && time.Since(series.fetchedAt) < seriesMaxAge
+	if isFresh && (series.isFull || !isFull) {
+		return series.DailySeries, nil
+	}
+
+	outputSize := "compact"
+	if isFull {
+		outputSize = "full"
+	}
+
+	currencyBase := fmt.Sprintf(
+		"%s?function=FX_DAILY&from_symbol=%s&to_symbol=%s&outputsize=%s",
+		c.BaseURL,
+		fromISO,
+		toISO,
+		outputSize,
+	)
+	url := fmt.Sprintf("%s&apikey=%s", currencyBase, c.Token)
+	var dailySeries DailySeries
+	if err := get(ctx, url, &dailySeries); err != nil {
+		return dailySeries, err
+	}
+
+	// Alphapoint responds with an error message instead of a series when
+	// we are rate limited, which should not be kept
+	if len(dailySeries.Days) > 0 {
+		c.mutex.Lock()
+		if c.series == nil {
+			c.series = map[string]cachedSeries{}
+		}
+		c.series[key] = cachedSeries{
+			DailySeries: dailySeries,
+			isFull:      isFull,
+			fetchedAt:   time.Now(),
+		}
+		c.mutex.Unlock()
+	}
+
+	return dailySeries, nil
+}
+
+// get requests a URL and decodes the JSON response into v. Retries stop
+// once the context is done.
+func get(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+
 	request := func(attempt uint) error {
-		resp, err := http.Get(url)
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
 		if err != nil {
 			return err
 		}
+		defer resp.Body.Close()
 
 		body, _ := ioutil.ReadAll(resp.Body)
-		log.Printf("alphapoint: response - %s", body)
-		err = json.Unmarshal(body, &currencyDetails)
+		err = json.Unmarshal(body, v)
 		if err != nil {
-			return err
+			log.Printf("alphapoint: invalid response - %s", body)
 		}
-
-		return nil
+		return err
 	}
 
-	err := retry.Retry(
+	return retry.Retry(
 		request,
 		strategy.Limit(10),
-		strategy.Backoff(backoff.Exponential(time.Second, 2)),
+		utils.Backoff(ctx, backoff.Exponential(time.Second, 2)),
 	)
-
-	if err != nil {
-		log.Panicf("alphapoint: unable to convert currency - %s", err)
-	}
-
-	exchangeRate, _ := strconv.ParseFloat(currencyDetails.Details.ExchangeRate, 64)
-	convertedValue := exchangeRate * total
-	conversion := &Conversion{
-		fromISO,
-		toISO,
-		exchangeRate,
-	}
-
-	return convertedValue, conversion
 }
@@ -1,7 +1,11 @@
 package alphapoint
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -9,6 +13,8 @@ import (
 )
 
 func TestAlphapoint(t *testing.T) {
+	ctx := context.Background()
+
 	t.Run("Returns client with default config", func(t *testing.T) {
 		token := "alphapointToken"
 		alphapoint := NewClient(token)
@@ -17,7 +23,7 @@ func TestAlphapoint(t *testing.T) {
 		assert.Equal(t, BaseURL, alphapoint.BaseURL)
 	})
 
-	t.Run("Converts currency", func(t *testing.T) {
+	t.Run("Returns exchange rate", func(t *testing.T) {
 		response := `{
 			"Realtime Currency Exchange Rate": {
 				"5. Exchange Rate": ".7"
@@ -32,23 +38,134 @@ func TestAlphapoint(t *testing.T) {
 			BaseURL: server.URL,
 		}
 
-		fromISO := "USD"
-		toISO := "SGD"
-		forConversion := 20.00
+		rate, err := alphapoint.Rate(ctx, "USD", "SGD", time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, 0.7, rate)
+	})
 
-		convertedAmount, conversion := alphapoint.Convert(
-			fromISO,
-			toISO,
-			forConversion,
-		)
+	t.Run("Returns historical exchange rate", func(t *testing.T) {
+		response := `{
+			"Time Series FX (Daily)": {
+				"2018-03-16": { "4. close": "1.33" },
+				"2018-03-15": { "4. close": "1.31" },
+				"2018-03-13": { "4. close": "1.30" }
+			}
+		}`
 
-		expectedConversion := &Conversion{
-			fromISO,
-			toISO,
-			0.7,
+		server := mocks.MakeTestServer(response)
+		defer server.Close()
+
+		alphapoint := Client{
+			Token:   "alphapointToken",
+			BaseURL: server.URL,
 		}
 
-		assert.Equal(t, expectedConversion, conversion)
-		assert.Equal(t, 14.0, convertedAmount)
+		rate, err := alphapoint.Rate(ctx, "USD", "SGD", time.Date(2018, 3, 15, 12, 0, 0, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Equal(t, 1.31, rate)
+
+		// No rates are published on the 14th, so we use the rate of the 13th
+		rate, err = alphapoint.Rate(ctx, "USD", "SGD", time.Date(2018, 3, 14, 12, 0, 0, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Equal(t, 1.30, rate)
+
+		_, err = alphapoint.Rate(ctx, "USD", "SGD", time.Date(2018, 3, 12, 12, 0, 0, 0, time.UTC))
+		assert.EqualError(t, err, "no exchange rate")
+	})
+
+	t.Run("Reuses fetched series for other dates", func(t *testing.T) {
+		response := `{
+			"Time Series FX (Daily)": {
+				"2018-03-16": { "4. close": "1.33" },
+				"2018-03-15": { "4. close": "1.31" }
+			}
+		}`
+
+		server := mocks.MakeTestServer(response)
+
+		alphapoint := Client{
+			Token:   "alphapointToken",
+			BaseURL: server.URL,
+		}
+
+		rate, err := alphapoint.Rate(ctx, "USD", "SGD", time.Date(2018, 3, 16, 12, 0, 0, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Equal(t, 1.33, rate)
+		server.Close()
+
+		rate, err = alphapoint.Rate(ctx, "USD", "SGD", time.Date(2018, 3, 15, 12, 0, 0, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Equal(t, 1.31, rate)
+	})
+
+	t.Run("Fetches series of other pairs while one is slow", func(t *testing.T) {
+		response := `{
+			"Time Series FX (Daily)": {
+				"2018-03-16": { "4. close": "1.33" }
+			}
+		}`
+
+		requested := make(chan bool)
+		release := make(chan bool)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("from_symbol") == "USD" {
+				close(requested)
+				<-release
+			}
+			w.Write([]byte(response))
+		}))
+		defer server.Close()
+
+		alphapoint := Client{
+			Token:   "alphapointToken",
+			BaseURL: server.URL,
+		}
+		date := time.Date(2018, 3, 16, 12, 0, 0, 0, time.UTC)
+
+		slowRate := make(chan float64)
+		go func() {
+			rate, _ := alphapoint.Rate(ctx, "USD", "SGD", date)
+			slowRate <- rate
+		}()
+		<-requested
+
+		rate, err := alphapoint.Rate(ctx, "EUR", "SGD", date)
+		assert.NoError(t, err)
+		assert.Equal(t, 1.33, rate)
+
+		close(release)
+		assert.Equal(t, 1.33, <-slowRate)
+	})
+
+	t.Run("Returns error without exchange rate", func(t *testing.T) {
+		response := `{
+			"Error Message": "Invalid API call."
+		}`
+
+		server := mocks.MakeTestServer(response)
+		defer server.Close()
+
+		alphapoint := Client{
+			Token:   "alphapointToken",
+			BaseURL: server.URL,
+		}
+
+		_, err := alphapoint.Rate(ctx, "USD", "XXX", time.Now())
+		assert.EqualError(t, err, "no exchange rate")
+	})
+	t.Run("Stops retrying once the context is cancelled", func(t *testing.T) {
+		server := mocks.MakeTestServer("invalid response")
+		defer server.Close()
+
+		alphapoint := Client{
+			Token:   "alphapointToken",
+			BaseURL: server.URL,
+		}
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := alphapoint.Rate(cancelled, "USD", "SGD", time.Now())
+		assert.Error(t, err)
 	})
 }
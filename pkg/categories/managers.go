@@ -0,0 +1,91 @@
+package categories
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+	// Register SQL driver for DB
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+
+	"github.com/fmitra/dennis-bot/pkg/crypto"
+	"github.com/fmitra/dennis-bot/pkg/utils"
+)
+
+// KeywordManager exposes methods to interface with a Keyword in our
+// database.
+type KeywordManager struct {
+	db        *gorm.DB
+	secretKey string
+}
+
+// NewKeywordManager returns a KeywordManager. The secret key is used
+// to digest keywords and encrypt categories.
+func NewKeywordManager(db *gorm.DB, secretKey string) *KeywordManager {
+	return &KeywordManager{
+		db:        db,
+		secretKey: secretKey,
+	}
+}
+
+// Learn associates every keyword in an expense description with a category.
+// Keywords that were previously learned are updated to the latest category.
+// Keywords are learned with the expense they describe by creating the
+// KeywordManager with the transaction saving the expense.
+func (m *KeywordManager) Learn(userID uint, description string, category string) error {
+	encryptedCategory, err := crypto.Encrypt(category, m.secretKey)
+	if err != nil {
+		return err
+	}
+
+	for _, keyword := range utils.ParseKeywords(description) {
+		var existing Keyword
+		digest := m.digest(userID, keyword)
+		query := m.db.Where("user_id = ? AND digest = ?", userID, digest)
+		if query.First(&existing).RecordNotFound() {
+			err = m.db.Create(&Keyword{
+				Digest:   digest,
+				Category: encryptedCategory,
+				UserID:   userID,
+			}).Error
+		} else {
+			err = m.db.Model(&existing).Update("category", encryptedCategory).Error
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Match returns the most recently learned category for any keyword in
+// an expense description. An empty string is returned if no keywords match.
+func (m *KeywordManager) Match(userID uint, description string) string {
+	digests := []string{}
+	for _, keyword := range utils.ParseKeywords(description) {
+		digests = append(digests, m.digest(userID, keyword))
+	}
+
+	if len(digests) == 0 {
+		return ""
+	}
+
+	var keyword Keyword
+	query := m.db.Where("user_id = ? AND digest IN (?)", userID, digests)
+	if query.Order("updated_at desc").First(&keyword).RecordNotFound() {
+		return ""
+	}
+
+	category, err := crypto.Decrypt(keyword.Category, m.secretKey)
+	if err != nil {
+		return ""
+	}
+
+	return category
+}
+
+// digest returns a keyed digest of a User's keyword.
+func (m *KeywordManager) digest(userID uint, keyword string) string {
+	return crypto.Digest(fmt.Sprintf("%d_%s", userID, keyword), m.secretKey)
+}
@@ -0,0 +1,68 @@
+package categories
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/fmitra/dennis-bot/pkg/users"
+	mocks "github.com/fmitra/dennis-bot/test"
+)
+
+type KeywordManagerSuite struct {
+	suite.Suite
+	Env *mocks.TestEnv
+}
+
+func (suite *KeywordManagerSuite) SetupSuite() {
+	configFile := "../../config/config.json"
+	suite.Env = mocks.GetTestEnv(configFile)
+}
+
+func (suite *KeywordManagerSuite) TearDownSuite() {
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *KeywordManagerSuite) BeforeTest(suiteName, testName string) {
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *KeywordManagerSuite) getTestUser() users.User {
+	mocks.CreateTestUser(suite.Env.Db, 0)
+	manager := users.NewUserManager(suite.Env.Db)
+	return manager.GetByTelegramID(mocks.TestUserID)
+}
+
+func (suite *KeywordManagerSuite) TestLearnsKeywords() {
+	user := suite.getTestUser()
+	manager := NewKeywordManager(suite.Env.Db, suite.Env.Config.SecretKey)
+
+	err := manager.Learn(user.ID, "Lunch at McDonalds", "food")
+	assert.NoError(suite.T(), err)
+
+	var keywords []Keyword
+	suite.Env.Db.Where("user_id = ?", user.ID).Find(&keywords)
+	assert.Equal(suite.T(), 2, len(keywords))
+	for _, keyword := range keywords {
+		assert.NotEqual(suite.T(), "lunch", keyword.Digest)
+		assert.NotEqual(suite.T(), "food", keyword.Category)
+	}
+}
+
+func (suite *KeywordManagerSuite) TestMatchesKeywords() {
+	user := suite.getTestUser()
+	manager := NewKeywordManager(suite.Env.Db, suite.Env.Config.SecretKey)
+
+	manager.Learn(user.ID, "Lunch at McDonalds", "food")
+	assert.Equal(suite.T(), "food", manager.Match(user.ID, "lunch"))
+	assert.Equal(suite.T(), "", manager.Match(user.ID, "taxi"))
+	assert.Equal(suite.T(), "", manager.Match(user.ID+1, "lunch"))
+
+	manager.Learn(user.ID, "Lunch", "work")
+	assert.Equal(suite.T(), "work", manager.Match(user.ID, "lunch"))
+}
+
+func TestKeywordManagerSuite(t *testing.T) {
+	suite.Run(t, new(KeywordManagerSuite))
+}
@@ -0,0 +1,22 @@
+// Package categories represents keywords a User's expenses were categorized
+// with, allowing the Bot service to categorize future expenses on their behalf.
+package categories
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/fmitra/dennis-bot/pkg/users"
+)
+
+// Keyword is a word from the description of a previously categorized expense.
+// Categories must be readable when tracking an expense, at which point we do
+// not have access to the User's private key. To avoid storing descriptions in
+// plaintext, keywords are stored as a keyed digest and categories are encrypted
+// with the bot's secret key.
+type Keyword struct {
+	gorm.Model
+	Digest   string `gorm:"type:varchar(64);not null;unique_index:idx_keyword_user_digest"` // Keyed digest of the keyword
+	Category string `gorm:"not null"`                                                       // Encrypted category of the keyword
+	User     users.User
+	UserID   uint `gorm:"not null;unique_index:idx_keyword_user_digest"`
+}
@@ -5,18 +5,48 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/gob"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"math/big"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
 )
 
+// envelopePrefix marks text sealed with a data key and data keys wrapped
+// with a public key. The number is the version of the envelope format.
+const envelopePrefix = "v2:"
+
+// passwordPrefix marks text encrypted with a password by Encrypt.
+const passwordPrefix = "$scrypt$"
+
+// passwordVersion is the version of the format of text encrypted with a password.
+const passwordVersion = 2
+
+// KeyBitSize is the size of newly created key pairs. Key pairs created before
+// were 1024 bits and are replaced once the User supplies their password.
+const KeyBitSize = 3072
+
+// saltSize is the number of random bytes used to salt each password derived key.
+const saltSize = 16
+
+// defaultKDFParams are the scrypt parameters for newly encrypted text. Parameters
+// are stored with the encrypted text so they may be raised later.
+var defaultKDFParams = kdfParams{N: 32768, R: 8, P: 1}
+
+// maxKDFParams are the largest scrypt parameters we accept when decrypting.
+var maxKDFParams = kdfParams{N: 1048576, R: 16, P: 4}
+
 // InitializeGob registers rsa PublicKey/PrivateKey so we may encode
 // using stdlib encoding/gob.
 func InitializeGob() {
@@ -91,12 +121,18 @@ func ParsePublicKey(b64 string) (rsa.PublicKey, error) {
 // keys are password protected to ensure we are unable to access them on
 // behalf of the user.
 func CreateProtectedKeyPair(password string) (string, string, error) {
-	blankKey := ""
 	publicKey, privateKey, err := CreateKeyPair()
 	if err != nil {
-		return blankKey, blankKey, err
+		return "", "", err
 	}
 
+	return ProtectKeyPair(publicKey, privateKey, password)
+}
+
+// ProtectKeyPair string encodes a public/private key pair, protecting the
+// private key with a password.
+func ProtectKeyPair(publicKey rsa.PublicKey, privateKey rsa.PrivateKey, password string) (string, string, error) {
+	blankKey := ""
 	publicKeyStr, err := encodeKey(publicKey)
 	if err != nil {
 		return blankKey, blankKey, err
@@ -115,15 +151,31 @@ func CreateProtectedKeyPair(password string) (string, string, error) {
 	return publicKeyStr, encryptedPrivateKeyStr, nil
 }
 
+// ReprotectPrivateKey decrypts a password protected private key and protects
+// it again with a new password. The key itself is unchanged, so data encrypted
+// with its public key remains readable.
+func ReprotectPrivateKey(b64, oldPassword, newPassword string) (string, error) {
+	encodedKey, err := Decrypt(b64, oldPassword)
+	if err != nil {
+		return "", err
+	}
+
+	// Decrypting a legacy key does not fail on an incorrect password, so we
+	// confirm the result is a valid key before protecting it again
+	if _, err = decodeKey(encodedKey, &rsa.PrivateKey{}); err != nil {
+		return "", errors.New("invalid private key")
+	}
+
+	return Encrypt(encodedKey, newPassword)
+}
+
 // CreateKeyPair creates an rsa.PublicKey and rsa.PrivateKey pair.
 func CreateKeyPair() (rsa.PublicKey, rsa.PrivateKey, error) {
 	var publicKey rsa.PublicKey
 	var privateKey rsa.PrivateKey
 
 	reader := rand.Reader
-	bitSize := 1024
-
-	key, err := rsa.GenerateKey(reader, bitSize)
+	key, err := rsa.GenerateKey(reader, KeyBitSize)
 	if err != nil {
 		log.Printf("users: unable to generate key pair %s", err)
 		return publicKey, privateKey, err
@@ -135,31 +187,206 @@ func CreateKeyPair() (rsa.PublicKey, rsa.PrivateKey, error) {
 	return publicKey, privateKey, nil
 }
 
-// Encrypt encrypts and base64 encodes a string with a password.
+// CreateDataKey creates a random 256-bit key to seal a single record. Data keys
+// are wrapped with a User's public key and stored alongside the record.
+func CreateDataKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// WrapDataKey encrypts a data key with an rsa.PublicKey. The wrapped key is
+// returned with the envelope version prefix for convenient storage.
+func WrapDataKey(key []byte, pk rsa.PublicKey) (string, error) {
+	wrappedKey, err := AsymEncrypt(string(key), pk)
+	if err != nil {
+		return "", err
+	}
+
+	return envelopePrefix + wrappedKey, nil
+}
+
+// UnwrapDataKey decrypts a data key wrapped by WrapDataKey with an rsa.PrivateKey.
+func UnwrapDataKey(wrappedKey string, pk rsa.PrivateKey) ([]byte, error) {
+	if !IsSealed(wrappedKey) {
+		return nil, errors.New("unsupported envelope version")
+	}
+
+	key, err := AsymDecrypt(strings.TrimPrefix(wrappedKey, envelopePrefix), pk)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(key), nil
+}
+
+// Seal encrypts text with a data key using AES-GCM. Sealed text is base64
+// encoded and carries the envelope version prefix so we can tell it apart
+// from text encrypted by earlier versions.
+func Seal(text string, key []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, []byte(text), nil)
+	return envelopePrefix + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Open decrypts text sealed by Seal with the same data key.
+func Open(sealed string, key []byte) (string, error) {
+	if !IsSealed(sealed) {
+		return "", errors.New("unsupported envelope version")
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, envelopePrefix))
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return "", errors.New("cipher text too short")
+	}
+
+	nonce := ciphertext[:gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// IsSealed checks if text was sealed or wrapped with the current envelope
+// version. Base64 encoded text from earlier versions never carries a prefix.
+func IsSealed(text string) bool {
+	return strings.HasPrefix(text, envelopePrefix)
+}
+
+// newGCM returns an AES-GCM cipher for a data key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Encrypt encrypts a string with a password using AES-GCM. The key is derived
+// from the password with scrypt and a random salt, so the same text and password
+// never produce the same result. Encrypted text is returned in a self-describing
+// format, for example "$scrypt$v=2$N=32768,r=8,p=1$<salt>$<ciphertext>".
 func Encrypt(text string, password string) (string, error) {
-	key := sha256.New()
-	key.Write([]byte(password))
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", err
+	}
 
-	block, err := aes.NewCipher(key.Sum(nil))
+	params := defaultKDFParams
+	key, err := params.deriveKey(password, salt)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
 	if err != nil {
 		return "", err
 	}
 
-	ciphertext := make([]byte, aes.BlockSize+len(text))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return "", err
 	}
 
-	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], []byte(text))
-	encodedText := base64.StdEncoding.EncodeToString(ciphertext)
+	ciphertext := gcm.Seal(nonce, nonce, []byte(text), nil)
+	encodedText := fmt.Sprintf(
+		"%sv=%d$%s$%s$%s",
+		passwordPrefix,
+		passwordVersion,
+		params,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(ciphertext),
+	)
 
 	return encodedText, nil
 }
 
-// Decrypt decrypts a base64 encoded string with a password.
+// Decrypt decrypts a string encrypted with a password. Text encrypted before
+// Encrypt used AES-GCM is still decrypted, so existing values may be upgraded
+// the next time they are encrypted.
 func Decrypt(text string, password string) (string, error) {
+	if IsLegacy(text) {
+		return decryptLegacy(text, password)
+	}
+
+	// Format is $scrypt$v=<version>$<params>$<salt>$<ciphertext>
+	parts := strings.Split(strings.TrimPrefix(text, passwordPrefix), "$")
+	if len(parts) != 4 || parts[0] != fmt.Sprintf("v=%d", passwordVersion) {
+		return "", errors.New("unsupported encryption version")
+	}
+
+	params, err := parseKDFParams(parts[1])
+	if err != nil {
+		return "", err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", err
+	}
+
+	key, err := params.deriveKey(password, salt)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return "", errors.New("cipher text too short")
+	}
+
+	nonce := ciphertext[:gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("invalid password")
+	}
+
+	return string(plaintext), nil
+}
+
+// IsLegacy checks if text was encrypted with a password before Encrypt used
+// AES-GCM. Legacy text is plain base64, which never carries a prefix.
+func IsLegacy(text string) bool {
+	return !strings.HasPrefix(text, passwordPrefix)
+}
+
+// decryptLegacy decrypts a base64 encoded string encrypted with AES-CFB and a
+// SHA-256 hash of the password. AES-CFB has no integrity check, so decrypting
+// with an incorrect password returns garbage rather than an error.
+func decryptLegacy(text string, password string) (string, error) {
 	key := sha256.New()
 	key.Write([]byte(password))
 
@@ -185,6 +412,39 @@ func Decrypt(text string, password string) (string, error) {
 	return string(decodedText), nil
 }
 
+// kdfParams are the scrypt cost parameters used to derive a key from a password.
+type kdfParams struct {
+	N int
+	R int
+	P int
+}
+
+// String returns the kdfParams in the format stored with encrypted text.
+func (k kdfParams) String() string {
+	return fmt.Sprintf("N=%d,r=%d,p=%d", k.N, k.R, k.P)
+}
+
+// deriveKey derives a 256-bit key from a password and salt.
+func (k kdfParams) deriveKey(password string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(password), salt, k.N, k.R, k.P, 32)
+}
+
+// parseKDFParams parses kdfParams stored with encrypted text. Parameters are
+// capped so a tampered value cannot make us spend unbounded memory.
+func parseKDFParams(s string) (kdfParams, error) {
+	var params kdfParams
+	_, err := fmt.Sscanf(s, "N=%d,r=%d,p=%d", &params.N, &params.R, &params.P)
+	if err != nil {
+		return kdfParams{}, errors.New("invalid encryption parameters")
+	}
+
+	if params.N > maxKDFParams.N || params.R > maxKDFParams.R || params.P > maxKDFParams.P {
+		return kdfParams{}, errors.New("invalid encryption parameters")
+	}
+
+	return params, nil
+}
+
 // HashText hashes a string text using bcrypt.
 func HashText(text string) (string, error) {
 	t := []byte(text)
@@ -205,6 +465,35 @@ func ValidateHash(hash, text string) error {
 	return bcrypt.CompareHashAndPassword(bHash, bText)
 }
 
+// Digest returns a hex encoded HMAC-SHA256 of a string text. Unlike HashText,
+// the digest is deterministic for a given key, allowing us to look up values
+// without storing them in plaintext.
+func Digest(text, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(text))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// codeAlphabet are the characters used in generated codes. Characters that are
+// easily confused with one another (0/o, 1/l/i) are left out.
+const codeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateCode returns a random code of the given length, suitable for one-time
+// codes we ask a user to write down.
+func GenerateCode(length int) (string, error) {
+	max := big.NewInt(int64(len(codeAlphabet)))
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = codeAlphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
 // encodeKey encodes a key type to a base64 encoded string for storage.
 func encodeKey(key interface{}) (string, error) {
 	b := bytes.Buffer{}
@@ -2,6 +2,7 @@ package crypto
 
 import (
 	"crypto/rsa"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -37,10 +38,39 @@ func TestKeys(t *testing.T) {
 		decrypted, _ := Decrypt(encrypted, password)
 		assert.Equal(t, text, decrypted)
 
-		decrypted, _ = Decrypt(encrypted, "invalid-password")
+		decrypted, err := Decrypt(encrypted, "invalid-password")
+		assert.EqualError(t, err, "invalid password")
 		assert.NotEqual(t, decrypted, text)
 	})
 
+	t.Run("Should encrypt text in a versioned format", func(t *testing.T) {
+		encrypted, err := Encrypt("This is private content", "moscow-in-june")
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(encrypted, "$scrypt$v=2$N=32768,r=8,p=1$"))
+		assert.False(t, IsLegacy(encrypted))
+
+		otherEncrypted, _ := Encrypt("This is private content", "moscow-in-june")
+		assert.NotEqual(t, encrypted, otherEncrypted)
+
+		tampered := strings.Replace(encrypted, "v=2", "v=3", 1)
+		_, err = Decrypt(tampered, "moscow-in-june")
+		assert.EqualError(t, err, "unsupported encryption version")
+
+		tampered = strings.Replace(encrypted, "N=32768", "N=1073741824", 1)
+		_, err = Decrypt(tampered, "moscow-in-june")
+		assert.EqualError(t, err, "invalid encryption parameters")
+	})
+
+	t.Run("Should decrypt legacy text with a password", func(t *testing.T) {
+		// Encrypted with AES-CFB and a SHA-256 hash of the password
+		legacy := "+HlTQ0luvPA2coRY0Bz+uvQkGD9MdiAvWa7S39wgXVcvJ7IBITAA"
+		assert.True(t, IsLegacy(legacy))
+
+		decrypted, err := Decrypt(legacy, "moscow-in-june")
+		assert.NoError(t, err)
+		assert.Equal(t, "This is private content", decrypted)
+	})
+
 	t.Run("Should create an encrypted encoded key pair", func(t *testing.T) {
 		password := "moscow-in-june"
 		publicKeyStr, encryptedPrivateKey, _ := CreateProtectedKeyPair(password)
@@ -77,6 +107,21 @@ func TestKeys(t *testing.T) {
 		assert.NotNil(t, privateKey.Primes)
 	})
 
+	t.Run("Should protect a private key with a new password", func(t *testing.T) {
+		_, encryptedPrivateKey, _ := CreateProtectedKeyPair("old-password")
+		originalKey, _ := ParsePrivateKey(encryptedPrivateKey, "old-password")
+
+		reprotectedKey, err := ReprotectPrivateKey(encryptedPrivateKey, "old-password", "new-password")
+		assert.NoError(t, err)
+
+		privateKey, err := ParsePrivateKey(reprotectedKey, "new-password")
+		assert.NoError(t, err)
+		assert.Equal(t, originalKey.D, privateKey.D)
+
+		_, err = ReprotectPrivateKey(encryptedPrivateKey, "wrong-password", "new-password")
+		assert.EqualError(t, err, "invalid password")
+	})
+
 	t.Run("Should parse encoded text to private key", func(t *testing.T) {
 		_, key, _ := CreateKeyPair()
 		privateKeyStr, _ := encodeKey(key)
@@ -104,4 +149,60 @@ func TestKeys(t *testing.T) {
 		err := ValidateHash(hashedPassword, password)
 		assert.NoError(t, err)
 	})
+
+	t.Run("Should create a deterministic digest", func(t *testing.T) {
+		digest := Digest("coffee", "secret-key")
+		assert.Equal(t, digest, Digest("coffee", "secret-key"))
+		assert.NotEqual(t, digest, Digest("coffee", "other-key"))
+		assert.NotEqual(t, digest, Digest("lunch", "secret-key"))
+		assert.Len(t, digest, 64)
+	})
+
+	t.Run("Should generate a random code", func(t *testing.T) {
+		code, err := GenerateCode(10)
+		assert.NoError(t, err)
+		assert.Len(t, code, 10)
+		assert.NotContains(t, code, "0")
+		assert.NotContains(t, code, "l")
+
+		otherCode, _ := GenerateCode(10)
+		assert.NotEqual(t, code, otherCode)
+	})
+
+	t.Run("Should seal and open text with a data key", func(t *testing.T) {
+		key, err := CreateDataKey()
+		assert.NoError(t, err)
+		assert.Len(t, key, 32)
+
+		text := strings.Repeat("a long description of an expense ", 20)
+		sealed, err := Seal(text, key)
+		assert.NoError(t, err)
+		assert.True(t, IsSealed(sealed))
+		assert.NotContains(t, sealed, "description")
+
+		opened, err := Open(sealed, key)
+		assert.NoError(t, err)
+		assert.Equal(t, text, opened)
+
+		otherKey, _ := CreateDataKey()
+		_, err = Open(sealed, otherKey)
+		assert.Error(t, err)
+
+		_, err = Open("bm90IHNlYWxlZA==", key)
+		assert.EqualError(t, err, "unsupported envelope version")
+	})
+
+	t.Run("Should wrap and unwrap a data key", func(t *testing.T) {
+		publicKey, privateKey, _ := CreateKeyPair()
+		assert.Equal(t, 3072, publicKey.N.BitLen())
+
+		key, _ := CreateDataKey()
+		wrappedKey, err := WrapDataKey(key, publicKey)
+		assert.NoError(t, err)
+		assert.True(t, IsSealed(wrappedKey))
+
+		unwrappedKey, err := UnwrapDataKey(wrappedKey, privateKey)
+		assert.NoError(t, err)
+		assert.Equal(t, key, unwrappedKey)
+	})
 }
@@ -0,0 +1,59 @@
+package exchange
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	// Register SQL driver for DB
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+)
+
+// RateManager exposes methods to interface with a Rate in our database.
+type RateManager struct {
+	db *gorm.DB
+}
+
+// NewRateManager returns a RateManager.
+func NewRateManager(db *gorm.DB) *RateManager {
+	return &RateManager{db: db}
+}
+
+// Save stores the exchange rate from one currency to another on the day
+// of a date. A previously stored rate for the same day is updated.
+func (m *RateManager) Save(fromISO string, toISO string, date time.Time, value float64) error {
+	var rate Rate
+	query := m.db.Where(
+		"from_currency = ? AND to_currency = ? AND day = ?",
+		fromISO, toISO, date.Format(DayFormat),
+	)
+	if query.First(&rate).RecordNotFound() {
+		return m.db.Create(&Rate{
+			FromCurrency: fromISO,
+			ToCurrency:   toISO,
+			Day:          date.Format(DayFormat),
+			Value:        value,
+		}).Error
+	}
+
+	// Updating the value alone would not touch UpdatedAt if it is unchanged
+	return m.db.Model(&rate).Updates(map[string]interface{}{
+		"value":      value,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// Latest returns the most recent exchange rate from one currency to another
+// on or before the day of a date.
+func (m *RateManager) Latest(fromISO string, toISO string, date time.Time) (Rate, error) {
+	var rate Rate
+	query := m.db.Where(
+		"from_currency = ? AND to_currency = ? AND day <= ?",
+		fromISO, toISO, date.Format(DayFormat),
+	)
+	if query.Order("day desc").First(&rate).RecordNotFound() {
+		return rate, errors.New("no exchange rate")
+	}
+
+	return rate, nil
+}
@@ -0,0 +1,98 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	mocks "github.com/fmitra/dennis-bot/test"
+)
+
+type RateManagerSuite struct {
+	suite.Suite
+	Env *mocks.TestEnv
+}
+
+func (suite *RateManagerSuite) SetupSuite() {
+	configFile := "../../config/config.json"
+	suite.Env = mocks.GetTestEnv(configFile)
+}
+
+func (suite *RateManagerSuite) TearDownSuite() {
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *RateManagerSuite) BeforeTest(suiteName, testName string) {
+	mocks.CleanUpEnv(suite.Env)
+}
+
+func (suite *RateManagerSuite) TestSavesRate() {
+	manager := NewRateManager(suite.Env.Db)
+	date := time.Date(2018, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	err := manager.Save("SGD", "USD", date, 0.7)
+	assert.NoError(suite.T(), err)
+
+	// Rates of the same day are updated
+	err = manager.Save("SGD", "USD", date.Add(time.Hour), 0.75)
+	assert.NoError(suite.T(), err)
+
+	var count int
+	suite.Env.Db.Model(&Rate{}).Count(&count)
+	assert.Equal(suite.T(), 1, count)
+
+	rate, err := manager.Latest("SGD", "USD", date)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "2018-03-14", rate.Day)
+	assert.Equal(suite.T(), 0.75, rate.Value)
+}
+
+func (suite *RateManagerSuite) TestReturnsLatestRate() {
+	manager := NewRateManager(suite.Env.Db)
+	march13 := time.Date(2018, 3, 13, 12, 0, 0, 0, time.UTC)
+	march16 := time.Date(2018, 3, 16, 12, 0, 0, 0, time.UTC)
+	manager.Save("SGD", "USD", march13, 0.7)
+	manager.Save("SGD", "USD", march16, 0.8)
+	manager.Save("USD", "SGD", march16, 1.25)
+
+	rate, err := manager.Latest("SGD", "USD", march16.AddDate(0, 0, 1))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0.8, rate.Value)
+
+	rate, err = manager.Latest("SGD", "USD", march16.AddDate(0, 0, -1))
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0.7, rate.Value)
+
+	_, err = manager.Latest("SGD", "USD", march13.AddDate(0, 0, -1))
+	assert.EqualError(suite.T(), err, "no exchange rate")
+
+	_, err = manager.Latest("SGD", "JPY", march16)
+	assert.EqualError(suite.T(), err, "no exchange rate")
+}
+
+func (suite *RateManagerSuite) TestChecksIfRateIsFresh() {
+	manager := NewRateManager(suite.Env.Db)
+	now := time.Now()
+	manager.Save("SGD", "USD", now, 0.7)
+
+	rate, _ := manager.Latest("SGD", "USD", now)
+	assert.True(suite.T(), rate.IsFresh(now, time.Hour))
+	assert.False(suite.T(), rate.IsFresh(now, 0))
+	assert.False(suite.T(), rate.IsFresh(now.AddDate(0, 0, 1), time.Hour))
+
+	// Rates of past days stay fresh once updated after the day ended
+	lastYear := now.AddDate(-1, 0, 0)
+	manager.Save("SGD", "USD", lastYear, 0.75)
+	rate, _ = manager.Latest("SGD", "USD", lastYear)
+	assert.True(suite.T(), rate.IsFresh(lastYear, 0))
+
+	// Rates updated before their day ended may still change
+	rate.UpdatedAt = lastYear
+	assert.False(suite.T(), rate.IsFresh(lastYear, time.Hour))
+}
+
+func TestRateManagerSuite(t *testing.T) {
+	suite.Run(t, new(RateManagerSuite))
+}
@@ -0,0 +1,41 @@
+// Package exchange stores exchange rates between currencies, allowing the Bot
+// service to convert expenses when rate providers are unavailable or rate
+// limited and the cache layer has been flushed.
+package exchange
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// DayFormat is the format of the day an exchange rate applies to.
+const DayFormat = "2006-01-02"
+
+// Rate is the exchange rate from one currency to another on a day. Rates
+// are updated whenever a rate provider returns a newer value for the day.
+type Rate struct {
+	gorm.Model
+	FromCurrency string  `gorm:"type:varchar(3);not null;unique_index:idx_rate_currency_day"`
+	ToCurrency   string  `gorm:"type:varchar(3);not null;unique_index:idx_rate_currency_day"`
+	Day          string  `gorm:"type:varchar(10);not null;unique_index:idx_rate_currency_day"` // Day of the rate (ex. 2018-03-14)
+	Value        float64 `gorm:"not null"`
+}
+
+// IsFresh checks if a Rate is for the same day as a date and is still
+// current. Rates of a day that has ended never change, so they are always
+// fresh once they were updated after the day ended. Rates of the current
+// day are fresh within the max age. Stale rates may still be used if no
+// fresh rate can be found.
+func (r Rate) IsFresh(date time.Time, maxAge time.Duration) bool {
+	if r.Day != date.Format(DayFormat) {
+		return false
+	}
+
+	today := time.Now().In(date.Location()).Format(DayFormat)
+	if r.Day < today {
+		return r.UpdatedAt.In(date.Location()).Format(DayFormat) > r.Day
+	}
+
+	return time.Since(r.UpdatedAt) < maxAge
+}
@@ -3,7 +3,6 @@ package expenses
 import (
 	"crypto/rsa"
 	"errors"
-	"fmt"
 	"log"
 	"strconv"
 	"time"
@@ -11,6 +10,8 @@ import (
 	"github.com/jinzhu/gorm"
 	// Register SQL driver for DB
 	_ "github.com/jinzhu/gorm/dialects/postgres"
+
+	"github.com/fmitra/dennis-bot/pkg/crypto"
 )
 
 const (
@@ -22,25 +23,54 @@ const (
 
 	// TODAY is a one day period of expenses
 	TODAY = "today"
+
+	// YESTERDAY is the one day period of expenses before today
+	YESTERDAY = "yesterday"
+
+	// LASTWEEK is the one week period of expenses before this week
+	LASTWEEK = "last week"
+
+	// LASTMONTH is the one month period of expenses before this month
+	LASTMONTH = "last month"
+
+	// YEAR is a one year period of expenses
+	YEAR = "year"
+
+	// LASTYEAR is the one year period of expenses before this year
+	LASTYEAR = "last year"
+
+	// UNCATEGORIZED is the category of expenses tracked without a category
+	UNCATEGORIZED = "uncategorized"
 )
 
+// upgradeBatchSize is the number of legacy Expenses we upgrade at a time.
+const upgradeBatchSize = 100
+
 // Clock is an interface that provides a Now method.
 type Clock interface {
 	Now() time.Time
 }
 
-// ExpenseManagerClock uses stdlib time to satisfy the Clock interface
-type ExpenseManagerClock struct{}
+// ExpenseManagerClock uses stdlib time to satisfy the Clock interface.
+// The current time is returned in the clock's Location, defaulting to UTC.
+type ExpenseManagerClock struct {
+	Location *time.Location
+}
 
 // ExpenseManager exposes methods to interface with an Expense in our database.
 type ExpenseManager struct {
-	clock Clock
-	db    *gorm.DB
+	clock     Clock
+	db        *gorm.DB
+	weekStart time.Weekday
 }
 
 // Now returns the current time.
 func (em *ExpenseManagerClock) Now() time.Time {
-	return time.Now()
+	if em.Location == nil {
+		return time.Now().UTC()
+	}
+
+	return time.Now().In(em.Location)
 }
 
 // NewExpenseManager returns an ExpenseManager with a default clock.
@@ -51,35 +81,225 @@ func NewExpenseManager(db *gorm.DB) *ExpenseManager {
 	}
 }
 
-// Save saves an Expense into our DB.
+// NewLocalExpenseManager returns an ExpenseManager with a clock in the
+// User's timezone. Periods such as today or this week are bound by the
+// User's local day rather than the UTC day, and weeks start on the User's
+// preferred day.
+func NewLocalExpenseManager(db *gorm.DB, loc *time.Location, weekStart time.Weekday) *ExpenseManager {
+	return &ExpenseManager{
+		db:        db,
+		clock:     &ExpenseManagerClock{Location: loc},
+		weekStart: weekStart,
+	}
+}
+
+// Now returns the current time according to the ExpenseManager's clock.
+func (m *ExpenseManager) Now() time.Time {
+	return m.clock.Now()
+}
+
+// Save saves an Expense into our DB. Expenses from a chat message that
+// was already tracked fail to save.
 func (m *ExpenseManager) Save(expense *Expense) error {
 	if m.db.NewRecord(expense) {
-		m.db.Create(expense)
-		return nil
+		return m.db.Create(expense).Error
 	}
 
 	log.Printf("models: attempting insert record with existing pk - %v", expense)
 	return errors.New("expense ID already exists")
 }
 
-// ParseTimePeriod parses a string period (ex. month) into a time.Time object.
-func (m *ExpenseManager) ParseTimePeriod(period string) (time.Time, error) {
-	today := m.clock.Now()
-	weekday := int(today.Weekday())
-	year, month, day := today.Date()
+// Update encrypts an existing Expense with the User's public key and saves
+// the changes into our DB.
+func (m *ExpenseManager) Update(expense *Expense, pk rsa.PublicKey) error {
+	if m.db.NewRecord(expense) {
+		return errors.New("expense does not exist")
+	}
 
-	switch period {
-	case MONTH:
-		return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC), nil
-	case WEEK:
-		year, month, day := today.AddDate(0, 0, -weekday).Date()
-		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC), nil
-	case TODAY:
-		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC), nil
-	default:
-		errorMessage := fmt.Sprintf("%s is an invalid period", period)
-		return time.Time{}, errors.New(errorMessage)
+	if err := expense.Encrypt(pk); err != nil {
+		return err
 	}
+
+	return m.db.Save(expense).Error
+}
+
+// Delete permanently removes a User's Expense from our DB.
+func (m *ExpenseManager) Delete(expense *Expense) error {
+	if m.db.NewRecord(expense) {
+		return errors.New("expense does not exist")
+	}
+
+	query := m.db.Unscoped().Where("user_id = ?", expense.UserID).Delete(expense)
+	if query.Error != nil {
+		return query.Error
+	}
+
+	if query.RowsAffected == 0 {
+		return errors.New("expense does not exist")
+	}
+
+	return nil
+}
+
+// UpgradeEncryption re-encrypts a User's legacy Expenses, which were encrypted
+// field by field with the User's public key, so they are sealed with a data key
+// instead. Expenses that fail to decrypt are left as they are. It returns the
+// number of Expenses upgraded.
+func (m *ExpenseManager) UpgradeEncryption(userID uint, privateKey rsa.PrivateKey) (int, error) {
+	upgraded := 0
+	lastID := uint(0)
+	legacyQuery := "user_id = ? AND id > ? AND (data_key = '' OR data_key IS NULL)"
+
+	for {
+		var expenses []Expense
+		err := m.db.Where(legacyQuery, userID, lastID).
+			Order("id asc").
+			Limit(upgradeBatchSize).
+			Find(&expenses).Error
+		if err != nil {
+			return upgraded, err
+		}
+
+		if len(expenses) == 0 {
+			return upgraded, nil
+		}
+
+		for _, expense := range expenses {
+			lastID = expense.ID
+			if err = expense.Decrypt(privateKey); err != nil {
+				continue
+			}
+
+			if err = expense.Encrypt(privateKey.PublicKey); err != nil {
+				return upgraded, err
+			}
+
+			// The Expense may have been edited or upgraded since we queried
+			// it, in which case we leave it alone
+			query := m.db.Model(&Expense{}).
+				Where("id = ? AND (data_key = '' OR data_key IS NULL)", expense.ID).
+				Updates(map[string]interface{}{
+					"total":       expense.Total,
+					"historical":  expense.Historical,
+					"description": expense.Description,
+					"currency":    expense.Currency,
+					"category":    expense.Category,
+					"data_key":    expense.DataKey,
+				})
+			if query.Error != nil {
+				return upgraded, query.Error
+			}
+
+			upgraded += int(query.RowsAffected)
+		}
+	}
+}
+
+// RewrapDataKeys protects a User's Expenses with a new key pair. Data keys are
+// unwrapped with the old private key and wrapped again with the new public key.
+// Legacy Expenses are sealed with a data key wrapped with the new public key.
+// Expenses that fail to decrypt with the old private key are left as they are.
+// It returns the number of Expenses protected with the new key pair.
+func (m *ExpenseManager) RewrapDataKeys(userID uint, oldKey rsa.PrivateKey, newKey rsa.PublicKey) (int, error) {
+	rewrapped := 0
+	lastID := uint(0)
+
+	for {
+		var expenses []Expense
+		err := m.db.Where("user_id = ? AND id > ?", userID, lastID).
+			Order("id asc").
+			Limit(upgradeBatchSize).
+			Find(&expenses).Error
+		if err != nil {
+			return rewrapped, err
+		}
+
+		if len(expenses) == 0 {
+			return rewrapped, nil
+		}
+
+		for _, expense := range expenses {
+			lastID = expense.ID
+			if expense.IsLegacy() {
+				if err = expense.Decrypt(oldKey); err != nil {
+					continue
+				}
+
+				if err = expense.Encrypt(newKey); err != nil {
+					return rewrapped, err
+				}
+			} else {
+				key, err := crypto.UnwrapDataKey(expense.DataKey, oldKey)
+				if err != nil {
+					log.Printf("expenses: failed to unwrap data key - %s", err)
+					continue
+				}
+
+				if expense.DataKey, err = crypto.WrapDataKey(key, newKey); err != nil {
+					return rewrapped, err
+				}
+			}
+
+			err = m.db.Model(&Expense{}).
+				Where("id = ?", expense.ID).
+				Updates(map[string]interface{}{
+					"total":       expense.Total,
+					"historical":  expense.Historical,
+					"description": expense.Description,
+					"currency":    expense.Currency,
+					"category":    expense.Category,
+					"data_key":    expense.DataKey,
+				}).Error
+			if err != nil {
+				return rewrapped, err
+			}
+
+			rewrapped++
+		}
+	}
+}
+
+// GetByID returns a User's Expense by its ID.
+func (m *ExpenseManager) GetByID(expenseID uint, userID uint) (Expense, error) {
+	var expense Expense
+	query := m.db.Where("id = ? AND user_id = ?", expenseID, userID)
+	if query.First(&expense).RecordNotFound() {
+		return expense, errors.New("expense does not exist")
+	}
+
+	return expense, nil
+}
+
+// LastForUser returns the most recently tracked Expense of a User.
+func (m *ExpenseManager) LastForUser(userID uint) (Expense, error) {
+	expenses, err := m.RecentForUser(userID, 1)
+	if err != nil {
+		return Expense{}, err
+	}
+
+	return expenses[0], nil
+}
+
+// RecentForUser returns a User's most recently tracked Expenses, newest first.
+func (m *ExpenseManager) RecentForUser(userID uint, limit int) ([]Expense, error) {
+	var expenses []Expense
+	query := m.db.Where("user_id = ?", userID).Order("id desc").Limit(limit)
+	if err := query.Find(&expenses).Error; err != nil {
+		return expenses, err
+	}
+
+	if len(expenses) == 0 {
+		return expenses, errors.New("no expenses found")
+	}
+
+	return expenses, nil
+}
+
+// ParseTimePeriod parses a string period into a Period with a start and end bound.
+// Periods may be relative to the current time (ex. month, last week, last 30 days)
+// or an explicit range of dates (ex. from march 1 to march 15).
+func (m *ExpenseManager) ParseTimePeriod(period string) (Period, error) {
+	return parsePeriod(period, m.clock.Now(), m.weekStart)
 }
 
 // QueryByPeriod finds all expenses within a specific period.
@@ -91,20 +311,25 @@ func (m *ExpenseManager) QueryByPeriod(period string, userID uint) ([]Expense, e
 		return expenses, err
 	}
 
-	query := "user_id = ? AND date >= ?"
-	if period == TODAY {
-		query = "user_id = ? AND date = ?"
-	}
-
-	if err = m.db.Where(query, userID, timePeriod).Find(&expenses).Error; err != nil {
+	// Expenses are ordered chronologically so they may be listed to the user
+	query := "user_id = ? AND date >= ? AND date < ?"
+	err = m.db.Where(query, userID, timePeriod.Start, timePeriod.End).
+		Order("date asc, id asc").
+		Find(&expenses).Error
+	if err != nil {
 		return expenses, err
 	}
 
 	return expenses, nil
 }
 
+// Converter converts the historical value of an Expense with the exchange
+// rate on the date of the Expense.
+type Converter func(historical float64, date time.Time) (float64, error)
+
 // TotalByPeriod sums the total historical value of a list of Expenses.
-func (m *ExpenseManager) TotalByPeriod(period string, userID uint, pk rsa.PrivateKey) (float64, error) {
+// Each value is converted on the date of its Expense if a Converter is given.
+func (m *ExpenseManager) TotalByPeriod(period string, userID uint, pk rsa.PrivateKey, convert Converter) (float64, error) {
 	expenseTotal := 0.0
 	expenses, err := m.QueryByPeriod(period, userID)
 	if err != nil {
@@ -115,8 +340,11 @@ func (m *ExpenseManager) TotalByPeriod(period string, userID uint, pk rsa.Privat
 	// as an encrypted string in the DB, so we must first query for the relevant
 	// records, decrypt, and sum it ourselves
 	for _, expense := range expenses {
-		expense.Decrypt(pk)
-		amount, err := strconv.ParseFloat(expense.Historical, 64)
+		if err = expense.Decrypt(pk); err != nil {
+			return 0.0, err
+		}
+
+		amount, err := historicalValue(expense, convert)
 		if err != nil {
 			return 0.0, err
 		}
@@ -125,3 +353,43 @@ func (m *ExpenseManager) TotalByPeriod(period string, userID uint, pk rsa.Privat
 	}
 	return expenseTotal, nil
 }
+
+// TotalByCategory sums the total historical value of a list of Expenses
+// grouped by category. Each value is converted on the date of its Expense
+// if a Converter is given.
+func (m *ExpenseManager) TotalByCategory(period string, userID uint, pk rsa.PrivateKey, convert Converter) (map[string]float64, error) {
+	totals := map[string]float64{}
+	expenses, err := m.QueryByPeriod(period, userID)
+	if err != nil {
+		return totals, err
+	}
+
+	for _, expense := range expenses {
+		if err = expense.Decrypt(pk); err != nil {
+			return map[string]float64{}, err
+		}
+
+		amount, err := historicalValue(expense, convert)
+		if err != nil {
+			return map[string]float64{}, err
+		}
+
+		category := expense.Category
+		if category == "" {
+			category = UNCATEGORIZED
+		}
+		totals[category] += amount
+	}
+	return totals, nil
+}
+
+// historicalValue returns the historical value of a decrypted Expense,
+// converted on the date of the Expense if a Converter is given.
+func historicalValue(expense Expense, convert Converter) (float64, error) {
+	amount, err := strconv.ParseFloat(expense.Historical, 64)
+	if err != nil || convert == nil {
+		return amount, err
+	}
+
+	return convert(amount, expense.Date)
+}
@@ -86,6 +86,180 @@ func (suite *ExpenseManagerSuite) TestCreateExpense() {
 	assert.False(suite.T(), suite.Env.Db.NewRecord(expense))
 }
 
+func (suite *ExpenseManagerSuite) TestSavesExpenseFromSourceOnce() {
+	user := GetTestUser(suite.Env.Db)
+	expenseManager := NewExpenseManager(suite.Env.Db)
+	newExpense := func(source string) *Expense {
+		return &Expense{
+			Date:        time.Now(),
+			Description: "Food",
+			Total:       "26.30",
+			Historical:  "20.25",
+			Currency:    "SGD",
+			Source:      source,
+			User:        user,
+		}
+	}
+
+	assert.NoError(suite.T(), expenseManager.Save(newExpense("456:123")))
+	assert.Error(suite.T(), expenseManager.Save(newExpense("456:123")))
+	assert.NoError(suite.T(), expenseManager.Save(newExpense("456:124")))
+
+	// Expenses without a source are never duplicates
+	assert.NoError(suite.T(), expenseManager.Save(newExpense("")))
+	assert.NoError(suite.T(), expenseManager.Save(newExpense("")))
+
+	var count int
+	suite.Env.Db.Model(&Expense{}).Where("user_id = ?", user.ID).Count(&count)
+	assert.Equal(suite.T(), 4, count)
+}
+
+func (suite *ExpenseManagerSuite) TestReturnsRecentExpenses() {
+	expenseManager := NewExpenseManager(suite.Env.Db)
+	user := GetTestUser(suite.Env.Db)
+
+	_, err := expenseManager.LastForUser(user.ID)
+	assert.EqualError(suite.T(), err, "no expenses found")
+
+	firstEntryDate := time.Date(2018, 3, 8, 0, 0, 0, 0, time.UTC)
+	BatchCreateExpenses(suite.Env.Db, user, firstEntryDate, 5)
+
+	expenses, err := expenseManager.RecentForUser(user.ID, 3)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 3, len(expenses))
+	assert.True(suite.T(), expenses[0].ID > expenses[1].ID)
+
+	lastExpense, err := expenseManager.LastForUser(user.ID)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), expenses[0].ID, lastExpense.ID)
+
+	expense, err := expenseManager.GetByID(lastExpense.ID, user.ID)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), lastExpense.ID, expense.ID)
+
+	_, err = expenseManager.GetByID(lastExpense.ID, user.ID+1)
+	assert.EqualError(suite.T(), err, "expense does not exist")
+}
+
+func (suite *ExpenseManagerSuite) TestUpdatesExpense() {
+	expenseManager := NewExpenseManager(suite.Env.Db)
+	user := GetTestUser(suite.Env.Db)
+	publicKey, _ := crypto.ParsePublicKey(user.PublicKey)
+	privateKey, _ := crypto.ParsePrivateKey(user.PrivateKey, "password")
+
+	err := expenseManager.Update(&Expense{Total: "20"}, publicKey)
+	assert.EqualError(suite.T(), err, "expense does not exist")
+
+	BatchCreateExpenses(suite.Env.Db, user, time.Now(), 1)
+	expense, _ := expenseManager.LastForUser(user.ID)
+	expense.Decrypt(privateKey)
+	expense.Total = "2000"
+	expense.Currency = "JPY"
+
+	err = expenseManager.Update(&expense, publicKey)
+	assert.NoError(suite.T(), err)
+
+	updatedExpense, _ := expenseManager.LastForUser(user.ID)
+	assert.NotEqual(suite.T(), "2000", updatedExpense.Total)
+	updatedExpense.Decrypt(privateKey)
+	assert.Equal(suite.T(), "2000", updatedExpense.Total)
+	assert.Equal(suite.T(), "JPY", updatedExpense.Currency)
+	assert.Equal(suite.T(), "Food", updatedExpense.Description)
+}
+
+func (suite *ExpenseManagerSuite) TestUpgradesLegacyExpenses() {
+	user := GetTestUser(suite.Env.Db)
+	publicKey, _ := user.GetPublicKey()
+	privateKey, _ := user.GetPrivateKey("password")
+	BatchCreateExpenses(suite.Env.Db, user, time.Now(), 1)
+
+	for _, description := range []string{"Coffee", "Lunch"} {
+		total, _ := crypto.AsymEncrypt("26.31", publicKey)
+		historical, _ := crypto.AsymEncrypt("20.25", publicKey)
+		encryptedDescription, _ := crypto.AsymEncrypt(description, publicKey)
+		currency, _ := crypto.AsymEncrypt("SGD", publicKey)
+		suite.Env.Db.Create(&Expense{
+			Date:        time.Now(),
+			Description: encryptedDescription,
+			Total:       total,
+			Historical:  historical,
+			Currency:    currency,
+			User:        user,
+		})
+	}
+
+	manager := NewExpenseManager(suite.Env.Db)
+	upgraded, err := manager.UpgradeEncryption(user.ID, privateKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 2, upgraded)
+
+	expenses, _ := manager.RecentForUser(user.ID, 3)
+	descriptions := []string{}
+	for _, expense := range expenses {
+		assert.False(suite.T(), expense.IsLegacy())
+		assert.NoError(suite.T(), expense.Decrypt(privateKey))
+		assert.Equal(suite.T(), "20.25", expense.Historical)
+		descriptions = append(descriptions, expense.Description)
+	}
+	assert.Equal(suite.T(), []string{"Lunch", "Coffee", "Food"}, descriptions)
+
+	upgraded, err = manager.UpgradeEncryption(user.ID, privateKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, upgraded)
+}
+
+func (suite *ExpenseManagerSuite) TestRewrapsDataKeys() {
+	user := GetTestUser(suite.Env.Db)
+	publicKey, _ := user.GetPublicKey()
+	privateKey, _ := user.GetPrivateKey("password")
+	BatchCreateExpenses(suite.Env.Db, user, time.Now(), 1)
+
+	total, _ := crypto.AsymEncrypt("26.31", publicKey)
+	description, _ := crypto.AsymEncrypt("Coffee", publicKey)
+	currency, _ := crypto.AsymEncrypt("SGD", publicKey)
+	suite.Env.Db.Create(&Expense{
+		Date:        time.Now(),
+		Description: description,
+		Total:       total,
+		Historical:  total,
+		Currency:    currency,
+		User:        user,
+	})
+
+	newPublicKey, newPrivateKey, _ := crypto.CreateKeyPair()
+	manager := NewExpenseManager(suite.Env.Db)
+	rewrapped, err := manager.RewrapDataKeys(user.ID, privateKey, newPublicKey)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 2, rewrapped)
+
+	expenses, _ := manager.RecentForUser(user.ID, 2)
+	descriptions := []string{}
+	for _, expense := range expenses {
+		assert.False(suite.T(), expense.IsLegacy())
+		assert.Error(suite.T(), expense.Decrypt(privateKey))
+		assert.NoError(suite.T(), expense.Decrypt(newPrivateKey))
+		descriptions = append(descriptions, expense.Description)
+	}
+	assert.Equal(suite.T(), []string{"Coffee", "Food"}, descriptions)
+}
+
+func (suite *ExpenseManagerSuite) TestDeletesExpense() {
+	expenseManager := NewExpenseManager(suite.Env.Db)
+	user := GetTestUser(suite.Env.Db)
+	BatchCreateExpenses(suite.Env.Db, user, time.Now(), 2)
+
+	expense, _ := expenseManager.LastForUser(user.ID)
+	err := expenseManager.Delete(&expense)
+	assert.NoError(suite.T(), err)
+
+	expenses, _ := expenseManager.RecentForUser(user.ID, 5)
+	assert.Equal(suite.T(), 1, len(expenses))
+	assert.NotEqual(suite.T(), expense.ID, expenses[0].ID)
+
+	err = expenseManager.Delete(&expense)
+	assert.EqualError(suite.T(), err, "expense does not exist")
+}
+
 func (suite *ExpenseManagerSuite) TestQueryExpensesByPeriod() {
 	currentTime := time.Date(2018, 3, 12, 0, 0, 0, 0, time.UTC)
 	mockTime := &mocks.MockTime{
@@ -105,8 +279,12 @@ func (suite *ExpenseManagerSuite) TestQueryExpensesByPeriod() {
 		expected int
 	}{
 		{"month", 10},
-		{"week", 8},
+		{"week", 7},
 		{"today", 1},
+		{"yesterday", 1},
+		{"last week", 2},
+		{"last 3 days", 3},
+		{"from march 10 to march 15", 6},
 	}
 
 	for _, test := range testCases {
@@ -147,11 +325,56 @@ func (suite *ExpenseManagerSuite) TestParseStringOptionToTime() {
 
 	var testCases = []struct {
 		input    string
-		expected time.Time
+		expected Period
 	}{
-		{"month", time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)},
-		{"week", time.Date(2018, 3, 11, 0, 0, 0, 0, time.UTC)},
-		{"today", time.Date(2018, 3, 12, 0, 0, 0, 0, time.UTC)},
+		{"month", Period{
+			time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2018, 4, 1, 0, 0, 0, 0, time.UTC),
+		}},
+		{"this week", Period{
+			time.Date(2018, 3, 11, 0, 0, 0, 0, time.UTC),
+			time.Date(2018, 3, 18, 0, 0, 0, 0, time.UTC),
+		}},
+		{"today", Period{
+			time.Date(2018, 3, 12, 0, 0, 0, 0, time.UTC),
+			time.Date(2018, 3, 13, 0, 0, 0, 0, time.UTC),
+		}},
+		{"yesterday", Period{
+			time.Date(2018, 3, 11, 0, 0, 0, 0, time.UTC),
+			time.Date(2018, 3, 12, 0, 0, 0, 0, time.UTC),
+		}},
+		{"last week", Period{
+			time.Date(2018, 3, 4, 0, 0, 0, 0, time.UTC),
+			time.Date(2018, 3, 11, 0, 0, 0, 0, time.UTC),
+		}},
+		{"last month", Period{
+			time.Date(2018, 2, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC),
+		}},
+		{"this year", Period{
+			time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		}},
+		{"last year", Period{
+			time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		}},
+		{"last 30 days", Period{
+			time.Date(2018, 2, 11, 0, 0, 0, 0, time.UTC),
+			time.Date(2018, 3, 13, 0, 0, 0, 0, time.UTC),
+		}},
+		{"from March 1st to March 15th", Period{
+			time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2018, 3, 16, 0, 0, 0, 0, time.UTC),
+		}},
+		{"2017-12-24 - 2018-01-02", Period{
+			time.Date(2017, 12, 24, 0, 0, 0, 0, time.UTC),
+			time.Date(2018, 1, 3, 0, 0, 0, 0, time.UTC),
+		}},
+		{"since 5 march", Period{
+			time.Date(2018, 3, 5, 0, 0, 0, 0, time.UTC),
+			time.Date(2018, 3, 13, 0, 0, 0, 0, time.UTC),
+		}},
 	}
 
 	for _, test := range testCases {
@@ -159,6 +382,72 @@ func (suite *ExpenseManagerSuite) TestParseStringOptionToTime() {
 		assert.NoError(suite.T(), err)
 		assert.Equal(suite.T(), test.expected, timePeriod)
 	}
+
+	for _, input := range []string{"some-date", "march 15 to march 1", "last 0 days"} {
+		_, err := expenseManager.ParseTimePeriod(input)
+		assert.EqualError(suite.T(), err, input+" is an invalid period")
+	}
+}
+
+func (suite *ExpenseManagerSuite) TestParsesWeekWithWeekStart() {
+	currentTime := time.Date(2018, 3, 12, 0, 0, 0, 0, time.UTC)
+	mockTime := &mocks.MockTime{
+		CurrentTime: currentTime,
+	}
+	expenseManager := &ExpenseManager{
+		db:        suite.Env.Db,
+		clock:     mockTime,
+		weekStart: time.Monday,
+	}
+
+	timePeriod, err := expenseManager.ParseTimePeriod("week")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), time.Date(2018, 3, 12, 0, 0, 0, 0, time.UTC), timePeriod.Start)
+	assert.Equal(suite.T(), time.Date(2018, 3, 19, 0, 0, 0, 0, time.UTC), timePeriod.End)
+
+	expenseManager.weekStart = time.Tuesday
+	timePeriod, err = expenseManager.ParseTimePeriod("last week")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), time.Date(2018, 2, 27, 0, 0, 0, 0, time.UTC), timePeriod.Start)
+	assert.Equal(suite.T(), time.Date(2018, 3, 6, 0, 0, 0, 0, time.UTC), timePeriod.End)
+}
+
+func (suite *ExpenseManagerSuite) TestQueryExpensesByLocalDay() {
+	tokyo := time.FixedZone("UTC+9", 9*3600)
+	currentTime := time.Date(2018, 3, 12, 8, 0, 0, 0, tokyo)
+	mockTime := &mocks.MockTime{
+		CurrentTime: currentTime,
+	}
+	expenseManager := &ExpenseManager{
+		db:    suite.Env.Db,
+		clock: mockTime,
+	}
+
+	timePeriod, _ := expenseManager.ParseTimePeriod("today")
+	assert.Equal(suite.T(), time.Date(2018, 3, 12, 0, 0, 0, 0, tokyo), timePeriod.Start)
+	assert.Equal(suite.T(), time.Date(2018, 3, 13, 0, 0, 0, 0, tokyo), timePeriod.End)
+
+	// Lunch in Tokyo falls on the previous day in UTC
+	user := GetTestUser(suite.Env.Db)
+	publicKey, _ := crypto.ParsePublicKey(user.PublicKey)
+	expense := &Expense{
+		Date:        time.Date(2018, 3, 12, 1, 0, 0, 0, tokyo),
+		Description: "Lunch",
+		Total:       "1000",
+		Historical:  "9.50",
+		Currency:    "JPY",
+		User:        user,
+	}
+	expense.Encrypt(publicKey)
+	suite.Env.Db.Create(expense)
+
+	expenses, err := expenseManager.QueryByPeriod("today", user.ID)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 1, len(expenses))
+
+	expenses, err = expenseManager.QueryByPeriod("yesterday", user.ID)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, len(expenses))
 }
 
 func (suite *ExpenseManagerSuite) TestSumsHistoricalTotalsByPeriod() {
@@ -180,18 +469,121 @@ func (suite *ExpenseManagerSuite) TestSumsHistoricalTotalsByPeriod() {
 		expected float64
 	}{
 		{"month", 202.5},
-		{"week", 162.0},
+		{"week", 141.75},
 		{"today", 20.25},
+		{"yesterday", 20.25},
 	}
 
 	privateKey, _ := crypto.ParsePrivateKey(user.PrivateKey, "password")
 	for _, test := range testCases {
-		total, err := expenseManager.TotalByPeriod(test.input, user.ID, privateKey)
+		total, err := expenseManager.TotalByPeriod(test.input, user.ID, privateKey, nil)
 		assert.NoError(suite.T(), err)
 		assert.Equal(suite.T(), test.expected, total)
 	}
 }
 
+func (suite *ExpenseManagerSuite) TestConvertsHistoricalTotalsOnExpenseDate() {
+	currentTime := time.Date(2018, 3, 12, 0, 0, 0, 0, time.UTC)
+	mockTime := &mocks.MockTime{
+		CurrentTime: currentTime,
+	}
+	expenseManager := &ExpenseManager{
+		db:    suite.Env.Db,
+		clock: mockTime,
+	}
+
+	firstEntryDate := time.Date(2018, 3, 8, 0, 0, 0, 0, time.UTC)
+	user := GetTestUser(suite.Env.Db)
+	BatchCreateExpenses(suite.Env.Db, user, firstEntryDate, 10)
+
+	// Expenses on the 9th and 10th are converted at twice the rate
+	rateChange := time.Date(2018, 3, 11, 0, 0, 0, 0, time.UTC)
+	convert := func(historical float64, date time.Time) (float64, error) {
+		if date.Before(rateChange) {
+			return historical * 2, nil
+		}
+		return historical, nil
+	}
+
+	privateKey, _ := crypto.ParsePrivateKey(user.PrivateKey, "password")
+	total, err := expenseManager.TotalByPeriod("month", user.ID, privateKey, convert)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 243.0, total)
+
+	totals, err := expenseManager.TotalByCategory("month", user.ID, privateKey, convert)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), map[string]float64{UNCATEGORIZED: 243.0}, totals)
+}
+
+func (suite *ExpenseManagerSuite) TestSumsHistoricalTotalsByCategory() {
+	currentTime := time.Date(2018, 3, 12, 0, 0, 0, 0, time.UTC)
+	mockTime := &mocks.MockTime{
+		CurrentTime: currentTime,
+	}
+	expenseManager := &ExpenseManager{
+		db:    suite.Env.Db,
+		clock: mockTime,
+	}
+
+	user := GetTestUser(suite.Env.Db)
+	publicKey, _ := crypto.ParsePublicKey(user.PublicKey)
+	for _, category := range []string{"food", "food", "transport", ""} {
+		expense := &Expense{
+			Date:        currentTime,
+			Description: "Description",
+			Total:       "26.31",
+			Historical:  "20.25",
+			Currency:    "SGD",
+			Category:    category,
+			User:        user,
+		}
+		expense.Encrypt(publicKey)
+		suite.Env.Db.Create(expense)
+	}
+
+	privateKey, _ := crypto.ParsePrivateKey(user.PrivateKey, "password")
+	totals, err := expenseManager.TotalByCategory("month", user.ID, privateKey, nil)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), map[string]float64{
+		"food":        40.5,
+		"transport":   20.25,
+		UNCATEGORIZED: 20.25,
+	}, totals)
+}
+
+func (suite *ExpenseManagerSuite) TestTotalsFailWithWrongKey() {
+	currentTime := time.Date(2018, 3, 12, 0, 0, 0, 0, time.UTC)
+	mockTime := &mocks.MockTime{
+		CurrentTime: currentTime,
+	}
+	expenseManager := &ExpenseManager{
+		db:    suite.Env.Db,
+		clock: mockTime,
+	}
+
+	user := GetTestUser(suite.Env.Db)
+	publicKey, _ := crypto.ParsePublicKey(user.PublicKey)
+	expense := &Expense{
+		Date:        currentTime,
+		Description: "Description",
+		Total:       "26.31",
+		Historical:  "20.25",
+		Currency:    "SGD",
+		Category:    "food",
+		User:        user,
+	}
+	expense.Encrypt(publicKey)
+	suite.Env.Db.Create(expense)
+
+	_, wrongKey, _ := crypto.CreateKeyPair()
+	_, err := expenseManager.TotalByPeriod("month", user.ID, wrongKey, nil)
+	assert.Error(suite.T(), err)
+
+	totals, err := expenseManager.TotalByCategory("month", user.ID, wrongKey, nil)
+	assert.Error(suite.T(), err)
+	assert.Equal(suite.T(), map[string]float64{}, totals)
+}
+
 func TestExpenseManagerSuite(t *testing.T) {
 	suite.Run(t, new(ExpenseManagerSuite))
 }
@@ -12,6 +12,12 @@ import (
 	"github.com/fmitra/dennis-bot/pkg/users"
 )
 
+// SourceIndex ensures an Expense is only tracked once from each chat message,
+// even if the message is delivered to the bot more than once. Expenses tracked
+// before sources were recorded have no source and are left out of the index.
+const SourceIndex = "CREATE UNIQUE INDEX IF NOT EXISTS idx_expense_user_source " +
+	"ON expenses (user_id, source) WHERE source <> ''"
+
 // Expense is a tracked expnese entry.
 type Expense struct {
 	gorm.Model
@@ -19,48 +25,139 @@ type Expense struct {
 	Description string    `gorm:"not null"`       // Description of the expense
 	Total       string    `gorm:"not null"`       // Total amount paid for the expense
 	Historical  string    // Historical USD value of the total
-	Currency    string    `gorm:"not null"`         // Currency ISO of the total
-	Category    string    `gorm:"type:varchar(30)"` // Category of the expense
+	Currency    string    `gorm:"not null"` // Currency ISO of the total
+	Category    string    // Category of the expense
+	DataKey     string    `gorm:"type:varchar(1000)"` // Data key sealing the expense, wrapped with the User's public key
+	Source      string    `gorm:"type:varchar(64)"`   // Reference to the chat message the expense was tracked from
 	User        users.User
 	UserID      uint `gorm:"index;not null"`
 }
 
-// Encrypt encrypts sensitive fields in an Expense record.
+// Encrypt encrypts sensitive fields in an Expense record. Each Expense is
+// sealed with its own data key, which is wrapped with the User's public key.
 func (e *Expense) Encrypt(publicKey rsa.PublicKey) error {
-	total, err := crypto.AsymEncrypt(e.Total, publicKey)
+	key, err := crypto.CreateDataKey()
+	if err != nil {
+		log.Printf("expenses: failed to create data key - %s", err)
+		return err
+	}
+
+	dataKey, err := crypto.WrapDataKey(key, publicKey)
+	if err != nil {
+		log.Printf("expenses: failed to wrap data key - %s", err)
+		return err
+	}
+
+	total, err := crypto.Seal(e.Total, key)
 	if err != nil {
 		log.Printf("expenses: failed to encrypt total - %s", err)
 		return err
 	}
 
-	historical, err := crypto.AsymEncrypt(e.Historical, publicKey)
+	historical, err := crypto.Seal(e.Historical, key)
 	if err != nil {
 		log.Printf("expenses: failed to encrypt historical - %s", err)
 		return err
 	}
 
-	description, err := crypto.AsymEncrypt(e.Description, publicKey)
+	description, err := crypto.Seal(e.Description, key)
 	if err != nil {
 		log.Printf("expenses: failed to encrypt description - %s", err)
 		return err
 	}
 
-	currency, err := crypto.AsymEncrypt(e.Currency, publicKey)
+	currency, err := crypto.Seal(e.Currency, key)
 	if err != nil {
 		log.Printf("expenses: failed to encrypt currency - %s", err)
 		return err
 	}
 
+	// Expenses tracked before categories were introduced have no category
+	// so we leave them blank rather than encrypt an empty value.
+	category := e.Category
+	if category != "" {
+		category, err = crypto.Seal(e.Category, key)
+		if err != nil {
+			log.Printf("expenses: failed to encrypt category - %s", err)
+			return err
+		}
+	}
+
 	e.Total = total
 	e.Historical = historical
 	e.Description = description
 	e.Currency = currency
+	e.Category = category
+	e.DataKey = dataKey
 
 	return nil
 }
 
-// Decrypt decrypts an Expense record.
+// Decrypt decrypts an Expense record. Expenses without a data key were
+// encrypted field by field with the User's public key and are decrypted
+// the same way.
 func (e *Expense) Decrypt(privateKey rsa.PrivateKey) error {
+	if e.IsLegacy() {
+		return e.decryptLegacy(privateKey)
+	}
+
+	key, err := crypto.UnwrapDataKey(e.DataKey, privateKey)
+	if err != nil {
+		log.Printf("expenses: failed to unwrap data key - %s", err)
+		return err
+	}
+
+	total, err := crypto.Open(e.Total, key)
+	if err != nil {
+		log.Printf("expenses: failed to decrypt total - %s", err)
+		return err
+	}
+
+	historical, err := crypto.Open(e.Historical, key)
+	if err != nil {
+		log.Printf("expenses: failed to decrypt historical - %s", err)
+		return err
+	}
+
+	description, err := crypto.Open(e.Description, key)
+	if err != nil {
+		log.Printf("expenses: failed to decrypt description - %s", err)
+		return err
+	}
+
+	currency, err := crypto.Open(e.Currency, key)
+	if err != nil {
+		log.Printf("expenses: failed to decrypt currency - %s", err)
+		return err
+	}
+
+	category := e.Category
+	if category != "" {
+		category, err = crypto.Open(e.Category, key)
+		if err != nil {
+			log.Printf("expenses: failed to decrypt category - %s", err)
+			return err
+		}
+	}
+
+	e.Total = total
+	e.Historical = historical
+	e.Description = description
+	e.Currency = currency
+	e.Category = category
+
+	return nil
+}
+
+// IsLegacy checks if an Expense was encrypted field by field with the User's
+// public key rather than sealed with a data key.
+func (e *Expense) IsLegacy() bool {
+	return e.DataKey == ""
+}
+
+// decryptLegacy decrypts an Expense record encrypted field by field with
+// the User's public key.
+func (e *Expense) decryptLegacy(privateKey rsa.PrivateKey) error {
 	total, err := crypto.AsymDecrypt(e.Total, privateKey)
 	if err != nil {
 		log.Printf("expenses: failed to decrypt total - %s", err)
@@ -85,10 +182,20 @@ func (e *Expense) Decrypt(privateKey rsa.PrivateKey) error {
 		return err
 	}
 
+	category := e.Category
+	if category != "" {
+		category, err = crypto.AsymDecrypt(e.Category, privateKey)
+		if err != nil {
+			log.Printf("expenses: failed to decrypt category - %s", err)
+			return err
+		}
+	}
+
 	e.Total = total
 	e.Historical = historical
 	e.Description = description
 	e.Currency = currency
+	e.Category = category
 
 	return nil
 }
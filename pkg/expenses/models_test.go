@@ -1,6 +1,7 @@
 package expenses
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -15,6 +16,7 @@ func TestExpenseModel(t *testing.T) {
 			Total:       "100.00",
 			Historical:  "1.58",
 			Currency:    "RUB",
+			Category:    "food",
 		}
 		publicKey, privateKey, _ := crypto.CreateKeyPair()
 
@@ -23,11 +25,71 @@ func TestExpenseModel(t *testing.T) {
 		assert.NotEqual(t, expense.Historical, "1.58")
 		assert.NotEqual(t, expense.Description, "Food")
 		assert.NotEqual(t, expense.Currency, "RUB")
+		assert.NotEqual(t, expense.Category, "food")
 
 		expense.Decrypt(privateKey)
 		assert.Equal(t, expense.Total, "100.00")
 		assert.Equal(t, expense.Historical, "1.58")
 		assert.Equal(t, expense.Description, "Food")
 		assert.Equal(t, expense.Currency, "RUB")
+		assert.Equal(t, expense.Category, "food")
+	})
+
+	t.Run("Should skip blank categories", func(t *testing.T) {
+		expense := Expense{
+			Description: "Food",
+			Total:       "100.00",
+			Historical:  "1.58",
+			Currency:    "RUB",
+		}
+		publicKey, privateKey, _ := crypto.CreateKeyPair()
+
+		expense.Encrypt(publicKey)
+		assert.Equal(t, expense.Category, "")
+
+		err := expense.Decrypt(privateKey)
+		assert.NoError(t, err)
+		assert.Equal(t, expense.Category, "")
+	})
+
+	t.Run("Should encrypt long descriptions", func(t *testing.T) {
+		description := strings.Repeat("dinner with the team ", 30)
+		expense := Expense{
+			Description: description,
+			Total:       "100.00",
+			Historical:  "1.58",
+			Currency:    "RUB",
+		}
+		publicKey, privateKey, _ := crypto.CreateKeyPair()
+
+		err := expense.Encrypt(publicKey)
+		assert.NoError(t, err)
+		assert.False(t, expense.IsLegacy())
+
+		err = expense.Decrypt(privateKey)
+		assert.NoError(t, err)
+		assert.Equal(t, description, expense.Description)
+	})
+
+	t.Run("Should decrypt legacy model fields", func(t *testing.T) {
+		publicKey, privateKey, _ := crypto.CreateKeyPair()
+		total, _ := crypto.AsymEncrypt("100.00", publicKey)
+		historical, _ := crypto.AsymEncrypt("1.58", publicKey)
+		description, _ := crypto.AsymEncrypt("Food", publicKey)
+		currency, _ := crypto.AsymEncrypt("RUB", publicKey)
+		expense := Expense{
+			Description: description,
+			Total:       total,
+			Historical:  historical,
+			Currency:    currency,
+		}
+		assert.True(t, expense.IsLegacy())
+
+		err := expense.Decrypt(privateKey)
+		assert.NoError(t, err)
+		assert.Equal(t, expense.Total, "100.00")
+		assert.Equal(t, expense.Historical, "1.58")
+		assert.Equal(t, expense.Description, "Food")
+		assert.Equal(t, expense.Currency, "RUB")
 	})
 }
@@ -0,0 +1,157 @@
+package expenses
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Period is a span of time between a Start (inclusive) and End (exclusive) bound.
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// lastDaysPeriod matches a relative number of days, for example "last 30 days".
+var lastDaysPeriod = regexp.MustCompile(`^(?:last|past) (\d+) days?$`)
+
+// rangeSeparators split an explicit date range, for example "march 1 to march 15".
+var rangeSeparators = []string{" to ", " until ", " - "}
+
+// dayLayouts are the formats we accept for each side of an explicit date range.
+// Layouts without a year default to the current year.
+var dayLayouts = []struct {
+	layout  string
+	hasYear bool
+}{
+	{"2006-01-02", true},
+	{"Jan 2 2006", true},
+	{"January 2 2006", true},
+	{"2 Jan 2006", true},
+	{"2 January 2006", true},
+	{"Jan 2", false},
+	{"January 2", false},
+	{"2 Jan", false},
+	{"2 January", false},
+}
+
+// ordinalSuffix matches day ordinals, for example "1st" or "15th".
+var ordinalSuffix = regexp.MustCompile(`(\d+)(?:st|nd|rd|th)\b`)
+
+// startOfDay returns midnight of a time's date in the time's location.
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// parseDay parses a single day of an explicit date range.
+func parseDay(s string, today time.Time) (time.Time, error) {
+	cleanDay := strings.Replace(s, ",", "", -1)
+	cleanDay = ordinalSuffix.ReplaceAllString(cleanDay, "$1")
+	cleanDay = strings.Join(strings.Fields(cleanDay), " ")
+
+	for _, day := range dayLayouts {
+		parsedDay, err := time.Parse(day.layout, cleanDay)
+		if err != nil {
+			continue
+		}
+
+		year := parsedDay.Year()
+		if !day.hasYear {
+			year = today.Year()
+		}
+		return time.Date(year, parsedDay.Month(), parsedDay.Day(), 0, 0, 0, 0, today.Location()), nil
+	}
+
+	return time.Time{}, errors.New("invalid day")
+}
+
+// parseDateRange parses an explicit date range, for example "from march 1 to march 15"
+// or "since march 1". The last day of a range is included in the Period.
+func parseDateRange(s string, today time.Time) (Period, error) {
+	if strings.HasPrefix(s, "since ") {
+		start, err := parseDay(strings.TrimPrefix(s, "since "), today)
+		if err != nil {
+			return Period{}, err
+		}
+
+		return Period{start, today.AddDate(0, 0, 1)}, nil
+	}
+
+	s = strings.TrimPrefix(s, "from ")
+	for _, separator := range rangeSeparators {
+		bounds := strings.SplitN(s, separator, 2)
+		if len(bounds) != 2 {
+			continue
+		}
+
+		start, err := parseDay(bounds[0], today)
+		if err != nil {
+			return Period{}, err
+		}
+
+		end, err := parseDay(bounds[1], today)
+		if err != nil {
+			return Period{}, err
+		}
+
+		if end.Before(start) {
+			return Period{}, errors.New("range ends before it starts")
+		}
+
+		return Period{start, end.AddDate(0, 0, 1)}, nil
+	}
+
+	return Period{}, errors.New("invalid range")
+}
+
+// parsePeriod parses a string period relative to a point in time. Period
+// bounds are in the same location as the point in time and weeks begin
+// on the weekStart day.
+func parsePeriod(period string, now time.Time, weekStart time.Weekday) (Period, error) {
+	today := startOfDay(now)
+	year, month, _ := today.Date()
+	daysIntoWeek := (int(today.Weekday()) - int(weekStart) + 7) % 7
+	thisWeek := today.AddDate(0, 0, -daysIntoWeek)
+	thisMonth := time.Date(year, month, 1, 0, 0, 0, 0, today.Location())
+	thisYear := time.Date(year, time.January, 1, 0, 0, 0, 0, today.Location())
+
+	cleanPeriod := strings.Join(strings.Fields(strings.ToLower(period)), " ")
+	cleanPeriod = strings.TrimPrefix(cleanPeriod, "this ")
+
+	switch cleanPeriod {
+	case TODAY:
+		return Period{today, today.AddDate(0, 0, 1)}, nil
+	case YESTERDAY:
+		return Period{today.AddDate(0, 0, -1), today}, nil
+	case WEEK:
+		return Period{thisWeek, thisWeek.AddDate(0, 0, 7)}, nil
+	case LASTWEEK:
+		return Period{thisWeek.AddDate(0, 0, -7), thisWeek}, nil
+	case MONTH:
+		return Period{thisMonth, thisMonth.AddDate(0, 1, 0)}, nil
+	case LASTMONTH:
+		return Period{thisMonth.AddDate(0, -1, 0), thisMonth}, nil
+	case YEAR:
+		return Period{thisYear, thisYear.AddDate(1, 0, 0)}, nil
+	case LASTYEAR:
+		return Period{thisYear.AddDate(-1, 0, 0), thisYear}, nil
+	}
+
+	if match := lastDaysPeriod.FindStringSubmatch(cleanPeriod); match != nil {
+		days, err := strconv.Atoi(match[1])
+		if err == nil && days > 0 {
+			return Period{today.AddDate(0, 0, 1-days), today.AddDate(0, 0, 1)}, nil
+		}
+	}
+
+	if dateRange, err := parseDateRange(cleanPeriod, today); err == nil {
+		return dateRange, nil
+	}
+
+	errorMessage := fmt.Sprintf("%s is an invalid period", period)
+	return Period{}, errors.New(errorMessage)
+}
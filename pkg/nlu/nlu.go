@@ -0,0 +1,126 @@
+// Package nlu describes a user's message as understood by a natural
+// language understanding backend. Backends such as Wit.ai or a local
+// grammar parser translate their own output into a Message so the bot
+// does not depend on the shape of any one backend's response.
+package nlu
+
+import (
+	"context"
+	"time"
+
+	"github.com/fmitra/dennis-bot/pkg/utils"
+)
+
+const (
+	// TrackExpense indicates the user wants to track an expense
+	TrackExpense = "track_expense"
+
+	// ExpenseTotal indicates the user wants a sum of their expense history
+	ExpenseTotal = "expense_total"
+
+	// CategoryTotal indicates the user wants a sum of their expense history
+	// for one or all categories
+	CategoryTotal = "category_total"
+
+	// ExpenseList indicates the user wants an itemized list of their expense history
+	ExpenseList = "expense_list"
+
+	// UndoExpense indicates the user wants to remove their last tracked expense
+	UndoExpense = "undo_expense"
+
+	// DeleteExpense indicates the user wants to remove one of their recent expenses
+	DeleteExpense = "delete_expense"
+
+	// EditExpense indicates the user wants to change their last tracked expense
+	EditExpense = "edit_expense"
+
+	// ShowSettings indicates the user wants to see their settings
+	ShowSettings = "show_settings"
+
+	// ChangeSetting indicates the user wants to change one of their settings
+	ChangeSetting = "change_setting"
+
+	// ChangePassword indicates the user wants to change their password
+	ChangePassword = "change_password"
+
+	// ResetPassword indicates the user forgot their password and wants
+	// to reset it with a recovery code
+	ResetPassword = "reset_password"
+
+	// Unknown indicates the backend failed to infer context around a message
+	Unknown = "unknown"
+
+	// AllCategories indicates the user is requesting a breakdown of expense
+	// history across every category rather than a single category
+	AllCategories = "all"
+)
+
+// NLU is an interface for backends that infer context from a user's message,
+// for example Wit.ai, a local grammar parser or an HTTP service.
+type NLU interface {
+	Parse(ctx context.Context, message string) Message
+}
+
+// Message is a user's message as understood by an NLU backend. Fields the
+// backend could not infer are left empty.
+type Message struct {
+	Text         string    // Original text of the message
+	Intent       string    // What the user wants to do (ex. track_expense)
+	Amount       float64   // Amount of an expense
+	Currency     string    // Currency ISO of the amount
+	Date         string    // Date of an expense as described by the user (ex. yesterday)
+	Description  string    // Description of an expense
+	Category     string    // Category of an expense or of requested expense history
+	Period       string    // Period of requested expense history (ex. this week)
+	Setting      string    // Setting the user wants to change (ex. currency)
+	SettingValue string    // New value of the setting (ex. EUR)
+	Confidence   float64   // Backend's confidence in the inferred intent, between 0 and 1
+	Ambiguous    bool      // Backend found several candidate amounts or dates
+	Expenses     []Message // Individual expenses of a message describing several expenses
+	Source       string    // Reference to the chat message an expense was described in
+}
+
+// Fallback parses messages with a Primary backend and falls back to a
+// Fallback backend for messages the Primary backend does not understand.
+type Fallback struct {
+	Primary  NLU
+	Fallback NLU
+}
+
+// Parse parses a message with the Primary backend. The Fallback backend
+// is only used if the Primary backend cannot infer an intent.
+func (f *Fallback) Parse(ctx context.Context, message string) Message {
+	parsed := f.Primary.Parse(ctx, message)
+	if parsed.Intent != Unknown {
+		return parsed
+	}
+
+	return f.Fallback.Parse(ctx, message)
+}
+
+// GetDate returns the date of an expense relative to the current time.
+// If no date is provided, we default to today.
+func (m Message) GetDate(now time.Time) time.Time {
+	return utils.ParseDate(m.Date, now)
+}
+
+// IsBatch checks if the Message describes several expenses at once.
+func (m Message) IsBatch() bool {
+	return len(m.Expenses) > 1
+}
+
+// IsComplete checks if the Message describes an expense we are able
+// to track. Batches are complete if every expense in them is.
+func (m Message) IsComplete() bool {
+	if m.IsBatch() {
+		for _, expense := range m.Expenses {
+			if !expense.IsComplete() {
+				return false
+			}
+		}
+		return m.Intent == TrackExpense
+	}
+
+	return m.Intent == TrackExpense && m.Amount > 0 &&
+		m.Currency != "" && m.Description != ""
+}
@@ -0,0 +1,85 @@
+package nlu
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// nluMock returns a fixed Message and counts its calls.
+type nluMock struct {
+	message Message
+	calls   int
+}
+
+func (n *nluMock) Parse(ctx context.Context, message string) Message {
+	n.calls++
+	return n.message
+}
+
+func TestFallback(t *testing.T) {
+	t.Run("Returns primary message if it is understood", func(t *testing.T) {
+		primary := &nluMock{message: Message{Intent: UndoExpense}}
+		fallback := &nluMock{}
+		backend := &Fallback{Primary: primary, Fallback: fallback}
+
+		message := backend.Parse(context.Background(), "undo")
+		assert.Equal(t, UndoExpense, message.Intent)
+		assert.Equal(t, 0, fallback.calls)
+	})
+
+	t.Run("Returns fallback message if primary is not understood", func(t *testing.T) {
+		primary := &nluMock{message: Message{Intent: Unknown}}
+		fallback := &nluMock{message: Message{Text: "from fallback", Intent: Unknown}}
+		backend := &Fallback{Primary: primary, Fallback: fallback}
+
+		message := backend.Parse(context.Background(), "hello there")
+		assert.Equal(t, "from fallback", message.Text)
+		assert.Equal(t, 1, primary.calls)
+		assert.Equal(t, 1, fallback.calls)
+	})
+}
+
+func TestMessage(t *testing.T) {
+	t.Run("Returns date relative to now", func(t *testing.T) {
+		now := time.Date(2018, 3, 12, 10, 0, 0, 0, time.UTC)
+		message := Message{Date: "yesterday"}
+		assert.Equal(t, 11, message.GetDate(now).Day())
+
+		message = Message{}
+		assert.Equal(t, 12, message.GetDate(now).Day())
+	})
+
+	t.Run("Checks if an expense is complete", func(t *testing.T) {
+		message := Message{
+			Intent:      TrackExpense,
+			Amount:      20,
+			Currency:    "SGD",
+			Description: "lunch",
+		}
+		assert.True(t, message.IsComplete())
+
+		message.Description = ""
+		assert.False(t, message.IsComplete())
+
+		message = Message{Intent: ExpenseTotal, Amount: 20, Currency: "SGD", Description: "lunch"}
+		assert.False(t, message.IsComplete())
+	})
+
+	t.Run("Checks if a batch of expenses is complete", func(t *testing.T) {
+		message := Message{
+			Intent: TrackExpense,
+			Expenses: []Message{
+				{Intent: TrackExpense, Amount: 20, Currency: "SGD", Description: "lunch"},
+				{Intent: TrackExpense, Amount: 5, Currency: "SGD", Description: "coffee"},
+			},
+		}
+		assert.True(t, message.IsBatch())
+		assert.True(t, message.IsComplete())
+
+		message.Expenses[1].Currency = ""
+		assert.False(t, message.IsComplete())
+	})
+}
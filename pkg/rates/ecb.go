@@ -0,0 +1,186 @@
+package rates
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ECBURL is the European Central Bank's daily reference rates feed.
+	ECBURL = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+
+	// ECBRecentURL is the feed of reference rates of the last 90 days.
+	ECBRecentURL = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-hist-90d.xml"
+
+	// ECBHistoryURL is the feed of every reference rate since 1999.
+	ECBHistoryURL = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-hist.xml"
+
+	// ecbFeedMaxAge is how long a fetched feed is used for.
+	ecbFeedMaxAge = time.Hour
+)
+
+// ecbFeed is the XML feed of the European Central Bank's reference rates.
+// Rates are quoted against EUR.
+type ecbFeed struct {
+	Cube struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string  `xml:"currency,attr"`
+				Rate     float64 `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+// ECB is a RateProvider for the European Central Bank's daily reference
+// rates. The ECB publishes rates for around 30 currencies against EUR, so
+// rates between other currencies are crossed through EUR. Feeds list the
+// rates of many days, so each fetched feed is kept for an hour and used
+// for every date it has rates for.
+type ECB struct {
+	BaseURL    string // Feed of the latest rates
+	RecentURL  string // Feed of the rates of the last 90 days
+	HistoryURL string // Feed of every rate
+
+	mutex sync.Mutex
+	feeds map[string]ecbRates
+}
+
+// ecbRates are the reference rates against EUR of each day of a feed,
+// keyed by day (ex. 2018-03-14).
+type ecbRates struct {
+	days      map[string]map[string]float64
+	fetchedAt time.Time
+}
+
+// NewECB returns an ECB provider with the default feed URLs.
+func NewECB() *ECB {
+	return &ECB{
+		BaseURL:    ECBURL,
+		RecentURL:  ECBRecentURL,
+		HistoryURL: ECBHistoryURL,
+	}
+}
+
+// Rate returns the exchange rate from one currency to another on a date.
+// The latest reference rates are used for dates within the last day.
+// Rates are not published on weekends and holidays, so older dates use
+// the reference rates of the date or of the last day before it.
+func (e *ECB) Rate(ctx context.Context, fromISO string, toISO string, date time.Time) (float64, error) {
+	var url string
+	switch age := time.Since(date); {
+	case age < 24*time.Hour:
+		url = e.BaseURL
+	case age < 90*24*time.Hour:
+		url = e.RecentURL
+	default:
+		url = e.HistoryURL
+	}
+
+	feed, err := e.feed(ctx, url)
+	if err != nil {
+		return 0, err
+	}
+
+	// The daily feed has a single day, the latest one
+	day := date.Format("2006-01-02")
+	if url == e.BaseURL {
+		day = ""
+	}
+
+	closestDay := ""
+	for feedDay := range feed.days {
+		isBefore := day == "" || feedDay <= day
+		if isBefore && feedDay > closestDay {
+			closestDay = feedDay
+		}
+	}
+	if closestDay == "" {
+		return 0, errors.New("no exchange rate")
+	}
+
+	return crossRate(feed.days[closestDay], fromISO, toISO)
+}
+
+// feed returns the reference rates of a feed, fetching the feed again
+// once the rates we have are more than an hour old. The feeds are only locked
+// while they are read or written, so a slow request never holds up the rates
+// of other feeds.
+func (e *ECB) feed(ctx context.Context, url string) (ecbRates, error) {
+	e.mutex.Lock()
+	feed, ok := e.feeds[url]
+	e.mutex.Unlock()
+	if ok && time.Since(feed.fetchedAt) < ecbFeedMaxAge {
+		return feed, nil
+	}
+
+	feed, err := fetchRates(ctx, url)
+	if err != nil {
+		return feed, err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.feeds == nil {
+		e.feeds = map[string]ecbRates{}
+	}
+	e.feeds[url] = feed
+	return feed, nil
+}
+
+// fetchRates returns the reference rates against EUR of every day of a feed.
+func fetchRates(ctx context.Context, url string) (ecbRates, error) {
+	rates := ecbRates{days: map[string]map[string]float64{}}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return rates, err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return rates, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return rates, errors.New("ecb feed unavailable")
+	}
+
+	var feed ecbFeed
+	if err = xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return rates, err
+	}
+
+	if len(feed.Cube.Days) == 0 {
+		return rates, errors.New("ecb feed has no rates")
+	}
+
+	for _, feedDay := range feed.Cube.Days {
+		dayRates := map[string]float64{"EUR": 1}
+		for _, rate := range feedDay.Rates {
+			dayRates[strings.ToUpper(rate.Currency)] = rate.Rate
+		}
+		rates.days[feedDay.Time] = dayRates
+	}
+
+	rates.fetchedAt = time.Now()
+	return rates, nil
+}
+
+// crossRate returns the exchange rate between two currencies quoted against
+// a common base currency.
+func crossRate(rates map[string]float64, fromISO string, toISO string) (float64, error) {
+	fromRate, fromOK := rates[strings.ToUpper(fromISO)]
+	toRate, toOK := rates[strings.ToUpper(toISO)]
+	if !fromOK || !toOK || fromRate <= 0 || toRate <= 0 {
+		return 0, errors.New("no exchange rate")
+	}
+
+	return toRate / fromRate, nil
+}
@@ -0,0 +1,119 @@
+package rates
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	mocks "github.com/fmitra/dennis-bot/test"
+)
+
+func TestECB(t *testing.T) {
+	ctx := context.Background()
+
+	response := `<?xml version="1.0" encoding="UTF-8"?>
+		<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+			<gesmes:subject>Reference rates</gesmes:subject>
+			<Cube>
+				<Cube time="2018-03-14">
+					<Cube currency="USD" rate="1.2"/>
+					<Cube currency="SGD" rate="1.62"/>
+				</Cube>
+			</Cube>
+		</gesmes:Envelope>`
+
+	t.Run("Returns provider with default feeds", func(t *testing.T) {
+		ecb := NewECB()
+		assert.Equal(t, ECBURL, ecb.BaseURL)
+		assert.Equal(t, ECBRecentURL, ecb.RecentURL)
+		assert.Equal(t, ECBHistoryURL, ecb.HistoryURL)
+	})
+
+	t.Run("Returns exchange rate", func(t *testing.T) {
+		server := mocks.MakeTestServer(response)
+		defer server.Close()
+
+		ecb := &ECB{BaseURL: server.URL}
+		rate, err := ecb.Rate(ctx, "EUR", "USD", time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, 1.2, rate)
+
+		rate, err = ecb.Rate(ctx, "usd", "SGD", time.Now())
+		assert.NoError(t, err)
+		assert.InDelta(t, 1.35, rate, 0.0001)
+	})
+
+	t.Run("Returns historical exchange rate", func(t *testing.T) {
+		history := `<?xml version="1.0" encoding="UTF-8"?>
+			<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+				<Cube>
+					<Cube time="2018-03-16">
+						<Cube currency="USD" rate="1.23"/>
+					</Cube>
+					<Cube time="2018-03-13">
+						<Cube currency="USD" rate="1.21"/>
+					</Cube>
+				</Cube>
+			</gesmes:Envelope>`
+		server := mocks.MakeTestServer(history)
+		defer server.Close()
+
+		ecb := &ECB{BaseURL: "http://localhost", HistoryURL: server.URL}
+		rate, err := ecb.Rate(ctx, "EUR", "USD", time.Date(2018, 3, 16, 12, 0, 0, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Equal(t, 1.23, rate)
+
+		// No rates are published on the 14th, so we use the rates of the 13th
+		rate, err = ecb.Rate(ctx, "EUR", "USD", time.Date(2018, 3, 14, 12, 0, 0, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Equal(t, 1.21, rate)
+
+		_, err = ecb.Rate(ctx, "EUR", "USD", time.Date(2018, 3, 12, 12, 0, 0, 0, time.UTC))
+		assert.EqualError(t, err, "no exchange rate")
+	})
+
+	t.Run("Reuses fetched feed for other dates", func(t *testing.T) {
+		history := `<?xml version="1.0" encoding="UTF-8"?>
+			<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+				<Cube>
+					<Cube time="2018-03-16">
+						<Cube currency="USD" rate="1.23"/>
+					</Cube>
+					<Cube time="2018-03-13">
+						<Cube currency="USD" rate="1.21"/>
+					</Cube>
+				</Cube>
+			</gesmes:Envelope>`
+		server := mocks.MakeTestServer(history)
+
+		ecb := &ECB{BaseURL: "http://localhost", HistoryURL: server.URL}
+		rate, err := ecb.Rate(ctx, "EUR", "USD", time.Date(2018, 3, 16, 12, 0, 0, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Equal(t, 1.23, rate)
+		server.Close()
+
+		rate, err = ecb.Rate(ctx, "EUR", "USD", time.Date(2018, 3, 13, 12, 0, 0, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Equal(t, 1.21, rate)
+	})
+
+	t.Run("Returns error for unknown currency", func(t *testing.T) {
+		server := mocks.MakeTestServer(response)
+		defer server.Close()
+
+		ecb := &ECB{BaseURL: server.URL}
+		_, err := ecb.Rate(ctx, "USD", "BTC", time.Now())
+		assert.EqualError(t, err, "no exchange rate")
+	})
+
+	t.Run("Returns error for invalid feed", func(t *testing.T) {
+		server := mocks.MakeTestServer(`<Envelope></Envelope>`)
+		defer server.Close()
+
+		ecb := &ECB{BaseURL: server.URL}
+		_, err := ecb.Rate(ctx, "USD", "SGD", time.Now())
+		assert.EqualError(t, err, "ecb feed has no rates")
+	})
+}
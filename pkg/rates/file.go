@@ -0,0 +1,111 @@
+package rates
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File is a RateProvider reading rates from a static file, for use when
+// the bot runs offline. Rates are loaded once and never change.
+//
+// JSON files list rates against a base currency:
+//
+//	{"base": "USD", "rates": {"EUR": 0.85, "SGD": 1.35}}
+//
+// CSV files list one currency and rate per line against a common base,
+// with an optional header:
+//
+//	currency,rate
+//	USD,1
+//	EUR,0.85
+type File struct {
+	rates map[string]float64
+}
+
+// NewFile returns a File provider with rates loaded from a JSON or CSV file.
+// The format is inferred from the file extension.
+func NewFile(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rates map[string]float64
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		rates, err = parseJSONRates(file)
+	case ".csv":
+		rates, err = parseCSVRates(file)
+	default:
+		err = errors.New("invalid rates file")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{rates: rates}, nil
+}
+
+// Rate returns the exchange rate from one currency to another. Files
+// have a single set of rates, which is used for every date.
+func (f *File) Rate(ctx context.Context, fromISO string, toISO string, date time.Time) (float64, error) {
+	return crossRate(f.rates, fromISO, toISO)
+}
+
+// parseJSONRates parses rates against a base currency from JSON.
+func parseJSONRates(r io.Reader) (map[string]float64, error) {
+	var ratesFile struct {
+		Base  string             `json:"base"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(r).Decode(&ratesFile); err != nil {
+		return nil, err
+	}
+
+	if ratesFile.Base == "" {
+		return nil, errors.New("rates file has no base currency")
+	}
+
+	rates := map[string]float64{strings.ToUpper(ratesFile.Base): 1}
+	for currency, rate := range ratesFile.Rates {
+		rates[strings.ToUpper(currency)] = rate
+	}
+
+	return rates, nil
+}
+
+// parseCSVRates parses rates against a common base currency from CSV.
+func parseCSVRates(r io.Reader) (map[string]float64, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	rates := map[string]float64{}
+	for i, record := range records {
+		if len(record) != 2 {
+			return nil, errors.New("invalid rates file")
+		}
+
+		// The first line may be a header
+		rate, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil && i == 0 {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		rates[strings.ToUpper(strings.TrimSpace(record[0]))] = rate
+	}
+
+	return rates, nil
+}
@@ -0,0 +1,75 @@
+package rates
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeRatesFile(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "rates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, name)
+	ioutil.WriteFile(path, []byte(content), 0644)
+	return path
+}
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Returns exchange rate from JSON", func(t *testing.T) {
+		path := writeRatesFile(t, "rates.json", `{"base": "usd", "rates": {"EUR": 0.8, "SGD": 1.4}}`)
+		defer os.RemoveAll(filepath.Dir(path))
+
+		file, err := NewFile(path)
+		assert.NoError(t, err)
+
+		rate, _ := file.Rate(ctx, "USD", "EUR", time.Now())
+		assert.Equal(t, 0.8, rate)
+
+		rate, _ = file.Rate(ctx, "EUR", "SGD", time.Now())
+		assert.InDelta(t, 1.75, rate, 0.0001)
+	})
+
+	t.Run("Returns exchange rate from CSV", func(t *testing.T) {
+		path := writeRatesFile(t, "rates.csv", "currency,rate\nUSD,1\neur, 0.8\n")
+		defer os.RemoveAll(filepath.Dir(path))
+
+		file, err := NewFile(path)
+		assert.NoError(t, err)
+
+		rate, _ := file.Rate(ctx, "EUR", "USD", time.Now())
+		assert.Equal(t, 1.25, rate)
+
+		_, err = file.Rate(ctx, "USD", "SGD", time.Now())
+		assert.EqualError(t, err, "no exchange rate")
+	})
+
+	t.Run("Returns error for invalid files", func(t *testing.T) {
+		path := writeRatesFile(t, "rates.txt", "USD 1")
+		defer os.RemoveAll(filepath.Dir(path))
+
+		_, err := NewFile(path)
+		assert.EqualError(t, err, "invalid rates file")
+
+		path = writeRatesFile(t, "rates.json", `{"rates": {"EUR": 0.8}}`)
+		defer os.RemoveAll(filepath.Dir(path))
+
+		_, err = NewFile(path)
+		assert.EqualError(t, err, "rates file has no base currency")
+
+		path = writeRatesFile(t, "rates.csv", "USD,1\nEUR,abc\n")
+		defer os.RemoveAll(filepath.Dir(path))
+
+		_, err = NewFile(path)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,96 @@
+// Package rates provides exchange rates between currencies. Rates may come
+// from several providers, such as the Alpha Vantage API, the European Central
+// Bank's daily reference rates or a static rates file for offline use.
+// Providers can be chained so a failing provider falls back to the next one.
+package rates
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+)
+
+const (
+	// ProviderAlphapoint fetches realtime and daily rates from the Alpha Vantage API
+	ProviderAlphapoint = "alphapoint"
+
+	// ProviderECB fetches the European Central Bank's daily reference rates
+	ProviderECB = "ecb"
+
+	// ProviderFile reads rates from a static JSON or CSV file
+	ProviderFile = "file"
+)
+
+// RateProvider is an interface for sources of exchange rates. Providers
+// return the rate on a date, or the closest rate before it if none was
+// published on the date.
+type RateProvider interface {
+	Rate(ctx context.Context, fromISO string, toISO string, date time.Time) (float64, error)
+}
+
+// Conversion describes the exchange rate between two currencies on a date.
+type Conversion struct {
+	FromCurrency string
+	ToCurrency   string
+	Rate         float64
+	Date         time.Time
+}
+
+// Chain is a RateProvider that asks each of its Providers for a rate in
+// order, falling back to the next Provider if one fails.
+type Chain struct {
+	Providers []RateProvider
+}
+
+// NewChain returns a Chain of RateProviders.
+func NewChain(providers ...RateProvider) *Chain {
+	return &Chain{Providers: providers}
+}
+
+// Rate returns the exchange rate of the first Provider able to supply one.
+// The error of the last Provider is returned if all of them fail.
+func (c *Chain) Rate(ctx context.Context, fromISO string, toISO string, date time.Time) (float64, error) {
+	err := errors.New("no rate providers")
+	for _, provider := range c.Providers {
+		var rate float64
+		rate, err = provider.Rate(ctx, fromISO, toISO, date)
+		if err == nil {
+			return rate, nil
+		}
+
+		log.Printf("rates: provider %T failed %s to %s - %s", provider, fromISO, toISO, err)
+	}
+
+	return 0, err
+}
+
+// NewProvider returns the configured RateProviders chained in order. Alpha
+// Vantage is used if no providers are configured.
+func NewProvider(providers []string, alphapointToken, ratesFile string) (RateProvider, error) {
+	if len(providers) == 0 {
+		providers = []string{ProviderAlphapoint}
+	}
+
+	chain := NewChain()
+	for _, provider := range providers {
+		switch provider {
+		case ProviderAlphapoint:
+			chain.Providers = append(chain.Providers, alphapoint.NewClient(alphapointToken))
+		case ProviderECB:
+			chain.Providers = append(chain.Providers, NewECB())
+		case ProviderFile:
+			file, err := NewFile(ratesFile)
+			if err != nil {
+				return nil, err
+			}
+			chain.Providers = append(chain.Providers, file)
+		default:
+			return nil, errors.New("invalid rate provider")
+		}
+	}
+
+	return chain, nil
+}
@@ -0,0 +1,92 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fmitra/dennis-bot/pkg/alphapoint"
+)
+
+type rateProviderMock struct {
+	rate  float64
+	err   error
+	calls int
+	date  time.Time
+}
+
+func (m *rateProviderMock) Rate(ctx context.Context, fromISO string, toISO string, date time.Time) (float64, error) {
+	m.calls++
+	m.date = date
+	return m.rate, m.err
+}
+
+func TestChain(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Returns rate of first provider", func(t *testing.T) {
+		first := &rateProviderMock{rate: 0.7}
+		second := &rateProviderMock{rate: 0.8}
+		chain := NewChain(first, second)
+
+		rate, err := chain.Rate(ctx, "USD", "SGD", time.Now())
+		assert.NoError(t, err)
+		assert.Equal(t, 0.7, rate)
+		assert.Equal(t, 0, second.calls)
+	})
+
+	t.Run("Falls back to next provider", func(t *testing.T) {
+		first := &rateProviderMock{err: errors.New("unavailable")}
+		second := &rateProviderMock{rate: 0.8}
+		chain := NewChain(first, second)
+
+		date := time.Date(2018, 3, 14, 0, 0, 0, 0, time.UTC)
+		rate, err := chain.Rate(ctx, "USD", "SGD", date)
+		assert.NoError(t, err)
+		assert.Equal(t, 0.8, rate)
+		assert.Equal(t, date, first.date)
+		assert.Equal(t, date, second.date)
+	})
+
+	t.Run("Returns error of last provider", func(t *testing.T) {
+		first := &rateProviderMock{err: errors.New("unavailable")}
+		second := &rateProviderMock{err: errors.New("no exchange rate")}
+		chain := NewChain(first, second)
+
+		_, err := chain.Rate(ctx, "USD", "SGD", time.Now())
+		assert.EqualError(t, err, "no exchange rate")
+
+		_, err = NewChain().Rate(ctx, "USD", "SGD", time.Now())
+		assert.EqualError(t, err, "no rate providers")
+	})
+}
+
+func TestNewProvider(t *testing.T) {
+	t.Run("Returns configured providers", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "rates")
+		defer os.RemoveAll(dir)
+		ratesFile := filepath.Join(dir, "rates.json")
+		ioutil.WriteFile(ratesFile, []byte(`{"base": "USD", "rates": {"EUR": 0.85}}`), 0644)
+
+		provider, err := NewProvider([]string{}, "alphapointToken", "")
+		assert.NoError(t, err)
+		assert.IsType(t, &alphapoint.Client{}, provider.(*Chain).Providers[0])
+
+		provider, err = NewProvider([]string{ProviderECB, ProviderFile}, "", ratesFile)
+		assert.NoError(t, err)
+		assert.IsType(t, &ECB{}, provider.(*Chain).Providers[0])
+		assert.IsType(t, &File{}, provider.(*Chain).Providers[1])
+
+		_, err = NewProvider([]string{"oanda"}, "", "")
+		assert.EqualError(t, err, "invalid rate provider")
+
+		_, err = NewProvider([]string{ProviderFile}, "", filepath.Join(dir, "missing.json"))
+		assert.Error(t, err)
+	})
+}
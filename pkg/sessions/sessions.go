@@ -2,6 +2,7 @@
 package sessions
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
@@ -20,16 +21,19 @@ type Config struct {
 	Db       int
 }
 
-// Session is an interface to interact with the cache layer.
+// Session is an interface to interact with the cache layer. Requests to
+// the cache are cancelled once the context is done.
 type Session interface {
-	Set(cacheKey string, v interface{}, timeInSeconds int)
-	Get(cacheKey string, v interface{}) error
-	Delete(cacheKey string) error
+	Set(ctx context.Context, cacheKey string, v interface{}, timeInSeconds int)
+	SetNX(ctx context.Context, cacheKey string, v interface{}, timeInSeconds int) (bool, error)
+	Get(ctx context.Context, cacheKey string, v interface{}) error
+	Delete(ctx context.Context, cacheKey string) error
 }
 
 // Client provides methods to interact with the cache layer.
 type Client struct {
 	codec *cache.Codec
+	redis *redis.Client
 }
 
 // NewClient returns a Client connected to the cache layer.
@@ -56,39 +60,58 @@ func NewClient(c Config) (*Client, error) {
 		},
 	}
 
-	return &Client{codec: &codec}, nil
+	return &Client{codec: &codec, redis: redisClient}, nil
 }
 
 // Delete removes an item from the cache.
-func (c *Client) Delete(cacheKey string) error {
-	err := c.codec.Delete(cacheKey)
-	if err != nil {
-		return err
-	}
-	return nil
+func (c *Client) Delete(ctx context.Context, cacheKey string) error {
+	return c.redis.WithContext(ctx).Del(cacheKey).Err()
 }
 
 // Set adds an item to the cahce. Cache timeout is provided in seconds
 // and defaults to one hour if a value of 0 is provided for the timeout.
-func (c *Client) Set(cacheKey string, v interface{}, timeInSeconds int) {
-	// One hour default duration
-	duration := time.Duration(3600) * time.Second
-	if timeInSeconds != 0 {
-		duration = time.Duration(timeInSeconds) * time.Second
+func (c *Client) Set(ctx context.Context, cacheKey string, v interface{}, timeInSeconds int) {
+	b, err := c.codec.Marshal(v)
+	if err != nil {
+		return
 	}
-	expireIn := duration
-	c.codec.Set(&cache.Item{
-		Key:        cacheKey,
-		Object:     v,
-		Expiration: expireIn,
-	})
+
+	c.redis.WithContext(ctx).Set(cacheKey, b, expiration(timeInSeconds))
+}
+
+// SetNX adds an item to the cache only if the cache key is not already set,
+// allowing callers to claim a key. Returns true if the item was added. Cache
+// timeout is provided in seconds and defaults to one hour if a value of 0 is
+// provided for the timeout.
+func (c *Client) SetNX(ctx context.Context, cacheKey string, v interface{}, timeInSeconds int) (bool, error) {
+	b, err := c.codec.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+
+	return c.redis.WithContext(ctx).SetNX(cacheKey, b, expiration(timeInSeconds)).Result()
 }
 
 // Get retrieves an item from the cache.
-func (c *Client) Get(cacheKey string, v interface{}) error {
-	err := c.codec.Get(cacheKey, &v)
+func (c *Client) Get(ctx context.Context, cacheKey string, v interface{}) error {
+	b, err := c.redis.WithContext(ctx).Get(cacheKey).Bytes()
 	if err != nil {
 		return errors.New("no session found")
 	}
+
+	if err = c.codec.Unmarshal(b, v); err != nil {
+		return errors.New("no session found")
+	}
 	return nil
 }
+
+// expiration returns a cache timeout in seconds as a duration. Timeouts
+// default to one hour if a value of 0 is provided.
+func expiration(timeInSeconds int) time.Duration {
+	// One hour default duration
+	duration := time.Duration(3600) * time.Second
+	if timeInSeconds != 0 {
+		duration = time.Duration(timeInSeconds) * time.Second
+	}
+	return duration
+}
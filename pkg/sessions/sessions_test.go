@@ -1,6 +1,7 @@
 package sessions
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"testing"
@@ -38,6 +39,8 @@ func GetSession() *Client {
 }
 
 func TestSessions(t *testing.T) {
+	ctx := context.Background()
+
 	t.Run("Sets and gets and deletes from session", func(t *testing.T) {
 		type UserMock struct {
 			UserID    string
@@ -52,16 +55,30 @@ func TestSessions(t *testing.T) {
 
 		expiresIn := 60
 		var cachedUser UserMock
-		session.Set("userID", userMock, expiresIn)
-		session.Get("userID", &cachedUser)
+		session.Set(ctx, "userID", userMock, expiresIn)
+		session.Get(ctx, "userID", &cachedUser)
 
 		assert.Equal(t, userMock, cachedUser)
 
-		session.Delete("userID")
-		err := session.Get("userID", &cachedUser)
+		session.Delete(ctx, "userID")
+		err := session.Get(ctx, "userID", &cachedUser)
 		assert.EqualError(t, err, "no session found")
 	})
 
+	t.Run("Sets only if not already set", func(t *testing.T) {
+		session := GetSession()
+		defer session.Delete(ctx, "updateID")
+
+		expiresIn := 60
+		isSet, err := session.SetNX(ctx, "updateID", true, expiresIn)
+		assert.NoError(t, err)
+		assert.True(t, isSet)
+
+		isSet, err = session.SetNX(ctx, "updateID", true, expiresIn)
+		assert.NoError(t, err)
+		assert.False(t, isSet)
+	})
+
 	t.Run("Returns error if not found", func(t *testing.T) {
 		type UserMock struct {
 			UserID    string
@@ -76,8 +93,8 @@ func TestSessions(t *testing.T) {
 
 		expiresIn := 60
 		var wanted UserMock
-		session.Set("userID", userMock, expiresIn)
-		err := session.Get("nonExistentUser", &wanted)
+		session.Set(ctx, "userID", userMock, expiresIn)
+		err := session.Get(ctx, "nonExistentUser", &wanted)
 
 		assert.EqualError(t, err, "no session found")
 	})
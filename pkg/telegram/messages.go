@@ -1,5 +1,9 @@
 package telegram
 
+import (
+	"fmt"
+)
+
 // IncomingMessage is a payload sent from Telegram representing
 // a User's message.
 type IncomingMessage struct {
@@ -43,6 +47,17 @@ func (i IncomingMessage) GetChatID() (chatID int) {
 	return i.Message.Chat.ID
 }
 
+// GetReference returns a reference to the Message that is unique to the
+// bot, for example "456:123" for Message 123 in Chat 456. Messages without
+// an ID have no reference.
+func (i IncomingMessage) GetReference() string {
+	if i.Message.MessageID == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%d:%d", i.Message.Chat.ID, i.Message.MessageID)
+}
+
 // GetMessage returns the text content of an IncomingMessaeg.
 func (i IncomingMessage) GetMessage() (message string) {
 	return i.Message.Text
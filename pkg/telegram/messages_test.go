@@ -46,4 +46,9 @@ func TestMessages(t *testing.T) {
 	t.Run("Gets Message", func(t *testing.T) {
 		assert.Equal(t, "Hello world", incomingMessage.GetMessage())
 	})
+
+	t.Run("Gets Message reference", func(t *testing.T) {
+		assert.Equal(t, "3:2", incomingMessage.GetReference())
+		assert.Equal(t, "", IncomingMessage{}.GetReference())
+	})
 }
@@ -0,0 +1,102 @@
+package telegram
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	// ModeWebhook receives updates from Telegram through the bot webhook
+	ModeWebhook = "webhook"
+
+	// ModePolling receives updates by long polling Telegram's getUpdates
+	// method, so the bot may run without a public domain
+	ModePolling = "polling"
+)
+
+// Update is a single update received from Telegram, such as an
+// IncomingMessage, along with its raw JSON payload. Updates we could
+// not read have no payload.
+type Update struct {
+	ID      int
+	Payload []byte
+}
+
+// Updater is an interface to receive updates from Telegram by polling.
+type Updater interface {
+	DeleteWebhook(ctx context.Context) int
+	GetUpdates(ctx context.Context, offset int, timeout int) ([]Update, error)
+}
+
+// Poller receives updates from Telegram by long polling. It tracks the
+// offset of the last update received so each update is only handled once.
+type Poller struct {
+	Updater Updater
+	Timeout int // Seconds Telegram holds a request open waiting for updates
+	offset  int
+}
+
+// NewPoller returns a Poller with a default timeout.
+func NewPoller(u Updater) *Poller {
+	return &Poller{
+		Updater: u,
+		Timeout: 30,
+	}
+}
+
+// Poll requests updates from Telegram until the context is cancelled,
+// handing each update to a handler in the order they were received.
+// Updates the handler fails on are requested again, along with every
+// update after them. Webhooks and polling cannot be used together, so
+// any webhook set for the bot is deleted before polling starts.
+func (p *Poller) Poll(ctx context.Context, handle func(payload []byte) error) {
+	p.Updater.DeleteWebhook(ctx)
+
+	retryDelay := time.Second
+	for ctx.Err() == nil {
+		updates, err := p.Updater.GetUpdates(ctx, p.offset, p.Timeout)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			log.Printf("telegram: failed to get updates - %s", err)
+		} else if err = p.handle(updates, handle); err != nil {
+			log.Printf("telegram: failed to handle update - %s", err)
+		}
+
+		// Back off before trying again so we do not flood Telegram while
+		// it is unavailable, or the handler while it cannot keep up
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryDelay):
+			}
+			if retryDelay < time.Minute {
+				retryDelay = retryDelay * 2
+			}
+			continue
+		}
+
+		retryDelay = time.Second
+	}
+}
+
+// handle hands updates to a handler in order, moving the offset past each
+// update once it is handled. Updates without a payload could not be read,
+// so they are skipped. We stop at the first update the handler fails on,
+// so it is not acknowledged and Telegram delivers it again.
+func (p *Poller) handle(updates []Update, handle func(payload []byte) error) error {
+	for _, update := range updates {
+		if update.Payload != nil {
+			if err := handle(update.Payload); err != nil {
+				return err
+			}
+		}
+		p.offset = update.ID + 1
+	}
+
+	return nil
+}
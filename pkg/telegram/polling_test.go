@@ -0,0 +1,146 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type updaterMock struct {
+	updates        [][]Update
+	errs           []error
+	offsets        []int
+	deletedWebhook bool
+}
+
+func (m *updaterMock) DeleteWebhook(ctx context.Context) int {
+	m.deletedWebhook = true
+	return 200
+}
+
+// GetUpdates returns the next error or batch of updates, then blocks until
+// the context is cancelled.
+func (m *updaterMock) GetUpdates(ctx context.Context, offset int, timeout int) ([]Update, error) {
+	m.offsets = append(m.offsets, offset)
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		return nil, err
+	}
+
+	if len(m.updates) == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	updates := m.updates[0]
+	m.updates = m.updates[1:]
+	return updates, nil
+}
+
+func TestPoller(t *testing.T) {
+	t.Run("Returns poller with default timeout", func(t *testing.T) {
+		poller := NewPoller(&updaterMock{})
+		assert.Equal(t, 30, poller.Timeout)
+	})
+
+	t.Run("Handles updates in order", func(t *testing.T) {
+		updater := &updaterMock{
+			updates: [][]Update{
+				{{ID: 10, Payload: []byte("first")}, {ID: 11, Payload: []byte("second")}},
+				{{ID: 12, Payload: []byte("third")}},
+			},
+		}
+		poller := NewPoller(updater)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		handled := []string{}
+		poller.Poll(ctx, func(payload []byte) error {
+			handled = append(handled, string(payload))
+			if len(handled) == 3 {
+				cancel()
+			}
+			return nil
+		})
+
+		assert.True(t, updater.deletedWebhook)
+		assert.Equal(t, []string{"first", "second", "third"}, handled)
+		assert.Equal(t, []int{0, 12}, updater.offsets)
+	})
+
+	t.Run("Retries after failing to get updates", func(t *testing.T) {
+		updater := &updaterMock{
+			errs:    []error{errors.New("unavailable")},
+			updates: [][]Update{{{ID: 10, Payload: []byte("first")}}},
+		}
+		poller := NewPoller(updater)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		poller.Poll(ctx, func(payload []byte) error {
+			cancel()
+			return nil
+		})
+
+		assert.Equal(t, []int{0, 0}, updater.offsets)
+	})
+
+	t.Run("Retries updates the handler fails on", func(t *testing.T) {
+		updater := &updaterMock{
+			updates: [][]Update{
+				{{ID: 10, Payload: []byte("first")}, {ID: 11, Payload: []byte("second")}},
+				{{ID: 11, Payload: []byte("second")}},
+			},
+		}
+		poller := NewPoller(updater)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		handled := []string{}
+		poller.Poll(ctx, func(payload []byte) error {
+			handled = append(handled, string(payload))
+			if len(handled) == 2 {
+				return errors.New("dispatcher queue full")
+			}
+			if len(handled) == 3 {
+				cancel()
+			}
+			return nil
+		})
+
+		assert.Equal(t, []string{"first", "second", "second"}, handled)
+		assert.Equal(t, []int{0, 11}, updater.offsets)
+	})
+
+	t.Run("Skips updates without a payload", func(t *testing.T) {
+		updater := &updaterMock{
+			updates: [][]Update{
+				{{ID: 10}},
+				{{ID: 11, Payload: []byte("second")}},
+			},
+		}
+		poller := NewPoller(updater)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		handled := []string{}
+		poller.Poll(ctx, func(payload []byte) error {
+			handled = append(handled, string(payload))
+			cancel()
+			return nil
+		})
+
+		assert.Equal(t, []string{"second"}, handled)
+		assert.Equal(t, []int{0, 11}, updater.offsets)
+	})
+
+	t.Run("Stops when cancelled", func(t *testing.T) {
+		updater := &updaterMock{}
+		poller := NewPoller(updater)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		poller.Poll(ctx, func(payload []byte) error { return nil })
+
+		assert.Empty(t, updater.offsets)
+	})
+}
@@ -4,62 +4,172 @@ package telegram
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/Rican7/retry"
 	"github.com/Rican7/retry/backoff"
 	"github.com/Rican7/retry/strategy"
+
+	"github.com/fmitra/dennis-bot/pkg/utils"
 )
 
 // BaseURL for Telegram
 const BaseURL = "https://api.telegram.org/bot"
 
+// DefaultWebhookPath is the path Telegram sends updates to if none is configured.
+const DefaultWebhookPath = "/webhook"
+
+// SecretTokenHeader is the header Telegram sends the webhook secret token in.
+const SecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
 // Telegram is an interface to provide utility methods to interact with
 // the Telegram API.
 type Telegram interface {
-	SetWebhook() int
-	Send(chatID int, message string) int
-	SendAction(chatID int, action string) int
+	SetWebhook(ctx context.Context) (int, error)
+	Send(ctx context.Context, chatID int, message string) int
+	SendAction(ctx context.Context, chatID int, action string) int
 }
 
 // Client is a consumer of the Telegram API.
 type Client struct {
-	Token   string
-	Domain  string
-	BaseURL string
+	Token       string
+	Domain      string
+	BaseURL     string
+	WebhookPath string // Path on the Domain that Telegram sends updates to
+	SecretToken string // Secret Telegram sends with every update to the webhook
 }
 
 // NewClient returns a Client with default BaseUrl to interact with the Telegram API.
 func NewClient(token string, domain string) *Client {
 	return &Client{
-		Token:   token,
-		Domain:  domain,
-		BaseURL: BaseURL,
+		Token:       token,
+		Domain:      domain,
+		BaseURL:     BaseURL,
+		WebhookPath: DefaultWebhookPath,
+	}
+}
+
+// SetWebhook update's Telegram with the location of the bot webhook and
+// the secret token Telegram should send with every update. Return's an
+// HTTP status code and an error if Telegram did not accept the webhook.
+func (c *Client) SetWebhook(ctx context.Context) (int, error) {
+	params := url.Values{}
+	params.Set("url", fmt.Sprintf("%s%s", c.Domain, c.WebhookPath))
+	if c.SecretToken != "" {
+		params.Set("secret_token", c.SecretToken)
+	}
+
+	requestURL := fmt.Sprintf("%s%s/setWebhook?%s", c.BaseURL, c.Token, params.Encode())
+	req, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		errorCode := 400
+		return errorCode, err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		errorCode := 400
+		return errorCode, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return resp.StatusCode, err
+	}
+
+	if !body.OK {
+		return resp.StatusCode, errors.New(body.Description)
 	}
+
+	return resp.StatusCode, nil
 }
 
-// SetWebhook update's Telegram with the location of the bot webhook.
-// Failure at this step causes a panic as the bot cannot run if it Telegram
-// is not set up with the webhook. Return's an HTTP status code.
-func (c *Client) SetWebhook() int {
-	webhook := fmt.Sprintf("%s/%s", c.Domain, c.Token)
-	url := fmt.Sprintf("%s%s/setWebhook?url=%s", c.BaseURL, c.Token, webhook)
-	resp, err := http.Get(url)
+// DeleteWebhook removes the bot webhook from Telegram, which is required
+// before receiving updates by polling. Returns an HTTP status code.
+func (c *Client) DeleteWebhook(ctx context.Context) int {
+	url := fmt.Sprintf("%s%s/deleteWebhook", c.BaseURL, c.Token)
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		log.Panicf("telegram: unable to set webhook - %s", err)
+		log.Printf("telegram: unable to delete webhook - %s", err)
+		errorCode := 400
+		return errorCode
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		log.Printf("telegram: unable to delete webhook - %s", err)
+		errorCode := 400
+		return errorCode
 	}
 	defer resp.Body.Close()
 
 	return resp.StatusCode
 }
 
-// Send sends a text message to a User. Returns an HTTP status code.
-func (c *Client) Send(chatID int, message string) int {
+// GetUpdates requests updates after an offset from Telegram. Telegram holds
+// the request open for up to timeout seconds until an update is available.
+// Updates we cannot read are logged and returned without a payload, so the
+// offset still moves past them.
+func (c *Client) GetUpdates(ctx context.Context, offset int, timeout int) ([]Update, error) {
+	url := fmt.Sprintf("%s%s/getUpdates?offset=%d&timeout=%d", c.BaseURL, c.Token, offset, timeout)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		OK          bool              `json:"ok"`
+		Description string            `json:"description"`
+		Result      []json.RawMessage `json:"result"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	if !body.OK {
+		return nil, errors.New(body.Description)
+	}
+
+	updates := []Update{}
+	for _, payload := range body.Result {
+		var incMessage IncomingMessage
+		if err = json.Unmarshal(payload, &incMessage); err == nil {
+			updates = append(updates, Update{ID: incMessage.UpdateID, Payload: payload})
+			continue
+		}
+
+		log.Printf("telegram: skipping unsupported update - %s", err)
+		var update struct {
+			UpdateID int `json:"update_id"`
+		}
+		if json.Unmarshal(payload, &update) == nil {
+			updates = append(updates, Update{ID: update.UpdateID})
+		}
+	}
+
+	return updates, nil
+}
+
+// Send sends a text message to a User. Requests are retried with an
+// exponential backoff until the context is done. Returns an HTTP status code.
+func (c *Client) Send(ctx context.Context, chatID int, message string) int {
 	url := fmt.Sprintf("%s%s/sendMessage", c.BaseURL, c.Token)
 	contentType := "application/json"
 	outMessage := OutgoingMessage{chatID, message}
@@ -70,30 +180,33 @@ func (c *Client) Send(chatID int, message string) int {
 		return errorCode
 	}
 
-	var respBody io.ReadCloser
-	var statusCode int
+	statusCode := 400
 	request := func(attempt uint) error {
-		resp, err := http.Post(url, contentType, bytes.NewReader(payload))
-		respBody = resp.Body
-		statusCode = resp.StatusCode
+		req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentType)
 
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
 		if err != nil {
 			return err
 		}
 
+		statusCode = resp.StatusCode
+		resp.Body.Close()
 		return nil
 	}
 
 	err = retry.Retry(
 		request,
 		strategy.Limit(10),
-		strategy.Backoff(backoff.Exponential(time.Second, 2)),
+		utils.Backoff(ctx, backoff.Exponential(time.Second, 2)),
 	)
 	if err != nil {
 		log.Printf("telegram: failed to send message - %s", err)
 	}
 
-	respBody.Close()
 	return statusCode
 }
 
@@ -101,7 +214,7 @@ func (c *Client) Send(chatID int, message string) int {
 // the user that we have received their message and will respond soon.
 // The most commong usage is to send a typing indicator. Returns an
 // HTTP status code.
-func (c *Client) SendAction(chatID int, action string) int {
+func (c *Client) SendAction(ctx context.Context, chatID int, action string) int {
 	url := fmt.Sprintf("%s%s/sendChatAction", c.BaseURL, c.Token)
 	contentType := "application/json"
 	chatAction := ChatAction{chatID, action}
@@ -113,7 +226,14 @@ func (c *Client) SendAction(chatID int, action string) int {
 	}
 
 	var statusCode int
-	resp, err := http.Post(url, contentType, bytes.NewReader(payload))
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("telegram: failed to send action - %s", err)
+		return errorCode
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
 	if err != nil {
 		log.Printf("telegram: failed to send action - %s", err)
 		return errorCode
@@ -1,7 +1,11 @@
 package telegram
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	mocks "github.com/fmitra/dennis-bot/test"
@@ -9,13 +13,63 @@ import (
 )
 
 func TestTelegram(t *testing.T) {
+	ctx := context.Background()
+
 	t.Run("Returns client with default config", func(t *testing.T) {
 		telegram := NewClient("telegramToken", "https://localhost")
 
 		assert.Equal(t, BaseURL, telegram.BaseURL)
+		assert.Equal(t, DefaultWebhookPath, telegram.WebhookPath)
 	})
 
 	t.Run("Sets webhook", func(t *testing.T) {
+		server := mocks.MakeTestServer(`{"ok": true, "result": true}`)
+		defer server.Close()
+		telegram := &Client{
+			Token:   "telegramToken",
+			Domain:  "https://localhost",
+			BaseURL: fmt.Sprintf("%s/", server.URL),
+		}
+
+		statusCode, err := telegram.SetWebhook(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, statusCode)
+	})
+
+	t.Run("Sets webhook with secret token", func(t *testing.T) {
+		var query url.Values
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.Query()
+			fmt.Fprint(w, `{"ok": true, "result": true}`)
+		}))
+		defer server.Close()
+		telegram := NewClient("telegramToken", "https://localhost")
+		telegram.BaseURL = fmt.Sprintf("%s/", server.URL)
+		telegram.WebhookPath = "/updates"
+		telegram.SecretToken = "secret"
+
+		statusCode, err := telegram.SetWebhook(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 200, statusCode)
+		assert.Equal(t, "https://localhost/updates", query.Get("url"))
+		assert.Equal(t, "secret", query.Get("secret_token"))
+	})
+
+	t.Run("Fails to set webhook", func(t *testing.T) {
+		response := `{"ok": false, "description": "Bad Request: bad webhook: HTTPS url must be provided for webhook"}`
+		server := mocks.MakeTestServer(response)
+		defer server.Close()
+		telegram := &Client{
+			Token:   "telegramToken",
+			Domain:  "http://localhost",
+			BaseURL: fmt.Sprintf("%s/", server.URL),
+		}
+
+		_, err := telegram.SetWebhook(ctx)
+		assert.EqualError(t, err, "Bad Request: bad webhook: HTTPS url must be provided for webhook")
+	})
+
+	t.Run("Deletes webhook", func(t *testing.T) {
 		server := mocks.MakeTestServer("")
 		defer server.Close()
 		telegram := &Client{
@@ -24,10 +78,73 @@ func TestTelegram(t *testing.T) {
 			BaseURL: fmt.Sprintf("%s/", server.URL),
 		}
 
-		statusCode := telegram.SetWebhook()
+		statusCode := telegram.DeleteWebhook(ctx)
 		assert.Equal(t, 200, statusCode)
 	})
 
+	t.Run("Gets updates", func(t *testing.T) {
+		response := `{
+			"ok": true,
+			"result": [
+				{"update_id": 10, "message": {"text": "Hello"}},
+				{"update_id": 11, "message": {"text": "World"}}
+			]
+		}`
+		server := mocks.MakeTestServer(response)
+		defer server.Close()
+		telegram := &Client{
+			Token:   "telegramToken",
+			Domain:  "https://localhost",
+			BaseURL: fmt.Sprintf("%s/", server.URL),
+		}
+
+		updates, err := telegram.GetUpdates(ctx, 10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(updates))
+		assert.Equal(t, 10, updates[0].ID)
+		assert.Equal(t, 11, updates[1].ID)
+		assert.Contains(t, string(updates[1].Payload), "World")
+	})
+
+	t.Run("Skips updates it cannot read", func(t *testing.T) {
+		response := `{
+			"ok": true,
+			"result": [
+				{"update_id": 10, "message": {"text": 5}},
+				{"update_id": 11, "message": {"text": "World"}}
+			]
+		}`
+		server := mocks.MakeTestServer(response)
+		defer server.Close()
+		telegram := &Client{
+			Token:   "telegramToken",
+			Domain:  "https://localhost",
+			BaseURL: fmt.Sprintf("%s/", server.URL),
+		}
+
+		updates, err := telegram.GetUpdates(ctx, 10, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(updates))
+		assert.Equal(t, 10, updates[0].ID)
+		assert.Nil(t, updates[0].Payload)
+		assert.Equal(t, 11, updates[1].ID)
+		assert.Contains(t, string(updates[1].Payload), "World")
+	})
+
+	t.Run("Returns error for failed updates", func(t *testing.T) {
+		response := `{"ok": false, "description": "Conflict: can't use getUpdates method while webhook is active"}`
+		server := mocks.MakeTestServer(response)
+		defer server.Close()
+		telegram := &Client{
+			Token:   "telegramToken",
+			Domain:  "https://localhost",
+			BaseURL: fmt.Sprintf("%s/", server.URL),
+		}
+
+		_, err := telegram.GetUpdates(ctx, 0, 0)
+		assert.EqualError(t, err, "Conflict: can't use getUpdates method while webhook is active")
+	})
+
 	t.Run("Sends telegram message", func(t *testing.T) {
 		server := mocks.MakeTestServer("")
 		defer server.Close()
@@ -39,10 +156,26 @@ func TestTelegram(t *testing.T) {
 
 		chatID := 5
 		message := "Hello world"
-		statusCode := telegram.Send(chatID, message)
+		statusCode := telegram.Send(ctx, chatID, message)
 		assert.Equal(t, 200, statusCode)
 	})
 
+	t.Run("Stops sending telegram message once the context is cancelled", func(t *testing.T) {
+		server := mocks.MakeTestServer("")
+		defer server.Close()
+		telegram := &Client{
+			Token:   "telegramToken",
+			Domain:  "https://localhost",
+			BaseURL: fmt.Sprintf("%s/", server.URL),
+		}
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		statusCode := telegram.Send(cancelled, 5, "Hello world")
+		assert.Equal(t, 400, statusCode)
+	})
+
 	t.Run("Sends a telegram chat action", func(t *testing.T) {
 		server := mocks.MakeTestServer("")
 		defer server.Close()
@@ -54,7 +187,7 @@ func TestTelegram(t *testing.T) {
 
 		chatID := 5
 		action := "typing"
-		statusCode := telegram.SendAction(chatID, action)
+		statusCode := telegram.SendAction(ctx, chatID, action)
 		assert.Equal(t, 200, statusCode)
 	})
 }
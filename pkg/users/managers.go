@@ -1,13 +1,16 @@
 package users
 
 import (
+	"crypto/rsa"
 	"errors"
 	"log"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	// Register SQL driver for DB
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 
+	"github.com/fmitra/dennis-bot/pkg/crypto"
 	"github.com/fmitra/dennis-bot/pkg/utils"
 )
 
@@ -17,6 +20,9 @@ type UserManager struct {
 	db *gorm.DB
 }
 
+// RecoveryCodeCount is the number of recovery codes created for a User.
+const RecoveryCodeCount = 8
+
 // SettingManager exposes methods to interface with a Setting in our
 // database.
 type SettingManager struct {
@@ -56,6 +62,267 @@ func (m *UserManager) GetByTelegramID(tID uint) User {
 	return user
 }
 
+// GetByID return's a bot User based on their account ID.
+func (m *UserManager) GetByID(userID uint) User {
+	var user User
+	m.db.Where("id = ?", userID).First(&user)
+	return user
+}
+
+// UpdatePassword changes a User's password. The password hash and password
+// protected private key are updated together in a single transaction.
+func (m *UserManager) UpdatePassword(userID uint, oldPassword, newPassword string) error {
+	tx := m.db.Begin()
+
+	var user User
+	query := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", userID)
+	if query.First(&user).RecordNotFound() {
+		tx.Rollback()
+		return errors.New("user does not exist")
+	}
+
+	if err := user.ChangePassword(oldPassword, newPassword); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err := tx.Model(&user).Updates(map[string]interface{}{
+		"password":    user.Password,
+		"private_key": user.PrivateKey,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Rewrapper protects a User's data with a new key pair instead of their old
+// key pair. It is run within the transaction replacing the key pair, so the
+// data and key pair are replaced together.
+type Rewrapper func(tx *gorm.DB, oldKey rsa.PrivateKey, newKey rsa.PublicKey) error
+
+// UpgradeKeyPair replaces a User's key pair if it is smaller than the key pairs
+// we create today. The User's data is protected with the new key pair by the
+// Rewrapper and their recovery codes, which hold copies of the old private key,
+// are replaced. The new recovery codes are returned. Key pairs that are kept
+// are protected again with the password if they were protected before password
+// encryption used a key derivation function.
+func (m *UserManager) UpgradeKeyPair(userID uint, password string, rewrap Rewrapper) ([]string, error) {
+	tx := m.db.Begin()
+
+	var user User
+	query := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", userID)
+	if query.First(&user).RecordNotFound() {
+		tx.Rollback()
+		return []string{}, errors.New("user does not exist")
+	}
+
+	if err := user.ValidatePassword(password); err != nil {
+		tx.Rollback()
+		return []string{}, errors.New("invalid password")
+	}
+
+	if !user.HasLegacyKeyPair() {
+		if err := reprotectPrivateKey(tx, user, password); err != nil {
+			tx.Rollback()
+			return []string{}, err
+		}
+		return []string{}, tx.Commit().Error
+	}
+
+	oldKey, err := crypto.ParsePrivateKey(user.PrivateKey, password)
+	if err != nil {
+		tx.Rollback()
+		return []string{}, err
+	}
+
+	publicKey, privateKey, err := crypto.CreateKeyPair()
+	if err != nil {
+		tx.Rollback()
+		return []string{}, err
+	}
+
+	if err = rewrap(tx, oldKey, publicKey); err != nil {
+		tx.Rollback()
+		return []string{}, err
+	}
+
+	user.PublicKey, user.PrivateKey, err = crypto.ProtectKeyPair(publicKey, privateKey, password)
+	if err != nil {
+		tx.Rollback()
+		return []string{}, err
+	}
+
+	err = tx.Model(&user).Updates(map[string]interface{}{
+		"public_key":  user.PublicKey,
+		"private_key": user.PrivateKey,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return []string{}, err
+	}
+
+	codes, err := replaceRecoveryCodes(tx, user, password)
+	if err != nil {
+		tx.Rollback()
+		return []string{}, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return []string{}, err
+	}
+
+	return codes, nil
+}
+
+// MarkEncryptionUpgraded records that a User's data encrypted with legacy
+// formats was upgraded, so the upgrade is not run again.
+func (m *UserManager) MarkEncryptionUpgraded(userID uint) error {
+	return m.db.Model(&User{}).
+		Where("id = ?", userID).
+		Update("encryption_upgraded", true).Error
+}
+
+// reprotectPrivateKey protects a User's private key again with their password
+// within a transaction if it was protected before password encryption used a
+// key derivation function. Keys already protected with the current format are
+// left as they are.
+func reprotectPrivateKey(tx *gorm.DB, user User, password string) error {
+	if !crypto.IsLegacy(user.PrivateKey) {
+		return nil
+	}
+
+	privateKey, err := crypto.ReprotectPrivateKey(user.PrivateKey, password, password)
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&user).Update("private_key", privateKey).Error
+}
+
+// CreateRecoveryCodes replaces a User's recovery codes with a new set of
+// one-time codes and returns the plaintext codes. Codes cannot be retrieved
+// again after they are created.
+func (m *UserManager) CreateRecoveryCodes(userID uint, password string) ([]string, error) {
+	tx := m.db.Begin()
+
+	var user User
+	query := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", userID)
+	if query.First(&user).RecordNotFound() {
+		tx.Rollback()
+		return []string{}, errors.New("user does not exist")
+	}
+
+	codes, err := replaceRecoveryCodes(tx, user, password)
+	if err != nil {
+		tx.Rollback()
+		return []string{}, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return []string{}, err
+	}
+
+	return codes, nil
+}
+
+// replaceRecoveryCodes replaces a User's recovery codes with a new set of
+// one-time codes within a transaction and returns the plaintext codes.
+func replaceRecoveryCodes(tx *gorm.DB, user User, password string) ([]string, error) {
+	// Old codes hold copies of the private key, so they are removed
+	// entirely rather than soft deleted
+	err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&RecoveryCode{}).Error
+	if err != nil {
+		return []string{}, err
+	}
+
+	var codes []string
+	for i := 0; i < RecoveryCodeCount; i++ {
+		code, recoveryCode, err := user.NewRecoveryCode(password)
+		if err != nil {
+			return []string{}, err
+		}
+
+		if err = tx.Create(&recoveryCode).Error; err != nil {
+			return []string{}, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// ResetPassword changes a User's password with one of their recovery codes.
+// The recovery code is used up and may not be used again.
+func (m *UserManager) ResetPassword(userID uint, code, newPassword string) error {
+	tx := m.db.Begin()
+
+	var user User
+	query := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", userID)
+	if query.First(&user).RecordNotFound() {
+		tx.Rollback()
+		return errors.New("user does not exist")
+	}
+
+	usedCode, err := findRecoveryCode(tx, userID, code)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = user.ResetPassword(usedCode, code, newPassword); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Model(&user).Updates(map[string]interface{}{
+		"password":    user.Password,
+		"private_key": user.PrivateKey,
+	}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Unscoped().Delete(&usedCode).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// ValidateRecoveryCode checks if a code matches one of a User's unused
+// recovery codes.
+func (m *UserManager) ValidateRecoveryCode(userID uint, code string) error {
+	_, err := findRecoveryCode(m.db, userID, code)
+	return err
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes a User has.
+func (m *UserManager) CountRecoveryCodes(userID uint) int {
+	var count int
+	m.db.Model(&RecoveryCode{}).Where("user_id = ?", userID).Count(&count)
+	return count
+}
+
+// findRecoveryCode returns the User's unused RecoveryCode matching a
+// plaintext code.
+func findRecoveryCode(db *gorm.DB, userID uint, code string) (RecoveryCode, error) {
+	var recoveryCodes []RecoveryCode
+	db.Where("user_id = ?", userID).Find(&recoveryCodes)
+
+	for _, recoveryCode := range recoveryCodes {
+		if recoveryCode.Validate(code) == nil {
+			return recoveryCode, nil
+		}
+	}
+
+	return RecoveryCode{}, errors.New("invalid recovery code")
+}
+
 // UpdateCurrency creates or updates a user's settings with the
 // valid currency ISO.
 func (m *SettingManager) UpdateCurrency(userID uint, currency string) error {
@@ -89,5 +356,88 @@ func (m *SettingManager) GetCurrency(userID uint) string {
 		return "USD"
 	}
 
+	if setting.Currency == "" {
+		return "USD"
+	}
+
 	return setting.Currency
 }
+
+// UpdateTimezone creates or updates a user's settings with a valid
+// timezone.
+func (m *SettingManager) UpdateTimezone(userID uint, timezone string) error {
+	location, err := utils.ParseTimezone(timezone)
+	if err != nil {
+		return err
+	}
+
+	setting := &Setting{
+		UserID:   userID,
+		Timezone: location.String(),
+	}
+
+	var existing Setting
+	if m.db.Where("user_id = ?", userID).First(&existing).RecordNotFound() {
+		m.db.Create(setting)
+		return nil
+	}
+
+	tx := m.db.Begin()
+	tx.Model(&existing).Update("timezone", location.String())
+	tx.Commit()
+
+	return nil
+}
+
+// GetLocation returns the location of the User's timezone. Users without
+// a timezone default to UTC.
+func (m *SettingManager) GetLocation(userID uint) *time.Location {
+	var setting Setting
+	if m.db.Where("user_id = ?", userID).First(&setting).RecordNotFound() {
+		return time.UTC
+	}
+
+	location, err := utils.ParseTimezone(setting.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return location
+}
+
+// UpdateWeekStart creates or updates a user's settings with the day
+// their week starts on.
+func (m *SettingManager) UpdateWeekStart(userID uint, day string) error {
+	weekday, err := utils.ParseWeekday(day)
+	if err != nil {
+		return err
+	}
+
+	setting := &Setting{
+		UserID:    userID,
+		WeekStart: int(weekday),
+	}
+
+	var existing Setting
+	if m.db.Where("user_id = ?", userID).First(&existing).RecordNotFound() {
+		m.db.Create(setting)
+		return nil
+	}
+
+	tx := m.db.Begin()
+	tx.Model(&existing).Update("week_start", int(weekday))
+	tx.Commit()
+
+	return nil
+}
+
+// GetWeekStart returns the day a User's week starts on. Weeks start on
+// Sunday by default.
+func (m *SettingManager) GetWeekStart(userID uint) time.Weekday {
+	var setting Setting
+	if m.db.Where("user_id = ?", userID).First(&setting).RecordNotFound() {
+		return time.Sunday
+	}
+
+	return time.Weekday(setting.WeekStart)
+}
@@ -1,11 +1,17 @@
 package users
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/jinzhu/gorm"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/fmitra/dennis-bot/pkg/crypto"
 	mocks "github.com/fmitra/dennis-bot/test"
 )
 
@@ -35,6 +41,15 @@ func (suite *Suite) TestReturnsUserByTelegramID() {
 	assert.Equal(suite.T(), mocks.TestUserID, queriedUser.TelegramID)
 }
 
+func (suite *Suite) TestReturnsUserByID() {
+	manager := NewUserManager(suite.Env.Db)
+	mocks.CreateTestUser(suite.Env.Db, 0)
+	user := manager.GetByTelegramID(mocks.TestUserID)
+
+	queriedUser := manager.GetByID(user.ID)
+	assert.Equal(suite.T(), mocks.TestUserID, queriedUser.TelegramID)
+}
+
 func (suite *Suite) TestCreatesNewUser() {
 	manager := NewUserManager(suite.Env.Db)
 	user := &User{
@@ -44,6 +59,179 @@ func (suite *Suite) TestCreatesNewUser() {
 	assert.NoError(suite.T(), err)
 }
 
+func (suite *Suite) TestUpdatePassword() {
+	manager := NewUserManager(suite.Env.Db)
+	user := &User{
+		TelegramID: mocks.TestUserID,
+		Password:   "my-password",
+	}
+	manager.Save(user)
+	originalKey, _ := user.GetPrivateKey("my-password")
+
+	err := manager.UpdatePassword(user.ID, "not-my-password", "new-password")
+	assert.EqualError(suite.T(), err, "invalid password")
+
+	err = manager.UpdatePassword(user.ID, "my-password", "new-password")
+	assert.NoError(suite.T(), err)
+
+	updatedUser := manager.GetByID(user.ID)
+	assert.NoError(suite.T(), updatedUser.ValidatePassword("new-password"))
+	privateKey, err := updatedUser.GetPrivateKey("new-password")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), originalKey.D, privateKey.D)
+
+	err = manager.UpdatePassword(uint(0), "new-password", "my-password")
+	assert.EqualError(suite.T(), err, "user does not exist")
+}
+
+func (suite *Suite) TestUpgradePrivateKey() {
+	manager := NewUserManager(suite.Env.Db)
+	user := &User{
+		TelegramID: mocks.TestUserID,
+		Password:   "my-password",
+	}
+	manager.Save(user)
+	originalKey, _ := user.GetPrivateKey("my-password")
+
+	// Protect the key the way it was protected before Encrypt used AES-GCM
+	encodedKey, _ := crypto.Decrypt(user.PrivateKey, "my-password")
+	legacyKey := mocks.EncryptLegacy(encodedKey, "my-password")
+	suite.Env.Db.Model(user).Update("private_key", legacyKey)
+
+	rewrap := func(tx *gorm.DB, oldKey rsa.PrivateKey, newKey rsa.PublicKey) error {
+		return errors.New("key pair should be kept")
+	}
+
+	_, err := manager.UpgradeKeyPair(user.ID, "not-my-password", rewrap)
+	assert.EqualError(suite.T(), err, "invalid password")
+
+	codes, err := manager.UpgradeKeyPair(user.ID, "my-password", rewrap)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 0, len(codes))
+
+	upgradedUser := manager.GetByID(user.ID)
+	assert.False(suite.T(), crypto.IsLegacy(upgradedUser.PrivateKey))
+	privateKey, err := upgradedUser.GetPrivateKey("my-password")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), originalKey.D, privateKey.D)
+
+	_, err = manager.UpgradeKeyPair(user.ID, "my-password", rewrap)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), upgradedUser.PrivateKey, manager.GetByID(user.ID).PrivateKey)
+}
+
+func (suite *Suite) TestUpgradeLegacyKeyPair() {
+	manager := NewUserManager(suite.Env.Db)
+	user := &User{
+		TelegramID: mocks.TestUserID,
+		Password:   "my-password",
+	}
+	manager.Save(user)
+	manager.CreateRecoveryCodes(user.ID, "my-password")
+
+	// Replace the key pair with one the size we created before
+	legacyKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	publicKey, privateKey, _ := crypto.ProtectKeyPair(legacyKey.PublicKey, *legacyKey, "my-password")
+	suite.Env.Db.Model(user).Updates(map[string]interface{}{
+		"public_key":  publicKey,
+		"private_key": privateKey,
+	})
+	legacyUser := manager.GetByID(user.ID)
+	assert.True(suite.T(), legacyUser.HasLegacyKeyPair())
+
+	// Key pairs are not replaced if the User's data cannot be protected
+	_, err := manager.UpgradeKeyPair(user.ID, "my-password", func(tx *gorm.DB, oldKey rsa.PrivateKey, newKey rsa.PublicKey) error {
+		return errors.New("rewrap failed")
+	})
+	assert.EqualError(suite.T(), err, "rewrap failed")
+	assert.Equal(suite.T(), publicKey, manager.GetByID(user.ID).PublicKey)
+
+	var rewrappedKey rsa.PublicKey
+	codes, err := manager.UpgradeKeyPair(user.ID, "my-password", func(tx *gorm.DB, oldKey rsa.PrivateKey, newKey rsa.PublicKey) error {
+		assert.Equal(suite.T(), legacyKey.D, oldKey.D)
+		rewrappedKey = newKey
+		return nil
+	})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), RecoveryCodeCount, len(codes))
+	assert.Equal(suite.T(), RecoveryCodeCount, manager.CountRecoveryCodes(user.ID))
+
+	upgradedUser := manager.GetByID(user.ID)
+	assert.False(suite.T(), upgradedUser.HasLegacyKeyPair())
+	upgradedKey, err := upgradedUser.GetPublicKey()
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), rewrappedKey.N, upgradedKey.N)
+
+	// New recovery codes hold copies of the new private key
+	err = manager.ResetPassword(user.ID, codes[0], "new-password")
+	assert.NoError(suite.T(), err)
+	resetUser := manager.GetByID(user.ID)
+	resetKey, err := resetUser.GetPrivateKey("new-password")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), upgradedKey.N, resetKey.N)
+}
+
+func (suite *Suite) TestCreateRecoveryCodes() {
+	manager := NewUserManager(suite.Env.Db)
+	user := &User{
+		TelegramID: mocks.TestUserID,
+		Password:   "my-password",
+	}
+	manager.Save(user)
+
+	_, err := manager.CreateRecoveryCodes(user.ID, "not-my-password")
+	assert.EqualError(suite.T(), err, "invalid password")
+	assert.Equal(suite.T(), 0, manager.CountRecoveryCodes(user.ID))
+
+	codes, err := manager.CreateRecoveryCodes(user.ID, "my-password")
+	assert.NoError(suite.T(), err)
+	assert.Len(suite.T(), codes, RecoveryCodeCount)
+	assert.Equal(suite.T(), RecoveryCodeCount, manager.CountRecoveryCodes(user.ID))
+
+	newCodes, err := manager.CreateRecoveryCodes(user.ID, "my-password")
+	assert.NoError(suite.T(), err)
+	assert.NotEqual(suite.T(), codes, newCodes)
+	assert.Equal(suite.T(), RecoveryCodeCount, manager.CountRecoveryCodes(user.ID))
+
+	_, err = manager.CreateRecoveryCodes(uint(0), "my-password")
+	assert.EqualError(suite.T(), err, "user does not exist")
+}
+
+func (suite *Suite) TestResetPassword() {
+	manager := NewUserManager(suite.Env.Db)
+	user := &User{
+		TelegramID: mocks.TestUserID,
+		Password:   "my-password",
+	}
+	manager.Save(user)
+	originalKey, _ := user.GetPrivateKey("my-password")
+	codes, _ := manager.CreateRecoveryCodes(user.ID, "my-password")
+
+	err := manager.ResetPassword(user.ID, "abcde-fghjk", "new-password")
+	assert.EqualError(suite.T(), err, "invalid recovery code")
+	assert.EqualError(suite.T(), manager.ValidateRecoveryCode(user.ID, "abcde-fghjk"), "invalid recovery code")
+	assert.NoError(suite.T(), manager.ValidateRecoveryCode(user.ID, codes[3]))
+
+	err = manager.ResetPassword(user.ID, codes[3], "new-password")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), RecoveryCodeCount-1, manager.CountRecoveryCodes(user.ID))
+
+	updatedUser := manager.GetByID(user.ID)
+	assert.NoError(suite.T(), updatedUser.ValidatePassword("new-password"))
+	privateKey, err := updatedUser.GetPrivateKey("new-password")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), originalKey.D, privateKey.D)
+
+	err = manager.ResetPassword(user.ID, codes[3], "other-password")
+	assert.EqualError(suite.T(), err, "invalid recovery code")
+
+	err = manager.ResetPassword(user.ID, codes[0], "other-password")
+	assert.NoError(suite.T(), err)
+
+	err = manager.ResetPassword(uint(0), codes[1], "new-password")
+	assert.EqualError(suite.T(), err, "user does not exist")
+}
+
 func (suite *Suite) TestUpdateCurrency() {
 	mocks.CreateTestUser(suite.Env.Db, uint(400))
 	um := NewUserManager(suite.Env.Db)
@@ -80,6 +268,40 @@ func (suite *Suite) TestGetCurrency() {
 	assert.Equal(suite.T(), "JPY", currency)
 }
 
+func (suite *Suite) TestUpdateTimezone() {
+	mocks.CreateTestUser(suite.Env.Db, uint(400))
+	um := NewUserManager(suite.Env.Db)
+	user := um.GetByTelegramID(uint(400))
+
+	manager := NewSettingManager(suite.Env.Db)
+	err := manager.UpdateTimezone(user.ID, "Mars/Olympus")
+	assert.EqualError(suite.T(), err, "invalid timezone")
+
+	err = manager.UpdateTimezone(user.ID, "asia/tokyo")
+	assert.NoError(suite.T(), err)
+
+	err = manager.UpdateTimezone(user.ID, "UTC+8")
+	assert.NoError(suite.T(), err)
+
+	var setting Setting
+	suite.Env.Db.Where("user_id = ?", user.ID).First(&setting)
+	assert.Equal(suite.T(), setting.UserID, user.ID)
+	assert.Equal(suite.T(), setting.Timezone, "UTC+8")
+	assert.Equal(suite.T(), "USD", manager.GetCurrency(user.ID))
+}
+
+func (suite *Suite) TestGetLocation() {
+	mocks.CreateTestUser(suite.Env.Db, uint(400))
+	um := NewUserManager(suite.Env.Db)
+	user := um.GetByTelegramID(uint(400))
+
+	manager := NewSettingManager(suite.Env.Db)
+	assert.Equal(suite.T(), time.UTC, manager.GetLocation(user.ID))
+
+	manager.UpdateTimezone(user.ID, "Asia/Tokyo")
+	assert.Equal(suite.T(), "Asia/Tokyo", manager.GetLocation(user.ID).String())
+}
+
 func TestSuite(t *testing.T) {
 	suite.Run(t, new(Suite))
 }
@@ -5,6 +5,7 @@ import (
 	"crypto/rsa"
 	"errors"
 	"log"
+	"strings"
 
 	"github.com/jinzhu/gorm"
 
@@ -16,22 +17,41 @@ import (
 // and public/private key pair.
 type User struct {
 	gorm.Model
-	TelegramID uint   `gorm:"unique_index"`
-	Password   string `gorm:"type:varchar(2000);not null"`
-	PublicKey  string `gorm:"type:varchar(2500);not null"`
-	PrivateKey string `gorm:"type:varchar(2500);not null"`
+	TelegramID         uint   `gorm:"unique_index"`
+	Password           string `gorm:"type:varchar(2000);not null"`
+	PublicKey          string `gorm:"type:varchar(2500);not null"`
+	PrivateKey         string `gorm:"type:text;not null"`
+	EncryptionUpgraded bool   `gorm:"not null;default:false"` // Whether data encrypted with legacy formats was upgraded
 }
 
 // Setting describes User specific settings for the bot. For example it
 // controls whether the bot returns expense history in the default currency,
-// USD or a user specified currency.
+// USD or a user specified currency, which timezone the User's days are
+// measured in and which day the User's week starts on.
 type Setting struct {
 	gorm.Model
-	Currency string `gorm:"type:varchar(30)"`
-	User     User
-	UserID   uint `gorm:"unique_index"`
+	Currency  string `gorm:"type:varchar(30)"`
+	Timezone  string `gorm:"type:varchar(64)"`
+	WeekStart int    `gorm:"not null;default:0"` // Day of the week a User's week starts, Sunday is 0
+	User      User
+	UserID    uint `gorm:"unique_index"`
 }
 
+// RecoveryCode is a one-time code a User may use to reset a forgotten password.
+// Each code protects its own copy of the User's private key, so the code alone
+// is enough to recover the key. Only a hash of the code is stored.
+type RecoveryCode struct {
+	gorm.Model
+	Code       string `gorm:"type:varchar(2000);not null"`
+	PrivateKey string `gorm:"type:text;not null"`
+	User       User
+	UserID     uint `gorm:"index;not null"`
+}
+
+// recoveryCodeLength is the number of characters in a RecoveryCode, excluding
+// the separator we display to the User.
+const recoveryCodeLength = 10
+
 // BeforeCreate hashes a User's plaintext password and generates
 // a public/private key pair on their behalf prior to creating a DB
 // record.
@@ -51,6 +71,7 @@ func (u *User) BeforeCreate(scope *gorm.Scope) error {
 	u.Password = hashedPassword
 	u.PublicKey = publicKey
 	u.PrivateKey = privateKey
+	u.EncryptionUpgraded = true
 	return nil
 }
 
@@ -60,6 +81,107 @@ func (u *User) ValidatePassword(password string) error {
 	return crypto.ValidateHash(u.Password, password)
 }
 
+// ChangePassword replaces the User's password. The private key is protected
+// again with the new password, so the User's key pair is unchanged.
+func (u *User) ChangePassword(oldPassword, newPassword string) error {
+	if err := u.ValidatePassword(oldPassword); err != nil {
+		return errors.New("invalid password")
+	}
+
+	privateKey, err := crypto.ReprotectPrivateKey(u.PrivateKey, oldPassword, newPassword)
+	if err != nil {
+		log.Printf("users: failed to protect private key with new password")
+		return err
+	}
+
+	hashedPassword, err := crypto.HashText(newPassword)
+	if err != nil {
+		return err
+	}
+
+	u.Password = hashedPassword
+	u.PrivateKey = privateKey
+	return nil
+}
+
+// NewRecoveryCode creates a RecoveryCode protecting a copy of the User's private
+// key. The plaintext code is returned separately as it is not stored.
+func (u *User) NewRecoveryCode(password string) (string, RecoveryCode, error) {
+	if err := u.ValidatePassword(password); err != nil {
+		return "", RecoveryCode{}, errors.New("invalid password")
+	}
+
+	code, err := crypto.GenerateCode(recoveryCodeLength)
+	if err != nil {
+		return "", RecoveryCode{}, err
+	}
+
+	privateKey, err := crypto.ReprotectPrivateKey(u.PrivateKey, password, code)
+	if err != nil {
+		log.Printf("users: failed to protect private key with recovery code")
+		return "", RecoveryCode{}, err
+	}
+
+	hashedCode, err := crypto.HashText(code)
+	if err != nil {
+		return "", RecoveryCode{}, err
+	}
+
+	recoveryCode := RecoveryCode{
+		Code:       hashedCode,
+		PrivateKey: privateKey,
+		UserID:     u.ID,
+	}
+	return FormatRecoveryCode(code), recoveryCode, nil
+}
+
+// ResetPassword replaces the User's password using a RecoveryCode instead of
+// the old password. The private key copy held by the RecoveryCode is protected
+// with the new password, so the User's key pair is unchanged.
+func (u *User) ResetPassword(recoveryCode RecoveryCode, code, newPassword string) error {
+	code = normalizeRecoveryCode(code)
+	if err := recoveryCode.Validate(code); err != nil {
+		return errors.New("invalid recovery code")
+	}
+
+	privateKey, err := crypto.ReprotectPrivateKey(recoveryCode.PrivateKey, code, newPassword)
+	if err != nil {
+		log.Printf("users: failed to protect private key with new password")
+		return err
+	}
+
+	hashedPassword, err := crypto.HashText(newPassword)
+	if err != nil {
+		return err
+	}
+
+	u.Password = hashedPassword
+	u.PrivateKey = privateKey
+	return nil
+}
+
+// Validate checks if a plaintext code validates against the RecoveryCode's
+// stored hash.
+func (r *RecoveryCode) Validate(code string) error {
+	return crypto.ValidateHash(r.Code, normalizeRecoveryCode(code))
+}
+
+// FormatRecoveryCode splits a recovery code in half so it is easier to read
+// and write down, for example "abcde-fghjk".
+func FormatRecoveryCode(code string) string {
+	code = normalizeRecoveryCode(code)
+	half := len(code) / 2
+	return code[:half] + "-" + code[half:]
+}
+
+// normalizeRecoveryCode removes formatting a User may include when typing
+// in a recovery code.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.Replace(code, "-", "", -1)
+	return strings.Join(strings.Fields(code), "")
+}
+
 // GetPrivateKey returns the decrypted rsa.PrivateKey of the User.
 func (u *User) GetPrivateKey(password string) (rsa.PrivateKey, error) {
 	if err := u.ValidatePassword(password); err != nil {
@@ -78,3 +200,14 @@ func (u *User) GetPrivateKey(password string) (rsa.PrivateKey, error) {
 func (u *User) GetPublicKey() (rsa.PublicKey, error) {
 	return crypto.ParsePublicKey(u.PublicKey)
 }
+
+// HasLegacyKeyPair checks if the User's key pair is smaller than the key
+// pairs we create today and should be replaced.
+func (u *User) HasLegacyKeyPair() bool {
+	publicKey, err := u.GetPublicKey()
+	if err != nil || publicKey.N == nil {
+		return false
+	}
+
+	return publicKey.N.BitLen() < crypto.KeyBitSize
+}
@@ -2,6 +2,7 @@ package users
 
 import (
 	"crypto/rsa"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -25,6 +26,68 @@ func TestUserModel(t *testing.T) {
 		assert.IsType(t, rsa.PrivateKey{}, userPrivateKey)
 	})
 
+	t.Run("It should change password", func(t *testing.T) {
+		crypto.InitializeGob()
+		password, _ := crypto.HashText("my-password")
+		publicKey, privateKey, _ := crypto.CreateProtectedKeyPair("my-password")
+		user := &User{
+			TelegramID: uint(123),
+			Password:   password,
+			PublicKey:  publicKey,
+			PrivateKey: privateKey,
+		}
+		originalKey, _ := user.GetPrivateKey("my-password")
+
+		err := user.ChangePassword("not-my-password", "new-password")
+		assert.EqualError(t, err, "invalid password")
+
+		err = user.ChangePassword("my-password", "new-password")
+		assert.NoError(t, err)
+		assert.NoError(t, user.ValidatePassword("new-password"))
+
+		userPrivateKey, err := user.GetPrivateKey("new-password")
+		assert.NoError(t, err)
+		assert.Equal(t, originalKey.D, userPrivateKey.D)
+	})
+
+	t.Run("It should reset password with a recovery code", func(t *testing.T) {
+		crypto.InitializeGob()
+		password, _ := crypto.HashText("my-password")
+		publicKey, privateKey, _ := crypto.CreateProtectedKeyPair("my-password")
+		user := &User{
+			TelegramID: uint(123),
+			Password:   password,
+			PublicKey:  publicKey,
+			PrivateKey: privateKey,
+		}
+		originalKey, _ := user.GetPrivateKey("my-password")
+
+		_, _, err := user.NewRecoveryCode("not-my-password")
+		assert.EqualError(t, err, "invalid password")
+
+		code, recoveryCode, err := user.NewRecoveryCode("my-password")
+		assert.NoError(t, err)
+		assert.Len(t, code, 11)
+		assert.NotEqual(t, code, recoveryCode.Code)
+
+		err = user.ResetPassword(recoveryCode, "abcde-fghjk", "new-password")
+		assert.EqualError(t, err, "invalid recovery code")
+
+		err = user.ResetPassword(recoveryCode, strings.ToUpper(code), "new-password")
+		assert.NoError(t, err)
+		assert.NoError(t, user.ValidatePassword("new-password"))
+
+		userPrivateKey, err := user.GetPrivateKey("new-password")
+		assert.NoError(t, err)
+		assert.Equal(t, originalKey.D, userPrivateKey.D)
+	})
+
+	t.Run("It should format recovery codes", func(t *testing.T) {
+		assert.Equal(t, "abcde-fghjk", FormatRecoveryCode("abcdefghjk"))
+		assert.Equal(t, "abcde-fghjk", FormatRecoveryCode("ABCDE FGHJK"))
+		assert.Equal(t, "abcde-fghjk", FormatRecoveryCode("abcde-fghjk"))
+	})
+
 	t.Run("It shoudl validate users password", func(t *testing.T) {
 		hashedPassword, _ := crypto.HashText("my-password")
 		user := &User{
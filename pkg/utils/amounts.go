@@ -0,0 +1,272 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Amount is an amount of money found in a string.
+type Amount struct {
+	Value    float64 // Value of the amount, with any magnitude applied (ex. 1.5k is 1500)
+	Currency string  // Currency ISO of the amount, empty if no currency was found
+	Start    int     // Byte offset in the string where the amount and its currency start
+	End      int     // Byte offset in the string where the amount and its currency end
+}
+
+// numberPattern matches a number with optional thousands and decimal
+// separators, for example "12", "1,200.50", "1.200,50" or "1'000".
+var numberPattern = regexp.MustCompile(`\d(?:[\d.,']*\d)?`)
+
+// magnitudePattern matches a magnitude directly after a number, for example
+// "1.5k" or "2 million".
+var magnitudePattern = regexp.MustCompile(`(?i)^(?:(k|mm|mn|m|bn|b)| ?(thousand|million|billion))\b`)
+
+// magnitudes are the multipliers of each magnitude suffix.
+var magnitudes = map[string]float64{
+	"k":        1e3,
+	"thousand": 1e3,
+	"m":        1e6,
+	"mm":       1e6,
+	"mn":       1e6,
+	"million":  1e6,
+	"b":        1e9,
+	"bn":       1e9,
+	"billion":  1e9,
+}
+
+// currencyNameISO maps every currency name to its ISO.
+var currencyNameISO = map[string]string{}
+
+// sortedNames and sortedSymbols are currency names and symbols from
+// longest to shortest, so "singapore dollar" is matched before "dollar".
+var sortedNames, sortedSymbols []string
+
+func init() {
+	for iso, names := range currencyNames {
+		for _, name := range names {
+			currencyNameISO[name] = iso
+			sortedNames = append(sortedNames, name)
+		}
+	}
+
+	for symbol := range currencySymbols {
+		sortedSymbols = append(sortedSymbols, symbol)
+	}
+
+	byLength := func(s []string) func(i, j int) bool {
+		return func(i, j int) bool {
+			if len(s[i]) != len(s[j]) {
+				return len(s[i]) > len(s[j])
+			}
+			return s[i] < s[j]
+		}
+	}
+	sort.Slice(sortedNames, byLength(sortedNames))
+	sort.Slice(sortedSymbols, byLength(sortedSymbols))
+}
+
+// FindAmounts returns every amount of money in a string, in order. Currencies
+// may be an ISO, symbol or name on either side of the number, for example
+// "12SGD", "$12.50", "€1.200,50", "1.5k JPY" or "300 yen". Currencies
+// following a number are preferred over currencies preceding it.
+func FindAmounts(s string) []Amount {
+	var amounts []Amount
+	for _, match := range numberPattern.FindAllStringIndex(s, -1) {
+		value, err := parseNumber(s[match[0]:match[1]])
+		if err != nil {
+			continue
+		}
+
+		amount := Amount{Start: match[0], End: match[1]}
+		if magnitude := magnitudePattern.FindStringSubmatch(s[amount.End:]); magnitude != nil {
+			suffix := strings.ToLower(magnitude[1] + magnitude[2])
+			value = value * magnitudes[suffix]
+			amount.End += len(magnitude[0])
+		}
+		amount.Value = value
+
+		if iso, length := currencyAfter(s[amount.End:]); length > 0 {
+			amount.Currency = iso
+			amount.End += length
+		} else if iso, length := currencyBefore(s[:amount.Start]); length > 0 {
+			amount.Currency = iso
+			amount.Start -= length
+		}
+
+		amounts = append(amounts, amount)
+	}
+
+	return amounts
+}
+
+// ParseAmount checks a string for possible currency and amount values,
+// for example "100 USD" should return 100 as a float and USD as
+// the currency ISO. The first amount with a currency is preferred.
+func ParseAmount(s string) (amount float64, currency string) {
+	amounts := FindAmounts(s)
+	if len(amounts) == 0 {
+		currency, _ = ParseCurrency(s)
+		return 0, currency
+	}
+
+	for _, found := range amounts {
+		if found.Currency != "" {
+			return found.Value, found.Currency
+		}
+	}
+
+	return amounts[0].Value, ""
+}
+
+// ParseCurrency checks if a string is a currency ISO, symbol or name, for
+// example "usd", "$" or "dollars".
+func ParseCurrency(s string) (string, error) {
+	cleanString := strings.TrimSpace(s)
+	iso, length := currencyAfter(cleanString)
+	if length == 0 || length != len(cleanString) {
+		return "", errors.New("invalid currency")
+	}
+
+	return iso, nil
+}
+
+// parseNumber parses a number written with either a dot or comma as its
+// decimal separator. If both are used, the last one is the decimal separator.
+// If only one is used once and followed by exactly three digits, a comma is a
+// thousands separator ("1,200") while a dot is a decimal separator ("1.200").
+func parseNumber(s string) (float64, error) {
+	number := strings.Replace(s, "'", "", -1)
+	dots := strings.Count(number, ".")
+	commas := strings.Count(number, ",")
+
+	decimal := ""
+	switch {
+	case dots > 0 && commas > 0:
+		decimal = "."
+		if strings.LastIndex(number, ",") > strings.LastIndex(number, ".") {
+			decimal = ","
+		}
+	case dots == 1:
+		decimal = "."
+	case commas == 1 && len(number)-strings.Index(number, ",") != 4:
+		decimal = ","
+	}
+
+	for _, separator := range []string{".", ","} {
+		if separator != decimal {
+			number = strings.Replace(number, separator, "", -1)
+		}
+	}
+
+	number = strings.Replace(number, ",", ".", -1)
+	return strconv.ParseFloat(number, 64)
+}
+
+// currencyAfter checks if a string starts with a currency, optionally after
+// a space. The currency ISO is returned along with the length of the match.
+func currencyAfter(s string) (string, int) {
+	offset := 0
+	if strings.HasPrefix(s, " ") {
+		offset = 1
+	}
+	text := s[offset:]
+
+	for _, symbol := range sortedSymbols {
+		if strings.HasPrefix(text, symbol) && isWordEnd(text, len(symbol)) {
+			return currencySymbols[symbol], offset + len(symbol)
+		}
+	}
+
+	if len(text) >= 3 && isWordEnd(text, 3) {
+		if iso, ok := parseCode(text[:3]); ok {
+			return iso, offset + 3
+		}
+	}
+
+	for _, name := range sortedNames {
+		if len(text) < len(name) || !strings.EqualFold(text[:len(name)], name) {
+			continue
+		}
+
+		for _, plural := range []string{"", "s", "es"} {
+			length := len(name) + len(plural)
+			if len(text) >= length && strings.EqualFold(text[len(name):length], plural) &&
+				isWordEnd(text, length) {
+				return currencyNameISO[name], offset + length
+			}
+		}
+	}
+
+	return "", 0
+}
+
+// currencyBefore checks if a string ends with a currency ISO or symbol,
+// optionally followed by a space. The currency ISO is returned along with
+// the length of the match.
+func currencyBefore(s string) (string, int) {
+	offset := 0
+	if strings.HasSuffix(s, " ") {
+		offset = 1
+	}
+	text := s[:len(s)-offset]
+
+	for _, symbol := range sortedSymbols {
+		start := len(text) - len(symbol)
+		if strings.HasSuffix(text, symbol) && isWordStart(text, start) {
+			return currencySymbols[symbol], offset + len(symbol)
+		}
+	}
+
+	start := len(text) - 3
+	if start >= 0 && isWordStart(text, start) {
+		if iso, ok := parseCode(text[start:]); ok {
+			return iso, offset + 3
+		}
+	}
+
+	return "", 0
+}
+
+// parseCode checks if a three letter code is a currency ISO. Codes that are
+// also English words must be in upper case.
+func parseCode(code string) (string, bool) {
+	iso, err := ParseISO(code)
+	if err != nil || strings.Contains(code, " ") {
+		return "", false
+	}
+
+	if wordCodes[iso] && code != iso {
+		return "", false
+	}
+
+	return iso, true
+}
+
+// isWordEnd checks if a match ending at index i of a string is not
+// followed by more letters.
+func isWordEnd(s string, i int) bool {
+	if i >= len(s) {
+		return true
+	}
+
+	last, _ := utf8.DecodeLastRuneInString(s[:i])
+	next, _ := utf8.DecodeRuneInString(s[i:])
+	return !unicode.IsLetter(last) || !unicode.IsLetter(next)
+}
+
+// isWordStart checks if a match starting at index i of a string is not
+// preceded by more letters.
+func isWordStart(s string, i int) bool {
+	if i <= 0 {
+		return true
+	}
+
+	first, _ := utf8.DecodeRuneInString(s[i:])
+	previous, _ := utf8.DecodeLastRuneInString(s[:i])
+	return !unicode.IsLetter(first) || !unicode.IsLetter(previous)
+}
@@ -169,3 +169,241 @@ var CURRENCIES = []string{
 	"NEO",
 	"LTC",
 }
+
+// currencyNames are the names of every currency in CURRENCIES. Names shared by
+// several currencies, such as peso or franc, are only listed with their country.
+// Plurals ending in "s" are matched automatically, so only irregular plurals
+// are listed.
+var currencyNames = map[string][]string{
+	"AED": {"uae dirham", "emirati dirham"},
+	"AFN": {"afghani", "afghan afghani"},
+	"ALL": {"lek", "leke", "albanian lek"},
+	"AMD": {"dram", "armenian dram"},
+	"ANG": {"netherlands antillean guilder", "antillean guilder"},
+	"AOA": {"kwanza", "angolan kwanza"},
+	"ARS": {"argentine peso", "argentinian peso"},
+	"AUD": {"australian dollar", "aussie dollar"},
+	"AWG": {"aruban florin", "aruban guilder"},
+	"AZN": {"manat", "azerbaijani manat"},
+	"BAM": {"convertible mark", "bosnian mark"},
+	"BBD": {"barbadian dollar", "bajan dollar"},
+	"BDT": {"taka", "bangladeshi taka"},
+	"BGN": {"lev", "leva", "bulgarian lev"},
+	"BHD": {"bahraini dinar"},
+	"BIF": {"burundian franc"},
+	"BMD": {"bermudian dollar", "bermuda dollar"},
+	"BND": {"brunei dollar"},
+	"BOB": {"boliviano", "bolivian boliviano"},
+	"BRL": {"real", "reais", "brazilian real", "brazilian reais"},
+	"BSD": {"bahamian dollar"},
+	"BTN": {"ngultrum", "bhutanese ngultrum"},
+	"BWP": {"pula", "botswana pula"},
+	"BYN": {"belarusian ruble", "belarusian rouble"},
+	"BZD": {"belize dollar"},
+	"CAD": {"canadian dollar"},
+	"CDF": {"congolese franc"},
+	"CHF": {"swiss franc"},
+	"CLP": {"chilean peso"},
+	"CNY": {"yuan", "renminbi", "rmb", "chinese yuan"},
+	"COP": {"colombian peso"},
+	"CRC": {"colon", "colones", "costa rican colon", "costa rican colones"},
+	"CUC": {"cuban convertible peso"},
+	"CUP": {"cuban peso"},
+	"CVE": {"cape verdean escudo"},
+	"CZK": {"koruna", "czech koruna", "czech crown"},
+	"DJF": {"djiboutian franc"},
+	"DKK": {"danish krone", "danish kroner"},
+	"DOP": {"dominican peso"},
+	"DZD": {"algerian dinar"},
+	"EGP": {"egyptian pound"},
+	"ERN": {"nakfa", "eritrean nakfa"},
+	"ETB": {"birr", "ethiopian birr"},
+	"EUR": {"euro"},
+	"FJD": {"fijian dollar", "fiji dollar"},
+	"FKP": {"falkland islands pound", "falkland pound"},
+	"GBP": {"pound", "quid", "pound sterling", "british pound", "sterling"},
+	"GEL": {"lari", "georgian lari"},
+	"GGP": {"guernsey pound"},
+	"GHS": {"cedi", "ghanaian cedi"},
+	"GIP": {"gibraltar pound"},
+	"GMD": {"dalasi", "gambian dalasi"},
+	"GNF": {"guinean franc"},
+	"GTQ": {"quetzal", "quetzales", "guatemalan quetzal"},
+	"GYD": {"guyanese dollar"},
+	"HKD": {"hong kong dollar", "hk dollar"},
+	"HNL": {"lempira", "honduran lempira"},
+	"HRK": {"kuna", "croatian kuna"},
+	"HTG": {"gourde", "haitian gourde"},
+	"HUF": {"forint", "hungarian forint"},
+	"IDR": {"rupiah", "indonesian rupiah"},
+	"ILS": {"shekel", "shekalim", "new shekel", "israeli shekel"},
+	"IMP": {"manx pound", "isle of man pound"},
+	"INR": {"rupee", "indian rupee"},
+	"IQD": {"iraqi dinar"},
+	"IRR": {"iranian rial"},
+	"ISK": {"icelandic krona", "icelandic kronur"},
+	"JEP": {"jersey pound"},
+	"JMD": {"jamaican dollar"},
+	"JOD": {"jordanian dinar"},
+	"JPY": {"yen", "japanese yen"},
+	"KES": {"kenyan shilling"},
+	"KGS": {"som", "kyrgyzstani som"},
+	"KHR": {"riel", "cambodian riel"},
+	"KMF": {"comorian franc"},
+	"KPW": {"north korean won"},
+	"KRW": {"won", "korean won", "south korean won"},
+	"KWD": {"kuwaiti dinar"},
+	"KYD": {"cayman islands dollar", "cayman dollar"},
+	"KZT": {"tenge", "kazakhstani tenge"},
+	"LAK": {"kip", "lao kip"},
+	"LBP": {"lebanese pound"},
+	"LKR": {"sri lankan rupee"},
+	"LRD": {"liberian dollar"},
+	"LSL": {"loti", "maloti", "lesotho loti"},
+	"LYD": {"libyan dinar"},
+	"MAD": {"moroccan dirham"},
+	"MDL": {"moldovan leu", "moldovan lei"},
+	"MGA": {"ariary", "malagasy ariary"},
+	"MKD": {"denar", "denari", "macedonian denar"},
+	"MMK": {"kyat", "myanmar kyat"},
+	"MNT": {"tugrik", "togrog", "mongolian tugrik"},
+	"MOP": {"pataca", "macanese pataca"},
+	"MRO": {"ouguiya", "mauritanian ouguiya"},
+	"MUR": {"mauritian rupee"},
+	"MVR": {"rufiyaa", "maldivian rufiyaa"},
+	"MWK": {"malawian kwacha"},
+	"MXN": {"mexican peso"},
+	"MYR": {"ringgit", "malaysian ringgit"},
+	"MZN": {"metical", "meticais", "mozambican metical"},
+	"NAD": {"namibian dollar"},
+	"NGN": {"naira", "nigerian naira"},
+	"NIO": {"cordoba", "nicaraguan cordoba"},
+	"NOK": {"norwegian krone", "norwegian kroner"},
+	"NPR": {"nepalese rupee"},
+	"NZD": {"new zealand dollar", "kiwi dollar"},
+	"OMR": {"omani rial"},
+	"PAB": {"balboa", "panamanian balboa"},
+	"PEN": {"sol", "soles", "peruvian sol", "peruvian soles"},
+	"PGK": {"kina", "papua new guinean kina"},
+	"PHP": {"philippine peso", "piso"},
+	"PKR": {"pakistani rupee"},
+	"PLN": {"zloty", "zlotys", "zlote", "zlotych", "polish zloty"},
+	"PYG": {"guarani", "paraguayan guarani"},
+	"QAR": {"qatari riyal"},
+	"RON": {"romanian leu", "romanian lei"},
+	"RSD": {"serbian dinar"},
+	"RUB": {"ruble", "rouble", "russian ruble", "russian rouble"},
+	"RWF": {"rwandan franc"},
+	"SAR": {"saudi riyal"},
+	"SBD": {"solomon islands dollar"},
+	"SCR": {"seychellois rupee"},
+	"SDG": {"sudanese pound"},
+	"SEK": {"swedish krona", "swedish kronor"},
+	"SGD": {"singapore dollar", "sing dollar"},
+	"SHP": {"saint helena pound"},
+	"SLL": {"leone", "sierra leonean leone"},
+	"SOS": {"somali shilling"},
+	"SPL": {"seborga luigino", "luigino", "luigini"},
+	"SRD": {"surinamese dollar"},
+	"STD": {"dobra", "sao tome dobra"},
+	"SVC": {"salvadoran colon"},
+	"SYP": {"syrian pound"},
+	"SZL": {"lilangeni", "emalangeni", "swazi lilangeni"},
+	"THB": {"baht", "thai baht"},
+	"TJS": {"somoni", "tajikistani somoni"},
+	"TMT": {"turkmenistan manat"},
+	"TND": {"tunisian dinar"},
+	"TOP": {"paanga", "pa'anga", "tongan paanga"},
+	"TRY": {"lira", "lire", "turkish lira"},
+	"TTD": {"trinidad and tobago dollar", "trinidad dollar"},
+	"TVD": {"tuvaluan dollar"},
+	"TWD": {"new taiwan dollar", "taiwan dollar"},
+	"TZS": {"tanzanian shilling"},
+	"UAH": {"hryvnia", "hryvnias", "hryvni", "ukrainian hryvnia"},
+	"UGX": {"ugandan shilling"},
+	"USD": {"dollar", "buck", "us dollar", "american dollar"},
+	"UYU": {"uruguayan peso"},
+	"UZS": {"uzbekistani som"},
+	"VEF": {"bolivar", "bolivares", "venezuelan bolivar"},
+	"VND": {"dong", "vietnamese dong"},
+	"VUV": {"vatu", "vanuatu vatu"},
+	"WST": {"tala", "samoan tala"},
+	"XAF": {"central african cfa franc"},
+	"XCD": {"east caribbean dollar"},
+	"XDR": {"special drawing right", "sdr"},
+	"XOF": {"west african cfa franc", "cfa franc"},
+	"XPF": {"cfp franc"},
+	"YER": {"yemeni rial"},
+	"ZAR": {"rand", "south african rand"},
+	"ZMW": {"zambian kwacha"},
+	"ZWD": {"zimbabwean dollar", "zimdollar"},
+	"BTC": {"bitcoin"},
+	"ETH": {"ether", "ethereum"},
+	"NEO": {"neo"},
+	"LTC": {"litecoin"},
+}
+
+// currencySymbols map symbols to the currency they most commonly represent.
+// Symbols shared by many currencies, such as kr or ₨, are left out.
+var currencySymbols = map[string]string{
+	"$":   "USD",
+	"US$": "USD",
+	"€":   "EUR",
+	"£":   "GBP",
+	"¥":   "JPY",
+	"JP¥": "JPY",
+	"CN¥": "CNY",
+	"元":   "CNY",
+	"₽":   "RUB",
+	"₹":   "INR",
+	"₩":   "KRW",
+	"₱":   "PHP",
+	"฿":   "THB",
+	"₫":   "VND",
+	"₺":   "TRY",
+	"₪":   "ILS",
+	"₴":   "UAH",
+	"₦":   "NGN",
+	"₸":   "KZT",
+	"₮":   "MNT",
+	"₭":   "LAK",
+	"₲":   "PYG",
+	"₡":   "CRC",
+	"₵":   "GHS",
+	"₾":   "GEL",
+	"₼":   "AZN",
+	"֏":   "AMD",
+	"৳":   "BDT",
+	"ƒ":   "ANG",
+	"S$":  "SGD",
+	"SG$": "SGD",
+	"HK$": "HKD",
+	"A$":  "AUD",
+	"AU$": "AUD",
+	"C$":  "CAD",
+	"CA$": "CAD",
+	"NZ$": "NZD",
+	"NT$": "TWD",
+	"R$":  "BRL",
+	"MX$": "MXN",
+	"EC$": "XCD",
+	"J$":  "JMD",
+	"TT$": "TTD",
+	"S/":  "PEN",
+	"zł":  "PLN",
+	"Kč":  "CZK",
+	"Ft":  "HUF",
+	"RM":  "MYR",
+	"Rp":  "IDR",
+	"лв":  "BGN",
+	"₿":   "BTC",
+	"Ξ":   "ETH",
+	"Ł":   "LTC",
+}
+
+// wordCodes are currency ISOs that are also common English words. They are
+// only recognized in upper case, so "12 all" is not 12 Albanian lek.
+var wordCodes = map[string]bool{
+	"ALL": true, "BAM": true, "BOB": true, "CUP": true, "GEL": true, "MAD": true,
+	"MOP": true, "PEN": true, "SOS": true, "TOP": true, "TRY": true,
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kierdavis/dateparser"
+)
+
+// monthPattern matches the name of a month, for example "march" or "mar".
+const monthPattern = `(january|february|march|april|may|june|july|august|september|october|november|december|` +
+	`jan|feb|mar|apr|jun|jul|aug|sept|sep|oct|nov|dec)`
+
+// ordinalPattern matches an optional ordinal suffix of a day, for example "3rd".
+const ordinalPattern = `(?:st|nd|rd|th)?`
+
+// agoPattern matches a date relative to today, for example "2 days ago".
+const agoPattern = `(\d+|an?|one) (day|week|month)s? ago`
+
+// weekdayPattern matches a day of the week, for example "last friday" or "monday".
+const weekdayPattern = `(last |this )?(monday|tuesday|wednesday|thursday|friday|saturday|sunday)`
+
+// monthDayPattern matches a day of a month, for example "march 14th" or "mar 14, 2018".
+const monthDayPattern = monthPattern + `\.? (\d{1,2})` + ordinalPattern + `(?:,? (\d{4}))?`
+
+// dayMonthPattern matches a day of a month, for example "14th of march" or "14 mar 2018".
+const dayMonthPattern = `(\d{1,2})` + ordinalPattern + ` (?:of )?` + monthPattern + `(?: (\d{4}))?`
+
+// ordinalDayPattern matches a day of the current month, for example "the 3rd".
+const ordinalDayPattern = `the (\d{1,2})(?:st|nd|rd|th)`
+
+// Date expressions are matched on their own to resolve them.
+var (
+	agoDate      = regexp.MustCompile(`\b` + agoPattern + `\b`)
+	weekdayDate  = regexp.MustCompile(`\b` + weekdayPattern + `\b`)
+	monthDayDate = regexp.MustCompile(`\b` + monthDayPattern + `\b`)
+	dayMonthDate = regexp.MustCompile(`\b` + dayMonthPattern + `\b`)
+	ordinalDate  = regexp.MustCompile(`\b` + ordinalDayPattern + `\b`)
+)
+
+// datePattern matches every date expression we understand in a message.
+var datePattern = regexp.MustCompile(`(?i)\b(?:on )?(` + strings.Join([]string{
+	"today",
+	"yesterday",
+	agoPattern,
+	monthDayPattern,
+	dayMonthPattern,
+	ordinalDayPattern,
+	weekdayPattern,
+	`\d{4}-\d{1,2}-\d{1,2}`,
+	`\d{1,2}/\d{1,2}(?:/\d{2,4})?`,
+}, "|") + `)\b`)
+
+// FindDate returns the first date expression in a string, for example
+// "yesterday", "last friday" or "march 14th", along with the start and end
+// of the expression in the string. A leading "on" is part of the expression
+// but not of the returned date. An empty date is returned if none is found.
+func FindDate(s string) (date string, start, end int) {
+	match := datePattern.FindStringSubmatchIndex(s)
+	if match == nil {
+		return "", 0, 0
+	}
+
+	return s[match[2]:match[3]], match[0], match[1]
+}
+
+// ParseDate checks if a string is a possible date value. Dates are
+// inferred relative to the current time and returned in its location,
+// so a user's "yesterday" is based on their local day. Relative dates
+// such as "2 days ago", "last friday", "the 3rd" or "march 14th" resolve
+// to the most recent matching day. If no date is found, we default to now.
+func ParseDate(s string, now time.Time) (inferredDate time.Time) {
+	lowerCase := strings.ToLower(s)
+	if date, ok := parseRelativeDate(lowerCase, now); ok {
+		return date
+	}
+
+	splitString := strings.Split(lowerCase, " ")
+	date := now
+
+	if strings.Contains(lowerCase, "yesterday") {
+		date = now.AddDate(0, 0, -1)
+	}
+
+	// Check if any item in the split is an actual date string
+	parser := &dateparser.Parser{}
+	for _, item := range splitString {
+		parsedTime, err := parser.Parse(item)
+		if err == nil {
+			year, month, day := parsedTime.Date()
+			date = onDay(year, month, day, now)
+		}
+	}
+
+	return date
+}
+
+// parseRelativeDate parses a date relative to the current time. Dates in
+// the future are moved back to the previous week, month or year, as we
+// only track expenses that already happened.
+func parseRelativeDate(s string, now time.Time) (time.Time, bool) {
+	year, month, _ := now.Date()
+
+	if match := agoDate.FindStringSubmatch(s); match != nil {
+		count, err := strconv.Atoi(match[1])
+		if err != nil {
+			count = 1
+		}
+
+		switch match[2] {
+		case "day":
+			return now.AddDate(0, 0, -count), true
+		case "week":
+			return now.AddDate(0, 0, -7*count), true
+		default:
+			return now.AddDate(0, -count, 0), true
+		}
+	}
+
+	if match := monthDayDate.FindStringSubmatch(s); match != nil {
+		return parseMonthDay(match[1], match[2], match[3], now)
+	}
+
+	if match := dayMonthDate.FindStringSubmatch(s); match != nil {
+		return parseMonthDay(match[2], match[1], match[3], now)
+	}
+
+	if match := ordinalDate.FindStringSubmatch(s); match != nil {
+		ordinal, _ := strconv.Atoi(match[1])
+		for months := 0; months < 12; months++ {
+			date := onDay(year, month-time.Month(months), ordinal, now)
+			if date.Day() == ordinal && !date.After(now) {
+				return date, true
+			}
+		}
+		return now, false
+	}
+
+	if match := weekdayDate.FindStringSubmatch(s); match != nil {
+		weekday, _ := ParseWeekday(match[2])
+		daysAgo := (int(now.Weekday()) - int(weekday) + 7) % 7
+		if daysAgo == 0 && match[1] == "last " {
+			daysAgo = 7
+		}
+		return now.AddDate(0, 0, -daysAgo), true
+	}
+
+	return now, false
+}
+
+// parseMonthDay parses the name of a month, a day and an optional year into
+// a date. Dates without a year are in the current year, or the previous year
+// if the day has not happened yet.
+func parseMonthDay(monthName, dayOfMonth, yearNumber string, now time.Time) (time.Time, bool) {
+	day, _ := strconv.Atoi(dayOfMonth)
+	month := time.January
+	for month < time.December && !strings.HasPrefix(strings.ToLower(month.String()), monthName[:3]) {
+		month++
+	}
+
+	year, err := strconv.Atoi(yearNumber)
+	if err != nil {
+		year = now.Year()
+		if onDay(year, month, day, now).After(now) {
+			year--
+		}
+	}
+
+	date := onDay(year, month, day, now)
+	if date.Day() != day {
+		return now, false
+	}
+
+	return date, true
+}
+
+// onDay returns a date with the same time of day and location as now.
+func onDay(year int, month time.Month, day int, now time.Time) time.Time {
+	return time.Date(
+		year, month, day,
+		now.Hour(), now.Minute(), now.Second(), now.Nanosecond(),
+		now.Location(),
+	)
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/Rican7/retry/backoff"
+	"github.com/Rican7/retry/strategy"
+)
+
+// Backoff is a retry strategy waiting between attempts with a backoff
+// algorithm, like strategy.Backoff. Waiting stops and no further attempts
+// are made once the context is done. The first attempt is always made, so
+// the caller receives an error from a cancelled request.
+func Backoff(ctx context.Context, algorithm backoff.Algorithm) strategy.Strategy {
+	return func(attempt uint) bool {
+		if attempt == 0 {
+			return true
+		}
+
+		timer := time.NewTimer(algorithm(attempt))
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
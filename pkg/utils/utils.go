@@ -3,11 +3,11 @@ package utils
 
 import (
 	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/kierdavis/dateparser"
+	"unicode"
 )
 
 // ParseISO checks if an input string is a valid currency ISO.
@@ -22,51 +22,93 @@ func ParseISO(s string) (string, error) {
 	return "", errors.New("invalid currency")
 }
 
-// ParseAmount checks a string for possible currency and amount values,
-// for example "100 USD" should return 100 as a float and USD as
-// the currency ISO.
-func ParseAmount(s string) (amount float64, currency string) {
-	upperCase := strings.ToUpper(s)
-	for _, currency := range CURRENCIES {
-		if strings.Contains(upperCase, currency) {
+// ParseTimezone checks if a string is a valid timezone. Timezones may be
+// an IANA name (ex. Asia/Tokyo) or an offset from UTC (ex. UTC+9).
+func ParseTimezone(s string) (*time.Location, error) {
+	cleanString := strings.TrimSpace(s)
+	if cleanString == "" {
+		return nil, errors.New("invalid timezone")
+	}
 
-			amount := strings.Split(upperCase, currency)[0]
-			cleanAmount := strings.Replace(amount, " ", "", -1)
-			parsedAmount, err := strconv.ParseFloat(cleanAmount, 64)
+	if offset, ok := parseUTCOffset(cleanString); ok {
+		return offset, nil
+	}
 
-			if err != nil {
-				return 0, currency
-			}
+	// IANA names are case sensitive, so we title case each word of the
+	// name in case the user typed it in lower case (ex. america/new_york)
+	name := strings.Replace(cleanString, " ", "_", -1)
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		words := strings.Split(part, "_")
+		for j, word := range words {
+			words[j] = strings.Title(strings.ToLower(word))
+		}
+		parts[i] = strings.Join(words, "_")
+	}
+
+	for _, name := range []string{name, strings.Join(parts, "/"), strings.ToUpper(name)} {
+		if name == "Local" {
+			continue
+		}
 
-			return parsedAmount, currency
+		location, err := time.LoadLocation(name)
+		if err == nil {
+			return location, nil
 		}
 	}
 
-	parsedAmount, _ := strconv.ParseFloat(s, 64)
-	return parsedAmount, ""
+	return nil, errors.New("invalid timezone")
 }
 
-// ParseDate checks if a string is a possible date value.
-func ParseDate(s string) (inferredDate time.Time) {
-	lowerCase := strings.ToLower(s)
-	splitString := strings.Split(lowerCase, " ")
-	today := time.Now()
-	date := today
+// ParseWeekday checks if a string is a day of the week, for example
+// "monday" or "Mon".
+func ParseWeekday(s string) (time.Weekday, error) {
+	cleanString := strings.ToLower(strings.TrimSpace(s))
+	if len(cleanString) >= 3 {
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			if strings.HasPrefix(strings.ToLower(day.String()), cleanString) {
+				return day, nil
+			}
+		}
+	}
 
-	if strings.Contains(lowerCase, "yesterday") {
-		date = today.AddDate(0, 0, -1)
+	return time.Sunday, errors.New("invalid weekday")
+}
+
+// parseUTCOffset parses an offset from UTC such as UTC+9, GMT-5:30 or +08:00
+// into a fixed timezone. Fixed timezones are named after their offset, so the
+// name may be parsed again later.
+func parseUTCOffset(s string) (*time.Location, bool) {
+	upperS := strings.ToUpper(strings.Replace(s, " ", "", -1))
+	upperS = strings.TrimPrefix(strings.TrimPrefix(upperS, "UTC"), "GMT")
+	if len(upperS) < 2 || (upperS[0] != '+' && upperS[0] != '-') {
+		return nil, false
 	}
 
-	// Check if any item in the split is an actual date string
-	parser := &dateparser.Parser{}
-	for _, item := range splitString {
-		parsedTime, err := parser.Parse(item)
-		if err == nil {
-			date = parsedTime
-		}
+	sign := 1
+	if upperS[0] == '-' {
+		sign = -1
+	}
+
+	hours, minutes := upperS[1:], "0"
+	if split := strings.SplitN(hours, ":", 2); len(split) == 2 {
+		hours, minutes = split[0], split[1]
+	} else if len(hours) == 4 {
+		hours, minutes = hours[:2], hours[2:]
+	}
+
+	h, hErr := strconv.Atoi(hours)
+	m, mErr := strconv.Atoi(minutes)
+	if hErr != nil || mErr != nil || h > 14 || m > 59 {
+		return nil, false
+	}
+
+	name := fmt.Sprintf("UTC%c%d", upperS[0], h)
+	if m > 0 {
+		name = fmt.Sprintf("%s:%02d", name, m)
 	}
 
-	return date
+	return time.FixedZone(name, sign*(h*3600+m*60)), true
 }
 
 // ParseDescription checks if a string is a description.
@@ -78,3 +120,46 @@ func ParseDescription(s string) (description string) {
 
 	return s
 }
+
+// ParseCategory checks a string for a category tag, for example "lunch #food"
+// should return food as the category and "lunch" as the remaining text.
+func ParseCategory(s string) (category string, text string) {
+	var words []string
+	for _, word := range strings.Fields(s) {
+		isTag := strings.HasPrefix(word, "#") && len(word) > 1
+		if isTag && category == "" {
+			category = strings.ToLower(strings.TrimFunc(word[1:], isNotLetterOrNumber))
+			continue
+		}
+		words = append(words, word)
+	}
+
+	return category, strings.Join(words, " ")
+}
+
+// ParseKeywords returns a unique list of lower case words from a string that
+// may be used to infer an expense category. Short words and numbers are
+// ignored as they rarely describe what was purchased.
+func ParseKeywords(s string) []string {
+	minLength := 3
+	seen := map[string]bool{}
+	keywords := []string{}
+
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, word := range words {
+		if len([]rune(word)) < minLength || seen[word] {
+			continue
+		}
+		seen[word] = true
+		keywords = append(keywords, word)
+	}
+
+	return keywords
+}
+
+// isNotLetterOrNumber checks if a rune is punctuation or whitespace.
+func isNotLetterOrNumber(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
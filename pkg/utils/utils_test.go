@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -43,6 +44,25 @@ func TestParseAmount(t *testing.T) {
 		{"0.00345BTC", output{0.00345, "BTC"}},
 		{"200", output{200, ""}},
 		{"Hogwarts", output{0, ""}},
+		{"$12.50", output{12.5, "USD"}},
+		{"€1.200,50", output{1200.5, "EUR"}},
+		{"1,200.50 usd", output{1200.5, "USD"}},
+		{"1'000 CHF", output{1000, "CHF"}},
+		{"1,5 EUR", output{1.5, "EUR"}},
+		{"1.5k JPY", output{1500, "JPY"}},
+		{"2 million rub", output{2000000, "RUB"}},
+		{"3mn NGN", output{3000000, "NGN"}},
+		{"¥500", output{500, "JPY"}},
+		{"300 yen", output{300, "JPY"}},
+		{"S$5", output{5, "SGD"}},
+		{"HK$ 20", output{20, "HKD"}},
+		{"20 singapore dollars", output{20, "SGD"}},
+		{"5 bucks", output{5, "USD"}},
+		{"50 euros for 2 tickets", output{50, "EUR"}},
+		{"3 cupcakes", output{3, ""}},
+		{"12 small coffees", output{12, ""}},
+		{"10 all", output{10, ""}},
+		{"10 ALL", output{10, "ALL"}},
 	}
 
 	for _, test := range parseAmountTests {
@@ -52,6 +72,54 @@ func TestParseAmount(t *testing.T) {
 	}
 }
 
+func TestFindAmounts(t *testing.T) {
+	amounts := FindAmounts("20 usd or €30.50 for 2 tickets")
+	assert.Equal(t, []Amount{
+		{Value: 20, Currency: "USD", Start: 0, End: 6},
+		{Value: 30.5, Currency: "EUR", Start: 10, End: 18},
+		{Value: 2, Currency: "", Start: 23, End: 24},
+	}, amounts)
+
+	assert.Len(t, FindAmounts("lunch"), 0)
+}
+
+func TestParseCurrency(t *testing.T) {
+	var parseCurrencyTests = []struct {
+		input    string
+		expected string
+	}{
+		{"usd", "USD"},
+		{" EUR ", "EUR"},
+		{"€", "EUR"},
+		{"R$", "BRL"},
+		{"pounds", "GBP"},
+		{"Swiss Francs", "CHF"},
+		{"TRY", "TRY"},
+	}
+
+	for _, test := range parseCurrencyTests {
+		currency, err := ParseCurrency(test.input)
+		assert.NoError(t, err, test.input)
+		assert.Equal(t, test.expected, currency)
+	}
+
+	for _, input := range []string{"doubloons", "try", "20 usd", ""} {
+		_, err := ParseCurrency(input)
+		assert.EqualError(t, err, "invalid currency", input)
+	}
+}
+
+func TestCurrencyNames(t *testing.T) {
+	for _, iso := range CURRENCIES {
+		assert.NotEmpty(t, currencyNames[iso], iso)
+	}
+
+	for _, iso := range currencySymbols {
+		_, err := ParseISO(iso)
+		assert.NoError(t, err, iso)
+	}
+}
+
 func TestDateParser(t *testing.T) {
 	parser := &dateparser.Parser{}
 	date, _ := parser.Parse("2017/11/10")
@@ -64,10 +132,129 @@ func TestDateParser(t *testing.T) {
 		{"11/10/2017", date},
 	}
 
+	now := time.Date(2017, 11, 12, 0, 0, 0, 0, time.UTC)
 	for _, test := range parseDateTests {
-		result := ParseDate(test.input)
+		result := ParseDate(test.input, now)
 		assert.Equal(t, test.expected, result)
 	}
+
+	tokyo := time.FixedZone("UTC+9", 9*3600)
+	now = time.Date(2017, 11, 12, 8, 30, 0, 0, tokyo)
+	assert.Equal(t, time.Date(2017, 11, 11, 8, 30, 0, 0, tokyo), ParseDate("yesterday", now))
+	assert.Equal(t, time.Date(2017, 11, 10, 8, 30, 0, 0, tokyo), ParseDate("2017-11-10", now))
+}
+
+func TestParseRelativeDate(t *testing.T) {
+	// Sunday, November 12th 2017 in Tokyo
+	tokyo := time.FixedZone("UTC+9", 9*3600)
+	now := time.Date(2017, 11, 12, 8, 30, 0, 0, tokyo)
+	day := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 8, 30, 0, 0, tokyo)
+	}
+
+	var parseDateTests = []struct {
+		input    string
+		expected time.Time
+	}{
+		{"today", day(2017, 11, 12)},
+		{"Yesterday", day(2017, 11, 11)},
+		{"2 days ago", day(2017, 11, 10)},
+		{"a day ago", day(2017, 11, 11)},
+		{"3 weeks ago", day(2017, 10, 22)},
+		{"1 month ago", day(2017, 10, 12)},
+		{"friday", day(2017, 11, 10)},
+		{"last friday", day(2017, 11, 10)},
+		{"sunday", day(2017, 11, 12)},
+		{"last sunday", day(2017, 11, 5)},
+		{"on the 3rd", day(2017, 11, 3)},
+		{"the 20th", day(2017, 10, 20)},
+		{"the 31st", day(2017, 10, 31)},
+		{"March 14th", day(2017, 3, 14)},
+		{"mar 14, 2016", day(2016, 3, 14)},
+		{"14th of March", day(2017, 3, 14)},
+		{"25 dec", day(2016, 12, 25)},
+		{"february 30", now},
+		{"hello", now},
+	}
+
+	for _, test := range parseDateTests {
+		assert.Equal(t, test.expected, ParseDate(test.input, now), test.input)
+	}
+}
+
+func TestFindDate(t *testing.T) {
+	var findDateTests = []struct {
+		input    string
+		expected string
+		match    string
+	}{
+		{"20 usd for lunch yesterday", "yesterday", "yesterday"},
+		{"20 usd for lunch on Last Friday", "Last Friday", "on Last Friday"},
+		{"20 usd 2 days ago for lunch", "2 days ago", "2 days ago"},
+		{"spent 20 usd on the 3rd", "the 3rd", "on the 3rd"},
+		{"20 usd for tickets on march 14th #travel", "march 14th", "on march 14th"},
+		{"20 usd for lunch on 2017-11-10", "2017-11-10", "on 2017-11-10"},
+		{"20 usd for lunch", "", ""},
+	}
+
+	for _, test := range findDateTests {
+		date, start, end := FindDate(test.input)
+		assert.Equal(t, test.expected, date)
+		assert.Equal(t, test.match, test.input[start:end])
+	}
+}
+
+func TestParseWeekday(t *testing.T) {
+	var parseWeekdayTests = []struct {
+		input    string
+		expected time.Weekday
+	}{
+		{"sunday", time.Sunday},
+		{"Monday", time.Monday},
+		{" sat ", time.Saturday},
+		{"thurs", time.Thursday},
+	}
+
+	for _, test := range parseWeekdayTests {
+		result, err := ParseWeekday(test.input)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, result)
+	}
+
+	for _, input := range []string{"", "mo", "someday"} {
+		_, err := ParseWeekday(input)
+		assert.EqualError(t, err, "invalid weekday")
+	}
+}
+
+func TestParseTimezone(t *testing.T) {
+	var parseTimezoneTests = []struct {
+		input    string
+		expected string
+		offset   int
+	}{
+		{"UTC", "UTC", 0},
+		{"Asia/Singapore", "Asia/Singapore", 8 * 3600},
+		{"america/new_york", "America/New_York", -5 * 3600},
+		{"UTC+9", "UTC+9", 9 * 3600},
+		{"gmt -5:30", "UTC-5:30", -(5*3600 + 30*60)},
+		{"+08:00", "UTC+8", 8 * 3600},
+	}
+
+	winter := time.Date(2018, 1, 15, 0, 0, 0, 0, time.UTC)
+	for _, test := range parseTimezoneTests {
+		location, err := ParseTimezone(test.input)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, location.String())
+
+		_, offset := winter.In(location).Zone()
+		assert.Equal(t, test.offset, offset)
+	}
+
+	for _, input := range []string{"", "Local", "Mars/Olympus", "UTC+20"} {
+		_, err := ParseTimezone(input)
+		assert.EqualError(t, err, "invalid timezone")
+	}
 }
 
 func TestParseDescription(t *testing.T) {
@@ -84,3 +271,67 @@ func TestParseDescription(t *testing.T) {
 		assert.Equal(t, test.expected, result)
 	}
 }
+
+func TestParseCategory(t *testing.T) {
+	type output struct {
+		category string
+		text     string
+	}
+	var parseCategoryTests = []struct {
+		input    string
+		expected output
+	}{
+		{"lunch #food", output{"food", "lunch"}},
+		{"#Transport taxi to airport", output{"transport", "taxi to airport"}},
+		{"coffee #drinks!", output{"drinks", "coffee"}},
+		{"coffee #drinks #food", output{"drinks", "coffee #food"}},
+		{"coffee", output{"", "coffee"}},
+		{"coffee #", output{"", "coffee #"}},
+	}
+
+	for _, test := range parseCategoryTests {
+		category, text := ParseCategory(test.input)
+		assert.Equal(t, test.expected.category, category)
+		assert.Equal(t, test.expected.text, text)
+	}
+}
+
+func TestParseKeywords(t *testing.T) {
+	var parseKeywordsTests = []struct {
+		input    string
+		expected []string
+	}{
+		{"Lunch at McDonalds", []string{"lunch", "mcdonalds"}},
+		{"taxi, taxi to the airport", []string{"taxi", "the", "airport"}},
+		{"2 tickets", []string{"tickets"}},
+		{"a b", []string{}},
+	}
+
+	for _, test := range parseKeywordsTests {
+		result := ParseKeywords(test.input)
+		assert.Equal(t, test.expected, result)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	wait := func(attempt uint) time.Duration {
+		return time.Millisecond
+	}
+
+	t.Run("Waits between attempts", func(t *testing.T) {
+		ctx := context.Background()
+		shouldRetry := Backoff(ctx, wait)
+		assert.True(t, shouldRetry(0))
+		assert.True(t, shouldRetry(1))
+	})
+
+	t.Run("Stops retrying once the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		shouldRetry := Backoff(ctx, func(attempt uint) time.Duration {
+			return time.Hour
+		})
+		assert.True(t, shouldRetry(0))
+		assert.False(t, shouldRetry(1))
+	})
+}
@@ -0,0 +1,281 @@
+package wit
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/fmitra/dennis-bot/pkg/nlu"
+	"github.com/fmitra/dennis-bot/pkg/utils"
+)
+
+const (
+	// BackendWit parses every message with Wit.ai
+	BackendWit = "wit"
+
+	// BackendLocal parses every message with grammar rules, without network calls
+	BackendLocal = "local"
+
+	// BackendLocalFirst parses messages with grammar rules and falls back to
+	// Wit.ai for messages the rules do not understand
+	BackendLocalFirst = "local_first"
+)
+
+// localConfidence is the confidence of Entities inferred by a LocalParser.
+// Grammar rules either match or they don't.
+const localConfidence = 1.0
+
+// periodPattern matches the periods we accept for expense history, for example
+// "this week", "last 30 days" or "from march 1 to march 15".
+const periodPattern = `(today|yesterday|(?:this |last )?(?:week|month|year)|` +
+	`(?:last|past) \d+ days?|(?:from )?\S.*? (?:to|until) \S.*|since \S.*)`
+
+// localIntents map grammar rules to the value of a Wit.ai intent Entity. Rules
+// are checked in order.
+var localIntents = []struct {
+	rule   *regexp.Regexp
+	intent string
+}{
+	{regexp.MustCompile(`^(?:i )?(?:forgot|reset|recover) (?:my )?password$`), "reset_password"},
+	{regexp.MustCompile(`^(?:change|update) (?:my )?password$`), "change_password"},
+	{regexp.MustCompile(`^undo(?: (?:that|it|my last expense|last expense))?$`), "undo_expense"},
+	{regexp.MustCompile(`^(?:delete|remove) (?:an |a |my )?(?:recent )?expenses?$`), "delete_expense"},
+	{regexp.MustCompile(`^(?:edit|change|fix) (?:my |the )?last expense$`), "edit_expense"},
+	{regexp.MustCompile(`^(?:show |what are )?(?:me )?(?:my )?settings$`), "show_settings"},
+}
+
+// changeSettingRule matches a request to change a setting, optionally with the
+// new value, for example "change my currency to EUR".
+var changeSettingRule = regexp.MustCompile(
+	`(?i)^(?:change|set|update) (?:my )?(currency|timezone|time zone|week start)(?: to (.+))?$`,
+)
+
+// totalRule matches a request for expense totals, for example "how much did
+// I spend on food this week". The category is optional.
+var totalRule = regexp.MustCompile(
+	`^(?:how much (?:did|have) i (?:spend|spent)|how much i spent|total spent|spending)` +
+		`(?: (?:on|for|by) (.+?))?(?: in| during| for)?(?: the)? ` + periodPattern + `$`,
+)
+
+// listRule matches a request for an itemized list of expenses, for example
+// "list my expenses last week".
+var listRule = regexp.MustCompile(
+	`^(?:list|show)(?: me)?(?: all)?(?: my)? expenses(?: for| in| during)?(?: the)? ` + periodPattern + `$`,
+)
+
+// bareAmountRule matches the start of a message before an amount without a
+// currency, for example "20 for lunch" or "spent 20 on lunch". Amounts without
+// a currency are only tracked at the start of a message.
+var bareAmountRule = regexp.MustCompile(`(?i)^(?:(?:i )?(?:spent|paid) )?$`)
+
+// batchSeparator splits a message describing several expenses, for example
+// "200RUB for lunch, 50RUB for coffee". Commas must be followed by a space
+// so thousands separators such as "1,200RUB" are not split.
+var batchSeparator = regexp.MustCompile(`\s*(?:[;\n]|,\s)\s*`)
+
+// fillerWords are words around a description that do not describe an expense.
+var fillerWords = map[string]bool{
+	"i": true, "spent": true, "paid": true, "bought": true, "on": true, "for": true,
+	"track": true, "add": true,
+}
+
+// LocalParser infers context from a message with grammar rules instead of
+// Wit.ai. Messages never leave the bot and no network calls are made.
+type LocalParser struct{}
+
+// LocalParser may be used in place of the Wit.ai Client.
+var _ Wit = (*LocalParser)(nil)
+
+// NewLocalParser returns a LocalParser.
+func NewLocalParser() *LocalParser {
+	return &LocalParser{}
+}
+
+// NewBackend returns the configured NLU backend. Wit.ai is used
+// if no backend is configured.
+func NewBackend(backend, token string) (nlu.NLU, error) {
+	switch backend {
+	case BackendWit, "":
+		return NewClient(token), nil
+	case BackendLocal:
+		return NewLocalParser(), nil
+	case BackendLocalFirst:
+		return &nlu.Fallback{
+			Primary:  NewLocalParser(),
+			Fallback: NewClient(token),
+		}, nil
+	default:
+		return nil, errors.New("invalid backend")
+	}
+}
+
+// ParseMessage parses a message into a Response with the same Entities
+// Wit.ai would infer. An empty Response is returned if no grammar rules
+// match the message. Messages are parsed locally, so the context is unused.
+func (p *LocalParser) ParseMessage(ctx context.Context, message string) Response {
+	var response Response
+	response.Text = message
+
+	// Setting values such as timezones are case sensitive, so we only
+	// lower case the message after checking for a setting change
+	trimmedMessage := strings.TrimRight(strings.Join(strings.Fields(message), " "), "?!. ")
+	cleanMessage := strings.ToLower(trimmedMessage)
+
+	for _, localIntent := range localIntents {
+		if localIntent.rule.MatchString(cleanMessage) {
+			response.Entities.Intent = localEntity(localIntent.intent)
+			return response
+		}
+	}
+
+	if match := changeSettingRule.FindStringSubmatch(trimmedMessage); match != nil {
+		response.Entities.Intent = localEntity("change_setting")
+		response.Entities.Setting = localEntity(strings.ToLower(match[1]))
+		if match[2] != "" {
+			response.Entities.SettingValue = localEntity(match[2])
+		}
+		return response
+	}
+
+	if match := totalRule.FindStringSubmatch(cleanMessage); match != nil {
+		response.Entities.TotalSpent = localEntity(match[2])
+		if match[1] != "" {
+			response.Entities.Category = localEntity(match[1])
+		}
+		return response
+	}
+
+	if match := listRule.FindStringSubmatch(cleanMessage); match != nil {
+		response.Entities.ExpenseList = localEntity(match[1])
+		return response
+	}
+
+	if batch := parseLocalBatch(message); len(batch) > 1 {
+		response.Entities = batch[0].Entities
+		response.Batch = batch
+		return response
+	}
+
+	return parseLocalExpense(message)
+}
+
+// Parse parses a message with grammar rules and translates the Response
+// into an nlu.Message.
+func (p *LocalParser) Parse(ctx context.Context, message string) nlu.Message {
+	response := p.ParseMessage(ctx, message)
+	return response.ToMessage()
+}
+
+// parseLocalExpense parses a message describing a single expense. An empty
+// Response is returned if the message has no amount.
+func parseLocalExpense(message string) Response {
+	var response Response
+	response.Text = message
+
+	// Dates are removed before looking for amounts so the numbers
+	// in dates such as "2 days ago" are not mistaken for amounts
+	text := message
+	date, start, end := utils.FindDate(message)
+	if date != "" {
+		text = strings.TrimSpace(message[:start] + " " + message[end:])
+	}
+
+	amounts, text := parseLocalAmounts(text)
+	if len(amounts) == 0 {
+		return response
+	}
+
+	for _, amount := range amounts {
+		response.Entities.Amount = append(response.Entities.Amount, localEntity(amount)...)
+	}
+	if date != "" {
+		response.Entities.DateTime = localEntity(date)
+	}
+
+	if description := parseLocalDescription(text); description != "" {
+		response.Entities.Description = localEntity(description)
+	}
+
+	return response
+}
+
+// parseLocalBatch splits a message describing several expenses into
+// individual expenses, for example "200RUB for lunch, 50RUB for coffee".
+// Every part of the message must be an expense we can track on its own,
+// otherwise no expenses are returned.
+func parseLocalBatch(message string) []Response {
+	parts := batchSeparator.Split(strings.TrimSpace(message), -1)
+	if len(parts) < 2 {
+		return []Response{}
+	}
+
+	batch := make([]Response, len(parts))
+	for i, part := range parts {
+		batch[i] = parseLocalExpense(part)
+		isTracking := batch[i].GetMessageOverview() == TrackingRequestedSuccess
+		if !isTracking || len(batch[i].Entities.Amount) != 1 {
+			return []Response{}
+		}
+	}
+
+	return batch
+}
+
+// localEntity returns an Entity with a single value inferred by a LocalParser.
+func localEntity(value string) Entity {
+	entity := make(Entity, 1)
+	entity[0].Value = value
+	entity[0].Confidence = localConfidence
+	return entity
+}
+
+// parseLocalAmounts finds every amount with a currency in a message, or an
+// amount without a currency at the start of the message if there are none.
+// Amounts are returned along with the rest of the message.
+func parseLocalAmounts(message string) ([]string, string) {
+	var found []utils.Amount
+	for _, amount := range utils.FindAmounts(message) {
+		if amount.Currency != "" {
+			found = append(found, amount)
+		}
+	}
+
+	if len(found) == 0 {
+		for _, amount := range utils.FindAmounts(message) {
+			isSeparated := amount.End == len(message) || unicode.IsSpace(rune(message[amount.End]))
+			if isSeparated && bareAmountRule.MatchString(message[:amount.Start]) {
+				found = append(found, amount)
+			}
+		}
+	}
+
+	amounts := []string{}
+	text := ""
+	end := 0
+	for _, amount := range found {
+		value := strconv.FormatFloat(amount.Value, 'f', -1, 64)
+		amounts = append(amounts, value+amount.Currency)
+		text += message[end:amount.Start] + " "
+		end = amount.End
+	}
+
+	return amounts, text + message[end:]
+}
+
+// parseLocalDescription removes filler words around the description of an
+// expense, for example "spent on lunch" is described as "lunch".
+func parseLocalDescription(text string) string {
+	words := strings.Fields(strings.Trim(text, "?!., "))
+	for len(words) > 0 && fillerWords[strings.ToLower(words[0])] {
+		words = words[1:]
+	}
+
+	for len(words) > 0 && fillerWords[strings.ToLower(words[len(words)-1])] {
+		words = words[:len(words)-1]
+	}
+
+	return strings.Join(words, " ")
+}
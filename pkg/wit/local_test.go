@@ -0,0 +1,223 @@
+package wit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fmitra/dennis-bot/pkg/nlu"
+)
+
+func TestLocalParser(t *testing.T) {
+	ctx := context.Background()
+	parser := NewLocalParser()
+
+	t.Run("Returns unknown request for messages it does not understand", func(t *testing.T) {
+		response := parser.ParseMessage(ctx, "hello there")
+		assert.Equal(t, UnknownRequest, response.GetMessageOverview())
+		assert.Equal(t, "hello there", response.Text)
+	})
+
+	t.Run("Parses an expense", func(t *testing.T) {
+		response := parser.ParseMessage(ctx, "20SGD for lunch")
+		assert.Equal(t, TrackingRequestedSuccess, response.GetMessageOverview())
+
+		amount, currency, _ := response.GetAmount()
+		assert.Equal(t, 20.0, amount)
+		assert.Equal(t, "SGD", currency)
+
+		description, _ := response.GetDescription()
+		assert.Equal(t, "lunch", description)
+	})
+
+	t.Run("Parses an expense with the currency first", func(t *testing.T) {
+		response := parser.ParseMessage(ctx, "Spent usd 4.50 on Coffee")
+		amount, currency, _ := response.GetAmount()
+		assert.Equal(t, 4.5, amount)
+		assert.Equal(t, "USD", currency)
+
+		description, _ := response.GetDescription()
+		assert.Equal(t, "Coffee", description)
+	})
+
+	t.Run("Parses an expense with a date and category", func(t *testing.T) {
+		response := parser.ParseMessage(ctx, "paid 1000 rub for tickets yesterday #travel")
+		assert.Equal(t, TrackingRequestedSuccess, response.GetMessageOverview())
+		assert.Equal(t, "yesterday", response.Entities.DateTime[0].Value)
+
+		description, _ := response.GetDescription()
+		assert.Equal(t, "tickets", description)
+
+		category, _ := response.GetCategory()
+		assert.Equal(t, "travel", category)
+	})
+
+	t.Run("Parses an expense with a relative date", func(t *testing.T) {
+		message := parser.Parse(ctx, "2 days ago spent 20 on lunch")
+		assert.Equal(t, "2 days ago", message.Date)
+		assert.Equal(t, 20.0, message.Amount)
+		assert.Equal(t, "lunch", message.Description)
+
+		message = parser.Parse(ctx, "20 usd for tickets on march 14th")
+		assert.Equal(t, "march 14th", message.Date)
+		assert.Equal(t, "tickets", message.Description)
+		assert.False(t, message.Ambiguous)
+	})
+
+	t.Run("Parses a batch of expenses", func(t *testing.T) {
+		message := parser.Parse(ctx, "200RUB for lunch, 50RUB for coffee\n1,200RUB taxi yesterday")
+		assert.Equal(t, nlu.TrackExpense, message.Intent)
+		assert.False(t, message.Ambiguous)
+		assert.Len(t, message.Expenses, 3)
+		assert.Equal(t, "lunch", message.Expenses[0].Description)
+		assert.Equal(t, 50.0, message.Expenses[1].Amount)
+		assert.Equal(t, 1200.0, message.Expenses[2].Amount)
+		assert.Equal(t, "taxi", message.Expenses[2].Description)
+		assert.Equal(t, "yesterday", message.Expenses[2].Date)
+		assert.True(t, message.IsComplete())
+
+		message = parser.Parse(ctx, "spent 20 usd on coffee, bagel")
+		assert.False(t, message.IsBatch())
+		assert.Equal(t, "coffee, bagel", message.Description)
+	})
+
+	t.Run("Parses every amount in an expense", func(t *testing.T) {
+		response := parser.ParseMessage(ctx, "20 usd or 30 usd for lunch")
+		assert.Len(t, response.Entities.Amount, 2)
+
+		message := response.ToMessage()
+		assert.True(t, message.Ambiguous)
+	})
+
+	t.Run("Parses an expense with a currency symbol or name", func(t *testing.T) {
+		message := parser.Parse(ctx, "€1.200,50 for rent")
+		assert.Equal(t, 1200.5, message.Amount)
+		assert.Equal(t, "EUR", message.Currency)
+		assert.Equal(t, "rent", message.Description)
+
+		message = parser.Parse(ctx, "spent 1.5k yen on 3 cupcakes")
+		assert.Equal(t, 1500.0, message.Amount)
+		assert.Equal(t, "JPY", message.Currency)
+		assert.Equal(t, "3 cupcakes", message.Description)
+		assert.False(t, message.Ambiguous)
+	})
+
+	t.Run("Parses an expense without currency", func(t *testing.T) {
+		message := parser.Parse(ctx, "spent 20 on lunch")
+		assert.Equal(t, nlu.TrackExpense, message.Intent)
+		assert.Equal(t, 20.0, message.Amount)
+		assert.Equal(t, "", message.Currency)
+		assert.Equal(t, "lunch", message.Description)
+
+		message = parser.Parse(ctx, "lunch with 2 friends")
+		assert.Equal(t, nlu.Unknown, message.Intent)
+	})
+
+	t.Run("Returns tracking error for an expense without description", func(t *testing.T) {
+		response := parser.ParseMessage(ctx, "20 EUR")
+		assert.Equal(t, TrackingRequestedError, response.GetMessageOverview())
+	})
+
+	t.Run("Parses expense totals", func(t *testing.T) {
+		response := parser.ParseMessage(ctx, "How much did I spend this week?")
+		assert.Equal(t, ExpenseTotalRequestedSuccess, response.GetMessageOverview())
+
+		period, _ := response.GetSpendPeriod()
+		assert.Equal(t, "this week", period)
+
+		response = parser.ParseMessage(ctx, "how much did i spend from march 1 to march 15")
+		period, _ = response.GetSpendPeriod()
+		assert.Equal(t, "from march 1 to march 15", period)
+	})
+
+	t.Run("Parses category totals", func(t *testing.T) {
+		response := parser.ParseMessage(ctx, "how much did I spend on food last month")
+		assert.Equal(t, CategoryTotalRequestedSuccess, response.GetMessageOverview())
+
+		period, _ := response.GetSpendPeriod()
+		assert.Equal(t, "last month", period)
+
+		category, _ := response.GetSpendCategory()
+		assert.Equal(t, "food", category)
+
+		response = parser.ParseMessage(ctx, "how much did I spend by category this month")
+		category, _ = response.GetSpendCategory()
+		assert.Equal(t, AllCategories, category)
+	})
+
+	t.Run("Parses expense lists", func(t *testing.T) {
+		response := parser.ParseMessage(ctx, "list my expenses for the last 30 days")
+		assert.Equal(t, ExpenseListRequestedSuccess, response.GetMessageOverview())
+
+		period, _ := response.GetListPeriod()
+		assert.Equal(t, "last 30 days", period)
+	})
+
+	t.Run("Parses intents", func(t *testing.T) {
+		intents := map[string]string{
+			"undo":                 UndoRequested,
+			"Delete an expense":    DeleteRequested,
+			"edit my last expense": EditRequested,
+			"show my settings":     ShowSettingsRequested,
+			"change my password":   ChangePasswordRequested,
+			"I forgot my password": ResetPasswordRequested,
+		}
+
+		for message, overview := range intents {
+			response := parser.ParseMessage(ctx, message)
+			assert.Equal(t, overview, response.GetMessageOverview(), message)
+		}
+	})
+
+	t.Run("Parses a message", func(t *testing.T) {
+		message := parser.Parse(ctx, "paid 1000 rub for tickets yesterday #travel")
+		assert.Equal(t, nlu.Message{
+			Text:        "paid 1000 rub for tickets yesterday #travel",
+			Intent:      nlu.TrackExpense,
+			Amount:      1000,
+			Currency:    "RUB",
+			Date:        "yesterday",
+			Description: "tickets",
+			Category:    "travel",
+			Confidence:  1,
+		}, message)
+
+		message = parser.Parse(ctx, "hello there")
+		assert.Equal(t, nlu.Unknown, message.Intent)
+	})
+
+	t.Run("Parses setting changes", func(t *testing.T) {
+		response := parser.ParseMessage(ctx, "change my timezone to Asia/Tokyo")
+		assert.Equal(t, ChangeSettingRequested, response.GetMessageOverview())
+
+		setting, _ := response.GetSetting()
+		assert.Equal(t, "timezone", setting)
+
+		value, _ := response.GetSettingValue()
+		assert.Equal(t, "Asia/Tokyo", value)
+
+		response = parser.ParseMessage(ctx, "Change my currency")
+		setting, _ = response.GetSetting()
+		assert.Equal(t, "currency", setting)
+
+		_, err := response.GetSettingValue()
+		assert.Error(t, err)
+	})
+}
+
+func TestNewBackend(t *testing.T) {
+	t.Run("Returns configured backend", func(t *testing.T) {
+		backend, _ := NewBackend("", "witAiToken")
+		assert.IsType(t, &Client{}, backend)
+
+		backend, _ = NewBackend(BackendLocal, "witAiToken")
+		assert.IsType(t, &LocalParser{}, backend)
+
+		backend, _ = NewBackend(BackendLocalFirst, "witAiToken")
+		assert.IsType(t, &nlu.Fallback{}, backend)
+
+		_, err := NewBackend("rasa", "witAiToken")
+		assert.EqualError(t, err, "invalid backend")
+	})
+}
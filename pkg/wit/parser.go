@@ -2,9 +2,12 @@ package wit
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/fmitra/dennis-bot/pkg/nlu"
 	"github.com/fmitra/dennis-bot/pkg/utils"
 )
 
@@ -20,52 +23,229 @@ const (
 	// get a sum of their expense history
 	ExpenseTotalRequestedSuccess = "expense_total_requested_success"
 
+	// CategoryTotalRequestedSuccess indicates the user is attempting to get
+	// a sum of their expense history for one or all categories
+	CategoryTotalRequestedSuccess = "category_total_requested_success"
+
+	// ExpenseListRequestedSuccess indicates the user is attempting to get
+	// an itemized list of their expense history
+	ExpenseListRequestedSuccess = "expense_list_requested_success"
+
+	// AllCategories indicates the user is requesting a breakdown of expense
+	// history across every category rather than a single category
+	AllCategories = nlu.AllCategories
+
+	// UndoRequested indicates the user wants to remove their last tracked expense
+	UndoRequested = "undo_requested"
+
+	// DeleteRequested indicates the user wants to remove one of their recent expenses
+	DeleteRequested = "delete_requested"
+
+	// EditRequested indicates the user wants to change their last tracked expense
+	EditRequested = "edit_requested"
+
+	// ShowSettingsRequested indicates the user wants to see their settings
+	ShowSettingsRequested = "show_settings_requested"
+
+	// ChangeSettingRequested indicates the user wants to change one of their settings
+	ChangeSettingRequested = "change_setting_requested"
+
+	// ChangePasswordRequested indicates the user wants to change their password
+	ChangePasswordRequested = "change_password_requested"
+
+	// ResetPasswordRequested indicates the user forgot their password and wants
+	// to reset it with a recovery code
+	ResetPasswordRequested = "reset_password_requested"
+
 	// UnknownRequest indicates Wit.ai failed to infer context around a message
 	UnknownRequest = "unknown_request"
 )
 
-// Entity is an item Wit.ai inferred from a response.
-// All Entities have a Confidence property indicating an
-// estimate of Wit.ai's inference.
-type Entity []struct {
-	Value      string  `json:"value"`
-	Confidence float64 `json:"confidence"`
+// requestedIntents maps the value of a Wit.ai intent Entity to a
+// message overview. Intents are prioritized over inferring context
+// from the remaining Entities.
+var requestedIntents = map[string]string{
+	"undo_expense":    UndoRequested,
+	"delete_expense":  DeleteRequested,
+	"edit_expense":    EditRequested,
+	"show_settings":   ShowSettingsRequested,
+	"change_setting":  ChangeSettingRequested,
+	"change_password": ChangePasswordRequested,
+	"reset_password":  ResetPasswordRequested,
+}
+
+// overviewIntents maps a message overview to the intent of an nlu.Message.
+var overviewIntents = map[string]string{
+	TrackingRequestedSuccess:      nlu.TrackExpense,
+	TrackingRequestedError:        nlu.TrackExpense,
+	ExpenseTotalRequestedSuccess:  nlu.ExpenseTotal,
+	CategoryTotalRequestedSuccess: nlu.CategoryTotal,
+	ExpenseListRequestedSuccess:   nlu.ExpenseList,
+	UndoRequested:                 nlu.UndoExpense,
+	DeleteRequested:               nlu.DeleteExpense,
+	EditRequested:                 nlu.EditExpense,
+	ShowSettingsRequested:         nlu.ShowSettings,
+	ChangeSettingRequested:        nlu.ChangeSetting,
+	ChangePasswordRequested:       nlu.ChangePassword,
+	ResetPasswordRequested:        nlu.ResetPassword,
+}
+
+// Entity is an item Wit.ai inferred from a response. Wit.ai
+// may infer several candidate values for the same Entity.
+type Entity []EntityValue
+
+// EntityValue is a candidate value of an Entity. All values have a
+// Confidence property indicating an estimate of Wit.ai's inference.
+// Datetime values inferred as an interval provide From and To bounds
+// instead of a Value.
+type EntityValue struct {
+	Value      string      `json:"value"`
+	Confidence float64     `json:"confidence"`
+	Type       string      `json:"type"`
+	From       EntityBound `json:"from"`
+	To         EntityBound `json:"to"`
+}
+
+// EntityBound is one side of an interval Entity.
+type EntityBound struct {
+	Value string `json:"value"`
+}
+
+// Best returns the value Wit.ai is most confident in. The first value
+// is returned if several values are equally likely.
+func (e Entity) Best() EntityValue {
+	best := e[0]
+	for _, value := range e[1:] {
+		if value.Confidence > best.Confidence {
+			best = value
+		}
+	}
+
+	return best
 }
 
 // Response is a a Response from Wit.ai containing a payload of Entities.
 type Response struct {
+	Text     string `json:"_text"`
 	Entities struct {
-		Amount      Entity `json:"amount"`
-		DateTime    Entity `json:"datetime"`
-		Description Entity `json:"description"`
-		TotalSpent  Entity `json:"total_spent"`
+		Amount       Entity `json:"amount"`
+		DateTime     Entity `json:"datetime"`
+		Description  Entity `json:"description"`
+		TotalSpent   Entity `json:"total_spent"`
+		ExpenseList  Entity `json:"expense_list"`
+		Category     Entity `json:"category"`
+		Intent       Entity `json:"intent"`
+		Setting      Entity `json:"setting"`
+		SettingValue Entity `json:"setting_value"`
 	} `json:"entities"`
+
+	// Batch holds the individual expenses of a message describing several
+	// expenses, for example "200RUB for lunch, 50RUB for coffee"
+	Batch []Response `json:"-"`
+}
+
+// GetBatch returns the individual expenses of a message describing several
+// expenses. Wit.ai infers an amount and description for each expense, so
+// amounts are paired with descriptions in order. Messages with a single
+// expense, or with expenses we can't track, return no expenses.
+func (r *Response) GetBatch() []Response {
+	if len(r.Batch) > 1 {
+		return r.Batch
+	}
+
+	amounts := r.Entities.Amount
+	descriptions := r.Entities.Description
+	if len(amounts) < 2 || len(amounts) != len(descriptions) {
+		return []Response{}
+	}
+
+	batch := make([]Response, len(amounts))
+	for i := range amounts {
+		batch[i].Text = r.Text
+		batch[i].Entities.Amount = Entity{amounts[i]}
+		batch[i].Entities.Description = Entity{descriptions[i]}
+		batch[i].Entities.DateTime = r.Entities.DateTime
+		if batch[i].GetMessageOverview() != TrackingRequestedSuccess {
+			return []Response{}
+		}
+	}
+
+	return batch
 }
 
 // GetSpendPeriod returns the spending period a user requested, for example,
-// a user may be interested in one `month` of spending history.
+// a user may be interested in one `month` of spending history. If Wit.ai
+// inferred a datetime interval, for example "from march 1 to march 15",
+// an explicit range is returned instead.
 func (r *Response) GetSpendPeriod() (string, error) {
 	totalSpent := r.Entities.TotalSpent
 	if len(totalSpent) == 0 {
 		return "", errors.New("no period specified")
 	}
 
-	return totalSpent[0].Value, nil
+	dateRange, err := r.GetDateRange()
+	if err == nil {
+		return dateRange, nil
+	}
+
+	return totalSpent.Best().Value, nil
+}
+
+// GetDateRange returns a datetime interval inferred by Wit.ai as a range of
+// days, for example "2018-03-01 to 2018-03-15". Wit.ai intervals exclude
+// their upper bound, while our ranges include the last day.
+func (r *Response) GetDateRange() (string, error) {
+	dateTime := r.Entities.DateTime
+	if len(dateTime) == 0 || dateTime.Best().Type != "interval" {
+		return "", errors.New("no date range")
+	}
+
+	dayFormat := "2006-01-02"
+	interval := dateTime.Best()
+	from, fromErr := time.Parse(time.RFC3339, interval.From.Value)
+	to, toErr := time.Parse(time.RFC3339, interval.To.Value)
+
+	switch {
+	case fromErr == nil && toErr == nil:
+		lastDay := to.Add(-time.Nanosecond)
+		return fmt.Sprintf("%s to %s", from.Format(dayFormat), lastDay.Format(dayFormat)), nil
+	case fromErr == nil:
+		return fmt.Sprintf("since %s", from.Format(dayFormat)), nil
+	default:
+		return "", errors.New("no date range")
+	}
 }
 
-// GetAmount returns the total amount a user is trying to track.
+// GetListPeriod returns the period a user requested an itemized list of
+// expenses for, for example, a user may want to see one `week` of expenses.
+func (r *Response) GetListPeriod() (string, error) {
+	expenseList := r.Entities.ExpenseList
+	if len(expenseList) == 0 {
+		return "", errors.New("no period specified")
+	}
+
+	return expenseList.Best().Value, nil
+}
+
+// GetAmount returns the total amount a user is trying to track. Amounts
+// without a currency are returned along with an error, so the user may
+// be asked for the currency.
 func (r *Response) GetAmount() (float64, string, error) {
 	amount := r.Entities.Amount
 	if len(amount) == 0 {
 		return 0, "", errors.New("no amount")
 	}
 
-	totalAmount, currency := utils.ParseAmount(amount[0].Value)
+	totalAmount, currency := utils.ParseAmount(amount.Best().Value)
 
 	if totalAmount > 0 && currency != "" {
 		return totalAmount, currency, nil
 	}
 
+	if totalAmount > 0 {
+		return totalAmount, "", errors.New("no currency")
+	}
+
 	return 0, "", errors.New("invalid amount")
 }
 
@@ -76,30 +256,116 @@ func (r *Response) GetDescription() (string, error) {
 		return "", errors.New("no description")
 	}
 
-	parsedDescription := utils.ParseDescription(description[0].Value)
+	// Category tags are not part of the description
+	_, text := utils.ParseCategory(description.Best().Value)
+	parsedDescription := utils.ParseDescription(text)
+	if parsedDescription == "" {
+		return "", errors.New("no description")
+	}
+
 	return parsedDescription, nil
 }
 
-// GetDate returns the date of an expense. If no date is provided,
-// we default to today.
-func (r *Response) GetDate() time.Time {
+// GetCategory returns the category of an expense. A category may be inferred
+// by Wit.ai or explicitly tagged by the user, for example "20SGD for lunch #food".
+func (r *Response) GetCategory() (string, error) {
+	category := r.Entities.Category
+	if len(category) != 0 && category.Best().Value != "" {
+		return strings.ToLower(category.Best().Value), nil
+	}
+
+	taggedCategory, _ := utils.ParseCategory(r.Text)
+	if taggedCategory != "" {
+		return taggedCategory, nil
+	}
+
+	description := r.Entities.Description
+	if len(description) != 0 {
+		taggedCategory, _ = utils.ParseCategory(description.Best().Value)
+	}
+
+	if taggedCategory != "" {
+		return taggedCategory, nil
+	}
+
+	return "", errors.New("no category")
+}
+
+// GetSpendCategory returns the category a user requested expense history
+// for. Requests for a breakdown of all categories return AllCategories.
+func (r *Response) GetSpendCategory() (string, error) {
+	category, err := r.GetCategory()
+	if err != nil {
+		return "", err
+	}
+
+	switch category {
+	case AllCategories, "category", "categories", "each category", "every category":
+		return AllCategories, nil
+	default:
+		return category, nil
+	}
+}
+
+// GetDate returns the date of an expense relative to the current time.
+// If no date is provided, we default to today.
+func (r *Response) GetDate(now time.Time) time.Time {
 	dateTime := r.Entities.DateTime
 	stringDate := ""
 	if len(dateTime) != 0 {
-		stringDate = dateTime[0].Value
+		stringDate = dateTime.Best().Value
 	}
 
-	parsedDate := utils.ParseDate(stringDate)
+	parsedDate := utils.ParseDate(stringDate, now)
 	return parsedDate
 }
 
+// GetIntent returns the intent Wit.ai inferred from a message, for example
+// a user may be trying to `undo_expense`.
+func (r *Response) GetIntent() (string, error) {
+	intent := r.Entities.Intent
+	if len(intent) == 0 || intent.Best().Value == "" {
+		return "", errors.New("no intent")
+	}
+
+	return strings.ToLower(intent.Best().Value), nil
+}
+
+// GetSetting returns the setting a user wants to change, for example
+// a user may want to change their `currency`.
+func (r *Response) GetSetting() (string, error) {
+	setting := r.Entities.Setting
+	if len(setting) == 0 || setting.Best().Value == "" {
+		return "", errors.New("no setting")
+	}
+
+	return strings.ToLower(setting.Best().Value), nil
+}
+
+// GetSettingValue returns the new value of the setting a user wants to
+// change, for example `EUR`.
+func (r *Response) GetSettingValue() (string, error) {
+	settingValue := r.Entities.SettingValue
+	if len(settingValue) == 0 || settingValue.Best().Value == "" {
+		return "", errors.New("no setting value")
+	}
+
+	return settingValue.Best().Value, nil
+}
+
 // IsTracking infers whether the user is trying to track an expense.
+// Users are tracking an expense as long as they provide an amount.
 func (r Response) IsTracking() (bool, error) {
-	_, _, err := r.GetAmount()
-	if err != nil {
+	amount, _, err := r.GetAmount()
+	if amount == 0 {
 		return false, err
 	}
 
+	if err != nil {
+		log.Printf("wit: cannot infer tracking without currency")
+		return true, err
+	}
+
 	_, err = r.GetDescription()
 	if err != nil {
 		log.Printf("wit: cannot infer tracking without description")
@@ -121,9 +387,25 @@ func (r Response) IsRequestingTotal() (bool, error) {
 	return true, nil
 }
 
+// IsRequestingList infers whether the user is requesting an itemized
+// list of their expense history.
+func (r Response) IsRequestingList() (bool, error) {
+	_, err := r.GetListPeriod()
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
 // GetMessageOverview returns a a description of what Wit.ai
 // inferred from a user's message.
 func (r Response) GetMessageOverview() string {
+	intent, _ := r.GetIntent()
+	if overview, ok := requestedIntents[intent]; ok {
+		return overview
+	}
+
 	isTracking, trackingErr := r.IsTracking()
 	isRequestingTotal, totalErr := r.IsRequestingTotal()
 
@@ -131,9 +413,81 @@ func (r Response) GetMessageOverview() string {
 		return TrackingRequestedError
 	} else if isTracking && trackingErr == nil {
 		return TrackingRequestedSuccess
+	}
+
+	isRequestingList, _ := r.IsRequestingList()
+	if isRequestingList {
+		return ExpenseListRequestedSuccess
+	}
+
+	_, categoryErr := r.GetSpendCategory()
+	if isRequestingTotal && totalErr == nil && categoryErr == nil {
+		return CategoryTotalRequestedSuccess
 	} else if isRequestingTotal && totalErr == nil {
 		return ExpenseTotalRequestedSuccess
 	}
 
 	return UnknownRequest
 }
+
+// ToMessage translates a Response into a backend neutral nlu.Message.
+// Only the Entities relevant to the inferred intent are kept.
+func (r Response) ToMessage() nlu.Message {
+	message := nlu.Message{Text: r.Text, Intent: nlu.Unknown}
+	intent, ok := overviewIntents[r.GetMessageOverview()]
+	if !ok {
+		return message
+	}
+
+	message.Intent = intent
+	entities := r.Entities
+	switch intent {
+	case nlu.TrackExpense:
+		if batch := r.GetBatch(); len(batch) != 0 {
+			message.Confidence = 1.0
+			for _, expense := range batch {
+				expenseMessage := expense.ToMessage()
+				message.Expenses = append(message.Expenses, expenseMessage)
+				if expenseMessage.Confidence < message.Confidence {
+					message.Confidence = expenseMessage.Confidence
+				}
+			}
+			break
+		}
+
+		message.Amount, message.Currency, _ = r.GetAmount()
+		message.Description, _ = r.GetDescription()
+		message.Category, _ = r.GetCategory()
+		if len(entities.DateTime) != 0 {
+			message.Date = entities.DateTime.Best().Value
+		}
+		message.Confidence = getConfidence(entities.Amount, entities.Description, entities.DateTime)
+		message.Ambiguous = len(entities.Amount) > 1 || len(entities.DateTime) > 1
+	case nlu.ExpenseTotal, nlu.CategoryTotal:
+		message.Period, _ = r.GetSpendPeriod()
+		message.Category, _ = r.GetSpendCategory()
+		message.Confidence = getConfidence(entities.TotalSpent, entities.Category)
+	case nlu.ExpenseList:
+		message.Period, _ = r.GetListPeriod()
+		message.Confidence = getConfidence(entities.ExpenseList)
+	default:
+		message.Setting, _ = r.GetSetting()
+		message.SettingValue, _ = r.GetSettingValue()
+		message.Confidence = getConfidence(entities.Intent)
+	}
+
+	return message
+}
+
+// getConfidence returns the lowest confidence of the Entities an inference
+// was based on. Entities that were not inferred are ignored.
+func getConfidence(entities ...Entity) float64 {
+	confidence := 1.0
+	for _, entity := range entities {
+		if len(entity) != 0 && entity.Best().Confidence < confidence {
+			confidence = entity.Best().Confidence
+		}
+	}
+
+	return confidence
+}
@@ -7,6 +7,8 @@ import (
 
 	"github.com/kierdavis/dateparser"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/fmitra/dennis-bot/pkg/nlu"
 )
 
 func getResponse(b []byte) Response {
@@ -105,9 +107,12 @@ func TestWitParser(t *testing.T) {
 		`))
 
 		amount, currency, err := response.GetAmount()
-		assert.Equal(t, 0.0, amount)
+		assert.Equal(t, 20.0, amount)
 		assert.Equal(t, "", currency)
-		assert.EqualError(t, err, "invalid amount")
+		assert.EqualError(t, err, "no currency")
+
+		overview := response.GetMessageOverview()
+		assert.Equal(t, TrackingRequestedError, overview)
 	})
 
 	t.Run("Returns description", func(t *testing.T) {
@@ -158,7 +163,8 @@ func TestWitParser(t *testing.T) {
 			}
 		`))
 
-		date := response.GetDate()
+		now := time.Date(2018, 10, 12, 0, 0, 0, 0, time.UTC)
+		date := response.GetDate(now)
 		assert.Equal(t, expectedDate, date)
 	})
 
@@ -173,8 +179,9 @@ func TestWitParser(t *testing.T) {
 			}
 		`))
 
-		date := response.GetDate()
-		assert.IsType(t, time.Time{}, date)
+		now := time.Date(2018, 10, 12, 8, 30, 0, 0, time.UTC)
+		date := response.GetDate(now)
+		assert.Equal(t, now, date)
 	})
 
 	t.Run("Infers tracking", func(t *testing.T) {
@@ -297,6 +304,260 @@ func TestWitParser(t *testing.T) {
 		assert.Equal(t, ExpenseTotalRequestedSuccess, overview)
 	})
 
+	t.Run("Returns date range as period", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"entities": {
+					"datetime": [
+						{
+							"type": "interval",
+							"confidence": 100.00,
+							"from": { "value": "2018-03-01T00:00:00.000-07:00" },
+							"to": { "value": "2018-03-16T00:00:00.000-07:00" }
+						}
+					],
+					"total_spent": [
+						{ "value": "range", "confidence": 100.00 }
+					]
+				}
+			}
+		`))
+
+		period, err := response.GetSpendPeriod()
+		assert.NoError(t, err)
+		assert.Equal(t, "2018-03-01 to 2018-03-15", period)
+	})
+
+	t.Run("Returns open date range as period", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"entities": {
+					"datetime": [
+						{
+							"type": "interval",
+							"confidence": 100.00,
+							"from": { "value": "2018-03-01T00:00:00.000-07:00" }
+						}
+					],
+					"total_spent": [
+						{ "value": "range", "confidence": 100.00 }
+					]
+				}
+			}
+		`))
+
+		period, err := response.GetSpendPeriod()
+		assert.NoError(t, err)
+		assert.Equal(t, "since 2018-03-01", period)
+	})
+
+	t.Run("Returns description without category tag", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"entities": {
+					"amount": [],
+					"datetime": [],
+					"description": [
+						{ "value": "for Lunch #food", "confidence": 100.00 }
+					]
+				}
+			}
+		`))
+
+		description, _ := response.GetDescription()
+		assert.Equal(t, "Lunch", description)
+	})
+
+	t.Run("Returns category", func(t *testing.T) {
+		var testCases = []struct {
+			input    string
+			expected string
+		}{
+			{`{"entities": {"category": [{ "value": "Food", "confidence": 100.00 }]}}`, "food"},
+			{`{"_text": "20SGD for lunch #food", "entities": {}}`, "food"},
+			{`{"entities": {"description": [{ "value": "lunch #food", "confidence": 100.00 }]}}`, "food"},
+		}
+
+		for _, test := range testCases {
+			response := getResponse([]byte(test.input))
+			category, err := response.GetCategory()
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, category)
+		}
+	})
+
+	t.Run("Returns error if category is blank", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"_text": "20SGD for lunch",
+				"entities": {
+					"description": [
+						{ "value": "lunch", "confidence": 100.00 }
+					]
+				}
+			}
+		`))
+
+		category, err := response.GetCategory()
+		assert.Equal(t, "", category)
+		assert.EqualError(t, err, "no category")
+	})
+
+	t.Run("Returns spend category", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"entities": {
+					"category": [
+						{ "value": "categories", "confidence": 100.00 }
+					]
+				}
+			}
+		`))
+
+		category, _ := response.GetSpendCategory()
+		assert.Equal(t, AllCategories, category)
+	})
+
+	t.Run("Returns category total success", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"entities": {
+					"amount": [],
+					"datetime": [],
+					"description": [],
+					"total_spent": [
+						{ "value": "month", "confidence": 100.00 }
+					],
+					"category": [
+						{ "value": "food", "confidence": 100.00 }
+					]
+				}
+			}
+		`))
+
+		overview := response.GetMessageOverview()
+		assert.Equal(t, CategoryTotalRequestedSuccess, overview)
+	})
+
+	t.Run("Returns list period", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"entities": {
+					"expense_list": [
+						{ "value": "week", "confidence": 100.00 }
+					]
+				}
+			}
+		`))
+
+		period, err := response.GetListPeriod()
+		assert.NoError(t, err)
+		assert.Equal(t, "week", period)
+	})
+
+	t.Run("Returns expense list success", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"entities": {
+					"amount": [],
+					"datetime": [],
+					"description": [],
+					"expense_list": [
+						{ "value": "week", "confidence": 100.00 }
+					]
+				}
+			}
+		`))
+
+		overview := response.GetMessageOverview()
+		assert.Equal(t, ExpenseListRequestedSuccess, overview)
+	})
+
+	t.Run("Returns intent", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"entities": {
+					"intent": [
+						{ "value": "Undo_Expense", "confidence": 100.00 }
+					]
+				}
+			}
+		`))
+
+		intent, err := response.GetIntent()
+		assert.NoError(t, err)
+		assert.Equal(t, "undo_expense", intent)
+
+		response = getResponse([]byte(`{ "entities": {} }`))
+		_, err = response.GetIntent()
+		assert.EqualError(t, err, "no intent")
+	})
+
+	t.Run("Returns setting change", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"entities": {
+					"intent": [
+						{ "value": "change_setting", "confidence": 100.00 }
+					],
+					"setting": [
+						{ "value": "Currency", "confidence": 100.00 }
+					],
+					"setting_value": [
+						{ "value": "EUR", "confidence": 100.00 }
+					]
+				}
+			}
+		`))
+
+		setting, err := response.GetSetting()
+		assert.NoError(t, err)
+		assert.Equal(t, "currency", setting)
+
+		value, err := response.GetSettingValue()
+		assert.NoError(t, err)
+		assert.Equal(t, "EUR", value)
+
+		assert.Equal(t, ChangeSettingRequested, response.GetMessageOverview())
+
+		response = getResponse([]byte(`{ "entities": {} }`))
+		_, err = response.GetSetting()
+		assert.EqualError(t, err, "no setting")
+		_, err = response.GetSettingValue()
+		assert.EqualError(t, err, "no setting value")
+	})
+
+	t.Run("Returns requested intent over entities", func(t *testing.T) {
+		var testCases = []struct {
+			intent   string
+			expected string
+		}{
+			{"undo_expense", UndoRequested},
+			{"delete_expense", DeleteRequested},
+			{"edit_expense", EditRequested},
+		}
+
+		for _, test := range testCases {
+			response := getResponse([]byte(`
+				{
+					"entities": {
+						"amount": [
+							{ "value": "20 USD", "confidence": 100.00 }
+						],
+						"description": [
+							{ "value": "Food", "confidence": 100.00 }
+						],
+						"intent": [
+							{ "value": "` + test.intent + `", "confidence": 100.00 }
+						]
+					}
+				}
+			`))
+
+			assert.Equal(t, test.expected, response.GetMessageOverview())
+		}
+	})
+
 	t.Run("Returns unknown intent", func(t *testing.T) {
 		response := getResponse([]byte(`
 			{
@@ -312,4 +573,158 @@ func TestWitParser(t *testing.T) {
 		overview := response.GetMessageOverview()
 		assert.Equal(t, UnknownRequest, overview)
 	})
+
+	t.Run("Translates expense into message", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"_text": "20 USD for Food yesterday #lunch",
+				"entities": {
+					"amount": [
+						{ "value": "20 USD", "confidence": 0.95 }
+					],
+					"datetime": [
+						{ "value": "yesterday", "confidence": 0.80 }
+					],
+					"description": [
+						{ "value": "Food", "confidence": 0.90 }
+					]
+				}
+			}
+		`))
+
+		message := response.ToMessage()
+		assert.Equal(t, nlu.Message{
+			Text:        "20 USD for Food yesterday #lunch",
+			Intent:      nlu.TrackExpense,
+			Amount:      20,
+			Currency:    "USD",
+			Date:        "yesterday",
+			Description: "Food",
+			Category:    "lunch",
+			Confidence:  0.80,
+		}, message)
+	})
+
+	t.Run("Returns most confident value", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"entities": {
+					"amount": [
+						{ "value": "20 USD", "confidence": 0.40 },
+						{ "value": "200 USD", "confidence": 0.55 }
+					],
+					"description": [
+						{ "value": "Food", "confidence": 0.90 }
+					]
+				}
+			}
+		`))
+
+		amount, _, _ := response.GetAmount()
+		assert.Equal(t, 200.0, amount)
+
+		message := response.ToMessage()
+		assert.Equal(t, 0.55, message.Confidence)
+		assert.True(t, message.Ambiguous)
+	})
+
+	t.Run("Translates batch of expenses into message", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"_text": "200RUB for lunch, 50RUB for coffee",
+				"entities": {
+					"amount": [
+						{ "value": "200RUB", "confidence": 0.95 },
+						{ "value": "50RUB", "confidence": 0.90 }
+					],
+					"description": [
+						{ "value": "lunch", "confidence": 0.90 },
+						{ "value": "coffee", "confidence": 0.85 }
+					]
+				}
+			}
+		`))
+
+		assert.Len(t, response.GetBatch(), 2)
+
+		message := response.ToMessage()
+		assert.True(t, message.IsBatch())
+		assert.False(t, message.Ambiguous)
+		assert.Equal(t, 0.85, message.Confidence)
+		assert.Equal(t, 200.0, message.Expenses[0].Amount)
+		assert.Equal(t, "lunch", message.Expenses[0].Description)
+		assert.Equal(t, 50.0, message.Expenses[1].Amount)
+		assert.Equal(t, "coffee", message.Expenses[1].Description)
+	})
+
+	t.Run("Returns no batch for unpaired amounts", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"entities": {
+					"amount": [
+						{ "value": "20 USD", "confidence": 0.40 },
+						{ "value": "200", "confidence": 0.55 }
+					],
+					"description": [
+						{ "value": "Food", "confidence": 0.90 },
+						{ "value": "Drinks", "confidence": 0.90 }
+					]
+				}
+			}
+		`))
+
+		assert.Len(t, response.GetBatch(), 0)
+		assert.False(t, response.ToMessage().IsBatch())
+	})
+
+	t.Run("Translates period into message", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"entities": {
+					"total_spent": [
+						{ "value": "week", "confidence": 0.70 }
+					],
+					"category": [
+						{ "value": "Food", "confidence": 0.90 }
+					]
+				}
+			}
+		`))
+
+		message := response.ToMessage()
+		assert.Equal(t, nlu.CategoryTotal, message.Intent)
+		assert.Equal(t, "week", message.Period)
+		assert.Equal(t, "food", message.Category)
+		assert.Equal(t, 0.70, message.Confidence)
+	})
+
+	t.Run("Translates setting change into message", func(t *testing.T) {
+		response := getResponse([]byte(`
+			{
+				"entities": {
+					"intent": [
+						{ "value": "change_setting", "confidence": 0.99 }
+					],
+					"setting": [
+						{ "value": "Currency", "confidence": 0.99 }
+					],
+					"setting_value": [
+						{ "value": "EUR", "confidence": 0.99 }
+					]
+				}
+			}
+		`))
+
+		message := response.ToMessage()
+		assert.Equal(t, nlu.ChangeSetting, message.Intent)
+		assert.Equal(t, "currency", message.Setting)
+		assert.Equal(t, "EUR", message.SettingValue)
+	})
+
+	t.Run("Translates unknown intent into message", func(t *testing.T) {
+		response := getResponse([]byte(`{ "_text": "hello" }`))
+
+		message := response.ToMessage()
+		assert.Equal(t, nlu.Message{Text: "hello", Intent: nlu.Unknown}, message)
+	})
 }
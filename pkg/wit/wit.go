@@ -3,6 +3,7 @@
 package wit
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -14,6 +15,9 @@ import (
 	"github.com/Rican7/retry"
 	"github.com/Rican7/retry/backoff"
 	"github.com/Rican7/retry/strategy"
+
+	"github.com/fmitra/dennis-bot/pkg/nlu"
+	"github.com/fmitra/dennis-bot/pkg/utils"
 )
 
 const (
@@ -27,7 +31,7 @@ const (
 // Wit is an itnerface to provide utility methods to interact with
 // the Wit.ai API.
 type Wit interface {
-	ParseMessage(message string) Response
+	ParseMessage(ctx context.Context, message string) Response
 }
 
 // Client is a consumer of the Wit.ai API.
@@ -49,8 +53,8 @@ func NewClient(token string) *Client {
 // ParseMessage passes a message to Wit.ai to infer context, for example,
 // Wit.ai may infer that the user is trying to track an expense.
 // Any error from Wit.ai is simply handled as an empty Response indicating,
-// we are not able to infer anything.
-func (c *Client) ParseMessage(message string) Response {
+// we are not able to infer anything. Retries stop once the context is done.
+func (c *Client) ParseMessage(ctx context.Context, message string) Response {
 	var response Response
 
 	witBaseURL := fmt.Sprintf("%s/message?v=%s", c.BaseURL, c.APIVersion)
@@ -65,7 +69,7 @@ func (c *Client) ParseMessage(message string) Response {
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.Token))
 	request := func(attempt uint) error {
 		client := &http.Client{}
-		resp, err := client.Do(req)
+		resp, err := client.Do(req.WithContext(ctx))
 		if err != nil {
 			return err
 		}
@@ -84,7 +88,7 @@ func (c *Client) ParseMessage(message string) Response {
 	err = retry.Retry(
 		request,
 		strategy.Limit(10),
-		strategy.Backoff(backoff.Exponential(time.Second, 2)),
+		utils.Backoff(ctx, backoff.Exponential(time.Second, 2)),
 	)
 
 	if err != nil {
@@ -93,3 +97,10 @@ func (c *Client) ParseMessage(message string) Response {
 
 	return response
 }
+
+// Parse passes a message to Wit.ai and translates the Response into
+// an nlu.Message.
+func (c *Client) Parse(ctx context.Context, message string) nlu.Message {
+	response := c.ParseMessage(ctx, message)
+	return response.ToMessage()
+}
@@ -1,6 +1,7 @@
 package wit
 
 import (
+	"context"
 	"testing"
 
 	mocks "github.com/fmitra/dennis-bot/test"
@@ -38,7 +39,7 @@ func TestWit(t *testing.T) {
 			APIVersion: "20180128",
 		}
 
-		response := witAi.ParseMessage("Hello world")
+		response := witAi.ParseMessage(context.Background(), "Hello world")
 		assert.IsType(t, Response{}, response)
 	})
 
@@ -52,7 +53,7 @@ func TestWit(t *testing.T) {
 			APIVersion: "20180128",
 		}
 
-		response := witAi.ParseMessage("Hello world")
+		response := witAi.ParseMessage(context.Background(), "Hello world")
 		assert.Equal(t, Response{}, response)
 	})
 }
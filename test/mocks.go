@@ -2,6 +2,7 @@
 package mocks
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -18,6 +19,7 @@ type TelegramMock struct {
 		Send       int
 		SendAction int
 	}
+	SendStatus int // Status code returned by Send, 200 if unset
 }
 
 // SessionMock mocks Session package.
@@ -25,43 +27,53 @@ type SessionMock struct {
 	Calls struct {
 		Get    int
 		Set    int
+		SetNX  int
 		Delete int
 	}
 }
 
 // Set mocks Session Set.
-func (s *SessionMock) Set(cacheKey string, v interface{}, timeInSeconds int) {
+func (s *SessionMock) Set(ctx context.Context, cacheKey string, v interface{}, timeInSeconds int) {
 	s.Calls.Set++
 }
 
+// SetNX mocks Session SetNX.
+func (s *SessionMock) SetNX(ctx context.Context, cacheKey string, v interface{}, timeInSeconds int) (bool, error) {
+	s.Calls.SetNX++
+	return true, nil
+}
+
 // Delete mocks Session Delete.
-func (s *SessionMock) Delete(cacheKey string) error {
+func (s *SessionMock) Delete(ctx context.Context, cacheKey string) error {
 	s.Calls.Delete++
 	return nil
 }
 
 // Get mocks Session Get.
-func (s *SessionMock) Get(cacheKey string, v interface{}) error {
+func (s *SessionMock) Get(ctx context.Context, cacheKey string, v interface{}) error {
 	s.Calls.Get++
 	return nil
 }
 
 // SetWebhook mocks Telegram SetWebhook.
-func (t *TelegramMock) SetWebhook() int {
+func (t *TelegramMock) SetWebhook(ctx context.Context) (int, error) {
 	t.Calls.SetWebhook++
 	statusCode := 200
-	return statusCode
+	return statusCode, nil
 }
 
 // Send mocks Telegram Send.
-func (t *TelegramMock) Send(chatID int, message string) int {
+func (t *TelegramMock) Send(ctx context.Context, chatID int, message string) int {
 	t.Calls.Send++
 	statusCode := 200
+	if t.SendStatus != 0 {
+		statusCode = t.SendStatus
+	}
 	return statusCode
 }
 
 // SendAction mocks Telegram SendAction.
-func (t *TelegramMock) SendAction(chatID int, action string) int {
+func (t *TelegramMock) SendAction(ctx context.Context, chatID int, action string) int {
 	t.Calls.SendAction++
 	statusCode := 200
 	return statusCode
@@ -121,6 +133,12 @@ var MessageMapMock = map[string][]string{
 	"default": []string{
 		"This is a default message",
 	},
+	"confirmation_invalid": []string{
+		"Please say yes or no",
+	},
+	"conversation_cancelled": []string{
+		"Ok, never mind",
+	},
 	"get_expense_total_invalid_period": []string{
 		"Whoops!",
 	},
@@ -130,6 +148,9 @@ var MessageMapMock = map[string][]string{
 	"get_expense_total_cancel": []string{
 		"Ok I'll stop asking",
 	},
+	"get_expense_total_new_recovery_codes": []string{
+		"New recovery codes {{var}}",
+	},
 	"get_expense_total_success": []string{
 		"You spent {{var}}",
 	},
@@ -139,11 +160,134 @@ var MessageMapMock = map[string][]string{
 	"get_expense_total_ask_for_password": []string{
 		"I need your password",
 	},
+	"get_category_total_success": []string{
+		"You spent {{var}}",
+	},
+	"get_category_total_breakdown": []string{
+		"Breakdown {{var}}",
+	},
+	"get_category_total_empty": []string{
+		"Nothing spent",
+	},
+	"get_category_total_invalid_category": []string{
+		"Which category?",
+	},
+	"get_expense_list_success": []string{
+		"Expenses {{var}}",
+	},
+	"get_expense_list_more": []string{
+		"More expenses {{var}}",
+	},
+	"get_expense_list_empty": []string{
+		"No expenses to list",
+	},
+	"manage_settings_show": []string{
+		"Settings {{var}}",
+	},
+	"manage_settings_ask_for_setting": []string{
+		"Which setting?",
+	},
+	"manage_settings_invalid_setting": []string{
+		"Invalid setting",
+	},
+	"manage_settings_ask_for_value": []string{
+		"New {{var}}?",
+	},
+	"manage_settings_invalid_value": []string{
+		"Invalid {{var}}",
+	},
+	"manage_settings_success": []string{
+		"Settings changed {{var}}",
+	},
+	"change_password_ask_for_old": []string{
+		"Current password?",
+	},
+	"change_password_invalid_old": []string{
+		"Wrong current password",
+	},
+	"change_password_ask_for_new": []string{
+		"New password?",
+	},
+	"change_password_confirm_new": []string{
+		"New password is {{var}}?",
+	},
+	"change_password_failed": []string{
+		"Password not changed",
+	},
+	"change_password_success": []string{
+		"Password changed",
+	},
+	"reset_password_ask_for_code": []string{
+		"Recovery code?",
+	},
+	"reset_password_invalid_code": []string{
+		"Invalid recovery code",
+	},
+	"reset_password_failed": []string{
+		"Password not reset",
+	},
+	"reset_password_success": []string{
+		"Password reset {{var}}",
+	},
+	"undo_expense_confirm": []string{
+		"Remove expense from {{var}}?",
+	},
+	"undo_expense_confirm_error": []string{
+		"Yes or no?",
+	},
+	"undo_expense_not_found": []string{
+		"No expenses",
+	},
+	"undo_expense_success": []string{
+		"Expense removed",
+	},
+	"undo_expense_error": []string{
+		"Expense not removed",
+	},
+	"delete_expense_choose": []string{
+		"Choose {{var}}",
+	},
+	"delete_expense_invalid_choice": []string{
+		"Invalid choice",
+	},
+	"edit_expense_ask_for_field": []string{
+		"Edit {{var}}?",
+	},
+	"edit_expense_invalid_field": []string{
+		"Invalid field",
+	},
+	"edit_expense_ask_for_value": []string{
+		"New {{var}}?",
+	},
+	"edit_expense_invalid_value": []string{
+		"Invalid {{var}}",
+	},
+	"edit_expense_success": []string{
+		"Expense changed",
+	},
 	"track_expense_error": []string{
 		"Whoops!",
 	},
 	"track_expense_success": []string{
-		"Roger that!",
+		"Roger that, {{var}}!",
+	},
+	"track_expense_batch_success": []string{
+		"Tracked {{var}}",
+	},
+	"track_expense_ask_for_description": []string{
+		"Description?",
+	},
+	"track_expense_ask_for_currency": []string{
+		"Currency for {{var}}?",
+	},
+	"track_expense_invalid_currency": []string{
+		"Invalid currency",
+	},
+	"track_expense_confirm": []string{
+		"Did you mean {{var}}?",
+	},
+	"track_expense_rejected": []string{
+		"Not tracked",
 	},
 	"onboard_user_ask_for_password": []string{
 		"What's your password?",
@@ -163,9 +307,21 @@ var MessageMapMock = map[string][]string{
 	"onboard_user_decryption_failed": []string{
 		"I'm having trouble with this password",
 	},
+	"onboard_user_show_recovery_codes": []string{
+		"Recovery codes {{var}}",
+	},
+	"onboard_user_recovery_codes_failed": []string{
+		"Recovery codes failed",
+	},
 	"onboard_user_ask_for_currency": []string{
 		"What currency do you want to use?",
 	},
+	"onboard_user_ask_for_timezone": []string{
+		"What timezone do you live in?",
+	},
+	"onboard_user_invalid_timezone": []string{
+		"Timezone is invalid",
+	},
 	"onboard_user_invalid_currency": []string{
 		"Currency is invalid",
 	},
@@ -1,7 +1,14 @@
 package mocks
 
 import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"log"
 	"strconv"
 	"sync"
@@ -22,6 +29,10 @@ import (
 var (
 	testEnv *TestEnv
 	once    sync.Once
+
+	keyPairOnce    sync.Once
+	testPublicKey  string
+	testPrivateKey string
 )
 
 // TestEnv is the working environmenet for test suites.
@@ -58,27 +69,70 @@ func CreateTestUser(db *gorm.DB, userID uint) {
 		telegramID = TestUserID
 	}
 	password, _ := bcrypt.GenerateFromPassword([]byte("my-password"), 10)
+	publicKey, privateKey := testKeyPair()
 	user := &user{
-		TelegramID: telegramID,
-		Password:   string(password),
+		TelegramID:         telegramID,
+		Password:           string(password),
+		PublicKey:          publicKey,
+		PrivateKey:         privateKey,
+		EncryptionUpgraded: true,
 	}
 	db.Create(user)
 }
 
+// testKeyPair returns a key pair protected with the password of test users.
+// Key pairs are slow to generate, so every test user shares the same one.
+func testKeyPair() (string, string) {
+	keyPairOnce.Do(func() {
+		var err error
+		testPublicKey, testPrivateKey, err = crypto.CreateProtectedKeyPair("my-password")
+		if err != nil {
+			log.Panicf("test environment: key pair generation failed - %s", err)
+		}
+	})
+
+	return testPublicKey, testPrivateKey
+}
+
+// EncryptLegacy encrypts text with a password the way crypto.Encrypt did before
+// it used AES-GCM, so tests may check legacy values are still readable.
+func EncryptLegacy(text string, password string) string {
+	key := sha256.Sum256([]byte(password))
+	block, _ := aes.NewCipher(key[:])
+
+	ciphertext := make([]byte, aes.BlockSize+len(text))
+	iv := ciphertext[:aes.BlockSize]
+	io.ReadFull(rand.Reader, iv)
+
+	stream := cipher.NewCFBEncrypter(block, iv)
+	stream.XORKeyStream(ciphertext[aes.BlockSize:], []byte(text))
+	return base64.StdEncoding.EncodeToString(ciphertext)
+}
+
 // CleanUpEnv cleans common DB and cached objects. Intended to be run after any test
 // suite with a DB dependency.
 func CleanUpEnv(testEnv *TestEnv) {
 	defaultUserCache := fmt.Sprintf("%s_conversation", strconv.Itoa(int(TestUserID)))
 	defaultPassCache := fmt.Sprintf("%s_password", strconv.Itoa(int(TestUserID)))
-	defaultCurrencyCache := "SGD_USD"
-	testEnv.Cache.Delete(defaultUserCache)
-	testEnv.Cache.Delete(defaultPassCache)
-	testEnv.Cache.Delete(defaultCurrencyCache)
+	defaultUpdateCache := "123_update"
+	ctx := context.Background()
+	testEnv.Cache.Delete(ctx, defaultUserCache)
+	testEnv.Cache.Delete(ctx, defaultPassCache)
+	testEnv.Cache.Delete(ctx, defaultUpdateCache)
+
+	// Rates are cached by day, so we clear the rates tests are likely to use
+	now := time.Now().UTC()
+	for _, date := range []time.Time{now, now.AddDate(0, 0, -1)} {
+		testEnv.Cache.Delete(ctx, fmt.Sprintf("SGD_USD_%s", date.Format("2006-01-02")))
+	}
 
 	tx := testEnv.Db.Begin()
+	tx.Exec("DELETE FROM keywords;")
 	tx.Exec("DELETE FROM expenses;")
+	tx.Exec("DELETE FROM recovery_codes;")
 	tx.Exec("DELETE FROM users;")
 	tx.Exec("DELETE FROM settings;")
+	tx.Exec("DELETE FROM rates;")
 	tx.Commit()
 }
 
@@ -86,19 +140,32 @@ func CleanUpEnv(testEnv *TestEnv) {
 // imports when creating the test environment.
 type user struct {
 	gorm.Model
-	Password   string `gorm:"type:varchar(2000);not null"`
-	TelegramID uint   `gorm:"unique_index"`
-	PublicKey  string `gorm:"type:varchar(2500);not null"`
-	PrivateKey string `gorm:"type:varchar(2500);not null"`
+	Password           string `gorm:"type:varchar(2000);not null"`
+	TelegramID         uint   `gorm:"unique_index"`
+	PublicKey          string `gorm:"type:varchar(2500);not null"`
+	PrivateKey         string `gorm:"type:text;not null"`
+	EncryptionUpgraded bool   `gorm:"not null;default:false"`
 }
 
 // Duplicate of the users pkg model. We define this here to prevent circular
 // imports when creating the test environment.
 type setting struct {
 	gorm.Model
-	Currency string `gorm:"type:varchar(30)"`
-	User     user
-	UserID   uint `gorm:"unique_index"`
+	Currency  string `gorm:"type:varchar(30)"`
+	Timezone  string `gorm:"type:varchar(64)"`
+	WeekStart int    `gorm:"not null;default:0"`
+	User      user
+	UserID    uint `gorm:"unique_index"`
+}
+
+// Duplicate of the users pkg model. We define this here to prevent circular
+// imports when creating the test environment.
+type recoveryCode struct {
+	gorm.Model
+	Code       string `gorm:"type:varchar(2000);not null"`
+	PrivateKey string `gorm:"type:text;not null"`
+	User       user
+	UserID     uint `gorm:"index;not null"`
 }
 
 // Duplicate of the expense pkg model. We define this here to prevent circular
@@ -109,12 +176,38 @@ type expense struct {
 	Description string    `gorm:"not null"`       // Description of the expense
 	Total       string    `gorm:"not null"`       // Total amount paid for the expense
 	Historical  string    // Historical USD value of the total
-	Currency    string    `gorm:"not null"`         // Currency ISO of the total
-	Category    string    `gorm:"type:varchar(30)"` // Category of the expense
+	Currency    string    `gorm:"not null"` // Currency ISO of the total
+	Category    string    // Category of the expense
+	DataKey     string    `gorm:"type:varchar(1000)"`
+	Source      string    `gorm:"type:varchar(64)"`
 	User        user
 	UserID      uint
 }
 
+// Duplicate of the expenses pkg source index.
+const expenseSourceIndex = "CREATE UNIQUE INDEX IF NOT EXISTS idx_expense_user_source " +
+	"ON expenses (user_id, source) WHERE source <> ''"
+
+// Duplicate of the categories pkg model. We define this here to prevent circular
+// imports when creating the test environment.
+type keyword struct {
+	gorm.Model
+	Digest   string `gorm:"type:varchar(64);not null;unique_index:idx_keyword_user_digest"`
+	Category string `gorm:"not null"`
+	User     user
+	UserID   uint `gorm:"not null;unique_index:idx_keyword_user_digest"`
+}
+
+// Duplicate of the exchange pkg model. We define this here to prevent circular
+// imports when creating the test environment.
+type rate struct {
+	gorm.Model
+	FromCurrency string  `gorm:"type:varchar(3);not null;unique_index:idx_rate_currency_day"`
+	ToCurrency   string  `gorm:"type:varchar(3);not null;unique_index:idx_rate_currency_day"`
+	Day          string  `gorm:"type:varchar(10);not null;unique_index:idx_rate_currency_day"`
+	Value        float64 `gorm:"not null"`
+}
+
 // getSessions returns sessions cache for test environment.
 func getSessions(cacheConfig config.AppConfig) *sessions.Client {
 	client, _ := sessions.NewClient(sessions.Config{
@@ -144,6 +237,12 @@ func getDb(dbConfig config.AppConfig) *gorm.DB {
 		log.Panicf("test environment: database connection failed - %s", err)
 	}
 
-	db.AutoMigrate(&user{}, &expense{}, &setting{})
+	db.AutoMigrate(&user{}, &expense{}, &setting{}, &keyword{}, &recoveryCode{}, &rate{})
+	for _, column := range []string{"category", "description", "total", "historical", "currency"} {
+		db.Model(&expense{}).ModifyColumn(column, "text")
+	}
+	db.Model(&user{}).ModifyColumn("private_key", "text")
+	db.Model(&recoveryCode{}).ModifyColumn("private_key", "text")
+	db.Exec(expenseSourceIndex)
 	return db
 }